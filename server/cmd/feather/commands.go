@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/feather-chat/feather/internal/config"
+	"github.com/feather-chat/feather/internal/file"
+)
+
+const storageUsage = "usage: feather storage migrate -from <s3|local> -to <s3|local>"
+
+// runCommand runs a command given after the flags, instead of the server.
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "storage":
+		return runStorage(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func runStorage(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "migrate" {
+		return errors.New(storageUsage)
+	}
+
+	fs := flag.NewFlagSet("storage migrate", flag.ContinueOnError)
+	from := fs.String("from", "", "Storage driver to copy files from")
+	to := fs.String("to", "", "Storage driver to copy files to")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" || *from == *to {
+		return errors.New(storageUsage)
+	}
+
+	ctx := context.Background()
+	src, err := openStorage(ctx, *from, cfg)
+	if err != nil {
+		return err
+	}
+	dst, err := openStorage(ctx, *to, cfg)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("copying files", "from", *from, "to", *to)
+	copied, skipped, err := file.CopyObjects(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	slog.Info("files copied; set storage.driver to use the new storage", "copied", copied, "skipped", skipped, "driver", *to)
+	return nil
+}
+
+func openStorage(ctx context.Context, driver string, cfg *config.Config) (file.Storage, error) {
+	s, err := file.NewStorage(ctx, driver, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("open %s storage: %w", driver, err)
+	}
+	if s == nil {
+		return nil, fmt.Errorf("%s storage is not configured", driver)
+	}
+	return s, nil
+}
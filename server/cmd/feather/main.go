@@ -11,9 +11,12 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/redis/go-redis/v9"
+
 	"github.com/feather-chat/feather/internal/config"
 	"github.com/feather-chat/feather/internal/database"
 	"github.com/feather-chat/feather/internal/file"
+	"github.com/feather-chat/feather/internal/mailer"
 	"github.com/feather-chat/feather/internal/server"
 )
 
@@ -35,6 +38,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Subcommands
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(cfg, args); err != nil {
+			slog.Error("command failed", "command", args[0], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Run migrations
 	migrationsPath := "migrations"
 	if _, err := os.Stat(migrationsPath); os.IsNotExist(err) {
@@ -76,35 +88,46 @@ func main() {
 	defer db.Close()
 	slog.Info("connected to PostgreSQL")
 
-	// Init Redis
-	redisClient, err := database.NewRedisClient(ctx, cfg.Redis.URL)
+	// Init Redis (optional: without it, WebSocket fan-out, presence and rate
+	// limits are local to this instance)
+	var redisClient *redis.Client
+	if cfg.Redis.URL != "" {
+		redisClient, err = database.NewRedisClient(ctx, cfg.Redis.URL)
+		if err != nil {
+			slog.Error("failed to connect to redis", "error", err)
+			os.Exit(1)
+		}
+		defer redisClient.Close()
+		slog.Info("connected to Redis")
+	} else {
+		slog.Warn("redis not configured; running in single-node mode")
+	}
+
+	// Init file storage
+	fileStorage, err := file.NewStorage(ctx, cfg.Storage.Driver, cfg)
+	if err != nil {
+		slog.Warn("failed to init file storage; files are disabled", "driver", cfg.Storage.Driver, "error", err)
+		fileStorage = nil
+	} else if fileStorage == nil {
+		slog.Warn("file storage not configured; files are disabled")
+	} else {
+		slog.Info("file storage ready", "driver", cfg.Storage.Driver)
+	}
+
+	// Init mailer
+	mail, err := mailer.New(cfg.Mail)
 	if err != nil {
-		slog.Error("failed to connect to redis", "error", err)
+		slog.Error("failed to init mailer", "error", err)
 		os.Exit(1)
 	}
-	defer redisClient.Close()
-	slog.Info("connected to Redis")
-
-	// Init MinIO file storage
-	var fileStorage *file.Storage
-	if cfg.MinIO.Endpoint != "" {
-		fileStorage, err = file.NewStorage(
-			cfg.MinIO.Endpoint, cfg.MinIO.AccessKey, cfg.MinIO.SecretKey,
-			cfg.MinIO.UseSSL, cfg.MinIO.Bucket,
-		)
-		if err != nil {
-			slog.Warn("failed to init file storage", "error", err)
-		} else {
-			if err := fileStorage.EnsureBucket(ctx); err != nil {
-				slog.Warn("failed to ensure bucket", "error", err)
-			} else {
-				slog.Info("connected to MinIO", "bucket", cfg.MinIO.Bucket)
-			}
-		}
+	if cfg.Mail.Driver == "smtp" {
+		slog.Info("mailer configured", "driver", cfg.Mail.Driver)
+	} else {
+		slog.Warn("mail driver is log; emails are not delivered, set mail.driver to smtp in production")
 	}
 
 	// Create and start server
-	srv := server.New(cfg, db, redisClient, fileStorage)
+	srv := server.New(cfg, db, redisClient, fileStorage, mail)
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
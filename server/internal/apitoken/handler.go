@@ -0,0 +1,200 @@
+package apitoken
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/middleware"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+type Handler struct {
+	service  *Service
+	validate *validator.Validate
+}
+
+func NewHandler(service *Service, validate *validator.Validate) *Handler {
+	return &Handler{service: service, validate: validate}
+}
+
+// Create creates a personal access token for the current user.
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeCreate(w, r)
+	if !ok {
+		return
+	}
+	userID := middleware.GetUserID(r.Context())
+	t, err := h.service.Create(r.Context(), req, userID, middleware.GetUserRole(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, t, http.StatusCreated)
+}
+
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.service.List(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, nonNil(tokens), http.StatusOK)
+}
+
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		writeError(w, "invalid token id", http.StatusBadRequest)
+		return
+	}
+	userID := middleware.GetUserID(r.Context())
+	if err := h.service.Revoke(r.Context(), tokenID, userID, userID); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Scopes lists the scopes a token can be granted.
+func (h *Handler) Scopes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, model.APITokenScopes, http.StatusOK)
+}
+
+func (h *Handler) CreateBot(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateBotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bot, err := h.service.CreateBot(r.Context(), req, middleware.GetUserID(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, bot, http.StatusCreated)
+}
+
+func (h *Handler) ListBots(w http.ResponseWriter, r *http.Request) {
+	bots, err := h.service.ListBots(r.Context())
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if bots == nil {
+		bots = []model.User{}
+	}
+	writeJSON(w, bots, http.StatusOK)
+}
+
+func (h *Handler) CreateBotToken(w http.ResponseWriter, r *http.Request) {
+	botID, ok := parseBotID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := h.decodeCreate(w, r)
+	if !ok {
+		return
+	}
+	t, err := h.service.CreateBotToken(r.Context(), botID, req, middleware.GetUserID(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, t, http.StatusCreated)
+}
+
+func (h *Handler) ListBotTokens(w http.ResponseWriter, r *http.Request) {
+	botID, ok := parseBotID(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := h.service.ListBotTokens(r.Context(), botID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, nonNil(tokens), http.StatusOK)
+}
+
+func (h *Handler) RevokeBotToken(w http.ResponseWriter, r *http.Request) {
+	botID, ok := parseBotID(w, r)
+	if !ok {
+		return
+	}
+	tokenID, err := uuid.Parse(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		writeError(w, "invalid token id", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.RevokeBotToken(r.Context(), botID, tokenID, middleware.GetUserID(r.Context())); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) decodeCreate(w http.ResponseWriter, r *http.Request) (model.CreateAPITokenRequest, bool) {
+	var req model.CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+func parseBotID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	botID, err := uuid.Parse(chi.URLParam(r, "botID"))
+	if err != nil {
+		writeError(w, "invalid bot id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return botID, true
+}
+
+func nonNil(tokens []model.APIToken) []model.APIToken {
+	if tokens == nil {
+		return []model.APIToken{}
+	}
+	return tokens
+}
+
+func handleServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrTokenNotFound):
+		writeError(w, "api token not found", http.StatusNotFound)
+	case errors.Is(err, ErrBotNotFound):
+		writeError(w, "bot not found", http.StatusNotFound)
+	case errors.Is(err, ErrInvalidScope):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrAdminScope):
+		writeError(w, err.Error(), http.StatusForbidden)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,168 @@
+package apitoken
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/feather-chat/feather/internal/model"
+)
+
+// tokenOwner is a token with the state of the user it acts as.
+type tokenOwner struct {
+	model.APIToken
+	UserName   string
+	UserRole   string
+	UserActive bool
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db: db}
+}
+
+const tokenColumns = `id, user_id, name, prefix, scopes, creator_id, expires_at, last_used_at, created_at`
+
+func scanToken(row pgx.Row, t *model.APIToken) error {
+	return row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.CreatorID, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+}
+
+func (r *Repository) Create(ctx context.Context, t *model.APIToken, tokenHash string) error {
+	query := `
+		INSERT INTO api_tokens (id, user_id, name, token_hash, prefix, scopes, creator_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.Exec(ctx, query, t.ID, t.UserID, t.Name, tokenHash, t.Prefix, t.Scopes, t.CreatorID, t.ExpiresAt, t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create api token: %w", err)
+	}
+	return nil
+}
+
+// GetByHash returns a token with its user, or nil.
+func (r *Repository) GetByHash(ctx context.Context, tokenHash string) (*tokenOwner, error) {
+	query := `
+		SELECT t.id, t.user_id, t.name, t.prefix, t.scopes, t.creator_id, t.expires_at, t.last_used_at, t.created_at,
+			u.name, u.role, u.is_active
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+	`
+	var t tokenOwner
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(
+		&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.CreatorID, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt,
+		&t.UserName, &t.UserRole, &t.UserActive,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api token: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *Repository) ListByUser(ctx context.Context, userID uuid.UUID) ([]model.APIToken, error) {
+	query := `SELECT ` + tokenColumns + ` FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []model.APIToken
+	for rows.Next() {
+		var t model.APIToken
+		if err := scanToken(rows, &t); err != nil {
+			return nil, fmt.Errorf("scan api token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Delete deletes one of the user's tokens and returns it, or nil if the user
+// has no such token.
+func (r *Repository) Delete(ctx context.Context, id, userID uuid.UUID) (*model.APIToken, error) {
+	query := `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2 RETURNING ` + tokenColumns
+	var t model.APIToken
+	err := scanToken(r.db.QueryRow(ctx, query, id, userID), &t)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("delete api token: %w", err)
+	}
+	return &t, nil
+}
+
+// Touch records that a token was used, at most once a minute.
+func (r *Repository) Touch(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	if _, err := r.db.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("touch api token: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) CreateBot(ctx context.Context, bot *model.User) error {
+	query := `
+		INSERT INTO users (id, email, name, role, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(ctx, query, bot.ID, bot.Email, bot.Name, bot.Role, bot.IsActive, bot.CreatedAt, bot.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create bot: %w", err)
+	}
+	return nil
+}
+
+// GetBot returns a bot account, or nil if the user is not a bot.
+func (r *Repository) GetBot(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	query := `
+		SELECT id, email, name, avatar_url, role, is_active, created_at, updated_at
+		FROM users WHERE id = $1 AND role = 'bot'
+	`
+	var u model.User
+	err := r.db.QueryRow(ctx, query, id).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.Role, &u.IsActive, &u.CreatedAt, &u.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get bot: %w", err)
+	}
+	return &u, nil
+}
+
+// ListBots lists bot accounts, including those of incoming webhooks.
+func (r *Repository) ListBots(ctx context.Context) ([]model.User, error) {
+	query := `
+		SELECT id, email, name, avatar_url, role, is_active, created_at, updated_at
+		FROM users WHERE role = 'bot'
+		ORDER BY name ASC, id ASC
+	`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list bots: %w", err)
+	}
+	defer rows.Close()
+
+	var bots []model.User
+	for rows.Next() {
+		var u model.User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.Role, &u.IsActive, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan bot: %w", err)
+		}
+		bots = append(bots, u)
+	}
+	return bots, rows.Err()
+}
@@ -0,0 +1,252 @@
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/audit"
+	"github.com/feather-chat/feather/internal/auth"
+	"github.com/feather-chat/feather/internal/middleware"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+var (
+	ErrTokenNotFound = errors.New("api token not found")
+	ErrBotNotFound   = errors.New("bot not found")
+	ErrInvalidScope  = errors.New("invalid scope")
+	ErrAdminScope    = errors.New("only admins can grant the admin scope")
+)
+
+// prefixLength is how much of a token is kept to recognise it in lists.
+const prefixLength = 12
+
+// ConnectionCloser closes the WebSocket connections opened with a revoked token.
+type ConnectionCloser interface {
+	DisconnectSession(userID, sessionID uuid.UUID)
+}
+
+// AuditLogger records administrative actions.
+type AuditLogger interface {
+	Log(ctx context.Context, entry audit.Entry)
+}
+
+type Service struct {
+	repo     *Repository
+	conns    ConnectionCloser
+	auditLog AuditLogger
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// SetConnectionCloser makes revocation also close the token's WebSocket
+// connections.
+func (s *Service) SetConnectionCloser(cc ConnectionCloser) {
+	s.conns = cc
+}
+
+// SetAuditLogger enables audit entries for token and bot changes.
+func (s *Service) SetAuditLogger(al AuditLogger) {
+	s.auditLog = al
+}
+
+// ValidateAPIToken resolves a token to its user and scopes. Tokens of
+// deactivated users stop working until the user is reactivated.
+func (s *Service) ValidateAPIToken(ctx context.Context, token string) (*middleware.APITokenIdentity, error) {
+	t, err := s.repo.GetByHash(ctx, auth.HashToken(token))
+	if err != nil || t == nil {
+		return nil, err
+	}
+	if !t.UserActive || (t.ExpiresAt != nil && !time.Now().Before(*t.ExpiresAt)) {
+		return nil, nil
+	}
+	if err := s.repo.Touch(ctx, t.ID); err != nil {
+		slog.Warn("failed to record api token use", "error", err)
+	}
+	return &middleware.APITokenIdentity{
+		TokenID:  t.ID,
+		UserID:   t.UserID,
+		UserName: t.UserName,
+		Role:     t.UserRole,
+		Scopes:   t.Scopes,
+	}, nil
+}
+
+// Create creates a token for the user. Only admins' tokens can have the admin
+// scope.
+func (s *Service) Create(ctx context.Context, req model.CreateAPITokenRequest, userID uuid.UUID, userRole string) (*model.APIToken, error) {
+	return s.create(ctx, req, userID, userRole, userID)
+}
+
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]model.APIToken, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// Revoke deletes one of the user's tokens and closes its connections.
+func (s *Service) Revoke(ctx context.Context, tokenID, userID, actorID uuid.UUID) error {
+	t, err := s.repo.Delete(ctx, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return ErrTokenNotFound
+	}
+	if s.conns != nil {
+		s.conns.DisconnectSession(t.UserID, t.ID)
+	}
+	s.audit(ctx, actorID, audit.ActionAPITokenRevoked, audit.EntityAPIToken, t.ID, map[string]interface{}{
+		"name":    t.Name,
+		"user_id": t.UserID,
+	})
+	return nil
+}
+
+// CreateBot creates a bot account for an integration to act as through its
+// tokens. Bots join channels like users do.
+func (s *Service) CreateBot(ctx context.Context, req model.CreateBotRequest, actorID uuid.UUID) (*model.User, error) {
+	now := time.Now()
+	bot := &model.User{
+		ID:        uuid.New(),
+		Name:      req.Name,
+		Role:      model.RoleBot,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	bot.Email = fmt.Sprintf("bot-%s@bots.feather.local", bot.ID)
+	if err := s.repo.CreateBot(ctx, bot); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, actorID, audit.ActionBotCreated, audit.EntityUser, bot.ID, map[string]interface{}{"name": bot.Name})
+	return bot, nil
+}
+
+func (s *Service) ListBots(ctx context.Context) ([]model.User, error) {
+	return s.repo.ListBots(ctx)
+}
+
+// CreateBotToken creates a token for a bot account on an admin's behalf.
+func (s *Service) CreateBotToken(ctx context.Context, botID uuid.UUID, req model.CreateAPITokenRequest, actorID uuid.UUID) (*model.APIToken, error) {
+	if err := s.checkBot(ctx, botID); err != nil {
+		return nil, err
+	}
+	return s.create(ctx, req, botID, string(model.RoleBot), actorID)
+}
+
+func (s *Service) ListBotTokens(ctx context.Context, botID uuid.UUID) ([]model.APIToken, error) {
+	if err := s.checkBot(ctx, botID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByUser(ctx, botID)
+}
+
+func (s *Service) RevokeBotToken(ctx context.Context, botID, tokenID, actorID uuid.UUID) error {
+	if err := s.checkBot(ctx, botID); err != nil {
+		return err
+	}
+	return s.Revoke(ctx, tokenID, botID, actorID)
+}
+
+func (s *Service) checkBot(ctx context.Context, botID uuid.UUID) error {
+	bot, err := s.repo.GetBot(ctx, botID)
+	if err != nil {
+		return err
+	}
+	if bot == nil {
+		return ErrBotNotFound
+	}
+	return nil
+}
+
+func (s *Service) create(ctx context.Context, req model.CreateAPITokenRequest, userID uuid.UUID, userRole string, actorID uuid.UUID) (*model.APIToken, error) {
+	scopes, err := validateScopes(req.Scopes, userRole)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &model.APIToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    token[:prefixLength],
+		Scopes:    scopes,
+		CreatorID: actorID,
+		CreatedAt: time.Now(),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := t.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+		t.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.Create(ctx, t, auth.HashToken(token)); err != nil {
+		return nil, err
+	}
+	t.Token = token
+
+	s.audit(ctx, actorID, audit.ActionAPITokenCreated, audit.EntityAPIToken, t.ID, map[string]interface{}{
+		"name":    t.Name,
+		"user_id": t.UserID,
+		"scopes":  t.Scopes,
+	})
+	return t, nil
+}
+
+// validateScopes checks requested scopes and drops duplicates.
+func validateScopes(requested []string, userRole string) ([]string, error) {
+	known := make(map[string]bool, len(model.APITokenScopes))
+	for _, scope := range model.APITokenScopes {
+		known[scope] = true
+	}
+
+	seen := make(map[string]bool, len(requested))
+	var scopes []string
+	for _, scope := range requested {
+		if !known[scope] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+		if scope == model.ScopeAdmin && userRole != string(model.RoleAdmin) {
+			return nil, ErrAdminScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func (s *Service) audit(ctx context.Context, actorID uuid.UUID, action, entityType string, entityID uuid.UUID, metadata map[string]interface{}) {
+	if s.auditLog == nil {
+		return
+	}
+	s.auditLog.Log(ctx, audit.Entry{
+		UserID:     actorID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Metadata:   metadata,
+	})
+}
+
+// generateToken returns a new token: the API token prefix and 32 random bytes
+// in hex.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return middleware.APITokenPrefix + hex.EncodeToString(b), nil
+}
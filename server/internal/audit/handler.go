@@ -0,0 +1,192 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// List returns a page of audit entries.
+// Query: user_id, action, entity_type, entity_id, from, to (RFC 3339), limit, cursor.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := parseFilter(q)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeError(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		f.Limit = limit
+	}
+
+	page, err := h.service.List(r.Context(), f, q.Get("cursor"))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, page, http.StatusOK)
+}
+
+// Export downloads every matching entry as ?format=csv (default) or json. It
+// takes the same filters as List.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := parseFilter(q)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		writeError(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	// Large exports can outlast the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// Entries are streamed, so errors after the first row can only be logged
+	if format == "json" {
+		err = exportJSON(w, r, h.service, f)
+	} else {
+		err = exportCSV(w, r, h.service, f)
+	}
+	if err != nil {
+		slog.Error("audit export failed", "error", err)
+	}
+}
+
+func exportCSV(w http.ResponseWriter, r *http.Request, s *Service, f Filter) error {
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "user_id", "user_email", "action", "entity_type", "entity_id", "ip_address", "metadata"})
+
+	err := s.Export(r.Context(), f, func(l AuditLog) error {
+		metadata, _ := json.Marshal(l.Metadata)
+		return cw.Write([]string{
+			l.ID.String(),
+			l.CreatedAt.UTC().Format(time.RFC3339),
+			idString(l.UserID),
+			l.UserEmail,
+			l.Action,
+			l.EntityType,
+			idString(l.EntityID),
+			l.IPAddress,
+			string(metadata),
+		})
+	})
+	cw.Flush()
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func exportJSON(w http.ResponseWriter, r *http.Request, s *Service, f Filter) error {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+
+	w.Write([]byte("["))
+	first := true
+	err := s.Export(r.Context(), f, func(l AuditLog) error {
+		if !first {
+			w.Write([]byte(","))
+		}
+		first = false
+		return enc.Encode(l)
+	})
+	w.Write([]byte("]\n"))
+	return err
+}
+
+func parseFilter(q url.Values) (Filter, error) {
+	var f Filter
+	if v := q.Get("user_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return f, errors.New("invalid user_id")
+		}
+		f.UserID = &id
+	}
+	if v := q.Get("entity_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return f, errors.New("invalid entity_id")
+		}
+		f.EntityID = &id
+	}
+	f.Action = q.Get("action")
+	f.EntityType = q.Get("entity_type")
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("from must be an RFC 3339 timestamp")
+		}
+		f.From = &t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("to must be an RFC 3339 timestamp")
+		}
+		f.To = &t
+	}
+	return f, nil
+}
+
+func idString(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func handleServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidCursor):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
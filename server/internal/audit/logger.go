@@ -6,6 +6,51 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/feather-chat/feather/internal/middleware"
+)
+
+// Audited actions.
+const (
+	ActionLogin               = "auth.login"
+	ActionLoginFailed         = "auth.login_failed"
+	ActionChannelCreated      = "channel.created"
+	ActionChannelDeleted      = "channel.deleted"
+	ActionChannelRoleChanged  = "channel.member_role_changed"
+	ActionMessageDeleted      = "message.deleted" // only recorded when someone else's message is deleted
+	ActionWebhookCreated      = "webhook.created"
+	ActionWebhookDeleted      = "webhook.deleted"
+	ActionInvitationCreated   = "invitation.created"
+	ActionInvitationRevoked   = "invitation.revoked"
+	ActionUserDeactivated     = "user.deactivated"
+	ActionUserReactivated     = "user.reactivated"
+	ActionUserRoleChanged     = "user.role_changed"
+	ActionUserSessionsRevoked = "user.sessions_revoked"
+	ActionUserPasswordReset   = "user.password_reset"
+	ActionPasswordRecovered   = "auth.password_reset"   // through an emailed link
+	ActionPasswordCleared     = "auth.password_cleared" // unverified account claimed by an external identity
+	ActionTwoFactorEnabled    = "auth.2fa_enabled"
+	ActionTwoFactorDisabled   = "auth.2fa_disabled"
+	ActionSettingsUpdated     = "workspace.settings_updated"
+	ActionUserProvisioned     = "user.provisioned" // created through SCIM
+	ActionSCIMTokenCreated    = "scim.token_created"
+	ActionSCIMTokenRevoked    = "scim.token_revoked"
+	ActionAPITokenCreated     = "api_token.created"
+	ActionAPITokenRevoked     = "api_token.revoked"
+	ActionBotCreated          = "bot.created"
+)
+
+// Entity types.
+const (
+	EntityUser            = "user"
+	EntityChannel         = "channel"
+	EntityMessage         = "message"
+	EntityWebhook         = "webhook"
+	EntityOutgoingWebhook = "outgoing_webhook"
+	EntityInvitation      = "invitation"
+	EntityWorkspace       = "workspace"
+	EntitySCIMToken       = "scim_token"
+	EntityAPIToken        = "api_token"
 )
 
 type Logger struct {
@@ -16,6 +61,8 @@ func NewLogger(db *pgxpool.Pool) *Logger {
 	return &Logger{db: db}
 }
 
+// Entry is an action to record. UserID is the actor and may be uuid.Nil (e.g. a
+// failed login). IPAddress defaults to the client IP in ctx.
 type Entry struct {
 	UserID     uuid.UUID
 	Action     string
@@ -25,15 +72,30 @@ type Entry struct {
 	IPAddress  string
 }
 
+// Log records the entry. Failures are logged and never fail the caller.
 func (l *Logger) Log(ctx context.Context, entry Entry) {
+	if entry.IPAddress == "" {
+		entry.IPAddress = middleware.GetClientIP(ctx)
+	}
+	if entry.Metadata == nil {
+		entry.Metadata = map[string]interface{}{}
+	}
+
 	query := `
 		INSERT INTO audit_logs (user_id, action, entity_type, entity_id, metadata, ip_address)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
 	`
 	_, err := l.db.Exec(ctx, query,
-		entry.UserID, entry.Action, entry.EntityType, entry.EntityID, entry.Metadata, entry.IPAddress,
+		nullableID(entry.UserID), entry.Action, entry.EntityType, nullableID(entry.EntityID), entry.Metadata, entry.IPAddress,
 	)
 	if err != nil {
 		slog.Error("failed to write audit log", "error", err, "action", entry.Action)
 	}
 }
+
+func nullableID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
@@ -3,15 +3,18 @@ package audit
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type AuditLog struct {
 	ID         uuid.UUID              `json:"id"`
 	UserID     *uuid.UUID             `json:"user_id"`
+	UserEmail  string                 `json:"user_email,omitempty"`
 	Action     string                 `json:"action"`
 	EntityType string                 `json:"entity_type"`
 	EntityID   *uuid.UUID             `json:"entity_id"`
@@ -20,6 +23,25 @@ type AuditLog struct {
 	CreatedAt  time.Time              `json:"created_at"`
 }
 
+// Filter narrows an audit log query. Zero values match everything. Results
+// are ordered newest first; After continues from a previous page.
+type Filter struct {
+	UserID     *uuid.UUID
+	Action     string
+	EntityType string
+	EntityID   *uuid.UUID
+	From       *time.Time
+	To         *time.Time
+	After      *pageKey
+	Limit      int
+}
+
+// pageKey is the position of the last entry on a page.
+type pageKey struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
 type Repository struct {
 	db *pgxpool.Pool
 }
@@ -28,30 +50,102 @@ func NewRepository(db *pgxpool.Pool) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) List(ctx context.Context, limit, offset int) ([]AuditLog, error) {
-	if limit <= 0 || limit > 100 {
-		limit = 50
+// List returns up to f.Limit entries matching the filter.
+func (r *Repository) List(ctx context.Context, f Filter) ([]AuditLog, error) {
+	var logs []AuditLog
+	err := r.Each(ctx, f, func(l AuditLog) error {
+		logs = append(logs, l)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return logs, nil
+}
 
-	query := `
-		SELECT id, user_id, action, entity_type, entity_id, metadata, ip_address, created_at
-		FROM audit_logs
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
-	`
-	rows, err := r.db.Query(ctx, query, limit, offset)
+// Each streams matching entries to fn without holding them in memory. A
+// zero f.Limit returns every match.
+func (r *Repository) Each(ctx context.Context, f Filter, fn func(AuditLog) error) error {
+	query, args := buildQuery(f)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("list audit logs: %w", err)
+		return fmt.Errorf("list audit logs: %w", err)
 	}
 	defer rows.Close()
 
-	var logs []AuditLog
 	for rows.Next() {
-		var l AuditLog
-		if err := rows.Scan(&l.ID, &l.UserID, &l.Action, &l.EntityType, &l.EntityID, &l.Metadata, &l.IPAddress, &l.CreatedAt); err != nil {
-			return nil, fmt.Errorf("scan audit log: %w", err)
+		l, err := scanLog(rows)
+		if err != nil {
+			return fmt.Errorf("scan audit log: %w", err)
+		}
+		if err := fn(*l); err != nil {
+			return err
 		}
-		logs = append(logs, l)
 	}
-	return logs, nil
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate audit logs: %w", err)
+	}
+	return nil
+}
+
+func buildQuery(f Filter) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.UserID != nil {
+		add("a.user_id = $%d", *f.UserID)
+	}
+	if f.Action != "" {
+		add("a.action = $%d", f.Action)
+	}
+	if f.EntityType != "" {
+		add("a.entity_type = $%d", f.EntityType)
+	}
+	if f.EntityID != nil {
+		add("a.entity_id = $%d", *f.EntityID)
+	}
+	if f.From != nil {
+		add("a.created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("a.created_at < $%d", *f.To)
+	}
+	if f.After != nil {
+		args = append(args, f.After.CreatedAt, f.After.ID)
+		conds = append(conds, fmt.Sprintf("(a.created_at, a.id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `
+		SELECT a.id, a.user_id, COALESCE(u.email, ''), a.action, a.entity_type, a.entity_id,
+			   COALESCE(a.metadata, '{}'), COALESCE(a.ip_address, ''), a.created_at
+		FROM audit_logs a
+		LEFT JOIN users u ON u.id = a.user_id
+	`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY a.created_at DESC, a.id DESC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return query, args
+}
+
+func scanLog(rows pgx.Rows) (*AuditLog, error) {
+	var l AuditLog
+	err := rows.Scan(
+		&l.ID, &l.UserID, &l.UserEmail, &l.Action, &l.EntityType, &l.EntityID,
+		&l.Metadata, &l.IPAddress, &l.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
 }
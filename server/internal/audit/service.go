@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Page is one page of audit entries. NextCursor is empty on the last page.
+type Page struct {
+	Entries    []AuditLog `json:"entries"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// List returns a page of entries matching the filter, starting after cursor.
+func (s *Service) List(ctx context.Context, f Filter, cursor string) (*Page, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultPageSize
+	}
+	if f.Limit > maxPageSize {
+		f.Limit = maxPageSize
+	}
+	if cursor != "" {
+		key, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		f.After = key
+	}
+
+	// Fetch one extra entry to learn whether another page exists
+	pageSize := f.Limit
+	f.Limit++
+	logs, err := s.repo.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Entries: logs}
+	if len(logs) > pageSize {
+		page.Entries = logs[:pageSize]
+		last := page.Entries[pageSize-1]
+		page.NextCursor = encodeCursor(pageKey{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	if page.Entries == nil {
+		page.Entries = []AuditLog{}
+	}
+	return page, nil
+}
+
+// Export streams every entry matching the filter, newest first.
+func (s *Service) Export(ctx context.Context, f Filter, fn func(AuditLog) error) error {
+	f.Limit = 0
+	f.After = nil
+	return s.repo.Each(ctx, f, fn)
+}
+
+func encodeCursor(k pageKey) string {
+	raw := k.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + k.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*pageKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	entryID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &pageKey{CreatedAt: createdAt, ID: entryID}, nil
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	attemptKeyPrefix = "feather:auth:2fa_failures:"
+
+	// maxTwoFactorFailures is how many wrong codes a challenge, or a user across
+	// all their challenges and settings changes, may submit per attempt window.
+	maxTwoFactorFailures = 5
+	twoFactorAttemptTTL  = 15 * time.Minute
+)
+
+// AttemptCounter counts failed 2FA codes so they cannot be guessed. A TOTP code
+// has a million values, so without a limit a stolen password plus a few
+// minutes of requests is enough. Counts are shared through Redis when
+// available, otherwise kept in memory on each instance.
+type AttemptCounter struct {
+	redis *redis.Client
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	local map[string]*attemptCount
+}
+
+type attemptCount struct {
+	failures  int
+	expiresAt time.Time
+}
+
+func NewAttemptCounter(redisClient *redis.Client) *AttemptCounter {
+	return &AttemptCounter{
+		redis: redisClient,
+		ttl:   twoFactorAttemptTTL,
+		local: make(map[string]*attemptCount),
+	}
+}
+
+// Failures returns the failures recorded for key in the current window.
+func (c *AttemptCounter) Failures(ctx context.Context, key string) (int, error) {
+	if c.redis != nil {
+		n, err := c.redis.Get(ctx, attemptKeyPrefix+key).Int()
+		if err == redis.Nil {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("get 2fa failures: %w", err)
+		}
+		return n, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if a, ok := c.local[key]; ok && time.Now().Before(a.expiresAt) {
+		return a.failures, nil
+	}
+	return 0, nil
+}
+
+// Fail records a failure for key and returns the failures in the window. The
+// window starts at the first failure.
+func (c *AttemptCounter) Fail(ctx context.Context, key string) (int, error) {
+	if c.redis != nil {
+		n, err := c.redis.Incr(ctx, attemptKeyPrefix+key).Result()
+		if err != nil {
+			return 0, fmt.Errorf("record 2fa failure: %w", err)
+		}
+		if n == 1 {
+			if err := c.redis.Expire(ctx, attemptKeyPrefix+key, c.ttl).Err(); err != nil {
+				return 0, fmt.Errorf("record 2fa failure: %w", err)
+			}
+		}
+		return int(n), nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, a := range c.local {
+		if !now.Before(a.expiresAt) {
+			delete(c.local, k)
+		}
+	}
+	a, ok := c.local[key]
+	if !ok {
+		a = &attemptCount{expiresAt: now.Add(c.ttl)}
+		c.local[key] = a
+	}
+	a.failures++
+	return a.failures, nil
+}
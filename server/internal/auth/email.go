@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/feather-chat/feather/internal/audit"
+	"github.com/feather-chat/feather/internal/mailer"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+// Purposes of tokens sent by email, and how long their links work.
+const (
+	emailTokenPasswordReset = "password_reset"
+	emailTokenVerification  = "email_verification"
+
+	passwordResetTTL = time.Hour
+	verificationTTL  = 72 * time.Hour
+)
+
+var (
+	ErrInvalidEmailToken    = errors.New("invalid or expired link")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+)
+
+// SetMailer enables password reset and email verification emails. Links point
+// at appURL.
+func (s *Service) SetMailer(m mailer.Mailer, appURL string) {
+	s.mail = m
+	s.appURL = appURL
+}
+
+// ForgotPassword emails a password reset link if an active account has the
+// address. It reports success either way so it can't be used to find accounts.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	if s.mail == nil {
+		return nil
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("find user: %w", err)
+	}
+	if user == nil || !user.IsActive || user.Role == model.RoleBot {
+		return nil
+	}
+
+	token, err := s.newEmailToken(ctx, user.ID, emailTokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	link := s.link("/reset-password", token)
+	return s.mail.Send(ctx, mailer.PasswordReset(user.Email, user.Name, link, passwordResetTTL))
+}
+
+// ConfirmPasswordReset sets a new password with a reset token and signs the
+// user out everywhere. Receiving the link also proves the email address.
+func (s *Service) ConfirmPasswordReset(ctx context.Context, req model.ConfirmPasswordResetRequest) error {
+	userID, err := s.repo.ConsumeEmailToken(ctx, emailTokenPasswordReset, HashToken(req.Token))
+	if err != nil {
+		return err
+	}
+	if userID == uuid.Nil {
+		return ErrInvalidEmailToken
+	}
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	if user == nil || !user.IsActive {
+		return ErrInvalidEmailToken
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 12)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	if err := s.repo.UpdatePassword(ctx, userID, string(hash)); err != nil {
+		return err
+	}
+	if err := s.repo.MarkEmailVerified(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, audit.Entry{
+		UserID:     userID,
+		Action:     audit.ActionPasswordRecovered,
+		EntityType: audit.EntityUser,
+		EntityID:   userID,
+	})
+	return nil
+}
+
+// VerifyEmail marks the address of the token's user as verified.
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	userID, err := s.repo.ConsumeEmailToken(ctx, emailTokenVerification, HashToken(token))
+	if err != nil {
+		return err
+	}
+	if userID == uuid.Nil {
+		return ErrInvalidEmailToken
+	}
+	return s.repo.MarkEmailVerified(ctx, userID)
+}
+
+// ResendVerification emails a new verification link, invalidating earlier ones.
+func (s *Service) ResendVerification(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return s.sendVerification(ctx, user)
+}
+
+func (s *Service) sendVerification(ctx context.Context, user *model.User) error {
+	if s.mail == nil {
+		return nil
+	}
+	token, err := s.newEmailToken(ctx, user.ID, emailTokenVerification, verificationTTL)
+	if err != nil {
+		return err
+	}
+	link := s.link("/verify-email", token)
+	return s.mail.Send(ctx, mailer.EmailVerification(user.Email, user.Name, link, verificationTTL))
+}
+
+// newEmailToken stores the hash of a new random token and returns the token.
+func (s *Service) newEmailToken(ctx context.Context, userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate random bytes: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	if err := s.repo.StoreEmailToken(ctx, userID, purpose, HashToken(token), time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *Service) link(path, token string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// logMailError logs a failed email that shouldn't fail the request sending it.
+func logMailError(err error, userID uuid.UUID) {
+	if err != nil {
+		slog.Warn("failed to send email", "error", err, "user_id", userID)
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"google.golang.org/api/idtoken"
 
 	"github.com/feather-chat/feather/internal/middleware"
 	"github.com/feather-chat/feather/internal/model"
+	"github.com/feather-chat/feather/internal/oidc"
+	"github.com/feather-chat/feather/internal/saml"
 )
 
 type AutoJoiner interface {
@@ -29,6 +35,7 @@ type Handler struct {
 	autoJoiner         AutoJoiner
 	googleClientID     string
 	invitationAcceptor InvitationAcceptor
+	appURL             string
 }
 
 func NewHandler(service *Service, validate *validator.Validate, autoJoiner AutoJoiner, googleClientID string) *Handler {
@@ -39,6 +46,11 @@ func (h *Handler) SetInvitationAcceptor(ia InvitationAcceptor) {
 	h.invitationAcceptor = ia
 }
 
+// SetAppURL sets the web app URL that SAML logins return the browser to.
+func (h *Handler) SetAppURL(appURL string) {
+	h.appURL = appURL
+}
+
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req model.RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -52,7 +64,8 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp, err := h.service.Register(r.Context(), req)
-	if err != nil {
+	var challenge *TwoFactorChallengeError
+	if err != nil && !errors.As(err, &challenge) {
 		if errors.Is(err, ErrEmailTaken) {
 			writeError(w, "email already registered", http.StatusConflict)
 			return
@@ -61,20 +74,27 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The account exists even when 2FA setup is required before signing in
+	userID := signedInUserID(resp, challenge)
+
 	// If invite token provided, accept invitation (which auto-joins)
 	if req.InviteToken != nil && *req.InviteToken != "" && h.invitationAcceptor != nil {
-		if err := h.invitationAcceptor.Accept(r.Context(), *req.InviteToken, resp.User.ID); err != nil {
-			slog.Warn("failed to accept invitation", "error", err, "user_id", resp.User.ID)
+		if err := h.invitationAcceptor.Accept(r.Context(), *req.InviteToken, userID); err != nil {
+			slog.Warn("failed to accept invitation", "error", err, "user_id", userID)
 		}
 	}
 
 	// Auto-join default channel
 	if h.autoJoiner != nil {
-		if err := h.autoJoiner.AutoJoinUser(r.Context(), resp.User.ID); err != nil {
-			slog.Warn("failed to auto-join user to default channel", "error", err, "user_id", resp.User.ID)
+		if err := h.autoJoiner.AutoJoinUser(r.Context(), userID); err != nil {
+			slog.Warn("failed to auto-join user to default channel", "error", err, "user_id", userID)
 		}
 	}
 
+	if challenge != nil {
+		writeJSON(w, challenge.Challenge, http.StatusCreated)
+		return
+	}
 	writeJSON(w, resp, http.StatusCreated)
 }
 
@@ -92,6 +112,11 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := h.service.Login(r.Context(), req)
 	if err != nil {
+		var challenge *TwoFactorChallengeError
+		if errors.As(err, &challenge) {
+			writeJSON(w, challenge.Challenge, http.StatusOK)
+			return
+		}
 		if errors.Is(err, ErrInvalidCreds) || errors.Is(err, ErrUserDeactivated) {
 			writeError(w, "invalid email or password", http.StatusUnauthorized)
 			return
@@ -121,6 +146,10 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 			writeError(w, "invalid or expired refresh token", http.StatusUnauthorized)
 			return
 		}
+		if errors.Is(err, ErrTwoFactorEnforced) {
+			writeError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 		writeError(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -128,14 +157,59 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, resp, http.StatusOK)
 }
 
+// Logout ends the current session. The refresh token in the body is optional.
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 	var req model.RefreshRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
 		writeError(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.service.Logout(r.Context(), req.RefreshToken); err != nil {
+	ctx := r.Context()
+	if err := h.service.Logout(ctx, middleware.GetUserID(ctx), middleware.GetSessionID(ctx), req.RefreshToken); err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll signs the user out of every session, including this one.
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.RevokeAllSessions(r.Context(), middleware.GetUserID(r.Context())); err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessions, err := h.service.ListSessions(ctx, middleware.GetUserID(ctx), middleware.GetSessionID(ctx))
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if sessions == nil {
+		sessions = []model.Session{}
+	}
+
+	writeJSON(w, sessions, http.StatusOK)
+}
+
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		writeError(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RevokeSession(r.Context(), middleware.GetUserID(r.Context()), sessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			writeError(w, "session not found", http.StatusNotFound)
+			return
+		}
 		writeError(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -200,7 +274,8 @@ func (h *Handler) GoogleOAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp, err := h.service.GoogleLogin(r.Context(), googleID, email, name)
-	if err != nil {
+	var challenge *TwoFactorChallengeError
+	if err != nil && !errors.As(err, &challenge) {
 		if errors.Is(err, ErrUserDeactivated) {
 			writeError(w, "user account is deactivated", http.StatusForbidden)
 			return
@@ -211,15 +286,497 @@ func (h *Handler) GoogleOAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Auto-join for new users (google_id was just set, check if user was just created)
+	userID := signedInUserID(resp, challenge)
+	if h.autoJoiner != nil {
+		if err := h.autoJoiner.AutoJoinUser(r.Context(), userID); err != nil {
+			slog.Warn("failed to auto-join google user to default channel", "error", err, "user_id", userID)
+		}
+	}
+
+	if challenge != nil {
+		writeJSON(w, challenge.Challenge, http.StatusOK)
+		return
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
+
+// ForgotPassword emails a reset link. It responds the same whether or not the
+// address has an account.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ForgotPassword(r.Context(), req.Email); err != nil {
+		slog.Error("forgot password failed", "error", err)
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.ConfirmPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ConfirmPasswordReset(r.Context(), req); err != nil {
+		if errors.Is(err, ErrInvalidEmailToken) {
+			writeError(w, "invalid or expired reset link", http.StatusBadRequest)
+			return
+		}
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req model.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), req.Token); err != nil {
+		if errors.Is(err, ErrInvalidEmailToken) {
+			writeError(w, "invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.ResendVerification(r.Context(), middleware.GetUserID(r.Context())); err != nil {
+		switch {
+		case errors.Is(err, ErrEmailAlreadyVerified):
+			writeError(w, "email is already verified", http.StatusConflict)
+		case errors.Is(err, ErrUserNotFound):
+			writeError(w, "user not found", http.StatusNotFound)
+		default:
+			writeError(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// LoginTwoFactorSetup starts authenticator enrollment for a login challenged
+// because the workspace requires 2FA.
+func (h *Handler) LoginTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	var req model.TwoFactorSetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	enrollment, err := h.service.BeginChallengeSetup(r.Context(), req.ChallengeToken)
+	if err != nil {
+		handleTwoFactorError(w, err)
+		return
+	}
+
+	writeJSON(w, enrollment, http.StatusOK)
+}
+
+// LoginTwoFactor completes a challenged login with a TOTP or recovery code.
+func (h *Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req model.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.service.CompleteTwoFactorLogin(r.Context(), req)
+	if err != nil {
+		handleTwoFactorError(w, err)
+		return
+	}
+
+	writeJSON(w, resp, http.StatusOK)
+}
+
+func (h *Handler) TwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.service.TwoFactorStatus(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, status, http.StatusOK)
+}
+
+func (h *Handler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	enrollment, err := h.service.Enroll(r.Context(), middleware.GetUserID(r.Context()))
+	if err != nil {
+		handleTwoFactorError(w, err)
+		return
+	}
+
+	writeJSON(w, enrollment, http.StatusOK)
+}
+
+func (h *Handler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.ConfirmEnrollment(r.Context(), middleware.GetUserID(r.Context()), code)
+	if err != nil {
+		handleTwoFactorError(w, err)
+		return
+	}
+
+	writeJSON(w, model.RecoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DisableTwoFactor(r.Context(), middleware.GetUserID(r.Context()), code); err != nil {
+		handleTwoFactorError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), middleware.GetUserID(r.Context()), code)
+	if err != nil {
+		handleTwoFactorError(w, err)
+		return
+	}
+
+	writeJSON(w, model.RecoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+func (h *Handler) GetWorkspaceSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.service.GetWorkspaceSettings(r.Context())
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, settings, http.StatusOK)
+}
+
+func (h *Handler) UpdateWorkspaceSettings(w http.ResponseWriter, r *http.Request) {
+	var req model.UpdateWorkspaceSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.service.UpdateWorkspaceSettings(r.Context(), middleware.GetUserID(r.Context()), req)
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, settings, http.StatusOK)
+}
+
+func (h *Handler) decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req model.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return req.Code, true
+}
+
+// signedInUserID returns the user a login signed in, or challenged for 2FA.
+func signedInUserID(resp *model.AuthResponse, challenge *TwoFactorChallengeError) uuid.UUID {
+	if challenge != nil {
+		return challenge.UserID
+	}
+	return resp.User.ID
+}
+
+func handleTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidChallenge):
+		writeError(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, ErrInvalidTwoFactorCode):
+		writeError(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, ErrTooManyAttempts):
+		writeError(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, ErrTwoFactorEnabled):
+		writeError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrTwoFactorNotEnabled), errors.Is(err, ErrTwoFactorNotEnrolled):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrTwoFactorEnforced):
+		writeError(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrUserNotFound):
+		writeError(w, "user not found", http.StatusNotFound)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// oidcStateCookie holds the signed state of an OIDC login in progress.
+const oidcStateCookie = "feather_oidc_state"
+
+func (h *Handler) ListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	providers := h.service.OIDCProviders()
+	if providers == nil {
+		providers = []model.SSOProvider{}
+	}
+	writeJSON(w, providers, http.StatusOK)
+}
+
+// OIDCAuthorize starts a single sign-on login. The client navigates to the
+// returned URL; the provider then redirects to the app, which posts the code
+// and state to OIDCCallback.
+func (h *Handler) OIDCAuthorize(w http.ResponseWriter, r *http.Request) {
+	authURL, stateToken, err := h.service.BeginOIDCLogin(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownProvider) {
+			writeError(w, "unknown identity provider", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, oidc.ErrUnavailable) {
+			slog.Error("oidc authorize failed", "error", err)
+			writeError(w, "identity provider unavailable", http.StatusBadGateway)
+			return
+		}
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateToken,
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(w, model.SSOAuthorizeResponse{AuthorizationURL: authURL}, http.StatusOK)
+}
+
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	var req model.OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		writeError(w, "invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+	// The state is single use
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/v1/auth/oidc", MaxAge: -1})
+
+	resp, err := h.service.CompleteOIDCLogin(r.Context(), chi.URLParam(r, "provider"), req, cookie.Value)
+	var challenge *TwoFactorChallengeError
+	if err != nil && !errors.As(err, &challenge) {
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			writeError(w, "unknown identity provider", http.StatusNotFound)
+		case errors.Is(err, ErrInvalidOIDCState):
+			writeError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			slog.Warn("oidc id token rejected", "error", err)
+			writeError(w, "invalid identity token", http.StatusUnauthorized)
+		case errors.Is(err, oidc.ErrInvalidCode):
+			writeError(w, "invalid authorization code", http.StatusUnauthorized)
+		case errors.Is(err, oidc.ErrMissingEmail):
+			writeError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrSignupNotAllowed), errors.Is(err, ErrEmailNotVerified):
+			writeError(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrUserDeactivated):
+			writeError(w, "user account is deactivated", http.StatusForbidden)
+		case errors.Is(err, oidc.ErrUnavailable):
+			slog.Error("oidc login failed", "error", err)
+			writeError(w, "identity provider unavailable", http.StatusBadGateway)
+		default:
+			slog.Error("oidc login failed", "error", err)
+			writeError(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	userID := signedInUserID(resp, challenge)
 	if h.autoJoiner != nil {
-		if err := h.autoJoiner.AutoJoinUser(r.Context(), resp.User.ID); err != nil {
-			slog.Warn("failed to auto-join google user to default channel", "error", err, "user_id", resp.User.ID)
+		if err := h.autoJoiner.AutoJoinUser(r.Context(), userID); err != nil {
+			slog.Warn("failed to auto-join sso user to default channel", "error", err, "user_id", userID)
 		}
 	}
 
+	if challenge != nil {
+		writeJSON(w, challenge.Challenge, http.StatusOK)
+		return
+	}
 	writeJSON(w, resp, http.StatusOK)
 }
 
+func (h *Handler) ListSAMLProviders(w http.ResponseWriter, r *http.Request) {
+	providers := h.service.SAMLProviders()
+	if providers == nil {
+		providers = []model.SSOProvider{}
+	}
+	writeJSON(w, providers, http.StatusOK)
+}
+
+// SAMLMetadata serves the service provider metadata that identity provider
+// admins import.
+func (h *Handler) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.service.SAMLMetadata(chi.URLParam(r, "provider"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownProvider) {
+			writeError(w, "unknown identity provider", http.StatusNotFound)
+			return
+		}
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// SAMLAuthorize starts a SAML login. The client navigates to the returned URL;
+// the provider then posts its response to SAMLACS.
+func (h *Handler) SAMLAuthorize(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.service.BeginSAMLLogin(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownProvider) {
+			writeError(w, "unknown identity provider", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, saml.ErrUnavailable) {
+			slog.Error("saml authorize failed", "error", err)
+			writeError(w, "identity provider unavailable", http.StatusBadGateway)
+			return
+		}
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, model.SSOAuthorizeResponse{AuthorizationURL: authURL}, http.StatusOK)
+}
+
+// SAMLACS is the assertion consumer service. The provider's response arrives
+// as a browser form post, so the result goes back to the app in the fragment
+// of a redirect to {app_url}/login/saml/{provider}: a refresh token to redeem
+// at /auth/refresh, a 2FA challenge, or an error.
+func (h *Handler) SAMLACS(w http.ResponseWriter, r *http.Request) {
+	providerID := chi.URLParam(r, "provider")
+	fail := func(message string) {
+		h.redirectSAMLResult(w, r, providerID, url.Values{"error": {message}})
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := r.ParseForm(); err != nil {
+		fail("invalid request body")
+		return
+	}
+
+	resp, err := h.service.CompleteSAMLLogin(r.Context(), providerID, r.PostForm.Get("SAMLResponse"), r.PostForm.Get("RelayState"))
+	var challenge *TwoFactorChallengeError
+	if err != nil && !errors.As(err, &challenge) {
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			writeError(w, "unknown identity provider", http.StatusNotFound)
+		case errors.Is(err, ErrInvalidRelayState):
+			fail(err.Error())
+		case errors.Is(err, saml.ErrInvalidResponse):
+			slog.Warn("saml response rejected", "error", err, "provider", providerID)
+			fail("invalid saml response")
+		case errors.Is(err, saml.ErrMissingEmail), errors.Is(err, ErrSignupNotAllowed):
+			fail(err.Error())
+		case errors.Is(err, ErrUserDeactivated):
+			fail("user account is deactivated")
+		case errors.Is(err, saml.ErrUnavailable):
+			slog.Error("saml login failed", "error", err)
+			fail("identity provider unavailable")
+		default:
+			slog.Error("saml login failed", "error", err)
+			fail("internal server error")
+		}
+		return
+	}
+
+	userID := signedInUserID(resp, challenge)
+	if h.autoJoiner != nil {
+		if err := h.autoJoiner.AutoJoinUser(r.Context(), userID); err != nil {
+			slog.Warn("failed to auto-join sso user to default channel", "error", err, "user_id", userID)
+		}
+	}
+
+	if challenge != nil {
+		h.redirectSAMLResult(w, r, providerID, url.Values{
+			"challenge_token": {challenge.Challenge.ChallengeToken},
+			"setup_required":  {strconv.FormatBool(challenge.Challenge.SetupRequired)},
+		})
+		return
+	}
+	h.redirectSAMLResult(w, r, providerID, url.Values{"refresh_token": {resp.RefreshToken}})
+}
+
+func (h *Handler) redirectSAMLResult(w http.ResponseWriter, r *http.Request, providerID string, result url.Values) {
+	target := h.appURL + "/login/saml/" + url.PathEscape(providerID) + "#" + result.Encode()
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
 func writeJSON(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
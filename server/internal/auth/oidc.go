@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2"
+
+	"github.com/feather-chat/feather/internal/model"
+	"github.com/feather-chat/feather/internal/oidc"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+)
+
+// SetOIDCProviders enables single sign-on through the providers.
+func (s *Service) SetOIDCProviders(providers []*oidc.Provider) {
+	s.oidc = make(map[string]*oidc.Provider, len(providers))
+	s.oidcOrder = s.oidcOrder[:0]
+	for _, p := range providers {
+		s.oidc[p.ID()] = p
+		s.oidcOrder = append(s.oidcOrder, model.SSOProvider{ID: p.ID(), Name: p.Name()})
+	}
+}
+
+// OIDCProviders lists the configured providers in configuration order.
+func (s *Service) OIDCProviders() []model.SSOProvider {
+	return s.oidcOrder
+}
+
+// BeginOIDCLogin returns the provider's authorization URL and the state token
+// the callback must present, which the handler keeps in a cookie.
+func (s *Service) BeginOIDCLogin(ctx context.Context, providerID string) (string, string, error) {
+	p, ok := s.oidc[providerID]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+	stateToken, err := s.tokens.GenerateOIDCState(OIDCState{
+		Provider: providerID,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("generate oidc state: %w", err)
+	}
+	return authURL, stateToken, nil
+}
+
+// CompleteOIDCLogin redeems the authorization code the provider redirected
+// back with and signs the user in.
+func (s *Service) CompleteOIDCLogin(ctx context.Context, providerID string, req model.OIDCCallbackRequest, stateToken string) (*model.AuthResponse, error) {
+	p, ok := s.oidc[providerID]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	st, err := s.tokens.ValidateOIDCState(stateToken)
+	if err != nil || st.Provider != providerID || subtle.ConstantTimeCompare([]byte(st.State), []byte(req.State)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	id, err := p.Exchange(ctx, req.Code, st.Verifier, st.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ExternalLogin(ctx, ExternalIdentity{
+		Provider:      "oidc:" + providerID,
+		Subject:       id.Subject,
+		Email:         id.Email,
+		EmailVerified: id.EmailVerified,
+		Name:          id.Name,
+		Groups:        id.Groups,
+	}, ExternalLoginOptions{
+		AllowedDomains: p.AllowedDomains(),
+		GroupMapping:   p.GroupMapping(),
+	})
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const replayKeyPrefix = "feather:auth:consumed:"
+
+// ReplayCache remembers one-time credentials, such as SAML assertions, until
+// they expire, so a captured one cannot be posted again. Entries are shared
+// through Redis when available, otherwise kept in memory on each instance.
+type ReplayCache struct {
+	redis *redis.Client
+
+	mu    sync.Mutex
+	local map[string]time.Time // key → expires at
+}
+
+func NewReplayCache(redisClient *redis.Client) *ReplayCache {
+	return &ReplayCache{redis: redisClient, local: make(map[string]time.Time)}
+}
+
+// Consume records key as used until expiresAt. It returns false if the key was
+// already used.
+func (c *ReplayCache) Consume(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	ttl := time.Until(expiresAt)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	if c.redis != nil {
+		ok, err := c.redis.SetNX(ctx, replayKeyPrefix+key, 1, ttl).Result()
+		if err != nil {
+			return false, fmt.Errorf("record consumed key: %w", err)
+		}
+		return ok, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, exp := range c.local {
+		if !now.Before(exp) {
+			delete(c.local, k)
+		}
+	}
+	if _, used := c.local[key]; used {
+		return false, nil
+	}
+	c.local[key] = now.Add(ttl)
+	return true, nil
+}
@@ -22,12 +22,12 @@ func NewRepository(db *pgxpool.Pool) *Repository {
 
 func (r *Repository) CreateUser(ctx context.Context, user *model.User) error {
 	query := `
-		INSERT INTO users (id, email, name, password_hash, google_id, role, is_active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO users (id, email, name, password_hash, google_id, role, is_active, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $8 THEN $9::timestamptz END, $9, $10)
 	`
 	_, err := r.db.Exec(ctx, query,
 		user.ID, user.Email, user.Name, user.PasswordHash, user.GoogleID,
-		user.Role, user.IsActive, user.CreatedAt, user.UpdatedAt,
+		user.Role, user.IsActive, user.EmailVerified, user.CreatedAt, user.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("create user: %w", err)
@@ -37,13 +37,13 @@ func (r *Repository) CreateUser(ctx context.Context, user *model.User) error {
 
 func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	query := `
-		SELECT id, email, name, password_hash, google_id, avatar_url, role, is_active, created_at, updated_at
+		SELECT id, email, name, password_hash, google_id, avatar_url, role, is_active, email_verified_at IS NOT NULL, created_at, updated_at
 		FROM users WHERE email = $1
 	`
 	var user model.User
 	err := r.db.QueryRow(ctx, query, email).Scan(
 		&user.ID, &user.Email, &user.Name, &user.PasswordHash, &user.GoogleID,
-		&user.AvatarURL, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.AvatarURL, &user.Role, &user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -56,13 +56,13 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.U
 
 func (r *Repository) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	query := `
-		SELECT id, email, name, password_hash, google_id, avatar_url, role, is_active, created_at, updated_at
+		SELECT id, email, name, password_hash, google_id, avatar_url, role, is_active, email_verified_at IS NOT NULL, created_at, updated_at
 		FROM users WHERE id = $1
 	`
 	var user model.User
 	err := r.db.QueryRow(ctx, query, id).Scan(
 		&user.ID, &user.Email, &user.Name, &user.PasswordHash, &user.GoogleID,
-		&user.AvatarURL, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.AvatarURL, &user.Role, &user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -73,40 +73,111 @@ func (r *Repository) GetUserByID(ctx context.Context, id uuid.UUID) (*model.User
 	return &user, nil
 }
 
-func (r *Repository) GetUserByGoogleID(ctx context.Context, googleID string) (*model.User, error) {
+// GetUserByIdentity returns the user linked to the provider's subject.
+func (r *Repository) GetUserByIdentity(ctx context.Context, provider, subject string) (*model.User, error) {
 	query := `
-		SELECT id, email, name, password_hash, google_id, avatar_url, role, is_active, created_at, updated_at
-		FROM users WHERE google_id = $1
+		SELECT u.id, u.email, u.name, u.password_hash, u.google_id, u.avatar_url, u.role, u.is_active, u.email_verified_at IS NOT NULL, u.created_at, u.updated_at
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2
 	`
 	var user model.User
-	err := r.db.QueryRow(ctx, query, googleID).Scan(
+	err := r.db.QueryRow(ctx, query, provider, subject).Scan(
 		&user.ID, &user.Email, &user.Name, &user.PasswordHash, &user.GoogleID,
-		&user.AvatarURL, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.AvatarURL, &user.Role, &user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("get user by google id: %w", err)
+		return nil, fmt.Errorf("get user by identity: %w", err)
 	}
 	return &user, nil
 }
 
-func (r *Repository) LinkGoogleID(ctx context.Context, userID uuid.UUID, googleID string) error {
-	query := `UPDATE users SET google_id = $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.db.Exec(ctx, query, googleID, userID)
+// LinkIdentity links the provider's subject to the user, or records a new
+// login if it is linked already.
+func (r *Repository) LinkIdentity(ctx context.Context, userID uuid.UUID, provider, subject, email string) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, subject) DO UPDATE
+		SET email = EXCLUDED.email, last_login_at = NOW()
+	`
+	_, err := r.db.Exec(ctx, query, userID, provider, subject, email)
+	if err != nil {
+		return fmt.Errorf("link identity: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) MarkEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW() WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, userID)
 	if err != nil {
-		return fmt.Errorf("link google id: %w", err)
+		return fmt.Errorf("mark email verified: %w", err)
 	}
 	return nil
 }
 
-func (r *Repository) StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+// StoreEmailToken stores a token sent by email for purpose, replacing the
+// user's earlier unused tokens for the same purpose so only the latest link works.
+func (r *Repository) StoreEmailToken(ctx context.Context, userID uuid.UUID, purpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM email_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return fmt.Errorf("delete email tokens: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO email_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)`,
+		userID, purpose, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("store email token: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeEmailToken marks an unused, unexpired token as used and returns its
+// user, or uuid.Nil if there is no such token.
+func (r *Repository) ConsumeEmailToken(ctx context.Context, purpose, tokenHash string) (uuid.UUID, error) {
 	query := `
-		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
-		VALUES ($1, $2, $3)
+		UPDATE email_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
 	`
-	_, err := r.db.Exec(ctx, query, userID, tokenHash, expiresAt)
+	var userID uuid.UUID
+	err := r.db.QueryRow(ctx, query, tokenHash, purpose).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("consume email token: %w", err)
+	}
+	return userID, nil
+}
+
+func (r *Repository) StoreRefreshToken(ctx context.Context, userID, sessionID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := r.db.Exec(ctx, query, userID, sessionID, tokenHash, expiresAt)
 	if err != nil {
 		return fmt.Errorf("store refresh token: %w", err)
 	}
@@ -116,6 +187,7 @@ func (r *Repository) StoreRefreshToken(ctx context.Context, userID uuid.UUID, to
 type RefreshTokenRecord struct {
 	ID        uuid.UUID
 	UserID    uuid.UUID
+	SessionID *uuid.UUID
 	TokenHash string
 	ExpiresAt time.Time
 	RevokedAt *time.Time
@@ -123,12 +195,12 @@ type RefreshTokenRecord struct {
 
 func (r *Repository) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshTokenRecord, error) {
 	query := `
-		SELECT id, user_id, token_hash, expires_at, revoked_at
+		SELECT id, user_id, session_id, token_hash, expires_at, revoked_at
 		FROM refresh_tokens WHERE token_hash = $1
 	`
 	var rec RefreshTokenRecord
 	err := r.db.QueryRow(ctx, query, tokenHash).Scan(
-		&rec.ID, &rec.UserID, &rec.TokenHash, &rec.ExpiresAt, &rec.RevokedAt,
+		&rec.ID, &rec.UserID, &rec.SessionID, &rec.TokenHash, &rec.ExpiresAt, &rec.RevokedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -148,11 +220,277 @@ func (r *Repository) RevokeRefreshToken(ctx context.Context, tokenHash string) e
 	return nil
 }
 
-func (r *Repository) RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) error {
-	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
-	_, err := r.db.Exec(ctx, query, userID)
+// RevokeAllUserSessions revokes every session and refresh token of the user.
+func (r *Repository) RevokeAllUserSessions(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("revoke user sessions: %w", err)
+	}
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
 	if err != nil {
 		return fmt.Errorf("revoke all user tokens: %w", err)
 	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *Repository) CreateSession(ctx context.Context, sess *model.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+	`
+	_, err := r.db.Exec(ctx, query,
+		sess.ID, sess.UserID, sess.UserAgent, sess.IPAddress, sess.CreatedAt, sess.LastUsedAt, sess.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetSession(ctx context.Context, id uuid.UUID) (*model.Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, COALESCE(ip_address, ''), created_at, last_used_at, expires_at, revoked_at
+		FROM sessions WHERE id = $1
+	`
+	var sess model.Session
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&sess.ID, &sess.UserID, &sess.UserAgent, &sess.IPAddress,
+		&sess.CreatedAt, &sess.LastUsedAt, &sess.ExpiresAt, &sess.RevokedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	return &sess, nil
+}
+
+// TouchSession records a refresh: the session's last use, client IP and new expiry.
+func (r *Repository) TouchSession(ctx context.Context, id uuid.UUID, ipAddress string, expiresAt time.Time) error {
+	query := `
+		UPDATE sessions
+		SET last_used_at = NOW(), ip_address = COALESCE(NULLIF($2, ''), ip_address), expires_at = $3
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, ipAddress, expiresAt)
+	if err != nil {
+		return fmt.Errorf("touch session: %w", err)
+	}
+	return nil
+}
+
+// ListActiveSessions returns the user's unrevoked, unexpired sessions, most recently used first.
+func (r *Repository) ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]model.Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, COALESCE(ip_address, ''), created_at, last_used_at, expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []model.Session
+	for rows.Next() {
+		var sess model.Session
+		if err := rows.Scan(
+			&sess.ID, &sess.UserID, &sess.UserAgent, &sess.IPAddress,
+			&sess.CreatedAt, &sess.LastUsedAt, &sess.ExpiresAt, &sess.RevokedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		sessions = append(sessions, sess)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes the session and its refresh tokens.
+func (r *Repository) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE session_id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("revoke session tokens: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// TOTPRecord is a user's authenticator. EnabledAt is nil while enrollment is
+// pending confirmation.
+type TOTPRecord struct {
+	UserID    uuid.UUID
+	Secret    string
+	EnabledAt *time.Time
+	LastStep  int64
+}
+
+func (r *Repository) GetTOTP(ctx context.Context, userID uuid.UUID) (*TOTPRecord, error) {
+	query := `SELECT user_id, secret, enabled_at, last_step FROM user_totp WHERE user_id = $1`
+	var rec TOTPRecord
+	err := r.db.QueryRow(ctx, query, userID).Scan(&rec.UserID, &rec.Secret, &rec.EnabledAt, &rec.LastStep)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get totp: %w", err)
+	}
+	return &rec, nil
+}
+
+// SetPendingTOTP starts or restarts enrollment with a new secret. It never
+// replaces an enabled authenticator.
+func (r *Repository) SetPendingTOTP(ctx context.Context, userID uuid.UUID, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`
+	_, err := r.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("set pending totp: %w", err)
+	}
+	return nil
+}
+
+// EnableTOTP confirms a pending enrollment at the verified time step and
+// replaces the user's recovery codes.
+func (r *Repository) EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE user_totp SET enabled_at = NOW(), last_step = $2 WHERE user_id = $1`, userID, step)
+	if err != nil {
+		return fmt.Errorf("enable totp: %w", err)
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseTOTPStep records a successful code at the time step. It returns false if a
+// code from that step or a later one was already used, so codes can't be replayed.
+func (r *Repository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, `UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND last_step < $2`, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("use totp step: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteTOTP removes the user's authenticator and recovery codes.
+func (r *Repository) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete totp: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return fmt.Errorf("insert recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used. It returns false if
+// the code doesn't exist or was already used.
+func (r *Repository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	query := `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	tag, err := r.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("use recovery code: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *Repository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	var n int
+	err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count recovery codes: %w", err)
+	}
+	return n, nil
+}
+
+func (r *Repository) GetWorkspaceSettings(ctx context.Context) (*model.WorkspaceSettings, error) {
+	var settings model.WorkspaceSettings
+	err := r.db.QueryRow(ctx, `SELECT require_two_factor, updated_at FROM workspace_settings WHERE id`).Scan(
+		&settings.RequireTwoFactor, &settings.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get workspace settings: %w", err)
+	}
+	return &settings, nil
+}
+
+func (r *Repository) UpdateWorkspaceSettings(ctx context.Context, settings *model.WorkspaceSettings) error {
+	query := `UPDATE workspace_settings SET require_two_factor = $1, updated_at = NOW() WHERE id RETURNING updated_at`
+	err := r.db.QueryRow(ctx, query, settings.RequireTwoFactor).Scan(&settings.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update workspace settings: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	revocationKeyPrefix        = "feather:auth:revoked:"
+	sessionRevocationKeyPrefix = "feather:auth:revoked_session:"
+)
+
+// RevocationStore is the denylist checked on every access token. Access tokens
+// are stateless, so this is how they stop working before they expire. It holds
+// revoked session IDs and, per user, a cutoff before which every token is
+// rejected. Entries only need to outlive the access token TTL, after which
+// every token they cover has expired anyway.
+//
+// Entries are shared through Redis when available and always kept locally, so
+// an instance still enforces its own revocations while Redis is unreachable.
+type RevocationStore struct {
+	redis *redis.Client
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	local    map[uuid.UUID]time.Time // user ID → cutoff
+	sessions map[uuid.UUID]time.Time // session ID → revoked at
+}
+
+func NewRevocationStore(redisClient *redis.Client, accessTTL time.Duration) *RevocationStore {
+	return &RevocationStore{
+		redis:    redisClient,
+		ttl:      accessTTL,
+		local:    make(map[uuid.UUID]time.Time),
+		sessions: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// RevokeSession rejects every access token issued for the session.
+func (s *RevocationStore) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	s.mu.Lock()
+	s.sessions[sessionID] = time.Now()
+	s.sweep()
+	s.mu.Unlock()
+
+	if s.redis == nil {
+		return nil
+	}
+	err := s.redis.Set(ctx, sessionRevocationKeyPrefix+sessionID.String(), 1, s.ttl).Err()
+	if err != nil {
+		return fmt.Errorf("store session revocation: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserTokens rejects every access token issued to the user until now.
+func (s *RevocationStore) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	// Access token iat has millisecond precision
+	cutoff := time.Now().Truncate(time.Millisecond)
+
+	s.mu.Lock()
+	s.local[userID] = cutoff
+	s.sweep()
+	s.mu.Unlock()
+
+	if s.redis == nil {
+		return nil
+	}
+	err := s.redis.Set(ctx, revocationKeyPrefix+userID.String(), float64(cutoff.UnixMilli())/1000, s.ttl).Err()
+	if err != nil {
+		return fmt.Errorf("store token revocation: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether a token issued to the user at issuedAt for the
+// session has been revoked. sessionID is uuid.Nil for tokens without a session.
+// Tokens issued in the same millisecond as a user cutoff are rejected too.
+func (s *RevocationStore) IsRevoked(ctx context.Context, userID, sessionID uuid.UUID, issuedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	cutoff, ok := s.local[userID]
+	_, sessionRevoked := s.sessions[sessionID]
+	s.mu.Unlock()
+	if (ok && !issuedAt.After(cutoff)) || sessionRevoked {
+		return true, nil
+	}
+
+	if s.redis == nil {
+		return false, nil
+	}
+	vals, err := s.redis.MGet(ctx,
+		revocationKeyPrefix+userID.String(),
+		sessionRevocationKeyPrefix+sessionID.String(),
+	).Result()
+	if err != nil {
+		return false, fmt.Errorf("get token revocation: %w", err)
+	}
+	if vals[1] != nil {
+		return true, nil
+	}
+	val, ok := vals[0].(string)
+	if !ok {
+		return false, nil
+	}
+	unix, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return false, fmt.Errorf("parse token revocation: %w", err)
+	}
+	return !issuedAt.After(time.UnixMilli(int64(math.Round(unix * 1000)))), nil
+}
+
+// sweep drops local entries older than the access token TTL. Callers hold mu.
+func (s *RevocationStore) sweep() {
+	expired := time.Now().Add(-s.ttl)
+	for userID, cutoff := range s.local {
+		if cutoff.Before(expired) {
+			delete(s.local, userID)
+		}
+	}
+	for sessionID, revokedAt := range s.sessions {
+		if revokedAt.Before(expired) {
+			delete(s.sessions, sessionID)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/feather-chat/feather/internal/model"
+	"github.com/feather-chat/feather/internal/saml"
+)
+
+var ErrInvalidRelayState = errors.New("invalid or expired relay state")
+
+// SetSAMLProviders enables single sign-on through the SAML providers.
+func (s *Service) SetSAMLProviders(providers []*saml.Provider) {
+	s.saml = make(map[string]*saml.Provider, len(providers))
+	s.samlOrder = s.samlOrder[:0]
+	for _, p := range providers {
+		s.saml[p.ID()] = p
+		s.samlOrder = append(s.samlOrder, model.SSOProvider{ID: p.ID(), Name: p.Name()})
+	}
+}
+
+// SAMLProviders lists the configured SAML providers in configuration order.
+func (s *Service) SAMLProviders() []model.SSOProvider {
+	return s.samlOrder
+}
+
+// SAMLMetadata returns the service provider metadata for a provider.
+func (s *Service) SAMLMetadata(providerID string) ([]byte, error) {
+	p, ok := s.saml[providerID]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p.Metadata()
+}
+
+// BeginSAMLLogin returns the provider URL that starts a login. The request ID
+// travels in the signed relay state, so the response can be matched to it.
+func (s *Service) BeginSAMLLogin(ctx context.Context, providerID string) (string, error) {
+	p, ok := s.saml[providerID]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	req, err := p.NewAuthnRequest(ctx)
+	if err != nil {
+		return "", err
+	}
+	relayState, err := s.tokens.GenerateSAMLRelayState(providerID, req.ID)
+	if err != nil {
+		return "", fmt.Errorf("generate saml relay state: %w", err)
+	}
+	return req.RedirectURL(relayState)
+}
+
+// CompleteSAMLLogin validates a response posted to the assertion consumer
+// service and signs the user in. Responses without a relay state of ours are
+// provider-initiated, which the provider must allow.
+func (s *Service) CompleteSAMLLogin(ctx context.Context, providerID, samlResponse, relayState string) (*model.AuthResponse, error) {
+	p, ok := s.saml[providerID]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	var requestID string
+	if relayState != "" {
+		provider, rid, err := s.tokens.ValidateSAMLRelayState(relayState)
+		switch {
+		case err == nil && provider == providerID:
+			requestID = rid
+		case !p.AllowsIDPInitiated():
+			return nil, ErrInvalidRelayState
+		}
+	}
+
+	id, err := p.ParseResponse(ctx, samlResponse, requestID)
+	if err != nil {
+		return nil, err
+	}
+	// A captured response stays valid until it expires; accept it only once
+	fresh, err := s.replays.Consume(ctx, "saml:"+providerID+":"+id.AssertionID, id.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, fmt.Errorf("%w: assertion %s was already used", saml.ErrInvalidResponse, id.AssertionID)
+	}
+
+	// SAML has no email_verified; any provider can assert any address, so
+	// only those configured as authoritative for their emails are believed
+	return s.ExternalLogin(ctx, ExternalIdentity{
+		Provider:      "saml:" + providerID,
+		Subject:       id.Subject,
+		Email:         id.Email,
+		EmailVerified: p.TrustsEmail(),
+		Name:          id.Name,
+		Groups:        id.Groups,
+	}, ExternalLoginOptions{
+		AllowedDomains: p.AllowedDomains(),
+		GroupMapping:   p.GroupMapping(),
+	})
+}
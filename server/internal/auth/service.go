@@ -4,12 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/feather-chat/feather/internal/audit"
+	"github.com/feather-chat/feather/internal/mailer"
+	"github.com/feather-chat/feather/internal/middleware"
 	"github.com/feather-chat/feather/internal/model"
+	"github.com/feather-chat/feather/internal/oidc"
+	"github.com/feather-chat/feather/internal/saml"
 )
 
 var (
@@ -18,15 +25,80 @@ var (
 	ErrInvalidToken    = errors.New("invalid or expired refresh token")
 	ErrUserNotFound    = errors.New("user not found")
 	ErrUserDeactivated = errors.New("user account is deactivated")
+	ErrSessionNotFound = errors.New("session not found")
+
+	ErrSignupNotAllowed = errors.New("sign-up is not allowed for this email domain")
+	ErrEmailNotVerified = errors.New("email is not verified by the identity provider")
 )
 
+// ExternalIdentity is a user as asserted by an external identity provider.
+// Provider names the provider in user_identities and the audit log.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// ExternalLoginOptions are a provider's sign-in policies.
+type ExternalLoginOptions struct {
+	AllowedDomains []string          // email domains that may sign up; empty allows all
+	GroupMapping   map[string]string // provider group → Feather user group
+}
+
+// AuditLogger records security-relevant actions.
+type AuditLogger interface {
+	Log(ctx context.Context, entry audit.Entry)
+}
+
+// GroupSyncer sets a user's user group memberships by group name.
+type GroupSyncer interface {
+	SyncMemberships(ctx context.Context, userID uuid.UUID, memberships map[string]bool) error
+}
+
+// ConnectionCloser closes live WebSocket connections of revoked sessions.
+type ConnectionCloser interface {
+	DisconnectUser(userID uuid.UUID)
+	DisconnectSession(userID, sessionID uuid.UUID)
+}
+
 type Service struct {
-	repo   *Repository
-	tokens *TokenService
+	repo        *Repository
+	tokens      *TokenService
+	revocations *RevocationStore
+	attempts    *AttemptCounter
+	replays     *ReplayCache
+	conns       ConnectionCloser
+	groups      GroupSyncer
+	auditLog    AuditLogger
+	mail        mailer.Mailer
+	appURL      string
+	oidc        map[string]*oidc.Provider
+	oidcOrder   []model.SSOProvider
+	saml        map[string]*saml.Provider
+	samlOrder   []model.SSOProvider
+}
+
+func NewService(repo *Repository, tokens *TokenService, revocations *RevocationStore, attempts *AttemptCounter, replays *ReplayCache) *Service {
+	return &Service{repo: repo, tokens: tokens, revocations: revocations, attempts: attempts, replays: replays}
+}
+
+// SetConnectionCloser makes session revocation also close the session's
+// WebSocket connections.
+func (s *Service) SetConnectionCloser(cc ConnectionCloser) {
+	s.conns = cc
 }
 
-func NewService(repo *Repository, tokens *TokenService) *Service {
-	return &Service{repo: repo, tokens: tokens}
+// SetGroupSyncer enables mapping identity provider groups to user groups.
+func (s *Service) SetGroupSyncer(gs GroupSyncer) {
+	s.groups = gs
+}
+
+// SetAuditLogger enables audit entries for logins.
+func (s *Service) SetAuditLogger(al AuditLogger) {
+	s.auditLog = al
 }
 
 func (s *Service) Register(ctx context.Context, req model.RegisterRequest) (*model.AuthResponse, error) {
@@ -58,7 +130,11 @@ func (s *Service) Register(ctx context.Context, req model.RegisterRequest) (*mod
 	if err := s.repo.CreateUser(ctx, user); err != nil {
 		return nil, fmt.Errorf("create user: %w", err)
 	}
+	logMailError(s.sendVerification(ctx, user), user.ID)
 
+	if err := s.checkSecondFactor(ctx, user, "register"); err != nil {
+		return nil, err
+	}
 	return s.generateAuthResponse(ctx, user)
 }
 
@@ -68,69 +144,168 @@ func (s *Service) Login(ctx context.Context, req model.LoginRequest) (*model.Aut
 		return nil, fmt.Errorf("find user: %w", err)
 	}
 	if user == nil {
+		s.auditLoginFailed(ctx, uuid.Nil, req.Email, "unknown_email")
 		return nil, ErrInvalidCreds
 	}
 	if !user.IsActive {
+		s.auditLoginFailed(ctx, user.ID, req.Email, "deactivated")
 		return nil, ErrUserDeactivated
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		s.auditLoginFailed(ctx, user.ID, req.Email, "invalid_password")
 		return nil, ErrInvalidCreds
 	}
 
+	if err := s.checkSecondFactor(ctx, user, "password"); err != nil {
+		return nil, err
+	}
+	s.auditLogin(ctx, user.ID, "password")
 	return s.generateAuthResponse(ctx, user)
 }
 
 func (s *Service) GoogleLogin(ctx context.Context, googleID, email, name string) (*model.AuthResponse, error) {
-	// Branch 1: user found by google_id → login
-	user, err := s.repo.GetUserByGoogleID(ctx, googleID)
+	// The handler only accepts Google accounts with a verified email
+	return s.ExternalLogin(ctx, ExternalIdentity{
+		Provider:      "google",
+		Subject:       googleID,
+		Email:         email,
+		EmailVerified: true,
+		Name:          name,
+	}, ExternalLoginOptions{})
+}
+
+// ExternalLogin signs in a user asserted by an external identity provider. The
+// identity is looked up by provider subject first, then linked to an existing
+// account with the same verified email, and otherwise a new account is created.
+// Claiming an account whose email was never verified clears its password.
+func (s *Service) ExternalLogin(ctx context.Context, ext ExternalIdentity, opts ExternalLoginOptions) (*model.AuthResponse, error) {
+	user, err := s.repo.GetUserByIdentity(ctx, ext.Provider, ext.Subject)
 	if err != nil {
-		return nil, fmt.Errorf("find user by google id: %w", err)
+		return nil, err
 	}
-	if user != nil {
-		if !user.IsActive {
-			return nil, ErrUserDeactivated
+
+	if user == nil {
+		user, err = s.repo.GetUserByEmail(ctx, ext.Email)
+		if err != nil {
+			return nil, fmt.Errorf("find user by email: %w", err)
+		}
+		// Linking trusts the provider's word that the address is theirs
+		if user != nil && !ext.EmailVerified {
+			s.auditLoginFailed(ctx, user.ID, ext.Email, "unverified_email")
+			return nil, ErrEmailNotVerified
+		}
+		// Nobody proved owning the address of an unverified account, so a
+		// password set on it may be someone else's who signed up first
+		if user != nil && !user.EmailVerified && user.PasswordHash != "" {
+			if err := s.clearUnverifiedPassword(ctx, user, ext.Provider); err != nil {
+				return nil, err
+			}
 		}
-		return s.generateAuthResponse(ctx, user)
 	}
 
-	// Branch 2: user found by email (no google_id) → link Google account
-	user, err = s.repo.GetUserByEmail(ctx, email)
-	if err != nil {
-		return nil, fmt.Errorf("find user by email: %w", err)
-	}
-	if user != nil {
-		if !user.IsActive {
-			return nil, ErrUserDeactivated
+	if user == nil {
+		if !emailDomainAllowed(ext.Email, opts.AllowedDomains) {
+			s.auditLoginFailed(ctx, uuid.Nil, ext.Email, "signup_not_allowed")
+			return nil, ErrSignupNotAllowed
 		}
-		if err := s.repo.LinkGoogleID(ctx, user.ID, googleID); err != nil {
-			return nil, fmt.Errorf("link google id: %w", err)
+		now := time.Now()
+		user = &model.User{
+			ID:            uuid.New(),
+			Email:         ext.Email,
+			Name:          ext.Name,
+			Role:          model.RoleMember,
+			IsActive:      true,
+			EmailVerified: ext.EmailVerified,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := s.repo.CreateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("create %s user: %w", ext.Provider, err)
 		}
-		user.GoogleID = &googleID
-		return s.generateAuthResponse(ctx, user)
 	}
 
-	// Branch 3: no user → create new user with Google info
-	now := time.Now()
-	user = &model.User{
-		ID:           uuid.New(),
-		Email:        email,
-		Name:         name,
-		PasswordHash: "",
-		GoogleID:     &googleID,
-		Role:         model.RoleMember,
-		IsActive:     true,
-		CreatedAt:    now,
-		UpdatedAt:    now,
+	if !user.IsActive {
+		s.auditLoginFailed(ctx, user.ID, ext.Email, "deactivated")
+		return nil, ErrUserDeactivated
 	}
 
-	if err := s.repo.CreateUser(ctx, user); err != nil {
-		return nil, fmt.Errorf("create google user: %w", err)
+	if err := s.repo.LinkIdentity(ctx, user.ID, ext.Provider, ext.Subject, ext.Email); err != nil {
+		return nil, err
 	}
+	if ext.EmailVerified && !user.EmailVerified && user.Email == ext.Email {
+		if err := s.repo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+	}
+	s.syncGroups(ctx, user.ID, ext.Groups, opts.GroupMapping)
 
+	if err := s.checkSecondFactor(ctx, user, ext.Provider); err != nil {
+		return nil, err
+	}
+	s.auditLogin(ctx, user.ID, ext.Provider)
 	return s.generateAuthResponse(ctx, user)
 }
 
+// clearUnverifiedPassword removes the password of an unverified account that
+// an external identity is about to claim, and signs out its sessions.
+func (s *Service) clearUnverifiedPassword(ctx context.Context, user *model.User, provider string) error {
+	if err := s.repo.UpdatePassword(ctx, user.ID, ""); err != nil {
+		return err
+	}
+	user.PasswordHash = ""
+	if err := s.RevokeAllSessions(ctx, user.ID); err != nil {
+		return err
+	}
+	s.audit(ctx, audit.Entry{
+		EntityType: audit.EntityUser,
+		EntityID:   user.ID,
+		Action:     audit.ActionPasswordCleared,
+		Metadata:   map[string]interface{}{"email": user.Email, "method": provider},
+	})
+	return nil
+}
+
+// emailDomainAllowed reports whether email is in one of domains. With no
+// domains, every address is allowed.
+func emailDomainAllowed(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	for _, d := range domains {
+		if strings.EqualFold(d, email[at+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncGroups updates the user's membership of each mapped Feather group to
+// match the provider's groups. Provider group names match case-insensitively.
+func (s *Service) syncGroups(ctx context.Context, userID uuid.UUID, groups []string, mapping map[string]string) {
+	if s.groups == nil || len(mapping) == 0 {
+		return
+	}
+	has := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		has[strings.ToLower(g)] = true
+	}
+	memberships := make(map[string]bool, len(mapping))
+	for external, name := range mapping {
+		memberships[name] = memberships[name] || has[strings.ToLower(external)]
+	}
+	if err := s.groups.SyncMemberships(ctx, userID, memberships); err != nil {
+		slog.Warn("failed to sync user groups", "error", err, "user_id", userID)
+	}
+}
+
+// Refresh rotates the refresh token and issues a new access token for the same
+// session.
 func (s *Service) Refresh(ctx context.Context, rawToken string) (*model.AuthResponse, error) {
 	tokenHash := HashToken(rawToken)
 
@@ -142,6 +317,17 @@ func (s *Service) Refresh(ctx context.Context, rawToken string) (*model.AuthResp
 		return nil, ErrInvalidToken
 	}
 
+	var sess *model.Session
+	if rec.SessionID != nil {
+		sess, err = s.repo.GetSession(ctx, *rec.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if sess == nil || sess.RevokedAt != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+
 	// Revoke old token
 	if err := s.repo.RevokeRefreshToken(ctx, tokenHash); err != nil {
 		return nil, fmt.Errorf("revoke old token: %w", err)
@@ -155,12 +341,106 @@ func (s *Service) Refresh(ctx context.Context, rawToken string) (*model.AuthResp
 		return nil, ErrUserNotFound
 	}
 
-	return s.generateAuthResponse(ctx, user)
+	// Sessions started before the workspace required 2FA end here, so the
+	// user has to sign in and set up an authenticator
+	missing, err := s.missingRequiredSecondFactor(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if missing {
+		if sess != nil {
+			if err := s.revokeSession(ctx, user.ID, sess.ID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrTwoFactorEnforced
+	}
+
+	// Tokens issued before sessions existed start one now
+	if sess == nil {
+		return s.generateAuthResponse(ctx, user)
+	}
+	if err := s.repo.TouchSession(ctx, sess.ID, middleware.GetClientIP(ctx), time.Now().Add(s.tokens.refreshTTL)); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, user, sess.ID)
 }
 
-func (s *Service) Logout(ctx context.Context, rawToken string) error {
-	tokenHash := HashToken(rawToken)
-	return s.repo.RevokeRefreshToken(ctx, tokenHash)
+// Logout ends the session the access token belongs to. The refresh token, if
+// given, is revoked too; it is the only handle on tokens issued before
+// sessions existed.
+func (s *Service) Logout(ctx context.Context, userID, sessionID uuid.UUID, rawToken string) error {
+	if rawToken != "" {
+		if err := s.repo.RevokeRefreshToken(ctx, HashToken(rawToken)); err != nil {
+			return err
+		}
+	}
+	if sessionID == uuid.Nil {
+		return nil
+	}
+	return s.revokeSession(ctx, userID, sessionID)
+}
+
+// ListSessions returns the user's active sessions, marking the current one.
+func (s *Service) ListSessions(ctx context.Context, userID, currentID uuid.UUID) ([]model.Session, error) {
+	sessions, err := s.repo.ListActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's sessions out immediately.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	sess, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if sess == nil || sess.UserID != userID {
+		return ErrSessionNotFound
+	}
+	if sess.RevokedAt != nil {
+		return nil
+	}
+	return s.revokeSession(ctx, userID, sessionID)
+}
+
+// RevokeAccessTokens rejects the user's current access tokens. Their refresh
+// tokens stay valid, so clients pick up changes such as a new role on refresh.
+func (s *Service) RevokeAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	return s.revocations.RevokeUserTokens(ctx, userID)
+}
+
+// RevokeAllSessions signs the user out everywhere: every session and refresh
+// token is revoked, current access tokens are rejected and live connections
+// are closed.
+func (s *Service) RevokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	if err := s.repo.RevokeAllUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.revocations.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	if s.conns != nil {
+		s.conns.DisconnectUser(userID)
+	}
+	return nil
+}
+
+func (s *Service) revokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	if err := s.repo.RevokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+	if err := s.revocations.RevokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+	if s.conns != nil {
+		s.conns.DisconnectSession(userID, sessionID)
+	}
+	return nil
 }
 
 func (s *Service) GetUser(ctx context.Context, userID uuid.UUID) (*model.User, error) {
@@ -174,8 +454,27 @@ func (s *Service) GetUser(ctx context.Context, userID uuid.UUID) (*model.User, e
 	return user, nil
 }
 
+// generateAuthResponse starts a new session for the user and issues its tokens.
 func (s *Service) generateAuthResponse(ctx context.Context, user *model.User) (*model.AuthResponse, error) {
-	accessToken, err := s.tokens.GenerateAccessToken(user)
+	now := time.Now()
+	sess := &model.Session{
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		UserAgent:  middleware.GetUserAgent(ctx),
+		IPAddress:  middleware.GetClientIP(ctx),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.tokens.refreshTTL),
+	}
+	if err := s.repo.CreateSession(ctx, sess); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, user, sess.ID)
+}
+
+// issueTokens issues an access and refresh token for the session.
+func (s *Service) issueTokens(ctx context.Context, user *model.User, sessionID uuid.UUID) (*model.AuthResponse, error) {
+	accessToken, err := s.tokens.GenerateAccessToken(user, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("generate access token: %w", err)
 	}
@@ -185,7 +484,7 @@ func (s *Service) generateAuthResponse(ctx context.Context, user *model.User) (*
 		return nil, fmt.Errorf("generate refresh token: %w", err)
 	}
 
-	if err := s.repo.StoreRefreshToken(ctx, user.ID, refreshHash, expiresAt); err != nil {
+	if err := s.repo.StoreRefreshToken(ctx, user.ID, sessionID, refreshHash, expiresAt); err != nil {
 		return nil, fmt.Errorf("store refresh token: %w", err)
 	}
 
@@ -195,3 +494,36 @@ func (s *Service) generateAuthResponse(ctx context.Context, user *model.User) (*
 		RefreshToken: rawRefresh,
 	}, nil
 }
+
+func (s *Service) audit(ctx context.Context, entry audit.Entry) {
+	if s.auditLog != nil {
+		s.auditLog.Log(ctx, entry)
+	}
+}
+
+func (s *Service) auditLogin(ctx context.Context, userID uuid.UUID, method string) {
+	if s.auditLog == nil {
+		return
+	}
+	s.auditLog.Log(ctx, audit.Entry{
+		UserID:     userID,
+		Action:     audit.ActionLogin,
+		EntityType: audit.EntityUser,
+		EntityID:   userID,
+		Metadata:   map[string]interface{}{"method": method},
+	})
+}
+
+// auditLoginFailed records a rejected login. The attempt has no actor; the
+// targeted account is the entity when it exists.
+func (s *Service) auditLoginFailed(ctx context.Context, accountID uuid.UUID, email, reason string) {
+	if s.auditLog == nil {
+		return
+	}
+	s.auditLog.Log(ctx, audit.Entry{
+		Action:     audit.ActionLoginFailed,
+		EntityType: audit.EntityUser,
+		EntityID:   accountID,
+		Metadata:   map[string]interface{}{"email": email, "reason": reason},
+	})
+}
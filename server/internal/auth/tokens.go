@@ -13,6 +13,28 @@ import (
 	"github.com/feather-chat/feather/internal/model"
 )
 
+// Token types, in the typ claim. Only access tokens authenticate API requests;
+// access tokens issued before typ existed have none.
+const (
+	TokenTypeAccess    = "access"
+	TokenTypeChallenge = "2fa_challenge"
+	TokenTypeOIDCState = "oidc_state"
+	TokenTypeSAMLRelay = "saml_relay"
+)
+
+// Purposes of a 2FA challenge: verify an enrolled authenticator, or set one up
+// first because the workspace requires 2FA.
+const (
+	ChallengeVerify = "verify"
+	ChallengeSetup  = "setup"
+)
+
+const (
+	challengeTTL = 5 * time.Minute
+	oidcStateTTL = 10 * time.Minute
+	samlRelayTTL = 10 * time.Minute
+)
+
 type TokenService struct {
 	secret     string
 	accessTTL  time.Duration
@@ -27,12 +49,20 @@ func NewTokenService(secret string, accessTTL, refreshTTL time.Duration) *TokenS
 	}
 }
 
-func (ts *TokenService) GenerateAccessToken(user *model.User) (string, error) {
+// GenerateAccessToken issues an access token for the session. Every token gets
+// its own jti; sid ties it to the session so revoking the session rejects it.
+// iat has millisecond precision, so a token issued right after the user's
+// tokens are revoked is not mistaken for one issued before.
+func (ts *TokenService) GenerateAccessToken(user *model.User, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"sub":  user.ID.String(),
+		"typ":  TokenTypeAccess,
 		"role": string(user.Role),
-		"exp":  time.Now().Add(ts.accessTTL).Unix(),
-		"iat":  time.Now().Unix(),
+		"sid":  sessionID.String(),
+		"jti":  uuid.New().String(),
+		"exp":  now.Add(ts.accessTTL).Unix(),
+		"iat":  float64(now.UnixMilli()) / 1000,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -66,6 +96,9 @@ func (ts *TokenService) ValidateAccessToken(tokenString string) (uuid.UUID, stri
 	if !ok {
 		return uuid.Nil, "", fmt.Errorf("invalid claims")
 	}
+	if typ, ok := claims["typ"]; ok && typ != TokenTypeAccess {
+		return uuid.Nil, "", fmt.Errorf("invalid token type")
+	}
 
 	sub, ok := claims["sub"].(string)
 	if !ok || sub == "" {
@@ -81,6 +114,118 @@ func (ts *TokenService) ValidateAccessToken(tokenString string) (uuid.UUID, stri
 	return userID, role, nil
 }
 
+// GenerateChallengeToken issues the short-lived token that stands in for a
+// password login until the second factor is verified. method is the first
+// factor, kept for the audit log.
+func (ts *TokenService) GenerateChallengeToken(userID uuid.UUID, purpose, method string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(challengeTTL)
+	token, err := ts.sign(TokenTypeChallenge, expiresAt, jwt.MapClaims{
+		"sub":     userID.String(),
+		"purpose": purpose,
+		"amr":     method,
+	})
+	return token, expiresAt, err
+}
+
+// ValidateChallengeToken returns the user, purpose and first-factor method of
+// a challenge token.
+func (ts *TokenService) ValidateChallengeToken(tokenString string) (uuid.UUID, string, string, error) {
+	claims, err := ts.parse(tokenString, TokenTypeChallenge)
+	if err != nil {
+		return uuid.Nil, "", "", err
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return uuid.Nil, "", "", fmt.Errorf("invalid user id: %w", err)
+	}
+
+	purpose, _ := claims["purpose"].(string)
+	method, _ := claims["amr"].(string)
+	return userID, purpose, method, nil
+}
+
+// OIDCState is what an OIDC login needs to remember between redirecting to the
+// provider and the callback. It is kept in a cookie so the callback only
+// succeeds in the browser that started the login.
+type OIDCState struct {
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func (ts *TokenService) GenerateOIDCState(st OIDCState) (string, error) {
+	return ts.sign(TokenTypeOIDCState, time.Now().Add(oidcStateTTL), jwt.MapClaims{
+		"provider": st.Provider,
+		"state":    st.State,
+		"nonce":    st.Nonce,
+		"verifier": st.Verifier,
+	})
+}
+
+func (ts *TokenService) ValidateOIDCState(tokenString string) (*OIDCState, error) {
+	claims, err := ts.parse(tokenString, TokenTypeOIDCState)
+	if err != nil {
+		return nil, err
+	}
+	st := &OIDCState{}
+	st.Provider, _ = claims["provider"].(string)
+	st.State, _ = claims["state"].(string)
+	st.Nonce, _ = claims["nonce"].(string)
+	st.Verifier, _ = claims["verifier"].(string)
+	return st, nil
+}
+
+// GenerateSAMLRelayState signs the ID of an authentication request sent to a
+// SAML provider. It goes out as the RelayState, which the provider posts back
+// with its response.
+func (ts *TokenService) GenerateSAMLRelayState(provider, requestID string) (string, error) {
+	return ts.sign(TokenTypeSAMLRelay, time.Now().Add(samlRelayTTL), jwt.MapClaims{
+		"provider": provider,
+		"rid":      requestID,
+	})
+}
+
+// ValidateSAMLRelayState returns the provider and request ID of a relay state.
+func (ts *TokenService) ValidateSAMLRelayState(tokenString string) (string, string, error) {
+	claims, err := ts.parse(tokenString, TokenTypeSAMLRelay)
+	if err != nil {
+		return "", "", err
+	}
+	provider, _ := claims["provider"].(string)
+	requestID, _ := claims["rid"].(string)
+	return provider, requestID, nil
+}
+
+// sign issues a token of type typ with the given claims.
+func (ts *TokenService) sign(typ string, expiresAt time.Time, claims jwt.MapClaims) (string, error) {
+	claims["typ"] = typ
+	claims["exp"] = expiresAt.Unix()
+	claims["iat"] = time.Now().Unix()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ts.secret))
+}
+
+// parse validates a token of type typ and returns its claims.
+func (ts *TokenService) parse(tokenString, typ string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(ts.secret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != typ {
+		return nil, fmt.Errorf("invalid claims")
+	}
+	return claims, nil
+}
+
 func HashToken(token string) string {
 	h := sha256.Sum256([]byte(token))
 	return hex.EncodeToString(h[:])
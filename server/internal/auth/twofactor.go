@@ -0,0 +1,402 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/audit"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+var (
+	ErrTwoFactorRequired    = errors.New("two-factor authentication required")
+	ErrInvalidChallenge     = errors.New("invalid or expired challenge token")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor enrollment has not been started")
+	ErrTwoFactorEnforced    = errors.New("two-factor authentication is required for this workspace")
+	ErrTooManyAttempts      = errors.New("too many invalid two-factor codes, try again later")
+)
+
+// TwoFactorChallengeError is returned by logins that need a second factor
+// before tokens are issued. The user's credentials were valid.
+type TwoFactorChallengeError struct {
+	UserID    uuid.UUID
+	Challenge model.TwoFactorChallenge
+}
+
+func (e *TwoFactorChallengeError) Error() string { return ErrTwoFactorRequired.Error() }
+func (e *TwoFactorChallengeError) Unwrap() error { return ErrTwoFactorRequired }
+
+// checkSecondFactor returns a *TwoFactorChallengeError if the user must pass a
+// second factor before signing in with method: they have an authenticator, or
+// the workspace requires one and they must set it up.
+func (s *Service) checkSecondFactor(ctx context.Context, user *model.User, method string) error {
+	rec, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	purpose := ChallengeVerify
+	if rec == nil || rec.EnabledAt == nil {
+		settings, err := s.repo.GetWorkspaceSettings(ctx)
+		if err != nil {
+			return err
+		}
+		if !settings.RequireTwoFactor {
+			return nil
+		}
+		purpose = ChallengeSetup
+	}
+
+	token, expiresAt, err := s.tokens.GenerateChallengeToken(user.ID, purpose, method)
+	if err != nil {
+		return fmt.Errorf("generate challenge token: %w", err)
+	}
+	return &TwoFactorChallengeError{
+		UserID: user.ID,
+		Challenge: model.TwoFactorChallenge{
+			TwoFactorRequired: true,
+			SetupRequired:     purpose == ChallengeSetup,
+			ChallengeToken:    token,
+			ExpiresAt:         expiresAt,
+		},
+	}
+}
+
+// missingRequiredSecondFactor reports whether the workspace requires 2FA and
+// the user has not set it up. Bots sign in with tokens and are exempt.
+func (s *Service) missingRequiredSecondFactor(ctx context.Context, user *model.User) (bool, error) {
+	if user.Role == model.RoleBot {
+		return false, nil
+	}
+	settings, err := s.repo.GetWorkspaceSettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !settings.RequireTwoFactor {
+		return false, nil
+	}
+	rec, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return rec == nil || rec.EnabledAt == nil, nil
+}
+
+// challengeUser resolves a challenge token to its still-active user.
+func (s *Service) challengeUser(ctx context.Context, challengeToken string) (*model.User, string, string, error) {
+	userID, purpose, method, err := s.tokens.ValidateChallengeToken(challengeToken)
+	if err != nil {
+		return nil, "", "", ErrInvalidChallenge
+	}
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("get user: %w", err)
+	}
+	if user == nil || !user.IsActive {
+		return nil, "", "", ErrInvalidChallenge
+	}
+	return user, purpose, method, nil
+}
+
+// BeginChallengeSetup starts enrollment for a user whose login was challenged
+// because the workspace requires 2FA.
+func (s *Service) BeginChallengeSetup(ctx context.Context, challengeToken string) (*model.TwoFactorEnrollment, error) {
+	user, purpose, _, err := s.challengeUser(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if purpose != ChallengeSetup {
+		return nil, ErrInvalidChallenge
+	}
+	return s.Enroll(ctx, user.ID)
+}
+
+// CompleteTwoFactorLogin exchanges a challenge token and a TOTP or recovery
+// code for tokens. Setup challenges confirm the pending enrollment instead, and
+// the response carries the new recovery codes.
+func (s *Service) CompleteTwoFactorLogin(ctx context.Context, req model.TwoFactorLoginRequest) (*model.AuthResponse, error) {
+	user, purpose, method, err := s.challengeUser(ctx, req.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// A challenge stops working after too many wrong codes; the user has to
+	// sign in again for a new one
+	attemptKey := "challenge:" + HashToken(req.ChallengeToken)
+	failures, err := s.attempts.Failures(ctx, attemptKey)
+	if err != nil {
+		return nil, err
+	}
+	if failures >= maxTwoFactorFailures {
+		return nil, ErrInvalidChallenge
+	}
+
+	var recoveryCodes []string
+	switch purpose {
+	case ChallengeVerify:
+		err = s.verifySecondFactor(ctx, user.ID, req.Code)
+	case ChallengeSetup:
+		recoveryCodes, err = s.ConfirmEnrollment(ctx, user.ID, req.Code)
+	default:
+		return nil, ErrInvalidChallenge
+	}
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		s.auditLoginFailed(ctx, user.ID, user.Email, "invalid_2fa_code")
+		if _, ferr := s.attempts.Fail(ctx, attemptKey); ferr != nil {
+			return nil, ferr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLogin(ctx, user.ID, method)
+	resp, err := s.generateAuthResponse(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	resp.RecoveryCodes = recoveryCodes
+	return resp, nil
+}
+
+// Enroll generates a new authenticator secret for the user. It is pending until
+// confirmed with a code from the authenticator.
+func (s *Service) Enroll(ctx context.Context, userID uuid.UUID) (*model.TwoFactorEnrollment, error) {
+	rec, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil && rec.EnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPendingTOTP(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &model.TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: otpauthURI(user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables 2FA with a code from the newly added authenticator
+// and returns the user's recovery codes. They are only ever shown here.
+func (s *Service) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	rec, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if rec.EnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	step, ok := validateTOTP(rec.Secret, code, time.Now(), rec.LastStep)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, audit.Entry{
+		UserID:     userID,
+		Action:     audit.ActionTwoFactorEnabled,
+		EntityType: audit.EntityUser,
+		EntityID:   userID,
+	})
+	return codes, nil
+}
+
+// DisableTwoFactor removes the user's authenticator and recovery codes after
+// checking a current code. Not allowed while the workspace requires 2FA.
+func (s *Service) DisableTwoFactor(ctx context.Context, userID uuid.UUID, code string) error {
+	settings, err := s.repo.GetWorkspaceSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if settings.RequireTwoFactor {
+		return ErrTwoFactorEnforced
+	}
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteTOTP(ctx, userID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, audit.Entry{
+		UserID:     userID,
+		Action:     audit.ActionTwoFactorDisabled,
+		EntityType: audit.EntityUser,
+		EntityID:   userID,
+	})
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a
+// current code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *Service) TwoFactorStatus(ctx context.Context, userID uuid.UUID) (*model.TwoFactorStatus, error) {
+	rec, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.repo.GetWorkspaceSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &model.TwoFactorStatus{Required: settings.RequireTwoFactor}
+	if rec != nil && rec.EnabledAt != nil {
+		status.Enabled = true
+		status.RecoveryCodesRemaining, err = s.repo.CountRecoveryCodes(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// verifySecondFactor checks a TOTP or recovery code of a user with 2FA enabled.
+// Either kind of code is accepted only once. After maxTwoFactorFailures wrong
+// codes, from any challenge or settings change, the user is locked out of 2FA
+// checks until the attempt window passes.
+func (s *Service) verifySecondFactor(ctx context.Context, userID uuid.UUID, code string) error {
+	rec, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if rec == nil || rec.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	attemptKey := "user:" + userID.String()
+	failures, err := s.attempts.Failures(ctx, attemptKey)
+	if err != nil {
+		return err
+	}
+	if failures >= maxTwoFactorFailures {
+		return ErrTooManyAttempts
+	}
+
+	err = s.useSecondFactorCode(ctx, rec, userID, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if _, ferr := s.attempts.Fail(ctx, attemptKey); ferr != nil {
+			return ferr
+		}
+	}
+	return err
+}
+
+func (s *Service) useSecondFactorCode(ctx context.Context, rec *TOTPRecord, userID uuid.UUID, code string) error {
+	if isTOTPCode(code) {
+		step, ok := validateTOTP(rec.Secret, code, time.Now(), rec.LastStep)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		// A concurrent request may have used this step already
+		used, err := s.repo.UseTOTPStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+func (s *Service) GetWorkspaceSettings(ctx context.Context) (*model.WorkspaceSettings, error) {
+	return s.repo.GetWorkspaceSettings(ctx)
+}
+
+// UpdateWorkspaceSettings applies the fields set in req. Requiring 2FA takes
+// effect at each user's next login or token refresh.
+func (s *Service) UpdateWorkspaceSettings(ctx context.Context, actorID uuid.UUID, req model.UpdateWorkspaceSettingsRequest) (*model.WorkspaceSettings, error) {
+	settings, err := s.repo.GetWorkspaceSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	if req.RequireTwoFactor != nil && *req.RequireTwoFactor != settings.RequireTwoFactor {
+		settings.RequireTwoFactor = *req.RequireTwoFactor
+		changes["require_two_factor"] = settings.RequireTwoFactor
+	}
+	if len(changes) == 0 {
+		return settings, nil
+	}
+
+	if err := s.repo.UpdateWorkspaceSettings(ctx, settings); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, audit.Entry{
+		UserID:     actorID,
+		Action:     audit.ActionSettingsUpdated,
+		EntityType: audit.EntityWorkspace,
+		Metadata:   changes,
+	})
+	return settings, nil
+}
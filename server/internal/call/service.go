@@ -14,10 +14,11 @@ import (
 )
 
 var (
-	ErrCallNotFound     = errors.New("call not found")
-	ErrCallAlreadyActive = errors.New("there is already an active call in this channel")
+	ErrCallNotFound       = errors.New("call not found")
+	ErrCallAlreadyActive  = errors.New("there is already an active call in this channel")
 	ErrNotCallParticipant = errors.New("not a call participant")
-	ErrCallNotRinging   = errors.New("call is not in ringing state")
+	ErrCallNotRinging     = errors.New("call is not in ringing state")
+	ErrForbidden          = errors.New("forbidden")
 )
 
 const ringingTimeout = 30 * time.Second
@@ -25,9 +26,10 @@ const ringingTimeout = 30 * time.Second
 type BroadcastFunc func(channelID uuid.UUID, event model.WebSocketEvent)
 type SendToUserFunc func(userID uuid.UUID, data []byte)
 
-// ChannelMemberChecker checks if a user is a member of a channel.
+// ChannelMemberChecker checks a user's membership and permissions in a channel.
 type ChannelMemberChecker interface {
 	IsMember(ctx context.Context, channelID, userID uuid.UUID) (bool, error)
+	HasPermission(ctx context.Context, channelID, userID uuid.UUID, userRole string, perm model.ChannelPermission) (bool, error)
 }
 
 type Service struct {
@@ -53,7 +55,17 @@ func (s *Service) SetMemberChecker(mc ChannelMemberChecker) {
 	s.memberChecker = mc
 }
 
-func (s *Service) Initiate(ctx context.Context, req model.InitiateCallRequest, initiatorID uuid.UUID) (*model.Call, error) {
+func (s *Service) Initiate(ctx context.Context, req model.InitiateCallRequest, initiatorID uuid.UUID, userRole string) (*model.Call, error) {
+	if s.memberChecker != nil {
+		allowed, err := s.memberChecker.HasPermission(ctx, req.ChannelID, initiatorID, userRole, model.PermStartCalls)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrForbidden
+		}
+	}
+
 	// Check for existing active call
 	existing, err := s.repo.GetActiveCallForChannel(ctx, req.ChannelID)
 	if err != nil {
@@ -111,8 +111,9 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := middleware.GetUserID(r.Context())
 	userRole := middleware.GetUserRole(r.Context())
-	if err := h.service.Delete(r.Context(), channelID, userRole); err != nil {
+	if err := h.service.Delete(r.Context(), channelID, userID, userRole); err != nil {
 		handleServiceError(w, err)
 		return
 	}
@@ -199,6 +200,78 @@ func (h *Handler) GetMembers(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, members, http.StatusOK)
 }
 
+func (h *Handler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(chi.URLParam(r, "channelID"))
+	if err != nil {
+		writeError(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+	targetID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var req model.UpdateMemberRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+	if err := h.service.UpdateMemberRole(r.Context(), channelID, targetID, req.Role, userID, userRole); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(chi.URLParam(r, "channelID"))
+	if err != nil {
+		writeError(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+	targetID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+	if err := h.service.RemoveMember(r.Context(), channelID, targetID, userID, userRole); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(chi.URLParam(r, "channelID"))
+	if err != nil {
+		writeError(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+	perms, err := h.service.GetPermissions(r.Context(), channelID, userID, userRole)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, perms, http.StatusOK)
+}
+
 func (h *Handler) MarkRead(w http.ResponseWriter, r *http.Request) {
 	channelID, err := uuid.Parse(chi.URLParam(r, "channelID"))
 	if err != nil {
@@ -225,6 +298,8 @@ func handleServiceError(w http.ResponseWriter, err error) {
 		writeError(w, "forbidden", http.StatusForbidden)
 	case errors.Is(err, ErrNotMember):
 		writeError(w, "not a channel member", http.StatusForbidden)
+	case errors.Is(err, ErrLastOwner):
+		writeError(w, err.Error(), http.StatusConflict)
 	default:
 		writeError(w, "internal server error", http.StatusInternalServerError)
 	}
@@ -21,11 +21,13 @@ func NewRepository(db *pgxpool.Pool) *Repository {
 
 func (r *Repository) Create(ctx context.Context, ch *model.Channel) error {
 	query := `
-		INSERT INTO channels (id, name, topic, description, type, is_readonly, creator_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO channels (id, name, topic, description, type, is_readonly,
+			admins_only, threads_only, slow_mode_seconds, max_attachments, creator_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 	_, err := r.db.Exec(ctx, query,
 		ch.ID, ch.Name, ch.Topic, ch.Description, ch.Type, ch.IsReadonly,
+		ch.AdminsOnly, ch.ThreadsOnly, ch.SlowModeSeconds, ch.MaxAttachments,
 		ch.CreatorID, ch.CreatedAt, ch.UpdatedAt,
 	)
 	if err != nil {
@@ -36,13 +38,15 @@ func (r *Repository) Create(ctx context.Context, ch *model.Channel) error {
 
 func (r *Repository) GetByID(ctx context.Context, id uuid.UUID) (*model.Channel, error) {
 	query := `
-		SELECT c.id, c.name, c.topic, c.description, c.type, c.is_readonly, c.creator_id, c.created_at, c.updated_at,
+		SELECT c.id, c.name, c.topic, c.description, c.type, c.is_readonly,
+			   c.admins_only, c.threads_only, c.slow_mode_seconds, c.max_attachments, c.creator_id, c.created_at, c.updated_at,
 			   (SELECT COUNT(*) FROM channel_members cm WHERE cm.channel_id = c.id) as member_count
 		FROM channels c WHERE c.id = $1
 	`
 	var ch model.Channel
 	err := r.db.QueryRow(ctx, query, id).Scan(
 		&ch.ID, &ch.Name, &ch.Topic, &ch.Description, &ch.Type, &ch.IsReadonly,
+		&ch.AdminsOnly, &ch.ThreadsOnly, &ch.SlowModeSeconds, &ch.MaxAttachments,
 		&ch.CreatorID, &ch.CreatedAt, &ch.UpdatedAt, &ch.MemberCount,
 	)
 	if err == pgx.ErrNoRows {
@@ -56,13 +60,15 @@ func (r *Repository) GetByID(ctx context.Context, id uuid.UUID) (*model.Channel,
 
 func (r *Repository) GetByName(ctx context.Context, name string) (*model.Channel, error) {
 	query := `
-		SELECT c.id, c.name, c.topic, c.description, c.type, c.is_readonly, c.creator_id, c.created_at, c.updated_at,
+		SELECT c.id, c.name, c.topic, c.description, c.type, c.is_readonly,
+			   c.admins_only, c.threads_only, c.slow_mode_seconds, c.max_attachments, c.creator_id, c.created_at, c.updated_at,
 			   (SELECT COUNT(*) FROM channel_members cm WHERE cm.channel_id = c.id) as member_count
 		FROM channels c WHERE c.name = $1
 	`
 	var ch model.Channel
 	err := r.db.QueryRow(ctx, query, name).Scan(
 		&ch.ID, &ch.Name, &ch.Topic, &ch.Description, &ch.Type, &ch.IsReadonly,
+		&ch.AdminsOnly, &ch.ThreadsOnly, &ch.SlowModeSeconds, &ch.MaxAttachments,
 		&ch.CreatorID, &ch.CreatedAt, &ch.UpdatedAt, &ch.MemberCount,
 	)
 	if err == pgx.ErrNoRows {
@@ -76,7 +82,8 @@ func (r *Repository) GetByName(ctx context.Context, name string) (*model.Channel
 
 func (r *Repository) List(ctx context.Context, userID uuid.UUID) ([]model.Channel, error) {
 	query := `
-		SELECT c.id, c.name, c.topic, c.description, c.type, c.is_readonly, c.creator_id, c.created_at, c.updated_at,
+		SELECT c.id, c.name, c.topic, c.description, c.type, c.is_readonly,
+			   c.admins_only, c.threads_only, c.slow_mode_seconds, c.max_attachments, c.creator_id, c.created_at, c.updated_at,
 			   (SELECT COUNT(*) FROM channel_members cm2 WHERE cm2.channel_id = c.id) as member_count,
 			   COALESCE(
 				   (SELECT COUNT(*) FROM messages m
@@ -104,6 +111,7 @@ func (r *Repository) List(ctx context.Context, userID uuid.UUID) ([]model.Channe
 		var ch model.Channel
 		if err := rows.Scan(
 			&ch.ID, &ch.Name, &ch.Topic, &ch.Description, &ch.Type, &ch.IsReadonly,
+			&ch.AdminsOnly, &ch.ThreadsOnly, &ch.SlowModeSeconds, &ch.MaxAttachments,
 			&ch.CreatorID, &ch.CreatedAt, &ch.UpdatedAt, &ch.MemberCount, &ch.UnreadCount,
 		); err != nil {
 			return nil, fmt.Errorf("scan channel: %w", err)
@@ -118,10 +126,14 @@ func (r *Repository) List(ctx context.Context, userID uuid.UUID) ([]model.Channe
 
 func (r *Repository) Update(ctx context.Context, ch *model.Channel) error {
 	query := `
-		UPDATE channels SET name = $1, topic = $2, description = $3, is_readonly = $4, updated_at = NOW()
-		WHERE id = $5
+		UPDATE channels SET name = $1, topic = $2, description = $3, is_readonly = $4,
+			admins_only = $5, threads_only = $6, slow_mode_seconds = $7, max_attachments = $8, updated_at = NOW()
+		WHERE id = $9
 	`
-	_, err := r.db.Exec(ctx, query, ch.Name, ch.Topic, ch.Description, ch.IsReadonly, ch.ID)
+	_, err := r.db.Exec(ctx, query,
+		ch.Name, ch.Topic, ch.Description, ch.IsReadonly,
+		ch.AdminsOnly, ch.ThreadsOnly, ch.SlowModeSeconds, ch.MaxAttachments, ch.ID,
+	)
 	if err != nil {
 		return fmt.Errorf("update channel: %w", err)
 	}
@@ -136,25 +148,27 @@ func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (r *Repository) AddMember(ctx context.Context, channelID, userID uuid.UUID, role string) error {
+// AddMember adds the user to the channel. added is false if they were already a member.
+func (r *Repository) AddMember(ctx context.Context, channelID, userID uuid.UUID, role string) (bool, error) {
 	query := `
 		INSERT INTO channel_members (channel_id, user_id, role)
 		VALUES ($1, $2, $3)
 		ON CONFLICT (channel_id, user_id) DO NOTHING
 	`
-	_, err := r.db.Exec(ctx, query, channelID, userID, role)
+	tag, err := r.db.Exec(ctx, query, channelID, userID, role)
 	if err != nil {
-		return fmt.Errorf("add member: %w", err)
+		return false, fmt.Errorf("add member: %w", err)
 	}
-	return nil
+	return tag.RowsAffected() > 0, nil
 }
 
-func (r *Repository) RemoveMember(ctx context.Context, channelID, userID uuid.UUID) error {
-	_, err := r.db.Exec(ctx, "DELETE FROM channel_members WHERE channel_id = $1 AND user_id = $2", channelID, userID)
+// RemoveMember removes the user from the channel. removed is false if they were not a member.
+func (r *Repository) RemoveMember(ctx context.Context, channelID, userID uuid.UUID) (bool, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM channel_members WHERE channel_id = $1 AND user_id = $2", channelID, userID)
 	if err != nil {
-		return fmt.Errorf("remove member: %w", err)
+		return false, fmt.Errorf("remove member: %w", err)
 	}
-	return nil
+	return tag.RowsAffected() > 0, nil
 }
 
 func (r *Repository) IsMember(ctx context.Context, channelID, userID uuid.UUID) (bool, error) {
@@ -226,3 +240,26 @@ func (r *Repository) GetMemberRole(ctx context.Context, channelID, userID uuid.U
 	}
 	return role, nil
 }
+
+func (r *Repository) SetMemberRole(ctx context.Context, channelID, userID uuid.UUID, role string) error {
+	_, err := r.db.Exec(ctx,
+		"UPDATE channel_members SET role = $3 WHERE channel_id = $1 AND user_id = $2",
+		channelID, userID, role,
+	)
+	if err != nil {
+		return fmt.Errorf("set member role: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) CountOwners(ctx context.Context, channelID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx,
+		"SELECT COUNT(*) FROM channel_members WHERE channel_id = $1 AND role = 'owner'",
+		channelID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count owners: %w", err)
+	}
+	return count, nil
+}
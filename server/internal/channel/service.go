@@ -2,12 +2,14 @@ package channel
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/feather-chat/feather/internal/audit"
 	"github.com/feather-chat/feather/internal/model"
 )
 
@@ -17,14 +19,36 @@ var (
 	ErrNotMember       = errors.New("not a channel member")
 	ErrForbidden       = errors.New("forbidden")
 	ErrAlreadyMember   = errors.New("already a member")
+	ErrLastOwner       = errors.New("channel must keep at least one owner")
 )
 
+type BroadcastFunc func(channelID uuid.UUID, event model.WebSocketEvent)
+
+// Subscriber keeps users' live connections subscribed to the channels they belong to.
+type Subscriber interface {
+	SubscribeUserToChannel(userID, channelID uuid.UUID)
+	UnsubscribeUserFromChannel(userID, channelID uuid.UUID)
+}
+
+// AuditLogger records administrative actions.
+type AuditLogger interface {
+	Log(ctx context.Context, entry audit.Entry)
+}
+
 type Service struct {
-	repo *Repository
+	repo      *Repository
+	broadcast BroadcastFunc
+	subs      Subscriber
+	auditLog  AuditLogger
 }
 
-func NewService(repo *Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo *Repository, broadcast BroadcastFunc, subs Subscriber) *Service {
+	return &Service{repo: repo, broadcast: broadcast, subs: subs}
+}
+
+// SetAuditLogger enables audit entries for channel creation, deletion and role changes.
+func (s *Service) SetAuditLogger(al AuditLogger) {
+	s.auditLog = al
 }
 
 func (s *Service) Create(ctx context.Context, req model.CreateChannelRequest, userID uuid.UUID, userRole string) (*model.Channel, error) {
@@ -43,25 +67,40 @@ func (s *Service) Create(ctx context.Context, req model.CreateChannelRequest, us
 	now := time.Now()
 	name := req.Name
 	ch := &model.Channel{
-		ID:          uuid.New(),
-		Name:        &name,
-		Topic:       req.Topic,
-		Description: req.Description,
-		Type:        req.Type,
-		IsReadonly:  req.IsReadonly,
-		CreatorID:   &userID,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+		ID:              uuid.New(),
+		Name:            &name,
+		Topic:           req.Topic,
+		Description:     req.Description,
+		Type:            req.Type,
+		IsReadonly:      req.IsReadonly,
+		AdminsOnly:      req.AdminsOnly,
+		ThreadsOnly:     req.ThreadsOnly,
+		SlowModeSeconds: req.SlowModeSeconds,
+		MaxAttachments:  req.MaxAttachments,
+		CreatorID:       &userID,
+		CreatedAt:       now,
+		UpdatedAt:       now,
 	}
 
 	if err := s.repo.Create(ctx, ch); err != nil {
 		return nil, err
 	}
 
-	// Auto-add creator as channel admin
-	if err := s.repo.AddMember(ctx, ch.ID, userID, "admin"); err != nil {
+	// Auto-add creator as channel owner
+	if _, err := s.repo.AddMember(ctx, ch.ID, userID, string(model.ChannelRoleOwner)); err != nil {
 		return nil, err
 	}
+	if s.subs != nil {
+		s.subs.SubscribeUserToChannel(userID, ch.ID)
+	}
+
+	s.audit(ctx, audit.Entry{
+		UserID:     userID,
+		Action:     audit.ActionChannelCreated,
+		EntityType: audit.EntityChannel,
+		EntityID:   ch.ID,
+		Metadata:   map[string]interface{}{"name": name, "type": ch.Type},
+	})
 
 	ch.MemberCount = 1
 	return ch, nil
@@ -103,9 +142,11 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req model.UpdateChan
 		return nil, ErrChannelNotFound
 	}
 
-	// Only creator or admin can update
-	isCreator := ch.CreatorID != nil && *ch.CreatorID == userID
-	if !isCreator && userRole != string(model.RoleAdmin) {
+	allowed, err := s.can(ctx, ch, userID, userRole, model.PermEditChannel)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
 		return nil, ErrForbidden
 	}
 
@@ -128,6 +169,18 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req model.UpdateChan
 	if req.IsReadonly != nil {
 		ch.IsReadonly = *req.IsReadonly
 	}
+	if req.AdminsOnly != nil {
+		ch.AdminsOnly = *req.AdminsOnly
+	}
+	if req.ThreadsOnly != nil {
+		ch.ThreadsOnly = *req.ThreadsOnly
+	}
+	if req.SlowModeSeconds != nil {
+		ch.SlowModeSeconds = *req.SlowModeSeconds
+	}
+	if req.MaxAttachments != nil {
+		ch.MaxAttachments = *req.MaxAttachments
+	}
 
 	if err := s.repo.Update(ctx, ch); err != nil {
 		return nil, err
@@ -136,11 +189,7 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req model.UpdateChan
 	return ch, nil
 }
 
-func (s *Service) Delete(ctx context.Context, id uuid.UUID, userRole string) error {
-	if userRole != string(model.RoleAdmin) {
-		return ErrForbidden
-	}
-
+func (s *Service) Delete(ctx context.Context, id, userID uuid.UUID, userRole string) error {
 	ch, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
@@ -149,7 +198,30 @@ func (s *Service) Delete(ctx context.Context, id uuid.UUID, userRole string) err
 		return ErrChannelNotFound
 	}
 
-	return s.repo.Delete(ctx, id)
+	allowed, err := s.can(ctx, ch, userID, userRole, model.PermDeleteChannel)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	metadata := map[string]interface{}{"type": ch.Type}
+	if ch.Name != nil {
+		metadata["name"] = *ch.Name
+	}
+	s.audit(ctx, audit.Entry{
+		UserID:     userID,
+		Action:     audit.ActionChannelDeleted,
+		EntityType: audit.EntityChannel,
+		EntityID:   id,
+		Metadata:   metadata,
+	})
+	return nil
 }
 
 func (s *Service) Join(ctx context.Context, channelID, userID uuid.UUID) error {
@@ -165,11 +237,135 @@ func (s *Service) Join(ctx context.Context, channelID, userID uuid.UUID) error {
 		return ErrForbidden
 	}
 
-	return s.repo.AddMember(ctx, channelID, userID, "member")
+	return s.addMember(ctx, channelID, userID, nil)
 }
 
 func (s *Service) Leave(ctx context.Context, channelID, userID uuid.UUID) error {
-	return s.repo.RemoveMember(ctx, channelID, userID)
+	return s.removeMember(ctx, channelID, userID, nil)
+}
+
+// RemoveMember kicks another member out of the channel. Removing yourself is
+// the same as leaving. Only workspace admins can remove someone whose channel
+// role is equal to or above their own.
+func (s *Service) RemoveMember(ctx context.Context, channelID, targetID, actorID uuid.UUID, actorRole string) error {
+	if targetID == actorID {
+		return s.Leave(ctx, channelID, actorID)
+	}
+
+	ch, err := s.repo.GetByID(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	if ch == nil {
+		return ErrChannelNotFound
+	}
+	if isDirect(ch) {
+		return ErrForbidden
+	}
+
+	allowed, err := s.can(ctx, ch, actorID, actorRole, model.PermKickMembers)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+
+	targetRole, err := s.repo.GetMemberRole(ctx, channelID, targetID)
+	if err != nil {
+		return err
+	}
+	if targetRole == "" {
+		return ErrNotMember
+	}
+	if actorRole != string(model.RoleAdmin) {
+		ownRole, err := s.effectiveRole(ctx, ch, actorID)
+		if err != nil {
+			return err
+		}
+		if roleRank(model.ChannelRole(targetRole)) >= roleRank(ownRole) {
+			return ErrForbidden
+		}
+	}
+
+	return s.removeMember(ctx, channelID, targetID, &actorID)
+}
+
+// addMember adds a member, subscribes their connections and announces them.
+// actorID is the inviter, or nil when users join on their own.
+func (s *Service) addMember(ctx context.Context, channelID, userID uuid.UUID, actorID *uuid.UUID) error {
+	added, err := s.repo.AddMember(ctx, channelID, userID, string(model.ChannelRoleMember))
+	if err != nil || !added {
+		return err
+	}
+
+	// Subscribe first so the new member also receives the event
+	if s.subs != nil {
+		s.subs.SubscribeUserToChannel(userID, channelID)
+	}
+	reason := model.MemberReasonJoined
+	if actorID != nil {
+		reason = model.MemberReasonInvited
+	}
+	s.broadcastMember(model.EventMemberJoined, channelID, userID, actorID, reason)
+	return nil
+}
+
+// removeMember removes a member, announces it and unsubscribes their
+// connections so they stop receiving the channel's events. actorID is the
+// member who removed them, or nil when they left.
+func (s *Service) removeMember(ctx context.Context, channelID, userID uuid.UUID, actorID *uuid.UUID) error {
+	removed, err := s.repo.RemoveMember(ctx, channelID, userID)
+	if err != nil || !removed {
+		return err
+	}
+
+	// Announce before unsubscribing so the removed user sees it too
+	reason := model.MemberReasonLeft
+	if actorID != nil {
+		reason = model.MemberReasonRemoved
+	}
+	s.broadcastMember(model.EventMemberLeft, channelID, userID, actorID, reason)
+	if s.subs != nil {
+		s.subs.UnsubscribeUserFromChannel(userID, channelID)
+	}
+	return nil
+}
+
+func (s *Service) broadcastMember(eventType model.EventType, channelID, userID uuid.UUID, actorID *uuid.UUID, reason string) {
+	if s.broadcast == nil {
+		return
+	}
+	payload, _ := json.Marshal(model.MemberEvent{
+		ChannelID: channelID,
+		UserID:    userID,
+		ActorID:   actorID,
+		Reason:    reason,
+	})
+	s.broadcast(channelID, model.WebSocketEvent{
+		Type:      eventType,
+		ChannelID: channelID.String(),
+		Payload:   payload,
+	})
+}
+
+func (s *Service) audit(ctx context.Context, entry audit.Entry) {
+	if s.auditLog != nil {
+		s.auditLog.Log(ctx, entry)
+	}
+}
+
+func roleRank(role model.ChannelRole) int {
+	switch role {
+	case model.ChannelRoleOwner:
+		return 3
+	case model.ChannelRoleAdmin:
+		return 2
+	case model.ChannelRoleMember:
+		return 1
+	default:
+		return 0
+	}
 }
 
 func (s *Service) InviteMember(ctx context.Context, channelID, inviterID, inviteeID uuid.UUID, inviterRole string) error {
@@ -181,16 +377,15 @@ func (s *Service) InviteMember(ctx context.Context, channelID, inviterID, invite
 		return ErrChannelNotFound
 	}
 
-	// Only channel members (or admins) can invite
-	isMember, err := s.repo.IsMember(ctx, channelID, inviterID)
+	allowed, err := s.can(ctx, ch, inviterID, inviterRole, model.PermInviteMembers)
 	if err != nil {
 		return err
 	}
-	if !isMember && inviterRole != string(model.RoleAdmin) {
+	if !allowed {
 		return ErrForbidden
 	}
 
-	return s.repo.AddMember(ctx, channelID, inviteeID, "member")
+	return s.addMember(ctx, channelID, inviteeID, &inviterID)
 }
 
 func (s *Service) GetMembers(ctx context.Context, channelID, userID uuid.UUID) ([]model.ChannelMember, error) {
@@ -215,6 +410,155 @@ func (s *Service) GetMembers(ctx context.Context, channelID, userID uuid.UUID) (
 	return s.repo.GetMembers(ctx, channelID)
 }
 
+// UpdateMemberRole promotes or demotes a channel member. The last owner cannot
+// be demoted, so every channel keeps someone able to manage roles.
+func (s *Service) UpdateMemberRole(ctx context.Context, channelID, targetID uuid.UUID, role model.ChannelRole, actorID uuid.UUID, actorRole string) error {
+	ch, err := s.repo.GetByID(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	if ch == nil {
+		return ErrChannelNotFound
+	}
+	if isDirect(ch) {
+		return ErrForbidden
+	}
+
+	allowed, err := s.can(ctx, ch, actorID, actorRole, model.PermManageRoles)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+
+	current, err := s.repo.GetMemberRole(ctx, channelID, targetID)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return ErrNotMember
+	}
+	if model.ChannelRole(current) == role {
+		return nil
+	}
+
+	if model.ChannelRole(current) == model.ChannelRoleOwner {
+		owners, err := s.repo.CountOwners(ctx, channelID)
+		if err != nil {
+			return err
+		}
+		if owners <= 1 {
+			return ErrLastOwner
+		}
+	}
+
+	if err := s.repo.SetMemberRole(ctx, channelID, targetID, string(role)); err != nil {
+		return err
+	}
+
+	s.audit(ctx, audit.Entry{
+		UserID:     actorID,
+		Action:     audit.ActionChannelRoleChanged,
+		EntityType: audit.EntityChannel,
+		EntityID:   channelID,
+		Metadata: map[string]interface{}{
+			"user_id":       targetID,
+			"role":          role,
+			"previous_role": current,
+		},
+	})
+	return nil
+}
+
+// HasPermission reports whether the user may perform the action in the channel.
+// Workspace admins may do anything; everyone else needs a channel role that
+// grants it.
+func (s *Service) HasPermission(ctx context.Context, channelID, userID uuid.UUID, userRole string, perm model.ChannelPermission) (bool, error) {
+	ch, err := s.repo.GetByID(ctx, channelID)
+	if err != nil {
+		return false, err
+	}
+	if ch == nil {
+		return false, ErrChannelNotFound
+	}
+	return s.can(ctx, ch, userID, userRole, perm)
+}
+
+// GetPermissions returns the user's effective role and capabilities in the channel.
+func (s *Service) GetPermissions(ctx context.Context, channelID, userID uuid.UUID, userRole string) (*model.ChannelPermissions, error) {
+	ch, err := s.repo.GetByID(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, ErrChannelNotFound
+	}
+
+	role, err := s.effectiveRole(ctx, ch, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	perms := &model.ChannelPermissions{Role: role, Permissions: role.Permissions()}
+	if userRole == string(model.RoleAdmin) {
+		perms.Permissions = model.ChannelRoleOwner.Permissions()
+	}
+	if perms.Permissions == nil {
+		perms.Permissions = []model.ChannelPermission{}
+	}
+	return perms, nil
+}
+
+// GetPostingPolicy returns the restrictions that apply to new messages in the channel.
+func (s *Service) GetPostingPolicy(ctx context.Context, channelID uuid.UUID) (*model.PostingPolicy, error) {
+	ch, err := s.repo.GetByID(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, ErrChannelNotFound
+	}
+	return &model.PostingPolicy{
+		IsReadonly:      ch.IsReadonly,
+		AdminsOnly:      ch.AdminsOnly,
+		ThreadsOnly:     ch.ThreadsOnly,
+		SlowModeSeconds: ch.SlowModeSeconds,
+		MaxAttachments:  ch.MaxAttachments,
+	}, nil
+}
+
+func (s *Service) can(ctx context.Context, ch *model.Channel, userID uuid.UUID, userRole string, perm model.ChannelPermission) (bool, error) {
+	if userRole == string(model.RoleAdmin) {
+		return true, nil
+	}
+	role, err := s.effectiveRole(ctx, ch, userID)
+	if err != nil {
+		return false, err
+	}
+	return role.Can(perm), nil
+}
+
+// effectiveRole returns the user's channel role, or "" for non-members. DM
+// participants have no owner, so each acts as a channel admin.
+func (s *Service) effectiveRole(ctx context.Context, ch *model.Channel, userID uuid.UUID) (model.ChannelRole, error) {
+	role, err := s.repo.GetMemberRole(ctx, ch.ID, userID)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		return "", nil
+	}
+	if isDirect(ch) {
+		return model.ChannelRoleAdmin, nil
+	}
+	return model.ChannelRole(role), nil
+}
+
+func isDirect(ch *model.Channel) bool {
+	return ch.Type == model.ChannelDM || ch.Type == model.ChannelGroupDM
+}
+
 func (s *Service) MarkRead(ctx context.Context, channelID, userID uuid.UUID) error {
 	return s.repo.UpdateLastRead(ctx, channelID, userID)
 }
@@ -259,5 +603,5 @@ func (s *Service) AutoJoinUser(ctx context.Context, userID uuid.UUID) error {
 	if general == nil {
 		return nil
 	}
-	return s.repo.AddMember(ctx, general.ID, userID, "member")
+	return s.addMember(ctx, general.ID, userID, nil)
 }
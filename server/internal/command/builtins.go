@@ -0,0 +1,168 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/channel"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+const maxReminderDelay = 365 * 24 * time.Hour
+
+func (s *Service) registerBuiltins() {
+	s.Register("topic", "Set the channel topic", "[text]", s.topic)
+	s.Register("invite", "Add a user to this channel", "@name", s.invite)
+	s.Register("leave", "Leave this channel", "", s.leave)
+	s.Register("mute", "Mute or unmute notifications for this channel", "", s.mute)
+	s.Register("remind", "Set a reminder", "[in] <30m|2h|1d> <text>", s.remind)
+	s.Register("shrug", "Append ¯\\_(ツ)_/¯ to your message", "[text]", s.shrug)
+}
+
+func (s *Service) topic(ctx context.Context, inv model.CommandInvocation) (*model.CommandResponse, error) {
+	if inv.Args == "" {
+		ch, err := s.channels.GetByID(ctx, inv.ChannelID, inv.UserID)
+		if err != nil {
+			return channelErrorResponse(err)
+		}
+		if ch.Topic == "" {
+			return ephemeral("This channel has no topic."), nil
+		}
+		return ephemeral("Current topic: " + ch.Topic), nil
+	}
+
+	topic := inv.Args
+	if _, err := s.channels.Update(ctx, inv.ChannelID, model.UpdateChannelRequest{Topic: &topic}, inv.UserID, inv.UserRole); err != nil {
+		return channelErrorResponse(err)
+	}
+	return inChannel(fmt.Sprintf("_set the channel topic: %s_", topic)), nil
+}
+
+func (s *Service) invite(ctx context.Context, inv model.CommandInvocation) (*model.CommandResponse, error) {
+	name := strings.TrimPrefix(inv.Args, "@")
+	if name == "" {
+		return ephemeral("Usage: /invite @name"), nil
+	}
+
+	user, err := s.repo.GetUserByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return ephemeral(fmt.Sprintf("No user named @%s.", name)), nil
+	}
+
+	if err := s.channels.InviteMember(ctx, inv.ChannelID, inv.UserID, user.ID, inv.UserRole); err != nil {
+		if errors.Is(err, channel.ErrAlreadyMember) {
+			return ephemeral(fmt.Sprintf("@%s is already in this channel.", user.Name)), nil
+		}
+		return channelErrorResponse(err)
+	}
+	return ephemeral(fmt.Sprintf("Added @%s to the channel.", user.Name)), nil
+}
+
+func (s *Service) leave(ctx context.Context, inv model.CommandInvocation) (*model.CommandResponse, error) {
+	if err := s.channels.Leave(ctx, inv.ChannelID, inv.UserID); err != nil {
+		return channelErrorResponse(err)
+	}
+	return ephemeral("You left the channel."), nil
+}
+
+func (s *Service) mute(ctx context.Context, inv model.CommandInvocation) (*model.CommandResponse, error) {
+	muted, err := s.repo.IsMuted(ctx, inv.ChannelID, inv.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.repo.SetMuted(ctx, inv.ChannelID, inv.UserID, !muted)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return ephemeral("You are not a member of this channel."), nil
+	}
+	if muted {
+		return ephemeral("Unmuted this channel."), nil
+	}
+	return ephemeral("Muted this channel."), nil
+}
+
+func (s *Service) remind(ctx context.Context, inv model.CommandInvocation) (*model.CommandResponse, error) {
+	delay, text, err := parseReminder(inv.Args)
+	if err != nil {
+		return ephemeral(err.Error() + " Usage: /remind [in] <30m|2h|1d> <text>"), nil
+	}
+
+	now := time.Now()
+	rem := &model.Reminder{
+		ID:        uuid.New(),
+		UserID:    inv.UserID,
+		ChannelID: inv.ChannelID,
+		Text:      text,
+		RemindAt:  now.Add(delay),
+		CreatedAt: now,
+	}
+	if err := s.repo.CreateReminder(ctx, rem); err != nil {
+		return nil, err
+	}
+
+	return ephemeral(fmt.Sprintf("OK, I'll remind you at %s.", rem.RemindAt.UTC().Format(time.RFC1123))), nil
+}
+
+func (s *Service) shrug(_ context.Context, inv model.CommandInvocation) (*model.CommandResponse, error) {
+	return inChannel(strings.TrimSpace(inv.Args + ` ¯\_(ツ)_/¯`)), nil
+}
+
+// parseReminder splits "[in] <duration> <text>" into its parts. Durations accept
+// Go syntax ("90m", "1h30m") plus a "d" suffix for days.
+func parseReminder(args string) (time.Duration, string, error) {
+	fields := strings.Fields(args)
+	if len(fields) > 0 && strings.EqualFold(fields[0], "me") {
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && strings.EqualFold(fields[0], "in") {
+		fields = fields[1:]
+	}
+	if len(fields) < 2 {
+		return 0, "", errors.New("Missing time or text.")
+	}
+
+	delay, err := parseDelay(fields[0])
+	if err != nil || delay <= 0 || delay > maxReminderDelay {
+		return 0, "", fmt.Errorf("Invalid time %q.", fields[0])
+	}
+
+	return delay, strings.Join(fields[1:], " "), nil
+}
+
+func parseDelay(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(strings.ToLower(s), "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// channelErrorResponse turns expected channel service errors into ephemeral
+// feedback. Anything else is returned as an internal error.
+func channelErrorResponse(err error) (*model.CommandResponse, error) {
+	switch {
+	case errors.Is(err, channel.ErrForbidden):
+		return ephemeral("You don't have permission to do that in this channel."), nil
+	case errors.Is(err, channel.ErrNotMember):
+		return ephemeral("You are not a member of this channel."), nil
+	case errors.Is(err, channel.ErrChannelNotFound):
+		return ephemeral("Channel not found."), nil
+	default:
+		return nil, err
+	}
+}
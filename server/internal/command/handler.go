@@ -0,0 +1,113 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/middleware"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+type Handler struct {
+	service  *Service
+	validate *validator.Validate
+}
+
+func NewHandler(service *Service, validate *validator.Validate) *Handler {
+	return &Handler{service: service, validate: validate}
+}
+
+// List returns all commands available to the composer for autocomplete.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	commands, err := h.service.List(r.Context())
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, commands, http.StatusOK)
+}
+
+func (h *Handler) ListCustom(w http.ResponseWriter, r *http.Request) {
+	commands, err := h.service.ListCustom(r.Context(), middleware.GetUserRole(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if commands == nil {
+		commands = []model.SlashCommand{}
+	}
+	writeJSON(w, commands, http.StatusOK)
+}
+
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateSlashCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+
+	cmd, err := h.service.Create(r.Context(), req, userID, userRole)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, cmd, http.StatusCreated)
+}
+
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	commandID, err := uuid.Parse(chi.URLParam(r, "commandID"))
+	if err != nil {
+		writeError(w, "invalid command id", http.StatusBadRequest)
+		return
+	}
+
+	userRole := middleware.GetUserRole(r.Context())
+	if err := h.service.Delete(r.Context(), commandID, userRole); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrCommandNotFound):
+		writeError(w, "command not found", http.StatusNotFound)
+	case errors.Is(err, ErrCommandExists):
+		writeError(w, "command name already taken", http.StatusConflict)
+	case errors.Is(err, ErrInvalidName):
+		writeError(w, "command name may only contain lowercase letters, digits, '-' and '_'", http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidURL):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrForbidden):
+		writeError(w, "forbidden", http.StatusForbidden)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,174 @@
+package command
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/feather-chat/feather/internal/model"
+)
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Create(ctx context.Context, cmd *model.SlashCommand) error {
+	query := `
+		INSERT INTO slash_commands (id, name, description, usage_hint, url, token, creator_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.Exec(ctx, query,
+		cmd.ID, cmd.Name, cmd.Description, cmd.Usage, cmd.URL, cmd.Token, cmd.CreatorID, cmd.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create slash command: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetByName(ctx context.Context, name string) (*model.SlashCommand, error) {
+	query := `
+		SELECT id, name, description, usage_hint, url, token, creator_id, created_at
+		FROM slash_commands WHERE name = $1
+	`
+	var cmd model.SlashCommand
+	err := r.db.QueryRow(ctx, query, name).Scan(
+		&cmd.ID, &cmd.Name, &cmd.Description, &cmd.Usage, &cmd.URL, &cmd.Token, &cmd.CreatorID, &cmd.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get slash command: %w", err)
+	}
+	return &cmd, nil
+}
+
+func (r *Repository) List(ctx context.Context) ([]model.SlashCommand, error) {
+	query := `
+		SELECT id, name, description, usage_hint, url, '', creator_id, created_at
+		FROM slash_commands ORDER BY name ASC
+	`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list slash commands: %w", err)
+	}
+	defer rows.Close()
+
+	var cmds []model.SlashCommand
+	for rows.Next() {
+		var cmd model.SlashCommand
+		if err := rows.Scan(&cmd.ID, &cmd.Name, &cmd.Description, &cmd.Usage, &cmd.URL, &cmd.Token, &cmd.CreatorID, &cmd.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan slash command: %w", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate slash commands: %w", err)
+	}
+	return cmds, nil
+}
+
+func (r *Repository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM slash_commands WHERE id = $1", id)
+	if err != nil {
+		return false, fmt.Errorf("delete slash command: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetUserByName finds an active user by display name (case-insensitive).
+func (r *Repository) GetUserByName(ctx context.Context, name string) (*model.User, error) {
+	var u model.User
+	err := r.db.QueryRow(ctx,
+		`SELECT id, name FROM users WHERE LOWER(name) = LOWER($1) AND is_active = true LIMIT 1`, name,
+	).Scan(&u.ID, &u.Name)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user by name: %w", err)
+	}
+	return &u, nil
+}
+
+// SetMuted toggles notifications for a user's channel membership.
+func (r *Repository) SetMuted(ctx context.Context, channelID, userID uuid.UUID, muted bool) (bool, error) {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE channel_members SET is_muted = $3 WHERE channel_id = $1 AND user_id = $2`,
+		channelID, userID, muted,
+	)
+	if err != nil {
+		return false, fmt.Errorf("set muted: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *Repository) IsMuted(ctx context.Context, channelID, userID uuid.UUID) (bool, error) {
+	var muted bool
+	err := r.db.QueryRow(ctx,
+		`SELECT is_muted FROM channel_members WHERE channel_id = $1 AND user_id = $2`,
+		channelID, userID,
+	).Scan(&muted)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get muted: %w", err)
+	}
+	return muted, nil
+}
+
+func (r *Repository) CreateReminder(ctx context.Context, rem *model.Reminder) error {
+	query := `
+		INSERT INTO reminders (id, user_id, channel_id, text, remind_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(ctx, query, rem.ID, rem.UserID, rem.ChannelID, rem.Text, rem.RemindAt, rem.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create reminder: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueReminders marks the due reminders of the given users as delivered
+// and returns them. Claiming with SKIP LOCKED ensures each reminder fires once
+// across instances.
+func (r *Repository) ClaimDueReminders(ctx context.Context, userIDs []uuid.UUID, limit int) ([]model.Reminder, error) {
+	query := `
+		UPDATE reminders SET delivered_at = NOW()
+		WHERE id IN (
+			SELECT id FROM reminders
+			WHERE delivered_at IS NULL AND remind_at <= NOW() AND user_id = ANY($1)
+			ORDER BY remind_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, channel_id, text, remind_at, delivered_at, created_at
+	`
+	rows, err := r.db.Query(ctx, query, userIDs, limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim reminders: %w", err)
+	}
+	defer rows.Close()
+
+	var reminders []model.Reminder
+	for rows.Next() {
+		var rem model.Reminder
+		if err := rows.Scan(&rem.ID, &rem.UserID, &rem.ChannelID, &rem.Text, &rem.RemindAt, &rem.DeliveredAt, &rem.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan reminder: %w", err)
+		}
+		reminders = append(reminders, rem)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate reminders: %w", err)
+	}
+	return reminders, nil
+}
@@ -0,0 +1,368 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/model"
+	"github.com/feather-chat/feather/internal/webhook"
+)
+
+var (
+	ErrCommandNotFound = errors.New("command not found")
+	ErrCommandExists   = errors.New("command name already taken")
+	ErrInvalidName     = errors.New("invalid command name")
+	ErrForbidden       = errors.New("forbidden")
+	ErrInvalidURL      = errors.New("command url must be an http or https url")
+)
+
+const (
+	customCommandTimeout  = 3 * time.Second
+	maxCustomResponseSize = 64 << 10
+	reminderPollInterval  = 15 * time.Second
+	reminderBatchSize     = 50
+)
+
+var (
+	// commandRegex matches "/name" or "/name args". Paths like "/etc/hosts" do not match.
+	commandRegex = regexp.MustCompile(`^/([a-z0-9][a-z0-9_-]*)(?:\s+([\s\S]*))?$`)
+	nameRegex    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// HandlerFunc runs a command and returns the response to show. A nil response means
+// the command completed without anything to display.
+type HandlerFunc func(ctx context.Context, inv model.CommandInvocation) (*model.CommandResponse, error)
+
+// SendToUserFunc delivers a raw WebSocket frame to every connection of a user.
+type SendToUserFunc func(userID uuid.UUID, data []byte)
+
+// OnlineUsersFunc returns the users connected to any instance.
+type OnlineUsersFunc func() []uuid.UUID
+
+// ChannelManager is the subset of channel operations used by built-in commands.
+type ChannelManager interface {
+	GetByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*model.Channel, error)
+	Update(ctx context.Context, id uuid.UUID, req model.UpdateChannelRequest, userID uuid.UUID, userRole string) (*model.Channel, error)
+	InviteMember(ctx context.Context, channelID, inviterID, inviteeID uuid.UUID, inviterRole string) error
+	Leave(ctx context.Context, channelID, userID uuid.UUID) error
+}
+
+type registeredCommand struct {
+	info    model.CommandInfo
+	handler HandlerFunc
+}
+
+type Service struct {
+	repo        *Repository
+	channels    ChannelManager
+	sendToUser  SendToUserFunc
+	onlineUsers OnlineUsersFunc
+	builtins    map[string]registeredCommand
+	httpClient  *http.Client
+}
+
+func NewService(repo *Repository, channels ChannelManager, sendToUser SendToUserFunc) *Service {
+	s := &Service{
+		repo:       repo,
+		channels:   channels,
+		sendToUser: sendToUser,
+		builtins:   make(map[string]registeredCommand),
+		httpClient: newCommandClient(),
+	}
+	s.registerBuiltins()
+	return s
+}
+
+// newCommandClient returns the client custom commands are sent with. It only
+// reaches public addresses and does not follow redirects, since replies are
+// shown to whoever invoked the command.
+func newCommandClient() *http.Client {
+	client := webhook.NewPublicClient(customCommandTimeout)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return client
+}
+
+// SetOnlineUsers enables reminder delivery. Reminders are only delivered while
+// their user is connected, so none fire unseen.
+func (s *Service) SetOnlineUsers(fn OnlineUsersFunc) {
+	s.onlineUsers = fn
+}
+
+// Register adds a built-in command. Custom commands cannot shadow built-ins.
+func (s *Service) Register(name, description, usage string, handler HandlerFunc) {
+	s.builtins[name] = registeredCommand{
+		info: model.CommandInfo{
+			Name:        name,
+			Description: description,
+			Usage:       usage,
+			BuiltIn:     true,
+		},
+		handler: handler,
+	}
+}
+
+// Execute runs the slash command in content, if any. handled is false when the
+// content is an ordinary message and should be posted as-is.
+func (s *Service) Execute(ctx context.Context, channelID, userID uuid.UUID, userRole, content string) (*model.CommandResponse, bool, error) {
+	match := commandRegex.FindStringSubmatch(strings.TrimSpace(content))
+	if match == nil {
+		return nil, false, nil
+	}
+
+	inv := model.CommandInvocation{
+		Name:      match[1],
+		Args:      strings.TrimSpace(match[2]),
+		ChannelID: channelID,
+		UserID:    userID,
+		UserRole:  userRole,
+	}
+
+	if cmd, ok := s.builtins[inv.Name]; ok {
+		resp, err := cmd.handler(ctx, inv)
+		return resp, true, err
+	}
+
+	custom, err := s.repo.GetByName(ctx, inv.Name)
+	if err != nil {
+		return nil, true, err
+	}
+	if custom == nil {
+		return ephemeral(fmt.Sprintf("/%s is not a valid command.", inv.Name)), true, nil
+	}
+
+	return s.executeCustom(ctx, custom, inv), true, nil
+}
+
+// List returns built-in and custom commands sorted by name.
+func (s *Service) List(ctx context.Context) ([]model.CommandInfo, error) {
+	custom, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]model.CommandInfo, 0, len(s.builtins)+len(custom))
+	for _, cmd := range s.builtins {
+		infos = append(infos, cmd.info)
+	}
+	for _, c := range custom {
+		infos = append(infos, model.CommandInfo{
+			Name:        c.Name,
+			Description: c.Description,
+			Usage:       c.Usage,
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// ListCustom returns the custom commands with their target URLs, for admins.
+func (s *Service) ListCustom(ctx context.Context, userRole string) ([]model.SlashCommand, error) {
+	if userRole != string(model.RoleAdmin) {
+		return nil, ErrForbidden
+	}
+	return s.repo.List(ctx)
+}
+
+func (s *Service) Create(ctx context.Context, req model.CreateSlashCommandRequest, creatorID uuid.UUID, userRole string) (*model.SlashCommand, error) {
+	if userRole != string(model.RoleAdmin) {
+		return nil, ErrForbidden
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(req.Name, "/"))
+	if !nameRegex.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+	if _, ok := s.builtins[name]; ok {
+		return nil, ErrCommandExists
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+	existing, err := s.repo.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrCommandExists
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &model.SlashCommand{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: req.Description,
+		Usage:       req.Usage,
+		URL:         req.URL,
+		Token:       token,
+		CreatorID:   creatorID,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.repo.Create(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id uuid.UUID, userRole string) error {
+	if userRole != string(model.RoleAdmin) {
+		return ErrForbidden
+	}
+	deleted, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCommandNotFound
+	}
+	return nil
+}
+
+// customCommandRequest is the JSON body POSTed to a custom command's URL.
+type customCommandRequest struct {
+	Token     string    `json:"token"`
+	Command   string    `json:"command"`
+	Text      string    `json:"text"`
+	ChannelID uuid.UUID `json:"channel_id"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+// executeCustom calls the command's URL. Failures are reported to the invoking
+// user as an ephemeral response rather than an error.
+func (s *Service) executeCustom(ctx context.Context, cmd *model.SlashCommand, inv model.CommandInvocation) *model.CommandResponse {
+	body, err := json.Marshal(customCommandRequest{
+		Token:     cmd.Token,
+		Command:   "/" + cmd.Name,
+		Text:      inv.Args,
+		ChannelID: inv.ChannelID,
+		UserID:    inv.UserID,
+	})
+	if err != nil {
+		return ephemeral(fmt.Sprintf("/%s failed.", cmd.Name))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, customCommandTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cmd.URL, bytes.NewReader(body))
+	if err != nil {
+		return ephemeral(fmt.Sprintf("/%s failed.", cmd.Name))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Feather-Commands/1.0")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		slog.Warn("custom command request failed", "command", cmd.Name, "error", err)
+		return ephemeral(fmt.Sprintf("/%s did not respond.", cmd.Name))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		slog.Warn("custom command returned error status", "command", cmd.Name, "status", resp.StatusCode)
+		return ephemeral(fmt.Sprintf("/%s failed with status %d.", cmd.Name, resp.StatusCode))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCustomResponseSize))
+	if err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	var out model.CommandResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		// Plain-text responses are shown to the invoking user only
+		return ephemeral(string(data))
+	}
+	if out.Text == "" {
+		return nil
+	}
+	if out.ResponseType != model.ResponseInChannel {
+		out.ResponseType = model.ResponseEphemeral
+	}
+	return &out
+}
+
+// RunReminderWorker delivers due /remind reminders until ctx is cancelled.
+func (s *Service) RunReminderWorker(ctx context.Context) {
+	ticker := time.NewTicker(reminderPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.deliverDueReminders(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverDueReminders sends due reminders to their users. Reminders of users
+// who are offline stay due until they connect again.
+func (s *Service) deliverDueReminders(ctx context.Context) {
+	if s.sendToUser == nil || s.onlineUsers == nil {
+		return
+	}
+	online := s.onlineUsers()
+	if len(online) == 0 {
+		return
+	}
+
+	reminders, err := s.repo.ClaimDueReminders(ctx, online, reminderBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("failed to claim due reminders", "error", err)
+		}
+		return
+	}
+
+	for _, rem := range reminders {
+		payload, _ := json.Marshal(rem)
+		event := model.WebSocketEvent{
+			Type:      model.EventReminderDue,
+			ChannelID: rem.ChannelID.String(),
+			Payload:   payload,
+		}
+		data, _ := json.Marshal(event)
+		s.sendToUser(rem.UserID, data)
+	}
+}
+
+func ephemeral(text string) *model.CommandResponse {
+	return &model.CommandResponse{ResponseType: model.ResponseEphemeral, Text: text}
+}
+
+func inChannel(text string) *model.CommandResponse {
+	return &model.CommandResponse{ResponseType: model.ResponseInChannel, Text: text}
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -12,15 +12,21 @@ type Config struct {
 	Redis     RedisConfig     `mapstructure:"redis"`
 	JWT       JWTConfig       `mapstructure:"jwt"`
 	MinIO     MinIOConfig     `mapstructure:"minio"`
+	Storage   StorageConfig   `mapstructure:"storage"`
 	Upload    UploadConfig    `mapstructure:"upload"`
 	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
 	OAuth     OAuthConfig     `mapstructure:"oauth"`
+	SAML      SAMLConfig      `mapstructure:"saml"`
 	WebRTC    WebRTCConfig    `mapstructure:"webrtc"`
+	Mail      MailConfig      `mapstructure:"mail"`
 }
 
+// ServerConfig's TrustedProxies lists the reverse proxies (CIDRs or IPs) whose
+// X-Forwarded-For and X-Real-IP headers are believed. Empty ignores the headers.
 type ServerConfig struct {
-	Port   int    `mapstructure:"port"`
-	AppURL string `mapstructure:"app_url"`
+	Port           int      `mapstructure:"port"`
+	AppURL         string   `mapstructure:"app_url"`
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type WebRTCConfig struct {
@@ -59,19 +65,104 @@ type MinIOConfig struct {
 	Bucket    string `mapstructure:"bucket"`
 }
 
+// StorageConfig selects where files are kept. The "s3" driver uses the minio
+// settings and works with MinIO or any S3-compatible store; files are
+// disabled if no endpoint is set. "local" keeps files under LocalDir and
+// "memory" in memory, lost on restart; with either, Feather serves the files
+// itself through signed URLs on PublicURL (relative URLs if empty).
+type StorageConfig struct {
+	Driver    string `mapstructure:"driver"`
+	LocalDir  string `mapstructure:"local_dir"`
+	PublicURL string `mapstructure:"public_url"`
+}
+
+// UploadConfig limits uploads. MaxSize applies to uploads through the server,
+// MaxDirectSize to direct-to-storage uploads. Files that are not attached to
+// a message within UnlinkedTTL are deleted; 0 keeps them.
 type UploadConfig struct {
-	MaxSize int64 `mapstructure:"max_size"`
+	MaxSize       int64         `mapstructure:"max_size"`
+	MaxDirectSize int64         `mapstructure:"max_direct_size"`
+	UnlinkedTTL   time.Duration `mapstructure:"unlinked_ttl"`
 }
 
+// RateLimitConfig sets how many requests each policy allows per Window. A
+// limit of 0 disables that policy.
 type RateLimitConfig struct {
-	Unauthenticated int `mapstructure:"unauthenticated"`
-	Authenticated   int `mapstructure:"authenticated"`
-	Webhooks        int `mapstructure:"webhooks"`
-	Auth            int `mapstructure:"auth"`
+	Window          time.Duration `mapstructure:"window"`
+	Unauthenticated int           `mapstructure:"unauthenticated"` // public routes, per IP
+	Authenticated   int           `mapstructure:"authenticated"`   // authenticated routes, per user
+	Webhooks        int           `mapstructure:"webhooks"`        // incoming webhooks, per token
+	Auth            int           `mapstructure:"auth"`            // login, register, refresh, per IP
+	Messages        int           `mapstructure:"messages"`        // message posting, per user
+	Uploads         int           `mapstructure:"uploads"`         // file uploads, per user
+}
+
+// MailConfig selects how email is sent. The "log" driver delivers nothing: it
+// logs each message's recipient and subject, and writes the whole message to
+// Dir when set; "smtp" sends through SMTP.
+type MailConfig struct {
+	Driver string     `mapstructure:"driver"`
+	From   string     `mapstructure:"from"`
+	Dir    string     `mapstructure:"dir"`
+	SMTP   SMTPConfig `mapstructure:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
 }
 
 type OAuthConfig struct {
-	GoogleClientID string `mapstructure:"google_client_id"`
+	GoogleClientID string               `mapstructure:"google_client_id"`
+	OIDCProviders  []OIDCProviderConfig `mapstructure:"oidc_providers"`
+}
+
+// OIDCProviderConfig is an OpenID Connect identity provider such as Keycloak or
+// Okta. Claims default to "email", "name" and "groups".
+type OIDCProviderConfig struct {
+	ID             string            `mapstructure:"id"`   // URL-safe, e.g. "okta"
+	Name           string            `mapstructure:"name"` // shown on the login button
+	Issuer         string            `mapstructure:"issuer"`
+	ClientID       string            `mapstructure:"client_id"`
+	ClientSecret   string            `mapstructure:"client_secret"`
+	RedirectURL    string            `mapstructure:"redirect_url"` // default {app_url}/login/oidc/{id}
+	Scopes         []string          `mapstructure:"scopes"`       // default openid, email, profile
+	EmailClaim     string            `mapstructure:"email_claim"`
+	NameClaim      string            `mapstructure:"name_claim"`
+	GroupsClaim    string            `mapstructure:"groups_claim"`
+	AllowedDomains []string          `mapstructure:"allowed_domains"` // email domains that may sign up; empty allows all
+	GroupMapping   map[string]string `mapstructure:"group_mapping"`   // provider group → Feather user group
+	TrustEmail     bool              `mapstructure:"trust_email"`     // treat emails as verified when email_verified is absent
+}
+
+// SAMLConfig configures Feather as a SAML 2.0 service provider. The optional
+// certificate and RSA key (PEM files) are published in the metadata so
+// providers can encrypt assertions.
+type SAMLConfig struct {
+	Certificate string               `mapstructure:"certificate"`
+	PrivateKey  string               `mapstructure:"private_key"`
+	Providers   []SAMLProviderConfig `mapstructure:"providers"`
+}
+
+// SAMLProviderConfig is a SAML identity provider such as ADFS, Okta or
+// Shibboleth. Attributes default to common names for email, display name and
+// groups.
+type SAMLProviderConfig struct {
+	ID                string            `mapstructure:"id"`   // URL-safe, e.g. "adfs"
+	Name              string            `mapstructure:"name"` // shown on the login button
+	MetadataURL       string            `mapstructure:"metadata_url"`
+	MetadataFile      string            `mapstructure:"metadata_file"`  // instead of metadata_url
+	EntityID          string            `mapstructure:"entity_id"`      // default: the SP metadata URL
+	NameIDFormat      string            `mapstructure:"name_id_format"` // default persistent
+	EmailAttribute    string            `mapstructure:"email_attribute"`
+	NameAttribute     string            `mapstructure:"name_attribute"`
+	GroupsAttribute   string            `mapstructure:"groups_attribute"`
+	AllowIDPInitiated bool              `mapstructure:"allow_idp_initiated"`
+	AllowedDomains    []string          `mapstructure:"allowed_domains"` // email domains that may sign up; empty allows all
+	GroupMapping      map[string]string `mapstructure:"group_mapping"`   // provider group → Feather user group
+	TrustEmail        bool              `mapstructure:"trust_email"`     // treat asserted emails as verified
 }
 
 func Load() (*Config, error) {
@@ -95,9 +186,23 @@ func Load() (*Config, error) {
 	v.BindEnv("minio.secret_key", "FEATHER_MINIO_SECRET_KEY")
 	v.BindEnv("minio.use_ssl", "FEATHER_MINIO_USE_SSL")
 	v.BindEnv("minio.bucket", "FEATHER_MINIO_BUCKET")
+	v.BindEnv("storage.driver", "FEATHER_STORAGE_DRIVER")
+	v.BindEnv("storage.local_dir", "FEATHER_STORAGE_LOCAL_DIR")
+	v.BindEnv("storage.public_url", "FEATHER_STORAGE_PUBLIC_URL")
+	v.BindEnv("upload.max_direct_size", "FEATHER_UPLOAD_MAX_DIRECT_SIZE")
+	v.BindEnv("upload.unlinked_ttl", "FEATHER_UPLOAD_UNLINKED_TTL")
 	v.BindEnv("database.max_conns", "FEATHER_DATABASE_MAX_CONNS")
 	v.BindEnv("database.min_conns", "FEATHER_DATABASE_MIN_CONNS")
 	v.BindEnv("oauth.google_client_id", "FEATHER_OAUTH_GOOGLE_CLIENT_ID")
+	v.BindEnv("server.app_url", "FEATHER_SERVER_APP_URL")
+	v.BindEnv("server.trusted_proxies", "FEATHER_SERVER_TRUSTED_PROXIES")
+	v.BindEnv("mail.driver", "FEATHER_MAIL_DRIVER")
+	v.BindEnv("mail.from", "FEATHER_MAIL_FROM")
+	v.BindEnv("mail.dir", "FEATHER_MAIL_DIR")
+	v.BindEnv("mail.smtp.host", "FEATHER_MAIL_SMTP_HOST")
+	v.BindEnv("mail.smtp.port", "FEATHER_MAIL_SMTP_PORT")
+	v.BindEnv("mail.smtp.username", "FEATHER_MAIL_SMTP_USERNAME")
+	v.BindEnv("mail.smtp.password", "FEATHER_MAIL_SMTP_PASSWORD")
 
 	// Defaults
 	v.SetDefault("database.max_conns", 25)
@@ -105,11 +210,21 @@ func Load() (*Config, error) {
 	v.SetDefault("server.port", 8080)
 	v.SetDefault("jwt.access_ttl", "15m")
 	v.SetDefault("jwt.refresh_ttl", "168h")
+	v.SetDefault("storage.driver", "s3")
+	v.SetDefault("storage.local_dir", "data/files")
 	v.SetDefault("upload.max_size", 20971520)
+	v.SetDefault("upload.max_direct_size", 5368709120)
+	v.SetDefault("upload.unlinked_ttl", "24h")
+	v.SetDefault("rate_limit.window", "1m")
 	v.SetDefault("rate_limit.unauthenticated", 100)
 	v.SetDefault("rate_limit.authenticated", 300)
 	v.SetDefault("rate_limit.webhooks", 60)
 	v.SetDefault("rate_limit.auth", 10)
+	v.SetDefault("rate_limit.messages", 60)
+	v.SetDefault("rate_limit.uploads", 20)
+	v.SetDefault("mail.driver", "log")
+	v.SetDefault("mail.from", "Feather <noreply@localhost>")
+	v.SetDefault("mail.smtp.port", 587)
 	v.SetDefault("webrtc.enabled", true)
 	v.SetDefault("webrtc.stun_servers", []string{"stun:stun.l.google.com:19302"})
 
@@ -2,28 +2,28 @@ package file
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/feather-chat/feather/internal/middleware"
 	"github.com/feather-chat/feather/internal/model"
 )
 
 type Handler struct {
-	storage *Storage
-	db      *pgxpool.Pool
-	maxSize int64
+	service  *Service
+	validate *validator.Validate
+	maxSize  int64
 }
 
-func NewHandler(storage *Storage, db *pgxpool.Pool, maxSize int64) *Handler {
-	return &Handler{storage: storage, db: db, maxSize: maxSize}
+func NewHandler(service *Service, validate *validator.Validate, maxSize int64) *Handler {
+	return &Handler{service: service, validate: validate, maxSize: maxSize}
 }
 
 func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
@@ -48,70 +48,259 @@ func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	fileID := uuid.New()
-	ext := filepath.Ext(header.Filename)
-	storageKey := fmt.Sprintf("%s/%s%s", channelID.String(), fileID.String(), ext)
-
-	if err := h.storage.Upload(r.Context(), storageKey, file, header.Size, header.Header.Get("Content-Type")); err != nil {
+	attachment, err := h.service.Upload(r.Context(), channelID, userID,
+		header.Filename, header.Header.Get("Content-Type"), header.Size, file)
+	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			writeError(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		writeError(w, "upload failed", http.StatusInternalServerError)
 		return
 	}
 
-	attachment := model.FileAttachment{
-		ID:          fileID,
-		ChannelID:   channelID,
-		UserID:      userID,
-		Filename:    header.Filename,
-		ContentType: header.Header.Get("Content-Type"),
-		SizeBytes:   header.Size,
-		StorageKey:  storageKey,
-		CreatedAt:   time.Now(),
+	writeJSON(w, attachment, http.StatusCreated)
+}
+
+// Download redirects to a short-lived URL for the file. Files in channels the
+// caller is not a member of are forbidden.
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+	fileID, err := uuid.Parse(chi.URLParam(r, "fileID"))
+	if err != nil {
+		writeError(w, "invalid file id", http.StatusBadRequest)
+		return
 	}
 
-	query := `
-		INSERT INTO file_attachments (id, channel_id, user_id, filename, content_type, size_bytes, storage_key)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`
-	_, err = h.db.Exec(r.Context(), query,
-		attachment.ID, attachment.ChannelID, attachment.UserID,
-		attachment.Filename, attachment.ContentType, attachment.SizeBytes, attachment.StorageKey,
-	)
+	url, err := h.service.DownloadURL(r.Context(), fileID, middleware.GetUserID(r.Context()))
 	if err != nil {
-		writeError(w, "internal server error", http.StatusInternalServerError)
+		handleServiceError(w, err)
 		return
 	}
 
-	writeJSON(w, attachment, http.StatusCreated)
+	http.Redirect(w, r, url, http.StatusFound)
 }
 
-func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+// Thumbnail redirects to a thumbnail of an image, by default the 360px one.
+// ?size=N picks the smallest thumbnail at least N pixels on its longest side.
+func (h *Handler) Thumbnail(w http.ResponseWriter, r *http.Request) {
 	fileID, err := uuid.Parse(chi.URLParam(r, "fileID"))
 	if err != nil {
 		writeError(w, "invalid file id", http.StatusBadRequest)
 		return
 	}
 
-	var storageKey string
-	err = h.db.QueryRow(r.Context(),
-		"SELECT storage_key FROM file_attachments WHERE id = $1",
-		fileID,
-	).Scan(&storageKey)
-	if err == pgx.ErrNoRows {
-		writeError(w, "file not found", http.StatusNotFound)
+	size := defaultThumbnailSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		size, err = strconv.Atoi(v)
+		if err != nil || size < 1 {
+			writeError(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+	}
+
+	url, err := h.service.ThumbnailURL(r.Context(), fileID, middleware.GetUserID(r.Context()), size)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// List returns a page of the files posted in the caller's channels.
+// Query: user_id, type (image, video, audio, document, archive), q (part of
+// the filename), from, to (RFC 3339), limit, cursor.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, nil)
+}
+
+// ListChannel returns a page of the files posted in the channel. It takes
+// the same query as List.
+func (h *Handler) ListChannel(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(chi.URLParam(r, "channelID"))
+	if err != nil {
+		writeError(w, "invalid channel id", http.StatusBadRequest)
 		return
 	}
+	h.list(w, r, &channelID)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, channelID *uuid.UUID) {
+	q := r.URL.Query()
+	f, err := parseFilter(q)
 	if err != nil {
-		writeError(w, "internal server error", http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	f.ChannelID = channelID
 
-	url, err := h.storage.GetPresignedURL(r.Context(), storageKey)
+	page, err := h.service.List(r.Context(), middleware.GetUserID(r.Context()), f, q.Get("cursor"))
 	if err != nil {
-		writeError(w, "internal server error", http.StatusInternalServerError)
+		handleServiceError(w, err)
 		return
 	}
 
-	http.Redirect(w, r, url, http.StatusFound)
+	writeJSON(w, page, http.StatusOK)
+}
+
+// CreateUpload starts a direct-to-storage upload into the channel.
+func (h *Handler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(chi.URLParam(r, "channelID"))
+	if err != nil {
+		writeError(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+
+	var req model.CreateUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.service.CreateUpload(r.Context(), channelID, middleware.GetUserID(r.Context()), req)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, upload, http.StatusCreated)
+}
+
+func (h *Handler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	uploadID, ok := parseUploadID(w, r)
+	if !ok {
+		return
+	}
+	upload, err := h.service.GetUpload(r.Context(), uploadID, middleware.GetUserID(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, upload, http.StatusOK)
+}
+
+// UploadParts returns presigned URLs for parts of a multipart upload.
+func (h *Handler) UploadParts(w http.ResponseWriter, r *http.Request) {
+	uploadID, ok := parseUploadID(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.UploadPartsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parts, err := h.service.PartURLs(r.Context(), uploadID, middleware.GetUserID(r.Context()), req.PartNumbers)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, parts, http.StatusOK)
+}
+
+// CompleteUpload verifies a finished upload and returns its attachment.
+func (h *Handler) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	uploadID, ok := parseUploadID(w, r)
+	if !ok {
+		return
+	}
+	attachment, err := h.service.CompleteUpload(r.Context(), uploadID, middleware.GetUserID(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, attachment, http.StatusCreated)
+}
+
+func (h *Handler) CancelUpload(w http.ResponseWriter, r *http.Request) {
+	uploadID, ok := parseUploadID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.CancelUpload(r.Context(), uploadID, middleware.GetUserID(r.Context())); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseUploadID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	uploadID, err := uuid.Parse(chi.URLParam(r, "uploadID"))
+	if err != nil {
+		writeError(w, "invalid upload id", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return uploadID, true
+}
+
+func parseFilter(q url.Values) (Filter, error) {
+	var f Filter
+	if v := q.Get("user_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return f, errors.New("invalid user_id")
+		}
+		f.UploaderID = &id
+	}
+	if v := q.Get("type"); v != "" {
+		if _, ok := typePatterns[v]; !ok {
+			return f, errors.New("type must be image, video, audio, document or archive")
+		}
+		f.Type = v
+	}
+	f.Query = q.Get("q")
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("from must be an RFC 3339 timestamp")
+		}
+		f.From = &t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("to must be an RFC 3339 timestamp")
+		}
+		f.To = &t
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return f, errors.New("invalid limit")
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
+
+func handleServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		writeError(w, "file not found", http.StatusNotFound)
+	case errors.Is(err, ErrNoThumbnail):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrUploadNotFound):
+		writeError(w, "upload not found", http.StatusNotFound)
+	case errors.Is(err, ErrForbidden):
+		writeError(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, ErrUploadTooLarge):
+		writeError(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrInvalidPart), errors.Is(err, ErrUploadMismatch), errors.Is(err, ErrInvalidCursor):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrUploadIncomplete):
+		writeError(w, err.Error(), http.StatusConflict)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
 }
 
 func writeJSON(w http.ResponseWriter, data interface{}, status int) {
@@ -0,0 +1,309 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var errNoSuchUpload = errors.New("no such multipart upload")
+
+// tempPrefix marks files still being written, which Walk skips.
+const tempPrefix = ".tmp-"
+
+// LocalStorage keeps files in a directory, for installs without an object
+// store. Objects are kept under objects/, their content types under types/,
+// and the parts of multipart uploads under uploads/<upload id>/.
+type LocalStorage struct {
+	dir    string
+	signer *Signer
+}
+
+func NewLocalStorage(dir string, signer *Signer) (*LocalStorage, error) {
+	if dir == "" {
+		return nil, errors.New("storage.local_dir is not set")
+	}
+	for _, tree := range []string{"objects", "types", "uploads"} {
+		if err := os.MkdirAll(filepath.Join(dir, tree), 0o750); err != nil {
+			return nil, fmt.Errorf("create storage directory: %w", err)
+		}
+	}
+	return &LocalStorage{dir: dir, signer: signer}, nil
+}
+
+func (s *LocalStorage) Signer() *Signer {
+	return s.signer
+}
+
+func (s *LocalStorage) Upload(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	if err := s.write(key, reader, contentType); err != nil {
+		return fmt.Errorf("upload file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path("objects", key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+	return f, nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	path, err := s.path("objects", key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat object: %w", err)
+	}
+
+	info := &ObjectInfo{Size: fi.Size(), ContentType: "application/octet-stream"}
+	typePath, _ := s.path("types", key)
+	if b, err := os.ReadFile(typePath); err == nil && len(b) > 0 {
+		info.ContentType = string(b)
+	}
+	return info, nil
+}
+
+func (s *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	info, err := s.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return fmt.Errorf("copy object: %s not found", srcKey)
+	}
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := s.write(dstKey, src, info.ContentType); err != nil {
+		return fmt.Errorf("copy object: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	for _, tree := range []string{"objects", "types"} {
+		path, err := s.path(tree, key)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("delete object: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *LocalStorage) Walk(ctx context.Context, fn func(key string) error) error {
+	root := filepath.Join(s.dir, "objects")
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel))
+	})
+}
+
+func (s *LocalStorage) GetPresignedURL(ctx context.Context, key, contentType, disposition string) (string, error) {
+	params := url.Values{}
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	if disposition != "" {
+		params.Set("response-content-disposition", disposition)
+	}
+	return s.signer.SignedURL("GET", key, params), nil
+}
+
+func (s *LocalStorage) PresignedPutURL(ctx context.Context, key string) (string, error) {
+	return s.signer.SignedURL("PUT", key, nil), nil
+}
+
+func (s *LocalStorage) NewMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	uploadID := uuid.NewString()
+	dir := filepath.Join(s.dir, "uploads", uploadID)
+	if err := os.Mkdir(dir, 0o750); err != nil {
+		return "", fmt.Errorf("start multipart upload: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "content-type"), []byte(contentType), 0o640); err != nil {
+		return "", fmt.Errorf("start multipart upload: %w", err)
+	}
+	return uploadID, nil
+}
+
+func (s *LocalStorage) PresignedPartURL(ctx context.Context, key, uploadID string, partNumber int) (string, error) {
+	params := url.Values{}
+	params.Set("uploadId", uploadID)
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	return s.signer.SignedURL("PUT", key, params), nil
+}
+
+func (s *LocalStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int, reader io.Reader) error {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+	if partNumber < 1 || partNumber > maxParts {
+		return fmt.Errorf("invalid part number %d", partNumber)
+	}
+	if err := writeFile(filepath.Join(dir, partName(partNumber)), reader); err != nil {
+		return fmt.Errorf("upload part: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("list parts: %w", err)
+	}
+
+	var parts []Part
+	for _, e := range entries {
+		n, ok := strings.CutPrefix(e.Name(), "part-")
+		if !ok {
+			continue
+		}
+		number, err := strconv.Atoi(n)
+		if err != nil {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("list parts: %w", err)
+		}
+		parts = append(parts, Part{Number: number, Size: fi.Size()})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+func (s *LocalStorage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+	contentType, err := os.ReadFile(filepath.Join(dir, "content-type"))
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+
+	readers := make([]io.Reader, len(parts))
+	for i, p := range parts {
+		f, err := os.Open(filepath.Join(dir, partName(p.Number)))
+		if err != nil {
+			return fmt.Errorf("complete multipart upload: %w", err)
+		}
+		defer f.Close()
+		readers[i] = f
+	}
+	if err := s.write(key, io.MultiReader(readers...), string(contentType)); err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *LocalStorage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	dir, err := s.uploadDir(uploadID)
+	if errors.Is(err, errNoSuchUpload) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// path returns where key is kept in one of the storage trees. Keys cannot
+// reach outside their tree.
+func (s *LocalStorage) path(tree, key string) (string, error) {
+	p := filepath.FromSlash(key)
+	if !filepath.IsLocal(p) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.dir, tree, p), nil
+}
+
+func (s *LocalStorage) uploadDir(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", errNoSuchUpload
+	}
+	dir := filepath.Join(s.dir, "uploads", uploadID)
+	if _, err := os.Stat(dir); err != nil {
+		return "", errNoSuchUpload
+	}
+	return dir, nil
+}
+
+// write stores an object and its content type.
+func (s *LocalStorage) write(key string, reader io.Reader, contentType string) error {
+	path, err := s.path("objects", key)
+	if err != nil {
+		return err
+	}
+	typePath, _ := s.path("types", key)
+	if err := writeFile(typePath, strings.NewReader(contentType)); err != nil {
+		return err
+	}
+	return writeFile(path, reader)
+}
+
+// writeFile writes path through a temporary file, so readers never see it
+// half written.
+func writeFile(path string, reader io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func partName(number int) string {
+	return fmt.Sprintf("part-%05d", number)
+}
@@ -0,0 +1,359 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// thumbnailSizes are the longest sides, in pixels, of the thumbnails made for
+// each image, smallest first.
+var thumbnailSizes = []int{64, 360, 720}
+
+const (
+	// defaultThumbnailSize is served when a client does not ask for a size.
+	defaultThumbnailSize = 360
+
+	// Images above either limit are stored without thumbnails, to bound the
+	// memory decoding them takes.
+	maxImageSize   = 50 << 20
+	maxImagePixels = 25_000_000
+
+	sniffLength      = 3072
+	thumbnailQuality = 80
+	reencodeQuality  = 90
+)
+
+// processedImage is what processing an uploaded image produced.
+type processedImage struct {
+	width, height int
+	// data replaces the original when metadata had to be removed from it; it
+	// is nil if the original was clean.
+	data       []byte
+	thumbnails map[int][]byte
+}
+
+// sniffContentType detects a file's type from its first bytes.
+func sniffContentType(head []byte) string {
+	return mimetype.Detect(head).String()
+}
+
+// inlineTypes are the types browsers are allowed to display. Every other file
+// is served as an attachment.
+var inlineTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// servedInline reports whether a file of contentType may be displayed rather
+// than downloaded.
+func servedInline(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && inlineTypes[mediaType]
+}
+
+func isProcessableImage(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// thumbnailKey is where a thumbnail of the file at key is stored.
+func thumbnailKey(key string, size int) string {
+	return fmt.Sprintf("%s_thumb%d.jpg", strings.TrimSuffix(key, path.Ext(key)), size)
+}
+
+// objectKeys returns the keys of a stored file and its thumbnails.
+func objectKeys(key string, sizes []int) []string {
+	keys := []string{key}
+	for _, size := range sizes {
+		keys = append(keys, thumbnailKey(key, size))
+	}
+	return keys
+}
+
+// processImage removes EXIF, GPS and text metadata from an image, measures it
+// and renders its thumbnails. A JPEG that relies on its EXIF orientation is
+// re-encoded upright, since the orientation goes with the metadata. It only
+// fails if data is not an image; one too large or broken to decode just gets
+// no thumbnails.
+func processImage(data []byte, contentType string) (*processedImage, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image config: %w", err)
+	}
+
+	out := &processedImage{width: cfg.Width, height: cfg.Height}
+	orientation := 1
+	switch contentType {
+	case "image/jpeg":
+		orientation = jpegOrientation(data)
+		out.data = stripJPEGMetadata(data)
+	case "image/png":
+		out.data = stripPNGMetadata(data)
+	}
+	if orientation >= 5 {
+		out.width, out.height = cfg.Height, cfg.Width
+	}
+
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return out, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return out, nil
+	}
+
+	rgba := flatten(img)
+	if orientation != 1 {
+		rgba = orient(rgba, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: reencodeQuality}); err != nil {
+			return nil, fmt.Errorf("encode image: %w", err)
+		}
+		out.data = buf.Bytes()
+	}
+
+	// Each thumbnail is scaled from the next larger one, which is much
+	// cheaper than scaling every one from the original
+	out.thumbnails = make(map[int][]byte, len(thumbnailSizes))
+	for i := len(thumbnailSizes) - 1; i >= 0; i-- {
+		size := thumbnailSizes[i]
+		rgba = fit(rgba, size)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, fmt.Errorf("encode thumbnail: %w", err)
+		}
+		out.thumbnails[size] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// flatten draws img onto a white background, since thumbnails are JPEGs and
+// have no transparency.
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// fit scales src down so that its longest side is at most size, keeping its
+// aspect ratio. Each pixel is the average of the source pixels it covers.
+func fit(src *image.RGBA, size int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= size && sh <= size {
+		return src
+	}
+	dw, dh := size, size
+	if sw >= sh {
+		dh = max(1, sh*size/sw)
+	} else {
+		dw = max(1, sw*size/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			var r, g, b, a int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					i += 4
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			o := dst.PixOffset(x, y)
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(b / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient transforms src as its EXIF orientation (2-8) says it should be
+// displayed.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x, y
+			switch orientation {
+			case 2: // mirrored
+				dx = w - 1 - x
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				dy = h - 1 - y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// jpegSegments calls fn with each marker segment before the image data,
+// including its marker and length. It returns the offset of the start of
+// scan, or -1 if data is not a well-formed JPEG.
+func jpegSegments(data []byte, fn func(marker byte, segment []byte)) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return -1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return -1
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA {
+			return i
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return -1
+		}
+		fn(marker, data[i:i+2+n])
+		i += 2 + n
+	}
+	return -1
+}
+
+// stripJPEGMetadata drops EXIF/XMP (APP1), IPTC (APP13) and comment segments
+// from a JPEG without re-encoding it. It returns nil if there were none.
+func stripJPEGMetadata(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	stripped := false
+	sos := jpegSegments(data, func(marker byte, segment []byte) {
+		switch marker {
+		case 0xE1, 0xED, 0xFE:
+			stripped = true
+		default:
+			out = append(out, segment...)
+		}
+	})
+	if sos < 0 || !stripped {
+		return nil
+	}
+	return append(out, data[sos:]...)
+}
+
+// jpegOrientation returns a JPEG's EXIF orientation, 1 (upright) if it has
+// none.
+func jpegOrientation(data []byte) int {
+	orientation := 1
+	jpegSegments(data, func(marker byte, segment []byte) {
+		if marker == 0xE1 && len(segment) > 10 && string(segment[4:10]) == "Exif\x00\x00" {
+			if o := exifOrientation(segment[10:]); o != 0 {
+				orientation = o
+			}
+		}
+	})
+	return orientation
+}
+
+// exifOrientation reads the Orientation tag from the first IFD of an EXIF
+// (TIFF) block. It returns 0 if there is none.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNGMetadata drops EXIF, text and timestamp chunks from a PNG. It
+// returns nil if there were none.
+func stripPNGMetadata(data []byte) []byte {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	stripped := false
+	for i := len(pngSignature); i+12 <= len(data); {
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) {
+			return nil
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+			stripped = true
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	if !stripped {
+		return nil
+	}
+	return out
+}
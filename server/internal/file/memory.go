@@ -0,0 +1,211 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStorage keeps files in memory, for tests and throwaway instances.
+// Everything is lost when the process exits.
+type MemoryStorage struct {
+	signer *Signer
+
+	mu      sync.Mutex
+	objects map[string]memoryObject
+	uploads map[string]*memoryUpload
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+}
+
+type memoryUpload struct {
+	key         string
+	contentType string
+	parts       map[int][]byte
+}
+
+// memoryReader lets ObjectHandler serve Range requests from memory.
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error { return nil }
+
+func NewMemoryStorage(signer *Signer) *MemoryStorage {
+	return &MemoryStorage{
+		signer:  signer,
+		objects: make(map[string]memoryObject),
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+func (s *MemoryStorage) Signer() *Signer {
+	return s.signer
+}
+
+func (s *MemoryStorage) Upload(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("upload file: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{data: data, contentType: contentType}
+	return nil
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("get object: %s not found", key)
+	}
+	return memoryReader{bytes.NewReader(obj.data)}, nil
+}
+
+func (s *MemoryStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, nil
+	}
+	return &ObjectInfo{Size: int64(len(obj.data)), ContentType: obj.contentType}, nil
+}
+
+func (s *MemoryStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[srcKey]
+	if !ok {
+		return fmt.Errorf("copy object: %s not found", srcKey)
+	}
+	// Stored data is never modified in place, so the copy can share it
+	s.objects[dstKey] = obj
+	return nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *MemoryStorage) Walk(ctx context.Context, fn func(key string) error) error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetPresignedURL(ctx context.Context, key, contentType, disposition string) (string, error) {
+	params := url.Values{}
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	if disposition != "" {
+		params.Set("response-content-disposition", disposition)
+	}
+	return s.signer.SignedURL("GET", key, params), nil
+}
+
+func (s *MemoryStorage) PresignedPutURL(ctx context.Context, key string) (string, error) {
+	return s.signer.SignedURL("PUT", key, nil), nil
+}
+
+func (s *MemoryStorage) NewMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	uploadID := uuid.NewString()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[uploadID] = &memoryUpload{key: key, contentType: contentType, parts: make(map[int][]byte)}
+	return uploadID, nil
+}
+
+func (s *MemoryStorage) PresignedPartURL(ctx context.Context, key, uploadID string, partNumber int) (string, error) {
+	params := url.Values{}
+	params.Set("uploadId", uploadID)
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	return s.signer.SignedURL("PUT", key, params), nil
+}
+
+func (s *MemoryStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int, reader io.Reader) error {
+	if partNumber < 1 || partNumber > maxParts {
+		return fmt.Errorf("invalid part number %d", partNumber)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("upload part: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[uploadID]
+	if !ok || u.key != key {
+		return errNoSuchUpload
+	}
+	u.parts[partNumber] = data
+	return nil
+}
+
+func (s *MemoryStorage) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[uploadID]
+	if !ok || u.key != key {
+		return nil, errNoSuchUpload
+	}
+	parts := make([]Part, 0, len(u.parts))
+	for number, data := range u.parts {
+		parts = append(parts, Part{Number: number, Size: int64(len(data))})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+func (s *MemoryStorage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[uploadID]
+	if !ok || u.key != key {
+		return errNoSuchUpload
+	}
+	var buf bytes.Buffer
+	for _, p := range parts {
+		data, ok := u.parts[p.Number]
+		if !ok {
+			return fmt.Errorf("complete multipart upload: part %d is missing", p.Number)
+		}
+		buf.Write(data)
+	}
+	s.objects[key] = memoryObject{data: buf.Bytes(), contentType: u.contentType}
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+func (s *MemoryStorage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, uploadID)
+	return nil
+}
@@ -0,0 +1,48 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// CopyObjects copies every object from src to dst, for moving files between
+// storage backends. Objects dst already has with the same size are skipped,
+// so an interrupted copy can be run again. Unfinished multipart uploads are
+// not copied.
+func CopyObjects(ctx context.Context, src, dst Storage) (copied, skipped int, err error) {
+	err = src.Walk(ctx, func(key string) error {
+		info, err := src.Stat(ctx, key)
+		if err != nil {
+			return err
+		}
+		if info == nil {
+			return nil // deleted since the walk began
+		}
+
+		existing, err := dst.Stat(ctx, key)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Size == info.Size {
+			skipped++
+			return nil
+		}
+
+		obj, err := src.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		if err := dst.Upload(ctx, key, obj, info.Size, info.ContentType); err != nil {
+			return fmt.Errorf("copy %s: %w", key, err)
+		}
+
+		copied++
+		if copied%100 == 0 {
+			slog.Info("copying files", "copied", copied, "skipped", skipped)
+		}
+		return nil
+	})
+	return copied, skipped, err
+}
@@ -0,0 +1,121 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// objectTransferTimeout replaces the server's short read and write timeouts
+// while an object is sent or received, since files can be large.
+const objectTransferTimeout = time.Hour
+
+// ObjectHandler serves the signed URLs of a ServedStorage backend. The
+// signature is the only authorization these requests carry.
+type ObjectHandler struct {
+	storage ServedStorage
+	maxSize int64
+}
+
+func NewObjectHandler(storage ServedStorage, maxSize int64) *ObjectHandler {
+	return &ObjectHandler{storage: storage, maxSize: maxSize}
+}
+
+// Get sends an object, honouring Range requests.
+func (h *ObjectHandler) Get(w http.ResponseWriter, r *http.Request) {
+	key, ok := h.verify(w, r)
+	if !ok {
+		return
+	}
+
+	info, err := h.storage.Stat(r.Context(), key)
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if info == nil {
+		writeError(w, "object not found", http.StatusNotFound)
+		return
+	}
+	obj, err := h.storage.Get(r.Context(), key)
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer obj.Close()
+
+	contentType := r.URL.Query().Get("response-content-type")
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	disposition := r.URL.Query().Get("response-content-disposition")
+	if !servedInline(contentType) {
+		contentType = "application/octet-stream"
+		if !strings.HasPrefix(disposition, "attachment") {
+			disposition = "attachment"
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	if disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	extendDeadlines(w)
+
+	if rs, ok := obj.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", time.Time{}, rs)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	io.Copy(w, obj)
+}
+
+// Put receives a whole object, or one part of a multipart upload.
+func (h *ObjectHandler) Put(w http.ResponseWriter, r *http.Request) {
+	key, ok := h.verify(w, r)
+	if !ok {
+		return
+	}
+	extendDeadlines(w)
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxSize)
+
+	var err error
+	if uploadID := r.URL.Query().Get("uploadId"); uploadID != "" {
+		partNumber, _ := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		err = h.storage.UploadPart(r.Context(), key, uploadID, partNumber, r.Body)
+	} else {
+		err = h.storage.Upload(r.Context(), key, r.Body, r.ContentLength, r.Header.Get("Content-Type"))
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.As(err, &tooLarge):
+		writeError(w, "file too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errNoSuchUpload):
+		writeError(w, "upload not found", http.StatusNotFound)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func (h *ObjectHandler) verify(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := strings.TrimPrefix(r.URL.Path, objectPath)
+	if !h.storage.Signer().Verify(r.Method, key, r.URL.Query()) {
+		writeError(w, "invalid or expired signature", http.StatusForbidden)
+		return "", false
+	}
+	return key, true
+}
+
+func extendDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(objectTransferTimeout)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+}
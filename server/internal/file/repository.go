@@ -0,0 +1,334 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/feather-chat/feather/internal/database"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Create(ctx context.Context, a *model.FileAttachment) error {
+	if _, err := r.db.Exec(ctx, insertAttachmentQuery, attachmentValues(a)...); err != nil {
+		return fmt.Errorf("create file attachment: %w", err)
+	}
+	return nil
+}
+
+const insertAttachmentQuery = `
+	INSERT INTO file_attachments (id, channel_id, user_id, filename, content_type, size_bytes,
+		width, height, thumbnail_sizes, storage_key, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+`
+
+func attachmentValues(a *model.FileAttachment) []interface{} {
+	sizes := a.ThumbnailSizes
+	if sizes == nil {
+		sizes = []int{}
+	}
+	return []interface{}{
+		a.ID, a.ChannelID, a.UserID, a.Filename, a.ContentType, a.SizeBytes,
+		a.Width, a.Height, sizes, a.StorageKey, a.CreatedAt,
+	}
+}
+
+func (r *Repository) GetByID(ctx context.Context, id uuid.UUID) (*model.FileAttachment, error) {
+	query := `
+		SELECT id, message_id, channel_id, user_id, filename, content_type, size_bytes,
+			width, height, thumbnail_sizes, storage_key, created_at
+		FROM file_attachments WHERE id = $1
+	`
+	var a model.FileAttachment
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&a.ID, &a.MessageID, &a.ChannelID, &a.UserID, &a.Filename, &a.ContentType, &a.SizeBytes,
+		&a.Width, &a.Height, &a.ThumbnailSizes, &a.StorageKey, &a.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get file attachment: %w", err)
+	}
+	return &a, nil
+}
+
+// Filter narrows a file listing. Zero values match everything. Results are
+// ordered newest first; After continues from a previous page.
+type Filter struct {
+	ChannelID  *uuid.UUID
+	UploaderID *uuid.UUID
+	Type       string // a key of typePatterns
+	Query      string // part of the filename, case-insensitive
+	From       *time.Time
+	To         *time.Time
+	After      *pageKey
+	Limit      int
+}
+
+// pageKey is the position of the last file on a page.
+type pageKey struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// typePatterns are the content types, as LIKE patterns, of each file type
+// listings can be filtered by.
+var typePatterns = map[string][]string{
+	"image": {"image/%"},
+	"video": {"video/%"},
+	"audio": {"audio/%"},
+	"document": {
+		"text/%", "application/pdf", "application/rtf", "application/msword", "application/vnd.ms-%",
+		"application/vnd.openxmlformats-officedocument.%", "application/vnd.oasis.opendocument.%",
+	},
+	"archive": {
+		"application/zip", "application/gzip", "application/x-tar", "application/x-bzip2", "application/x-xz",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/vnd.rar",
+	},
+}
+
+// List returns files attached to messages in channels the user is a member
+// of, up to f.Limit of them.
+func (r *Repository) List(ctx context.Context, userID uuid.UUID, f Filter) ([]model.FileAttachment, error) {
+	args := []interface{}{userID}
+	conds := []string{
+		"fa.channel_id IN (SELECT cm.channel_id FROM channel_members cm WHERE cm.user_id = $1)",
+		"m.deleted_at IS NULL",
+	}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.ChannelID != nil {
+		add("fa.channel_id = $%d", *f.ChannelID)
+	}
+	if f.UploaderID != nil {
+		add("fa.user_id = $%d", *f.UploaderID)
+	}
+	if f.Type != "" {
+		add("fa.content_type LIKE ANY($%d)", typePatterns[f.Type])
+	}
+	if f.Query != "" {
+		add("fa.filename ILIKE $%d", "%"+database.EscapeLike(f.Query)+"%")
+	}
+	if f.From != nil {
+		add("fa.created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("fa.created_at < $%d", *f.To)
+	}
+	if f.After != nil {
+		args = append(args, f.After.CreatedAt, f.After.ID)
+		conds = append(conds, fmt.Sprintf("(fa.created_at, fa.id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, f.Limit)
+
+	query := fmt.Sprintf(`
+		SELECT fa.id, fa.message_id, fa.channel_id, fa.user_id, fa.filename, fa.content_type, fa.size_bytes,
+			fa.width, fa.height, fa.thumbnail_sizes, fa.created_at
+		FROM file_attachments fa
+		JOIN messages m ON m.id = fa.message_id
+		WHERE %s
+		ORDER BY fa.created_at DESC, fa.id DESC
+		LIMIT $%d
+	`, strings.Join(conds, " AND "), len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []model.FileAttachment
+	for rows.Next() {
+		var a model.FileAttachment
+		if err := rows.Scan(
+			&a.ID, &a.MessageID, &a.ChannelID, &a.UserID, &a.Filename, &a.ContentType, &a.SizeBytes,
+			&a.Width, &a.Height, &a.ThumbnailSizes, &a.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan file: %w", err)
+		}
+		a.SetThumbnailURL()
+		files = append(files, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate files: %w", err)
+	}
+	return files, nil
+}
+
+// DeleteByMessage deletes a message's attachments and returns the storage
+// keys of the files and their thumbnails.
+func (r *Repository) DeleteByMessage(ctx context.Context, messageID uuid.UUID) ([]string, error) {
+	return r.deleteReturningKeys(ctx, "delete message attachments",
+		`DELETE FROM file_attachments WHERE message_id = $1 RETURNING storage_key, thumbnail_sizes`, messageID)
+}
+
+// DeleteUnlinked deletes up to limit attachments uploaded before cutoff that
+// were never linked to a message, and returns the storage keys of the files
+// and their thumbnails.
+func (r *Repository) DeleteUnlinked(ctx context.Context, cutoff time.Time, limit int) ([]string, error) {
+	query := `
+		DELETE FROM file_attachments WHERE id IN (
+			SELECT id FROM file_attachments
+			WHERE message_id IS NULL AND created_at < $1
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING storage_key, thumbnail_sizes
+	`
+	return r.deleteReturningKeys(ctx, "delete unlinked attachments", query, cutoff, limit)
+}
+
+func (r *Repository) deleteReturningKeys(ctx context.Context, op, query string, args ...interface{}) ([]string, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		var sizes []int
+		if err := rows.Scan(&key, &sizes); err != nil {
+			return nil, fmt.Errorf("scan storage key: %w", err)
+		}
+		keys = append(keys, objectKeys(key, sizes)...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return keys, nil
+}
+
+const uploadColumns = `id, channel_id, user_id, filename, content_type, size_bytes, storage_key, multipart_id, part_size, expires_at, created_at`
+
+func scanUpload(row pgx.Row, u *model.FileUpload) error {
+	var multipartID *string
+	err := row.Scan(&u.ID, &u.ChannelID, &u.UserID, &u.Filename, &u.ContentType, &u.SizeBytes, &u.StorageKey,
+		&multipartID, &u.PartSize, &u.ExpiresAt, &u.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if multipartID != nil {
+		u.MultipartID = *multipartID
+		u.Multipart = true
+		u.PartCount = int((u.SizeBytes + u.PartSize - 1) / u.PartSize)
+	}
+	return nil
+}
+
+func (r *Repository) CreateUpload(ctx context.Context, u *model.FileUpload) error {
+	var multipartID *string
+	if u.MultipartID != "" {
+		multipartID = &u.MultipartID
+	}
+	query := `
+		INSERT INTO file_uploads (` + uploadColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err := r.db.Exec(ctx, query,
+		u.ID, u.ChannelID, u.UserID, u.Filename, u.ContentType, u.SizeBytes, u.StorageKey,
+		multipartID, u.PartSize, u.ExpiresAt, u.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create file upload: %w", err)
+	}
+	return nil
+}
+
+// GetUpload returns an unexpired upload, or nil.
+func (r *Repository) GetUpload(ctx context.Context, id uuid.UUID) (*model.FileUpload, error) {
+	query := `SELECT ` + uploadColumns + ` FROM file_uploads WHERE id = $1 AND expires_at > NOW()`
+	var u model.FileUpload
+	err := scanUpload(r.db.QueryRow(ctx, query, id), &u)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get file upload: %w", err)
+	}
+	return &u, nil
+}
+
+// CompleteUpload replaces a finished upload with its attachment. It returns
+// false if the upload was already completed or cancelled.
+func (r *Repository) CompleteUpload(ctx context.Context, uploadID uuid.UUID, a *model.FileAttachment) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM file_uploads WHERE id = $1`, uploadID)
+	if err != nil {
+		return false, fmt.Errorf("delete file upload: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, insertAttachmentQuery, attachmentValues(a)...); err != nil {
+		return false, fmt.Errorf("create file attachment: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit tx: %w", err)
+	}
+	return true, nil
+}
+
+func (r *Repository) DeleteUpload(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM file_uploads WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("delete file upload: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredUploads deletes up to limit expired uploads and returns them.
+func (r *Repository) DeleteExpiredUploads(ctx context.Context, limit int) ([]model.FileUpload, error) {
+	query := `
+		DELETE FROM file_uploads WHERE id IN (
+			SELECT id FROM file_uploads
+			WHERE expires_at <= NOW()
+			ORDER BY expires_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + uploadColumns
+	rows, err := r.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("delete expired uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var uploads []model.FileUpload
+	for rows.Next() {
+		var u model.FileUpload
+		if err := scanUpload(rows, &u); err != nil {
+			return nil, fmt.Errorf("scan file upload: %w", err)
+		}
+		uploads = append(uploads, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("delete expired uploads: %w", err)
+	}
+	return uploads, nil
+}
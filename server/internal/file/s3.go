@@ -0,0 +1,187 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage keeps files in a bucket on MinIO or another S3-compatible
+// store, which serves presigned URLs itself.
+type S3Storage struct {
+	client *minio.Client
+	core   *minio.Core
+	bucket string
+}
+
+func NewS3Storage(endpoint, accessKey, secretKey string, useSSL bool, bucket string) (*S3Storage, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create minio client: %w", err)
+	}
+
+	return &S3Storage{client: client, core: &minio.Core{Client: client}, bucket: bucket}, nil
+}
+
+func (s *S3Storage) EnsureBucket(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("check bucket: %w", err)
+	}
+	if !exists {
+		if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{}); err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *S3Storage) Upload(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, reader, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("upload file: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+	return obj, nil
+}
+
+func (s *S3Storage) GetPresignedURL(ctx context.Context, key, contentType, disposition string) (string, error) {
+	params := url.Values{}
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+	if disposition != "" {
+		params.Set("response-content-disposition", disposition)
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, presignExpiry, params)
+	if err != nil {
+		return "", fmt.Errorf("get presigned url: %w", err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3Storage) PresignedPutURL(ctx context.Context, key string) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, key, presignExpiry)
+	if err != nil {
+		return "", fmt.Errorf("presign put: %w", err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat object: %w", err)
+	}
+	return &ObjectInfo{Size: info.Size, ContentType: info.ContentType}, nil
+}
+
+func (s *S3Storage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	info, err := s.client.StatObject(ctx, s.bucket, srcKey, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("stat object: %w", err)
+	}
+	// Objects over 5GiB are copied in parts, which drops the content type
+	// unless it is set again
+	_, err = s.client.ComposeObject(ctx, minio.CopyDestOptions{
+		Bucket:          s.bucket,
+		Object:          dstKey,
+		ReplaceMetadata: true,
+		UserMetadata:    map[string]string{"Content-Type": info.ContentType},
+	}, minio.CopySrcOptions{Bucket: s.bucket, Object: srcKey})
+	if err != nil {
+		return fmt.Errorf("copy object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) NewMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	uploadID, err := s.core.NewMultipartUpload(ctx, s.bucket, key, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", fmt.Errorf("start multipart upload: %w", err)
+	}
+	return uploadID, nil
+}
+
+func (s *S3Storage) PresignedPartURL(ctx context.Context, key, uploadID string, partNumber int) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	params.Set("uploadId", uploadID)
+	u, err := s.client.Presign(ctx, "PUT", s.bucket, key, presignExpiry, params)
+	if err != nil {
+		return "", fmt.Errorf("presign part: %w", err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3Storage) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	var parts []Part
+	marker := 0
+	for {
+		result, err := s.core.ListObjectParts(ctx, s.bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, fmt.Errorf("list parts: %w", err)
+		}
+		for _, p := range result.ObjectParts {
+			parts = append(parts, Part{Number: p.PartNumber, Size: p.Size, ETag: p.ETag})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (s *S3Storage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	complete := make([]minio.CompletePart, len(parts))
+	for i, p := range parts {
+		complete[i] = minio.CompletePart{PartNumber: p.Number, ETag: p.ETag}
+	}
+	if _, err := s.core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, complete, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	return s.core.AbortMultipartUpload(ctx, s.bucket, key, uploadID)
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) Walk(ctx context.Context, fn func(key string) error) error {
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return fmt.Errorf("list objects: %w", obj.Err)
+		}
+		if err := fn(obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
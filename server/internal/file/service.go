@@ -0,0 +1,601 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/config"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+var (
+	ErrFileNotFound     = errors.New("file not found")
+	ErrNoThumbnail      = errors.New("file has no thumbnail")
+	ErrForbidden        = errors.New("forbidden")
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadTooLarge   = errors.New("file too large")
+	ErrInvalidPart      = errors.New("invalid part number")
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+	ErrUploadMismatch   = errors.New("uploaded file does not match the declared size or content type")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+)
+
+const (
+	cleanupInterval  = 15 * time.Minute
+	cleanupBatchSize = 100
+
+	// uploadTTL is how long a direct upload can take before it is discarded.
+	uploadTTL = 24 * time.Hour
+	// Files larger than minPartSize are uploaded in parts of at least that
+	// size, and no more than maxParts of them (the S3 limits are 5 MiB and
+	// 10,000).
+	minPartSize = 16 << 20
+	maxParts    = 10000
+
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// MemberChecker checks whether a user is a member of a channel.
+type MemberChecker interface {
+	IsMember(ctx context.Context, channelID, userID uuid.UUID) (bool, error)
+}
+
+// Page is one page of a file listing. NextCursor is empty on the last page.
+type Page struct {
+	Files      []model.FileAttachment `json:"files"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+type Service struct {
+	repo    *Repository
+	storage Storage
+	members MemberChecker
+	cfg     config.UploadConfig
+}
+
+func NewService(repo *Repository, storage Storage, members MemberChecker, cfg config.UploadConfig) *Service {
+	return &Service{repo: repo, storage: storage, members: members, cfg: cfg}
+}
+
+// Upload stores a file in a channel the user is a member of. It stays
+// unlinked until a message attaches it.
+func (s *Service) Upload(ctx context.Context, channelID, userID uuid.UUID, filename, contentType string, size int64, body io.Reader) (*model.FileAttachment, error) {
+	if err := s.checkMember(ctx, channelID, userID); err != nil {
+		return nil, err
+	}
+
+	a := &model.FileAttachment{
+		ID:          uuid.New(),
+		ChannelID:   channelID,
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		SizeBytes:   size,
+		CreatedAt:   time.Now(),
+	}
+	a.StorageKey = storageKey(channelID, a.ID, filename)
+
+	if err := s.storage.Upload(ctx, a.StorageKey, body, size, contentType); err != nil {
+		return nil, err
+	}
+	if err := s.processMedia(ctx, a); err != nil {
+		s.deleteObjects(ctx, objectKeys(a.StorageKey, a.ThumbnailSizes))
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, a); err != nil {
+		s.deleteObjects(ctx, objectKeys(a.StorageKey, a.ThumbnailSizes))
+		return nil, err
+	}
+	return a, nil
+}
+
+// DownloadURL returns a short-lived URL for a file in a channel the user is a
+// member of. Unlinked files can only be downloaded by their uploader.
+func (s *Service) DownloadURL(ctx context.Context, fileID, userID uuid.UUID) (string, error) {
+	a, err := s.getAccessible(ctx, fileID, userID)
+	if err != nil {
+		return "", err
+	}
+	if servedInline(a.ContentType) {
+		return s.storage.GetPresignedURL(ctx, a.StorageKey, a.ContentType, "")
+	}
+	// Anything else could be HTML or SVG that runs script on the storage
+	// origin, so it is only ever downloaded.
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	return s.storage.GetPresignedURL(ctx, a.StorageKey, "application/octet-stream", disposition)
+}
+
+// ThumbnailURL returns a short-lived URL for the smallest thumbnail of a file
+// that is at least size pixels on its longest side, or its largest one.
+func (s *Service) ThumbnailURL(ctx context.Context, fileID, userID uuid.UUID, size int) (string, error) {
+	a, err := s.getAccessible(ctx, fileID, userID)
+	if err != nil {
+		return "", err
+	}
+	if len(a.ThumbnailSizes) == 0 {
+		return "", ErrNoThumbnail
+	}
+
+	chosen := a.ThumbnailSizes[len(a.ThumbnailSizes)-1]
+	for _, ts := range a.ThumbnailSizes {
+		if ts >= size {
+			chosen = ts
+			break
+		}
+	}
+	return s.storage.GetPresignedURL(ctx, thumbnailKey(a.StorageKey, chosen), "image/jpeg", "")
+}
+
+// List returns a page of the files posted in channels the user is a member
+// of, starting after cursor. Listing one channel requires membership in it.
+func (s *Service) List(ctx context.Context, userID uuid.UUID, f Filter, cursor string) (*Page, error) {
+	if f.ChannelID != nil {
+		if err := s.checkMember(ctx, *f.ChannelID, userID); err != nil {
+			return nil, err
+		}
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultPageSize
+	}
+	if f.Limit > maxPageSize {
+		f.Limit = maxPageSize
+	}
+	if cursor != "" {
+		key, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		f.After = key
+	}
+
+	// Fetch one extra file to learn whether another page exists
+	pageSize := f.Limit
+	f.Limit++
+	files, err := s.repo.List(ctx, userID, f)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Files: files}
+	if len(files) > pageSize {
+		page.Files = files[:pageSize]
+		last := page.Files[pageSize-1]
+		page.NextCursor = encodeCursor(pageKey{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	if page.Files == nil {
+		page.Files = []model.FileAttachment{}
+	}
+	return page, nil
+}
+
+// getAccessible returns a file the user can download.
+func (s *Service) getAccessible(ctx context.Context, fileID, userID uuid.UUID) (*model.FileAttachment, error) {
+	a, err := s.repo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil || (a.MessageID == nil && a.UserID != userID) {
+		return nil, ErrFileNotFound
+	}
+	if err := s.checkMember(ctx, a.ChannelID, userID); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// processMedia replaces a stored file's declared content type with the one
+// sniffed from its contents. Images are also measured, stripped of their
+// metadata in place, and get thumbnails stored next to them.
+func (s *Service) processMedia(ctx context.Context, a *model.FileAttachment) error {
+	obj, err := s.storage.Get(ctx, a.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(obj, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("read stored file: %w", err)
+	}
+	head = head[:n]
+	a.ContentType = sniffContentType(head)
+	if !isProcessableImage(a.ContentType) || a.SizeBytes > maxImageSize {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.MultiReader(bytes.NewReader(head), obj))
+	if err != nil {
+		return fmt.Errorf("read stored file: %w", err)
+	}
+	img, err := processImage(data, a.ContentType)
+	if err != nil {
+		slog.Warn("failed to process image", "file_id", a.ID, "error", err)
+		return nil
+	}
+
+	a.Width, a.Height = &img.width, &img.height
+	if img.data != nil {
+		if err := s.storage.Upload(ctx, a.StorageKey, bytes.NewReader(img.data), int64(len(img.data)), a.ContentType); err != nil {
+			return err
+		}
+		a.SizeBytes = int64(len(img.data))
+	}
+	for _, size := range thumbnailSizes {
+		thumb, ok := img.thumbnails[size]
+		if !ok {
+			continue
+		}
+		if err := s.storage.Upload(ctx, thumbnailKey(a.StorageKey, size), bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+			return err
+		}
+		a.ThumbnailSizes = append(a.ThumbnailSizes, size)
+	}
+	a.SetThumbnailURL()
+	return nil
+}
+
+// CreateUpload starts a direct-to-storage upload into a channel the user is
+// a member of. The client sends the file to the returned URL, or part by part
+// for a multipart upload, then calls CompleteUpload.
+func (s *Service) CreateUpload(ctx context.Context, channelID, userID uuid.UUID, req model.CreateUploadRequest) (*model.FileUpload, error) {
+	if err := s.checkMember(ctx, channelID, userID); err != nil {
+		return nil, err
+	}
+	if req.SizeBytes > s.cfg.MaxDirectSize {
+		return nil, ErrUploadTooLarge
+	}
+
+	now := time.Now()
+	u := &model.FileUpload{
+		ID:          uuid.New(),
+		ChannelID:   channelID,
+		UserID:      userID,
+		Filename:    req.Filename,
+		ContentType: req.ContentType,
+		SizeBytes:   req.SizeBytes,
+		ExpiresAt:   now.Add(uploadTTL),
+		CreatedAt:   now,
+	}
+	u.StorageKey = storageKey(channelID, u.ID, req.Filename)
+
+	if req.SizeBytes > minPartSize {
+		multipartID, err := s.storage.NewMultipartUpload(ctx, stagingKey(u.ID), req.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		u.MultipartID = multipartID
+		u.Multipart = true
+		u.PartSize = partSize(req.SizeBytes)
+		u.PartCount = int((req.SizeBytes + u.PartSize - 1) / u.PartSize)
+	}
+
+	if err := s.repo.CreateUpload(ctx, u); err != nil {
+		s.discardUpload(ctx, u)
+		return nil, err
+	}
+	if !u.Multipart {
+		if err := s.presignPut(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// GetUpload returns the state of one of the user's uploads so it can be
+// resumed: a fresh URL for a single-part upload, or the parts uploaded so far.
+func (s *Service) GetUpload(ctx context.Context, uploadID, userID uuid.UUID) (*model.FileUpload, error) {
+	u, err := s.getUpload(ctx, uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.Multipart {
+		return u, s.presignPut(ctx, u)
+	}
+
+	parts, err := s.storage.ListParts(ctx, stagingKey(u.ID), u.MultipartID)
+	if err != nil {
+		return nil, err
+	}
+	u.UploadedParts = make([]model.UploadPart, len(parts))
+	for i, p := range parts {
+		u.UploadedParts[i] = model.UploadPart{PartNumber: p.Number, Size: p.Size}
+	}
+	return u, nil
+}
+
+// PartURLs presigns PUT URLs for parts of one of the user's multipart uploads.
+func (s *Service) PartURLs(ctx context.Context, uploadID, userID uuid.UUID, partNumbers []int) ([]model.UploadPart, error) {
+	u, err := s.getUpload(ctx, uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.Multipart {
+		return nil, ErrInvalidPart
+	}
+
+	parts := make([]model.UploadPart, len(partNumbers))
+	for i, n := range partNumbers {
+		if n < 1 || n > u.PartCount {
+			return nil, fmt.Errorf("%w: %d", ErrInvalidPart, n)
+		}
+		url, err := s.storage.PresignedPartURL(ctx, stagingKey(u.ID), u.MultipartID, n)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = model.UploadPart{PartNumber: n, URL: url}
+	}
+	return parts, nil
+}
+
+// CompleteUpload finishes one of the user's uploads once every byte is in
+// storage, checks the stored object against what was declared, and creates
+// its attachment. An upload that does not match is discarded.
+//
+// Clients upload to a staging key, and the object is copied from there to the
+// file's key before it is checked. The presigned URLs stay valid after
+// completion, so this keeps them from replacing the file once it is accepted.
+func (s *Service) CompleteUpload(ctx context.Context, uploadID, userID uuid.UUID) (*model.FileAttachment, error) {
+	u, err := s.getUpload(ctx, uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkMember(ctx, u.ChannelID, userID); err != nil {
+		return nil, err
+	}
+
+	staging := stagingKey(u.ID)
+	if u.Multipart {
+		parts, err := s.storage.ListParts(ctx, staging, u.MultipartID)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) != u.PartCount {
+			return nil, ErrUploadIncomplete
+		}
+		if err := s.storage.CompleteMultipartUpload(ctx, staging, u.MultipartID, parts); err != nil {
+			return nil, err
+		}
+		// The parts are gone now; what is left to clean up is the object
+		u.MultipartID = ""
+	}
+
+	staged, err := s.storage.Stat(ctx, staging)
+	if err != nil {
+		return nil, err
+	}
+	if staged == nil {
+		return nil, ErrUploadIncomplete
+	}
+	if err := s.storage.Copy(ctx, staging, u.StorageKey); err != nil {
+		return nil, err
+	}
+	s.deleteObjects(ctx, []string{staging})
+
+	// Checked after the copy, as the staged object can still be replaced
+	info, err := s.storage.Stat(ctx, u.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil || info.Size != u.SizeBytes || info.ContentType != u.ContentType {
+		s.discardUpload(ctx, u)
+		if err := s.repo.DeleteUpload(ctx, u.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrUploadMismatch
+	}
+
+	a := &model.FileAttachment{
+		ID:          u.ID,
+		ChannelID:   u.ChannelID,
+		UserID:      u.UserID,
+		Filename:    u.Filename,
+		ContentType: u.ContentType,
+		SizeBytes:   u.SizeBytes,
+		StorageKey:  u.StorageKey,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.processMedia(ctx, a); err != nil {
+		return nil, err
+	}
+	ok, err := s.repo.CompleteUpload(ctx, u.ID, a)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	return a, nil
+}
+
+// CancelUpload discards one of the user's uploads and anything sent so far.
+func (s *Service) CancelUpload(ctx context.Context, uploadID, userID uuid.UUID) error {
+	u, err := s.getUpload(ctx, uploadID, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteUpload(ctx, u.ID); err != nil {
+		return err
+	}
+	s.discardUpload(ctx, u)
+	return nil
+}
+
+func (s *Service) getUpload(ctx context.Context, uploadID, userID uuid.UUID) (*model.FileUpload, error) {
+	u, err := s.repo.GetUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || u.UserID != userID {
+		return nil, ErrUploadNotFound
+	}
+	return u, nil
+}
+
+func (s *Service) presignPut(ctx context.Context, u *model.FileUpload) error {
+	url, err := s.storage.PresignedPutURL(ctx, stagingKey(u.ID))
+	if err != nil {
+		return err
+	}
+	u.URL = url
+	return nil
+}
+
+// discardUpload removes whatever an abandoned upload left in storage: the
+// staged object or parts, and the file if completing it failed part way.
+func (s *Service) discardUpload(ctx context.Context, u *model.FileUpload) {
+	staging := stagingKey(u.ID)
+	if u.MultipartID != "" {
+		if err := s.storage.AbortMultipartUpload(ctx, staging, u.MultipartID); err != nil {
+			slog.Warn("failed to abort multipart upload", "key", staging, "error", err)
+		}
+	}
+	s.deleteObjects(ctx, append([]string{staging}, objectKeys(u.StorageKey, thumbnailSizes)...))
+}
+
+// DeleteForMessage deletes the files attached to a deleted message.
+func (s *Service) DeleteForMessage(ctx context.Context, messageID uuid.UUID) error {
+	keys, err := s.repo.DeleteByMessage(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	s.deleteObjects(ctx, keys)
+	return nil
+}
+
+// RunCleanupWorker discards expired direct uploads and, if the unlinked TTL
+// is set, deletes files that were never attached to a message within it,
+// until ctx is cancelled.
+func (s *Service) RunCleanupWorker(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.deleteExpiredUploads(ctx)
+			if s.cfg.UnlinkedTTL > 0 {
+				s.deleteUnlinked(ctx)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Service) deleteExpiredUploads(ctx context.Context) {
+	for {
+		uploads, err := s.repo.DeleteExpiredUploads(ctx, cleanupBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("failed to delete expired uploads", "error", err)
+			}
+			return
+		}
+		for i := range uploads {
+			s.discardUpload(ctx, &uploads[i])
+		}
+		if len(uploads) < cleanupBatchSize {
+			return
+		}
+	}
+}
+
+func (s *Service) deleteUnlinked(ctx context.Context) {
+	cutoff := time.Now().Add(-s.cfg.UnlinkedTTL)
+	for {
+		keys, err := s.repo.DeleteUnlinked(ctx, cutoff, cleanupBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("failed to delete unlinked attachments", "error", err)
+			}
+			return
+		}
+		s.deleteObjects(ctx, keys)
+		if len(keys) > 0 {
+			slog.Info("deleted unlinked attachments", "count", len(keys))
+		}
+		if len(keys) < cleanupBatchSize {
+			return
+		}
+	}
+}
+
+// deleteObjects removes files from storage once their rows are gone. A
+// failure only leaves an orphaned object behind, so it is logged and skipped.
+func (s *Service) deleteObjects(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			slog.Warn("failed to delete stored file", "key", key, "error", err)
+		}
+	}
+}
+
+func (s *Service) checkMember(ctx context.Context, channelID, userID uuid.UUID) error {
+	isMember, err := s.members.IsMember(ctx, channelID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func encodeCursor(k pageKey) string {
+	raw := k.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + k.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*pageKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	fileID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &pageKey{CreatedAt: createdAt, ID: fileID}, nil
+}
+
+func storageKey(channelID, fileID uuid.UUID, filename string) string {
+	return fmt.Sprintf("%s/%s%s", channelID, fileID, filepath.Ext(filename))
+}
+
+// stagingKey is where a direct upload is sent before CompleteUpload checks it.
+func stagingKey(uploadID uuid.UUID) string {
+	return "staging/" + uploadID.String()
+}
+
+// partSize picks the part size for a multipart upload of size bytes.
+func partSize(size int64) int64 {
+	ps := int64(minPartSize)
+	if fit := (size + maxParts - 1) / maxParts; fit > ps {
+		ps = fit
+	}
+	return ps
+}
@@ -0,0 +1,65 @@
+package file
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// objectPath is where Feather serves the objects of local and in-memory
+// storage.
+const objectPath = "/api/v1/storage/objects/"
+
+// signedParams are the query parameters a signature covers besides the
+// method, key and expiry.
+var signedParams = []string{"uploadId", "partNumber", "response-content-type", "response-content-disposition"}
+
+// Signer signs and verifies the expiring object URLs Feather serves for
+// backends without an object store of their own.
+type Signer struct {
+	key     []byte
+	baseURL string
+}
+
+// NewSigner signs with a key derived from secret. URLs are relative to
+// baseURL, or to the site the client is on if it is empty.
+func NewSigner(secret, baseURL string) *Signer {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("feather file storage"))
+	return &Signer{key: mac.Sum(nil), baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// SignedURL returns a URL that allows method on the object at key until it
+// expires, with params included in the signature.
+func (s *Signer) SignedURL(method, key string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("expires", strconv.FormatInt(time.Now().Add(presignExpiry).Unix(), 10))
+	params.Set("signature", s.sign(method, key, params))
+	u := url.URL{Path: objectPath + key, RawQuery: params.Encode()}
+	return s.baseURL + u.String()
+}
+
+// Verify reports whether params carry an unexpired signature for method on
+// key.
+func (s *Signer) Verify(method, key string, params url.Values) bool {
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(s.sign(method, key, params)), []byte(params.Get("signature")))
+}
+
+func (s *Signer) sign(method, key string, params url.Values) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(method + "\n" + key + "\n" + params.Get("expires")))
+	for _, name := range signedParams {
+		mac.Write([]byte("\n" + params.Get(name)))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -6,58 +6,107 @@ import (
 	"io"
 	"time"
 
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/feather-chat/feather/internal/config"
 )
 
-type Storage struct {
-	client *minio.Client
-	bucket string
-}
+// presignExpiry is how long presigned download and upload URLs stay valid.
+const presignExpiry = 15 * time.Minute
 
-func NewStorage(endpoint, accessKey, secretKey string, useSSL bool, bucket string) (*Storage, error) {
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: useSSL,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("create minio client: %w", err)
-	}
+// Storage keeps file contents by key. Clients download and upload directly
+// through presigned URLs, either to the store itself or, for backends that
+// implement ServedStorage, to Feather.
+type Storage interface {
+	// Upload stores an object, replacing any with the same key. size is -1
+	// if unknown.
+	Upload(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+	// Get opens a stored object for reading.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat returns an object's size and content type, or nil if it does not
+	// exist.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Copy copies an object within the store, content type included,
+	// replacing any object at dstKey.
+	Copy(ctx context.Context, srcKey, dstKey string) error
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// Walk calls fn with the key of every stored object.
+	Walk(ctx context.Context, fn func(key string) error) error
 
-	return &Storage{client: client, bucket: bucket}, nil
+	// GetPresignedURL returns a download URL. A non-empty contentType or
+	// disposition overrides the Content-Type or Content-Disposition the
+	// object is served with.
+	GetPresignedURL(ctx context.Context, key, contentType, disposition string) (string, error)
+	// PresignedPutURL returns a URL the client can PUT the whole object to.
+	PresignedPutURL(ctx context.Context, key string) (string, error)
+
+	// NewMultipartUpload starts a multipart upload and returns its ID.
+	NewMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	// PresignedPartURL returns a URL the client can PUT one part of a
+	// multipart upload to.
+	PresignedPartURL(ctx context.Context, key, uploadID string, partNumber int) (string, error)
+	// ListParts returns the parts uploaded so far, in part number order.
+	ListParts(ctx context.Context, key, uploadID string) ([]Part, error)
+	// CompleteMultipartUpload assembles the uploaded parts into the object.
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error
+	// AbortMultipartUpload discards a multipart upload and its parts.
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
 }
 
-func (s *Storage) EnsureBucket(ctx context.Context) error {
-	exists, err := s.client.BucketExists(ctx, s.bucket)
-	if err != nil {
-		return fmt.Errorf("check bucket: %w", err)
-	}
-	if !exists {
-		if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{}); err != nil {
-			return fmt.Errorf("create bucket: %w", err)
-		}
-	}
-	return nil
+// ServedStorage is a backend whose presigned URLs point at Feather, which
+// serves them with an ObjectHandler.
+type ServedStorage interface {
+	Storage
+	Signer() *Signer
+	// UploadPart stores one part of a multipart upload.
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, reader io.Reader) error
 }
 
-func (s *Storage) Upload(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
-	_, err := s.client.PutObject(ctx, s.bucket, key, reader, size, minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	if err != nil {
-		return fmt.Errorf("upload file: %w", err)
-	}
-	return nil
+// ObjectInfo is what storage reports about a stored object.
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
 }
 
-func (s *Storage) GetPresignedURL(ctx context.Context, key string) (string, error) {
-	url, err := s.client.PresignedGetObject(ctx, s.bucket, key, 15*time.Minute, nil)
-	if err != nil {
-		return "", fmt.Errorf("get presigned url: %w", err)
-	}
-	return url.String(), nil
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	Number int
+	Size   int64
+	ETag   string
 }
 
-func (s *Storage) Delete(ctx context.Context, key string) error {
-	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+// Storage drivers.
+const (
+	DriverS3     = "s3"
+	DriverLocal  = "local"
+	DriverMemory = "memory"
+)
+
+// NewStorage opens the storage backend for driver. It returns nil without an
+// error for the s3 driver when no endpoint is configured, which disables
+// files.
+func NewStorage(ctx context.Context, driver string, cfg *config.Config) (Storage, error) {
+	switch driver {
+	case DriverS3:
+		if cfg.MinIO.Endpoint == "" {
+			return nil, nil
+		}
+		s, err := NewS3Storage(cfg.MinIO.Endpoint, cfg.MinIO.AccessKey, cfg.MinIO.SecretKey, cfg.MinIO.UseSSL, cfg.MinIO.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.EnsureBucket(ctx); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case DriverLocal:
+		s, err := NewLocalStorage(cfg.Storage.LocalDir, NewSigner(cfg.JWT.Secret, cfg.Storage.PublicURL))
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case DriverMemory:
+		return NewMemoryStorage(NewSigner(cfg.JWT.Secret, cfg.Storage.PublicURL)), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
 }
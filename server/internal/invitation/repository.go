@@ -119,3 +119,12 @@ func (r *Repository) Revoke(ctx context.Context, id uuid.UUID) error {
 	}
 	return nil
 }
+
+func (r *Repository) GetUserName(ctx context.Context, userID uuid.UUID) (string, error) {
+	var name string
+	err := r.db.QueryRow(ctx, `SELECT name FROM users WHERE id = $1`, userID).Scan(&name)
+	if err != nil {
+		return "", fmt.Errorf("get user name: %w", err)
+	}
+	return name, nil
+}
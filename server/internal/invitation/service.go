@@ -5,10 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/feather-chat/feather/internal/audit"
+	"github.com/feather-chat/feather/internal/mailer"
 	"github.com/feather-chat/feather/internal/model"
 )
 
@@ -23,9 +26,16 @@ type AutoJoiner interface {
 	AutoJoinUser(ctx context.Context, userID uuid.UUID) error
 }
 
+// AuditLogger records administrative actions.
+type AuditLogger interface {
+	Log(ctx context.Context, entry audit.Entry)
+}
+
 type Service struct {
 	repo       *Repository
 	autoJoiner AutoJoiner
+	auditLog   AuditLogger
+	mail       mailer.Mailer
 	appURL     string
 }
 
@@ -33,6 +43,16 @@ func NewService(repo *Repository, autoJoiner AutoJoiner, appURL string) *Service
 	return &Service{repo: repo, autoJoiner: autoJoiner, appURL: appURL}
 }
 
+// SetAuditLogger enables audit entries for invitation creation and revocation.
+func (s *Service) SetAuditLogger(al AuditLogger) {
+	s.auditLog = al
+}
+
+// SetMailer enables emailing invitations created for an address.
+func (s *Service) SetMailer(m mailer.Mailer) {
+	s.mail = m
+}
+
 func (s *Service) Create(ctx context.Context, req model.CreateInvitationRequest, inviterID uuid.UUID) (*model.WorkspaceInvitation, error) {
 	token, err := generateToken()
 	if err != nil {
@@ -54,7 +74,14 @@ func (s *Service) Create(ctx context.Context, req model.CreateInvitationRequest,
 		return nil, err
 	}
 
+	s.audit(ctx, audit.ActionInvitationCreated, inviterID, inv)
 	inv.InviteURL = s.buildInviteURL(token)
+
+	if inv.Email != nil && s.mail != nil {
+		if err := s.sendInvitation(ctx, inv); err != nil {
+			slog.Warn("failed to send invitation email", "error", err, "invitation_id", inv.ID)
+		}
+	}
 	return inv, nil
 }
 
@@ -120,7 +147,40 @@ func (s *Service) Revoke(ctx context.Context, id uuid.UUID, userID uuid.UUID, us
 		return ErrForbidden
 	}
 
-	return s.repo.Revoke(ctx, id)
+	if err := s.repo.Revoke(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, audit.ActionInvitationRevoked, userID, inv)
+	return nil
+}
+
+func (s *Service) audit(ctx context.Context, action string, actorID uuid.UUID, inv *model.WorkspaceInvitation) {
+	if s.auditLog == nil {
+		return
+	}
+	metadata := map[string]interface{}{
+		"max_uses":   inv.MaxUses,
+		"expires_at": inv.ExpiresAt,
+	}
+	if inv.Email != nil {
+		metadata["email"] = *inv.Email
+	}
+	s.auditLog.Log(ctx, audit.Entry{
+		UserID:     actorID,
+		Action:     action,
+		EntityType: audit.EntityInvitation,
+		EntityID:   inv.ID,
+		Metadata:   metadata,
+	})
+}
+
+func (s *Service) sendInvitation(ctx context.Context, inv *model.WorkspaceInvitation) error {
+	inviterName, err := s.repo.GetUserName(ctx, inv.InviterID)
+	if err != nil {
+		return err
+	}
+	return s.mail.Send(ctx, mailer.Invitation(*inv.Email, inviterName, inv.InviteURL, inv.ExpiresAt))
 }
 
 func (s *Service) buildInviteURL(token string) string {
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogMailer logs that messages were sent instead of sending them. Bodies carry
+// reset, verification and invitation links, so they are never logged; with a
+// directory set, each message is written there as a .eml file, which is how
+// tests and local development read them.
+type LogMailer struct {
+	dir  string
+	from string
+}
+
+func NewLogMailer(dir, from string) *LogMailer {
+	return &LogMailer{dir: dir, from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.Info("email", "to", msg.To, "subject", msg.Subject)
+	if m.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("create mail dir: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New())
+	if err := os.WriteFile(filepath.Join(m.dir, name), compose(m.from, msg), 0o644); err != nil {
+		return fmt.Errorf("write mail file: %w", err)
+	}
+	return nil
+}
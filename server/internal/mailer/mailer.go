@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/feather-chat/feather/internal/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer for the configured driver: "smtp", or "log" for
+// development, which delivers nothing and only records messages in the log
+// and optionally a directory.
+// Either way sending happens in the background so requests never wait on the
+// mail server.
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("mail: smtp driver requires mail.smtp.host")
+		}
+		return Async(NewSMTPMailer(cfg.SMTP, cfg.From)), nil
+	case "log", "":
+		return Async(NewLogMailer(cfg.Dir, cfg.From)), nil
+	default:
+		return nil, fmt.Errorf("mail: unknown driver %q", cfg.Driver)
+	}
+}
+
+// sendTimeout bounds a background send.
+const sendTimeout = 30 * time.Second
+
+type asyncMailer struct {
+	next Mailer
+}
+
+// Async wraps m so Send returns immediately and delivery failures are logged.
+func Async(m Mailer) Mailer {
+	return &asyncMailer{next: m}
+}
+
+func (a *asyncMailer) Send(ctx context.Context, msg Message) error {
+	// The request context ends with the response; keep its values only
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+		if err := a.next.Send(ctx, msg); err != nil {
+			slog.Error("failed to send email", "error", err, "to", msg.To, "subject", msg.Subject)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+)
+
+// PasswordReset is the email with a link to choose a new password.
+func PasswordReset(to, name, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your Feather password",
+		Body: fmt.Sprintf(`Hi %s,
+
+Someone asked to reset the password for your Feather account. To choose a new
+password, open this link within %s:
+
+%s
+
+If it wasn't you, ignore this email; your password stays the same.
+`, name, formatTTL(ttl), link),
+	}
+}
+
+// EmailVerification is the email confirming a new account's address.
+func EmailVerification(to, name, link string, ttl time.Duration) Message {
+	return Message{
+		To:      to,
+		Subject: "Verify your email for Feather",
+		Body: fmt.Sprintf(`Hi %s,
+
+Confirm this is your email address by opening this link within %s:
+
+%s
+
+If you didn't create a Feather account, ignore this email.
+`, name, formatTTL(ttl), link),
+	}
+}
+
+// Invitation is the email sent for an invitation addressed to someone.
+func Invitation(to, inviterName, link string, expiresAt time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: fmt.Sprintf("%s invited you to Feather", inviterName),
+		Body: fmt.Sprintf(`%s invited you to join their workspace on Feather.
+
+Accept the invitation before %s:
+
+%s
+`, inviterName, expiresAt.UTC().Format("January 2, 2006 15:04 MST"), link),
+	}
+}
+
+func formatTTL(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		days := int(d / (24 * time.Hour))
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	hours := int(d / time.Hour)
+	if hours == 1 {
+		return "1 hour"
+	}
+	if hours > 1 {
+		return fmt.Sprintf("%d hours", hours)
+	}
+	return fmt.Sprintf("%d minutes", int(d/time.Minute))
+}
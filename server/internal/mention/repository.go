@@ -130,9 +130,21 @@ func (r *Repository) GetGroupMemberIDs(ctx context.Context, groupID uuid.UUID) (
 	return ids, rows.Err()
 }
 
-// GetChannelMemberIDs returns all member user IDs for a channel.
+func (r *Repository) IsChannelMember(ctx context.Context, channelID, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM channel_members WHERE channel_id = $1 AND user_id = $2)`,
+		channelID, userID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check channel member: %w", err)
+	}
+	return exists, nil
+}
+
+// GetChannelMemberIDs returns member user IDs for a channel, skipping members who muted it.
 func (r *Repository) GetChannelMemberIDs(ctx context.Context, channelID uuid.UUID) ([]uuid.UUID, error) {
-	rows, err := r.db.Query(ctx, `SELECT user_id FROM channel_members WHERE channel_id = $1`, channelID)
+	rows, err := r.db.Query(ctx, `SELECT user_id FROM channel_members WHERE channel_id = $1 AND is_muted = false`, channelID)
 	if err != nil {
 		return nil, fmt.Errorf("get channel member ids: %w", err)
 	}
@@ -3,6 +3,7 @@ package mention
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"time"
 
@@ -13,15 +14,27 @@ import (
 
 type BroadcastFunc func(channelID uuid.UUID, event model.WebSocketEvent)
 
+// EphemeralSender delivers a message that only one user sees.
+type EphemeralSender interface {
+	SendEphemeral(userID, channelID uuid.UUID, parentID, authorID *uuid.UUID, content string) *model.EphemeralMessage
+}
+
 type Service struct {
 	repo      *Repository
 	broadcast BroadcastFunc
+	ephemeral EphemeralSender
 }
 
 func NewService(repo *Repository, broadcast BroadcastFunc) *Service {
 	return &Service{repo: repo, broadcast: broadcast}
 }
 
+// SetEphemeralSender sets the sender used to tell authors about mentions that
+// won't reach anyone (called after service initialization to break circular deps).
+func (s *Service) SetEphemeralSender(es EphemeralSender) {
+	s.ephemeral = es
+}
+
 // ProcessMentions parses a message for @mentions, resolves them, creates records, and notifies.
 func (s *Service) ProcessMentions(ctx context.Context, msg *model.Message) {
 	parsed := ParseMentions(msg.Content)
@@ -47,6 +60,16 @@ func (s *Service) handleUserOrGroupMention(ctx context.Context, msg *model.Messa
 		return
 	}
 	if user != nil {
+		if user.ID != msg.UserID && s.ephemeral != nil {
+			isMember, err := s.repo.IsChannelMember(ctx, msg.ChannelID, user.ID)
+			if err != nil {
+				slog.Error("mention: failed to check membership", "error", err)
+			} else if !isMember {
+				s.ephemeral.SendEphemeral(msg.UserID, msg.ChannelID, msg.ParentID, nil,
+					fmt.Sprintf("@%s was mentioned but is not in this channel, so they won't be notified.", user.Name))
+			}
+		}
+
 		mn := &model.Mention{
 			ID:              uuid.New(),
 			MessageID:       msg.ID,
@@ -3,6 +3,7 @@ package message
 import (
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 	"strconv"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 
+	"github.com/feather-chat/feather/internal/channel"
 	"github.com/feather-chat/feather/internal/middleware"
 	"github.com/feather-chat/feather/internal/model"
 )
@@ -43,13 +45,20 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 	userRole := middleware.GetUserRole(r.Context())
 
-	msg, err := h.service.Create(r.Context(), channelID, req, userID, userRole)
+	msg, ephemeral, err := h.service.Create(r.Context(), channelID, req, userID, userRole)
 	if err != nil {
 		handleServiceError(w, err)
 		return
 	}
 
-	writeJSON(w, msg, http.StatusCreated)
+	switch {
+	case msg != nil:
+		writeJSON(w, msg, http.StatusCreated)
+	case ephemeral != nil:
+		writeJSON(w, ephemeral, http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
 
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
@@ -151,6 +160,58 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *Handler) Pin(w http.ResponseWriter, r *http.Request) {
+	h.setPinned(w, r, true)
+}
+
+func (h *Handler) Unpin(w http.ResponseWriter, r *http.Request) {
+	h.setPinned(w, r, false)
+}
+
+func (h *Handler) setPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	channelID, err := uuid.Parse(chi.URLParam(r, "channelID"))
+	if err != nil {
+		writeError(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		writeError(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+
+	msg, err := h.service.SetPinned(r.Context(), channelID, messageID, pinned, userID, userRole)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, msg, http.StatusOK)
+}
+
+func (h *Handler) ListPinned(w http.ResponseWriter, r *http.Request) {
+	channelID, err := uuid.Parse(chi.URLParam(r, "channelID"))
+	if err != nil {
+		writeError(w, "invalid channel id", http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	messages, err := h.service.ListPinned(r.Context(), channelID, userID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if messages == nil {
+		messages = []model.Message{}
+	}
+	writeJSON(w, messages, http.StatusOK)
+}
+
 func (h *Handler) GetThread(w http.ResponseWriter, r *http.Request) {
 	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
 	if err != nil {
@@ -174,12 +235,26 @@ func handleServiceError(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, ErrMessageNotFound):
 		writeError(w, "message not found", http.StatusNotFound)
+	case errors.Is(err, channel.ErrChannelNotFound):
+		writeError(w, "channel not found", http.StatusNotFound)
 	case errors.Is(err, ErrForbidden):
 		writeError(w, "forbidden", http.StatusForbidden)
 	case errors.Is(err, ErrEditExpired):
 		writeError(w, "edit window expired (24h)", http.StatusForbidden)
 	case errors.Is(err, ErrReadonly):
 		writeError(w, "channel is read-only", http.StatusForbidden)
+	case errors.Is(err, ErrAdminsOnly):
+		writeError(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrThreadsOnly):
+		writeError(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrTooManyAttachments), errors.Is(err, ErrInvalidAttachment):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrSlowMode):
+		var slow *SlowModeError
+		if errors.As(err, &slow) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(slow.RetryAfter.Seconds()))))
+		}
+		writeError(w, err.Error(), http.StatusTooManyRequests)
 	default:
 		writeError(w, "internal server error", http.StatusInternalServerError)
 	}
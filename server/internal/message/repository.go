@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/feather-chat/feather/internal/model"
@@ -21,11 +23,20 @@ func NewRepository(db *pgxpool.Pool) *Repository {
 }
 
 func (r *Repository) Create(ctx context.Context, msg *model.Message) error {
+	return insertMessage(ctx, r.db, msg)
+}
+
+// execer is satisfied by both the pool and a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+func insertMessage(ctx context.Context, db execer, msg *model.Message) error {
 	query := `
 		INSERT INTO messages (id, channel_id, user_id, parent_id, content, is_alert, alert_severity, alert_metadata, created_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err := r.db.Exec(ctx, query,
+	_, err := db.Exec(ctx, query,
 		msg.ID, msg.ChannelID, msg.UserID, msg.ParentID,
 		msg.Content, msg.IsAlert, msg.AlertSeverity, msg.AlertMetadata, msg.CreatedAt,
 	)
@@ -39,7 +50,7 @@ func (r *Repository) GetByID(ctx context.Context, id uuid.UUID) (*model.Message,
 	query := `
 		SELECT m.id, m.channel_id, m.user_id, m.parent_id, m.content,
 			   m.is_alert, m.alert_severity, m.alert_metadata,
-			   m.edited_at, m.deleted_at, m.created_at,
+			   m.edited_at, m.deleted_at, m.created_at, m.pinned_at, m.pinned_by,
 			   u.id, u.email, u.name, u.avatar_url, u.role, u.is_active, u.created_at, u.updated_at,
 			   (SELECT COUNT(*) FROM messages r WHERE r.parent_id = m.id AND r.deleted_at IS NULL) as reply_count
 		FROM messages m
@@ -68,7 +79,7 @@ func (r *Repository) List(ctx context.Context, params model.MessageListParams) (
 		query = `
 			SELECT m.id, m.channel_id, m.user_id, m.parent_id, m.content,
 				   m.is_alert, m.alert_severity, m.alert_metadata,
-				   m.edited_at, m.deleted_at, m.created_at,
+				   m.edited_at, m.deleted_at, m.created_at, m.pinned_at, m.pinned_by,
 				   u.id, u.email, u.name, u.avatar_url, u.role, u.is_active, u.created_at, u.updated_at,
 				   (SELECT COUNT(*) FROM messages r WHERE r.parent_id = m.id AND r.deleted_at IS NULL) as reply_count
 			FROM messages m
@@ -83,7 +94,7 @@ func (r *Repository) List(ctx context.Context, params model.MessageListParams) (
 		query = `
 			SELECT m.id, m.channel_id, m.user_id, m.parent_id, m.content,
 				   m.is_alert, m.alert_severity, m.alert_metadata,
-				   m.edited_at, m.deleted_at, m.created_at,
+				   m.edited_at, m.deleted_at, m.created_at, m.pinned_at, m.pinned_by,
 				   u.id, u.email, u.name, u.avatar_url, u.role, u.is_active, u.created_at, u.updated_at,
 				   (SELECT COUNT(*) FROM messages r WHERE r.parent_id = m.id AND r.deleted_at IS NULL) as reply_count
 			FROM messages m
@@ -120,7 +131,7 @@ func (r *Repository) GetThread(ctx context.Context, parentID uuid.UUID) ([]model
 	query := `
 		SELECT m.id, m.channel_id, m.user_id, m.parent_id, m.content,
 			   m.is_alert, m.alert_severity, m.alert_metadata,
-			   m.edited_at, m.deleted_at, m.created_at,
+			   m.edited_at, m.deleted_at, m.created_at, m.pinned_at, m.pinned_by,
 			   u.id, u.email, u.name, u.avatar_url, u.role, u.is_active, u.created_at, u.updated_at,
 			   0 as reply_count
 		FROM messages m
@@ -167,6 +178,67 @@ func (r *Repository) SoftDelete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// LastPostedAt returns when the user last posted in the channel, including
+// messages they have since deleted, or nil if they never have.
+func (r *Repository) LastPostedAt(ctx context.Context, channelID, userID uuid.UUID) (*time.Time, error) {
+	var last *time.Time
+	err := r.db.QueryRow(ctx,
+		"SELECT MAX(created_at) FROM messages WHERE channel_id = $1 AND user_id = $2",
+		channelID, userID,
+	).Scan(&last)
+	if err != nil {
+		return nil, fmt.Errorf("get last posted: %w", err)
+	}
+	return last, nil
+}
+
+// SetPinned pins the message when pinnedBy is non-nil and unpins it otherwise.
+func (r *Repository) SetPinned(ctx context.Context, id uuid.UUID, pinnedBy *uuid.UUID) error {
+	query := `
+		UPDATE messages
+		SET pinned_at = CASE WHEN $2::uuid IS NULL THEN NULL ELSE NOW() END, pinned_by = $2
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, pinnedBy)
+	if err != nil {
+		return fmt.Errorf("set pinned: %w", err)
+	}
+	return nil
+}
+
+// ListPinned returns a channel's pinned messages, most recently pinned first.
+func (r *Repository) ListPinned(ctx context.Context, channelID uuid.UUID) ([]model.Message, error) {
+	query := `
+		SELECT m.id, m.channel_id, m.user_id, m.parent_id, m.content,
+			   m.is_alert, m.alert_severity, m.alert_metadata,
+			   m.edited_at, m.deleted_at, m.created_at, m.pinned_at, m.pinned_by,
+			   u.id, u.email, u.name, u.avatar_url, u.role, u.is_active, u.created_at, u.updated_at,
+			   (SELECT COUNT(*) FROM messages r WHERE r.parent_id = m.id AND r.deleted_at IS NULL) as reply_count
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.channel_id = $1 AND m.pinned_at IS NOT NULL AND m.deleted_at IS NULL
+		ORDER BY m.pinned_at DESC
+	`
+	rows, err := r.db.Query(ctx, query, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("list pinned: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []model.Message
+	for rows.Next() {
+		msg, err := r.scanMessageRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		messages = append(messages, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate pinned: %w", err)
+	}
+	return messages, nil
+}
+
 func (r *Repository) GetReactions(ctx context.Context, messageID uuid.UUID) ([]model.ReactionGroup, error) {
 	query := `
 		SELECT emoji, COUNT(*) as count, array_agg(user_id) as users
@@ -228,23 +300,42 @@ func (r *Repository) GetReactionsForMessages(ctx context.Context, messageIDs []u
 	return result, nil
 }
 
-// LinkAttachments sets message_id on the given file attachment IDs.
-func (r *Repository) LinkAttachments(ctx context.Context, messageID uuid.UUID, attachmentIDs []uuid.UUID) error {
-	if len(attachmentIDs) == 0 {
-		return nil
+// CreateWithAttachments inserts a message and links the given attachments to
+// it in one transaction. Only unlinked attachments uploaded to the message's
+// channel by its author can be linked; if any of attachmentIDs is not one,
+// nothing is written and ErrInvalidAttachment is returned.
+func (r *Repository) CreateWithAttachments(ctx context.Context, msg *model.Message, attachmentIDs []uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
 	}
-	query := `UPDATE file_attachments SET message_id = $1 WHERE id = ANY($2) AND message_id IS NULL`
-	_, err := r.db.Exec(ctx, query, messageID, attachmentIDs)
+	defer tx.Rollback(ctx)
+
+	if err := insertMessage(ctx, tx, msg); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE file_attachments SET message_id = $1
+		WHERE id = ANY($2) AND message_id IS NULL AND channel_id = $3 AND user_id = $4
+	`, msg.ID, attachmentIDs, msg.ChannelID, msg.UserID)
 	if err != nil {
 		return fmt.Errorf("link attachments: %w", err)
 	}
+	if tag.RowsAffected() != int64(len(attachmentIDs)) {
+		return ErrInvalidAttachment
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
 	return nil
 }
 
 // GetAttachmentsByMessageID returns attachments for a single message.
 func (r *Repository) GetAttachmentsByMessageID(ctx context.Context, messageID uuid.UUID) ([]model.FileAttachment, error) {
 	query := `
-		SELECT id, message_id, channel_id, user_id, filename, content_type, size_bytes, created_at
+		SELECT id, message_id, channel_id, user_id, filename, content_type, size_bytes, width, height, thumbnail_sizes, created_at
 		FROM file_attachments WHERE message_id = $1
 		ORDER BY created_at ASC
 	`
@@ -257,9 +348,11 @@ func (r *Repository) GetAttachmentsByMessageID(ctx context.Context, messageID uu
 	var attachments []model.FileAttachment
 	for rows.Next() {
 		var a model.FileAttachment
-		if err := rows.Scan(&a.ID, &a.MessageID, &a.ChannelID, &a.UserID, &a.Filename, &a.ContentType, &a.SizeBytes, &a.CreatedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.ChannelID, &a.UserID, &a.Filename, &a.ContentType, &a.SizeBytes,
+			&a.Width, &a.Height, &a.ThumbnailSizes, &a.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan attachment: %w", err)
 		}
+		a.SetThumbnailURL()
 		attachments = append(attachments, a)
 	}
 	return attachments, rows.Err()
@@ -271,7 +364,7 @@ func (r *Repository) GetAttachmentsForMessages(ctx context.Context, messageIDs [
 		return make(map[uuid.UUID][]model.FileAttachment), nil
 	}
 	query := `
-		SELECT id, message_id, channel_id, user_id, filename, content_type, size_bytes, created_at
+		SELECT id, message_id, channel_id, user_id, filename, content_type, size_bytes, width, height, thumbnail_sizes, created_at
 		FROM file_attachments WHERE message_id = ANY($1)
 		ORDER BY created_at ASC
 	`
@@ -284,9 +377,11 @@ func (r *Repository) GetAttachmentsForMessages(ctx context.Context, messageIDs [
 	result := make(map[uuid.UUID][]model.FileAttachment)
 	for rows.Next() {
 		var a model.FileAttachment
-		if err := rows.Scan(&a.ID, &a.MessageID, &a.ChannelID, &a.UserID, &a.Filename, &a.ContentType, &a.SizeBytes, &a.CreatedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.ChannelID, &a.UserID, &a.Filename, &a.ContentType, &a.SizeBytes,
+			&a.Width, &a.Height, &a.ThumbnailSizes, &a.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan attachment: %w", err)
 		}
+		a.SetThumbnailURL()
 		if a.MessageID != nil {
 			result[*a.MessageID] = append(result[*a.MessageID], a)
 		}
@@ -306,7 +401,7 @@ func (r *Repository) scanMessage(row scannable) (*model.Message, error) {
 	err := row.Scan(
 		&msg.ID, &msg.ChannelID, &msg.UserID, &msg.ParentID, &msg.Content,
 		&msg.IsAlert, &msg.AlertSeverity, &alertMetadata,
-		&msg.EditedAt, &msg.DeletedAt, &msg.CreatedAt,
+		&msg.EditedAt, &msg.DeletedAt, &msg.CreatedAt, &msg.PinnedAt, &msg.PinnedBy,
 		&user.ID, &user.Email, &user.Name, &user.AvatarURL, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
 		&msg.ReplyCount,
 	)
@@ -329,7 +424,7 @@ func (r *Repository) scanMessageRow(rows pgx.Rows) (*model.Message, error) {
 	err := rows.Scan(
 		&msg.ID, &msg.ChannelID, &msg.UserID, &msg.ParentID, &msg.Content,
 		&msg.IsAlert, &msg.AlertSeverity, &alertMetadata,
-		&msg.EditedAt, &msg.DeletedAt, &msg.CreatedAt,
+		&msg.EditedAt, &msg.DeletedAt, &msg.CreatedAt, &msg.PinnedAt, &msg.PinnedBy,
 		&user.ID, &user.Email, &user.Name, &user.AvatarURL, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
 		&msg.ReplyCount,
 	)
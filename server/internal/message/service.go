@@ -4,43 +4,85 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/feather-chat/feather/internal/audit"
 	"github.com/feather-chat/feather/internal/model"
 )
 
 var (
-	ErrMessageNotFound = errors.New("message not found")
-	ErrForbidden       = errors.New("forbidden")
-	ErrEditExpired     = errors.New("edit window expired (24h)")
-	ErrReadonly        = errors.New("channel is read-only")
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrForbidden          = errors.New("forbidden")
+	ErrEditExpired        = errors.New("edit window expired (24h)")
+	ErrReadonly           = errors.New("channel is read-only")
+	ErrAdminsOnly         = errors.New("only workspace admins can post in this channel")
+	ErrThreadsOnly        = errors.New("new messages in this channel must be thread replies")
+	ErrSlowMode           = errors.New("slow mode is enabled in this channel")
+	ErrTooManyAttachments = errors.New("too many attachments")
+	ErrInvalidAttachment  = errors.New("attachments must be your own unused uploads to this channel")
 )
 
+// SlowModeError is returned when a member posts again before their cooldown
+// has elapsed. It matches ErrSlowMode with errors.Is.
+type SlowModeError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SlowModeError) Error() string { return ErrSlowMode.Error() }
+func (e *SlowModeError) Unwrap() error { return ErrSlowMode }
+
 type ChannelChecker interface {
 	IsMember(ctx context.Context, channelID, userID uuid.UUID) (bool, error)
+	HasPermission(ctx context.Context, channelID, userID uuid.UUID, userRole string, perm model.ChannelPermission) (bool, error)
+	GetPostingPolicy(ctx context.Context, channelID uuid.UUID) (*model.PostingPolicy, error)
 }
 
 type BroadcastFunc func(channelID uuid.UUID, event model.WebSocketEvent)
 
+// SendToUserFunc delivers a raw WebSocket frame to every connection of a user.
+type SendToUserFunc func(userID uuid.UUID, data []byte)
+
 // MentionProcessor processes mentions in a message after creation.
 type MentionProcessor interface {
 	ProcessMentions(ctx context.Context, msg *model.Message)
 }
 
+// CommandExecutor runs slash commands. handled is false when content is an
+// ordinary message.
+type CommandExecutor interface {
+	Execute(ctx context.Context, channelID, userID uuid.UUID, userRole, content string) (resp *model.CommandResponse, handled bool, err error)
+}
+
+// AttachmentRemover deletes the files attached to a message.
+type AttachmentRemover interface {
+	DeleteForMessage(ctx context.Context, messageID uuid.UUID) error
+}
+
+// AuditLogger records administrative actions.
+type AuditLogger interface {
+	Log(ctx context.Context, entry audit.Entry)
+}
+
 type Service struct {
 	repo             *Repository
 	channels         ChannelChecker
 	broadcast        BroadcastFunc
+	sendToUser       SendToUserFunc
 	mentionProcessor MentionProcessor
+	commands         CommandExecutor
+	auditLog         AuditLogger
+	attachments      AttachmentRemover
 }
 
-func NewService(repo *Repository, channels ChannelChecker, broadcast BroadcastFunc) *Service {
+func NewService(repo *Repository, channels ChannelChecker, broadcast BroadcastFunc, sendToUser SendToUserFunc) *Service {
 	return &Service{
-		repo:      repo,
-		channels:  channels,
-		broadcast: broadcast,
+		repo:       repo,
+		channels:   channels,
+		broadcast:  broadcast,
+		sendToUser: sendToUser,
 	}
 }
 
@@ -49,13 +91,51 @@ func (s *Service) SetMentionProcessor(mp MentionProcessor) {
 	s.mentionProcessor = mp
 }
 
-func (s *Service) Create(ctx context.Context, channelID uuid.UUID, req model.CreateMessageRequest, userID uuid.UUID, userRole string) (*model.Message, error) {
+// SetCommandExecutor enables slash-command handling in Create.
+func (s *Service) SetCommandExecutor(ce CommandExecutor) {
+	s.commands = ce
+}
+
+// SetAuditLogger enables audit entries for moderator deletes.
+func (s *Service) SetAuditLogger(al AuditLogger) {
+	s.auditLog = al
+}
+
+// SetAttachmentRemover makes deleting a message also delete its files.
+func (s *Service) SetAttachmentRemover(ar AttachmentRemover) {
+	s.attachments = ar
+}
+
+// Create posts a message. If the content is a slash command, the command runs
+// instead: an in_channel response is posted as the user's message, and an
+// ephemeral response is sent only to the user and returned with a nil message.
+func (s *Service) Create(ctx context.Context, channelID uuid.UUID, req model.CreateMessageRequest, userID uuid.UUID, userRole string) (*model.Message, *model.EphemeralMessage, error) {
 	isMember, err := s.channels.IsMember(ctx, channelID, userID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if !isMember {
-		return nil, ErrForbidden
+		return nil, nil, ErrForbidden
+	}
+
+	if s.commands != nil {
+		resp, handled, err := s.commands.Execute(ctx, channelID, userID, userRole, req.Content)
+		if err != nil {
+			return nil, nil, err
+		}
+		if handled {
+			if resp == nil {
+				return nil, nil, nil
+			}
+			if resp.ResponseType != model.ResponseInChannel {
+				return nil, s.SendEphemeral(userID, channelID, req.ParentID, nil, resp.Text), nil
+			}
+			req.Content = resp.Text
+		}
+	}
+
+	if err := s.checkPostingPolicy(ctx, channelID, req, userID, userRole); err != nil {
+		return nil, nil, err
 	}
 
 	msg := &model.Message{
@@ -67,19 +147,18 @@ func (s *Service) Create(ctx context.Context, channelID uuid.UUID, req model.Cre
 		CreatedAt: time.Now(),
 	}
 
-	if err := s.repo.Create(ctx, msg); err != nil {
-		return nil, err
-	}
-
-	// Link file attachments to this message
-	if len(req.AttachmentIDs) > 0 {
-		_ = s.repo.LinkAttachments(ctx, msg.ID, req.AttachmentIDs)
+	if attachmentIDs := uniqueIDs(req.AttachmentIDs); len(attachmentIDs) > 0 {
+		if err := s.repo.CreateWithAttachments(ctx, msg, attachmentIDs); err != nil {
+			return nil, nil, err
+		}
+	} else if err := s.repo.Create(ctx, msg); err != nil {
+		return nil, nil, err
 	}
 
 	// Fetch full message with user data
 	full, err := s.repo.GetByID(ctx, msg.ID)
 	if err != nil {
-		return msg, nil // Return basic message if fetch fails
+		return msg, nil, nil // Return basic message if fetch fails
 	}
 
 	// Fetch reactions
@@ -103,6 +182,117 @@ func (s *Service) Create(ctx context.Context, channelID uuid.UUID, req model.Cre
 		go s.mentionProcessor.ProcessMentions(context.Background(), full)
 	}
 
+	return full, nil, nil
+}
+
+// checkPostingPolicy enforces the channel's posting restrictions. Members with
+// post_readonly (channel owners and admins, workspace admins) are exempt from
+// everything except the attachment limit.
+func (s *Service) checkPostingPolicy(ctx context.Context, channelID uuid.UUID, req model.CreateMessageRequest, userID uuid.UUID, userRole string) error {
+	policy, err := s.channels.GetPostingPolicy(ctx, channelID)
+	if err != nil {
+		return err
+	}
+
+	if policy.MaxAttachments > 0 && len(req.AttachmentIDs) > policy.MaxAttachments {
+		return ErrTooManyAttachments
+	}
+
+	restricted := policy.AdminsOnly || policy.IsReadonly || (policy.ThreadsOnly && req.ParentID == nil) || policy.SlowModeSeconds > 0
+	if !restricted {
+		return nil
+	}
+	exempt, err := s.channels.HasPermission(ctx, channelID, userID, userRole, model.PermPostReadonly)
+	if err != nil {
+		return err
+	}
+	if exempt {
+		return nil
+	}
+
+	if policy.AdminsOnly {
+		return ErrAdminsOnly
+	}
+	if policy.IsReadonly {
+		return ErrReadonly
+	}
+	if policy.ThreadsOnly && req.ParentID == nil {
+		return ErrThreadsOnly
+	}
+	if policy.SlowModeSeconds > 0 {
+		last, err := s.repo.LastPostedAt(ctx, channelID, userID)
+		if err != nil {
+			return err
+		}
+		if last != nil {
+			cooldown := time.Duration(policy.SlowModeSeconds) * time.Second
+			if wait := cooldown - time.Since(*last); wait > 0 {
+				return &SlowModeError{RetryAfter: wait}
+			}
+		}
+	}
+	return nil
+}
+
+// SendEphemeral delivers a message to a single user's connected clients without
+// storing it. authorID is nil for system messages.
+func (s *Service) SendEphemeral(userID, channelID uuid.UUID, parentID, authorID *uuid.UUID, content string) *model.EphemeralMessage {
+	msg := &model.EphemeralMessage{
+		ID:          uuid.New(),
+		ChannelID:   channelID,
+		UserID:      authorID,
+		ParentID:    parentID,
+		Content:     content,
+		IsEphemeral: true,
+		CreatedAt:   time.Now(),
+	}
+
+	if s.sendToUser != nil {
+		payload, _ := json.Marshal(msg)
+		event := model.WebSocketEvent{
+			Type:      model.EventMessageEphemeral,
+			ChannelID: channelID.String(),
+			Payload:   payload,
+		}
+		data, _ := json.Marshal(event)
+		s.sendToUser(userID, data)
+	}
+
+	return msg
+}
+
+// CreateAlertMessage posts an alert on behalf of a bot user (e.g. an incoming webhook).
+// Bot users are not channel members, so no membership check is performed.
+func (s *Service) CreateAlertMessage(ctx context.Context, channelID, botUserID uuid.UUID, content string, severity string, metadata json.RawMessage) (*model.Message, error) {
+	msg := &model.Message{
+		ID:            uuid.New(),
+		ChannelID:     channelID,
+		UserID:        botUserID,
+		Content:       content,
+		IsAlert:       true,
+		AlertSeverity: &severity,
+		AlertMetadata: metadata,
+		CreatedAt:     time.Now(),
+	}
+
+	if err := s.repo.Create(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	full, err := s.repo.GetByID(ctx, msg.ID)
+	if err != nil || full == nil {
+		return msg, nil // Return basic message if fetch fails
+	}
+
+	if s.broadcast != nil {
+		s.broadcastMessage(model.EventMessageNew, full)
+	}
+
+	// Alerts can page people via @mentions
+	if s.mentionProcessor != nil {
+		go s.mentionProcessor.ProcessMentions(context.Background(), full)
+	}
+
 	return full, nil
 }
 
@@ -216,22 +406,98 @@ func (s *Service) Delete(ctx context.Context, channelID, messageID uuid.UUID, us
 		return ErrMessageNotFound
 	}
 
-	// Author or admin can delete
-	if msg.UserID != userID && userRole != string(model.RoleAdmin) {
-		return ErrForbidden
+	// Authors can delete their own messages; anyone else needs delete_messages
+	if msg.UserID != userID {
+		allowed, err := s.channels.HasPermission(ctx, msg.ChannelID, userID, userRole, model.PermDeleteMessages)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrForbidden
+		}
 	}
 
 	if err := s.repo.SoftDelete(ctx, messageID); err != nil {
 		return err
 	}
 
+	// The message stays behind as a tombstone, but its files are gone for good
+	if s.attachments != nil {
+		if err := s.attachments.DeleteForMessage(ctx, messageID); err != nil {
+			slog.Error("failed to delete message attachments", "message_id", messageID, "error", err)
+		}
+	}
+
 	if s.broadcast != nil {
 		s.broadcastMessage(model.EventMessageDeleted, msg)
 	}
 
+	// Deleting your own message is routine; moderating someone else's is audited
+	if msg.UserID != userID && s.auditLog != nil {
+		s.auditLog.Log(ctx, audit.Entry{
+			UserID:     userID,
+			Action:     audit.ActionMessageDeleted,
+			EntityType: audit.EntityMessage,
+			EntityID:   messageID,
+			Metadata: map[string]interface{}{
+				"author_id":  msg.UserID,
+				"channel_id": msg.ChannelID,
+			},
+		})
+	}
+
 	return nil
 }
 
+// SetPinned pins or unpins a message and broadcasts the change as an update.
+func (s *Service) SetPinned(ctx context.Context, channelID, messageID uuid.UUID, pinned bool, userID uuid.UUID, userRole string) (*model.Message, error) {
+	msg, err := s.repo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil || msg.ChannelID != channelID {
+		return nil, ErrMessageNotFound
+	}
+
+	allowed, err := s.channels.HasPermission(ctx, channelID, userID, userRole, model.PermPinMessages)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrForbidden
+	}
+
+	var pinnedBy *uuid.UUID
+	if pinned {
+		pinnedBy = &userID
+	}
+	if err := s.repo.SetPinned(ctx, messageID, pinnedBy); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.broadcast != nil {
+		s.broadcastMessage(model.EventMessageUpdated, updated)
+	}
+
+	return updated, nil
+}
+
+func (s *Service) ListPinned(ctx context.Context, channelID, userID uuid.UUID) ([]model.Message, error) {
+	isMember, err := s.channels.IsMember(ctx, channelID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrForbidden
+	}
+	return s.repo.ListPinned(ctx, channelID)
+}
+
 func (s *Service) broadcastMessage(eventType model.EventType, msg *model.Message) {
 	payload, _ := json.Marshal(msg)
 	event := model.WebSocketEvent{
@@ -241,3 +507,16 @@ func (s *Service) broadcastMessage(eventType model.EventType, msg *model.Message
 	}
 	s.broadcast(msg.ChannelID, event)
 }
+
+// uniqueIDs returns ids without duplicates, in their original order.
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	var unique []uuid.UUID
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"context"
+	"log/slog"
+	"math"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -12,10 +15,16 @@ import (
 type contextKey string
 
 const (
-	UserIDKey  contextKey = "user_id"
-	UserRoleKey contextKey = "user_role"
+	UserIDKey     contextKey = "user_id"
+	UserRoleKey   contextKey = "user_role"
+	SessionIDKey  contextKey = "session_id"
+	APITokenIDKey contextKey = "api_token_id"
+	ScopesKey     contextKey = "scopes"
 )
 
+// APITokenPrefix starts every API token, which tells them apart from JWTs.
+const APITokenPrefix = "fth_"
+
 func GetUserID(ctx context.Context) uuid.UUID {
 	id, _ := ctx.Value(UserIDKey).(uuid.UUID)
 	return id
@@ -26,7 +35,69 @@ func GetUserRole(ctx context.Context) string {
 	return role
 }
 
-func Auth(jwtSecret string) func(http.Handler) http.Handler {
+// GetSessionID returns the session the access token belongs to, or uuid.Nil for
+// tokens issued before sessions existed.
+func GetSessionID(ctx context.Context) uuid.UUID {
+	id, _ := ctx.Value(SessionIDKey).(uuid.UUID)
+	return id
+}
+
+// GetAPITokenID returns the API token that authenticated the request, or
+// uuid.Nil for a user's session.
+func GetAPITokenID(ctx context.Context) uuid.UUID {
+	id, _ := ctx.Value(APITokenIDKey).(uuid.UUID)
+	return id
+}
+
+// HasScope reports whether the request may use scope. Sessions have every
+// scope; API tokens only those they were granted.
+func HasScope(ctx context.Context, scope string) bool {
+	if GetAPITokenID(ctx) == uuid.Nil {
+		return true
+	}
+	scopes, _ := ctx.Value(ScopesKey).([]string)
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenIdentity is the user and scopes of a valid API token.
+type APITokenIdentity struct {
+	TokenID  uuid.UUID
+	UserID   uuid.UUID
+	UserName string
+	Role     string
+	Scopes   []string
+}
+
+// APITokenValidator resolves API tokens. It returns nil for tokens that are
+// unknown, expired or belong to a deactivated user.
+type APITokenValidator interface {
+	ValidateAPIToken(ctx context.Context, token string) (*APITokenIdentity, error)
+}
+
+// IssuedAt returns when an access token was issued. Its iat has millisecond
+// precision, which jwt's own accessors truncate to seconds.
+func IssuedAt(claims jwt.MapClaims) time.Time {
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(math.Round(iat * 1000)))
+}
+
+// RevocationChecker reports whether an access token has been revoked before it
+// expired, either with its session or by signing the user out everywhere.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, userID, sessionID uuid.UUID, issuedAt time.Time) (bool, error)
+}
+
+// Auth authenticates requests with a user's access token or, when apiTokens is
+// set, an API token.
+func Auth(jwtSecret string, revocations RevocationChecker, apiTokens APITokenValidator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -41,6 +112,25 @@ func Auth(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
+			if apiTokens != nil && strings.HasPrefix(parts[1], APITokenPrefix) {
+				identity, err := apiTokens.ValidateAPIToken(r.Context(), parts[1])
+				if err != nil {
+					slog.Error("api token validation failed", "error", err)
+					http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+					return
+				}
+				if identity == nil {
+					http.Error(w, `{"error":"invalid token"}`, http.StatusUnauthorized)
+					return
+				}
+				ctx := context.WithValue(r.Context(), UserIDKey, identity.UserID)
+				ctx = context.WithValue(ctx, UserRoleKey, identity.Role)
+				ctx = context.WithValue(ctx, APITokenIDKey, identity.TokenID)
+				ctx = context.WithValue(ctx, ScopesKey, identity.Scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
 				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 					return nil, jwt.ErrSignatureInvalid
@@ -58,6 +148,13 @@ func Auth(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Only access tokens authenticate requests; tokens from before
+			// typ existed have none
+			if typ, ok := claims["typ"]; ok && typ != "access" {
+				http.Error(w, `{"error":"invalid token type"}`, http.StatusUnauthorized)
+				return
+			}
+
 			sub, ok := claims["sub"].(string)
 		if !ok || sub == "" {
 			http.Error(w, `{"error":"invalid token claims"}`, http.StatusUnauthorized)
@@ -70,15 +167,36 @@ func Auth(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
+			var sessionID uuid.UUID
+			if sid, ok := claims["sid"].(string); ok {
+				sessionID, _ = uuid.Parse(sid)
+			}
+
+			if revocations != nil {
+				revoked, err := revocations.IsRevoked(r.Context(), userID, sessionID, IssuedAt(claims))
+				// Fail open: an unreachable Redis must not sign everyone out,
+				// and revocations made by this instance are still enforced
+				// from its local copy. The WebSocket handshake does the same.
+				if err != nil {
+					slog.Warn("token revocation check failed", "error", err, "user_id", userID)
+				}
+				if revoked {
+					http.Error(w, `{"error":"token revoked"}`, http.StatusUnauthorized)
+					return
+				}
+			}
+
 			role, _ := claims["role"].(string)
 
 			ctx := context.WithValue(r.Context(), UserIDKey, userID)
 			ctx = context.WithValue(ctx, UserRoleKey, role)
+			ctx = context.WithValue(ctx, SessionIDKey, sessionID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// AdminOnly requires the admin role, and the admin scope for API tokens.
 func AdminOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		role := GetUserRole(r.Context())
@@ -86,6 +204,46 @@ func AdminOnly(next http.Handler) http.Handler {
 			http.Error(w, `{"error":"admin access required"}`, http.StatusForbidden)
 			return
 		}
+		if !HasScope(r.Context(), "admin") {
+			http.Error(w, `{"error":"token lacks scope admin"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScopes lets API tokens through with the read scope for GET and HEAD
+// requests and the write scope for the rest. Sessions are always let through.
+func RequireScopes(read, write string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = read
+			}
+			if !HasScope(r.Context(), scope) {
+				http.Error(w, `{"error":"token lacks scope `+scope+`"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope lets API tokens through with scope, whatever the method. Sessions
+// are always let through.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return RequireScopes(scope, scope)
+}
+
+// SessionOnly rejects API tokens, for managing sessions, credentials and
+// tokens themselves.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetAPITokenID(r.Context()) != uuid.Nil {
+			http.Error(w, `{"error":"not available to API tokens"}`, http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	ClientIPKey  contextKey = "client_ip"
+	UserAgentKey contextKey = "user_agent"
+)
+
+// ParseTrustedProxies parses proxy addresses given as CIDRs or single IPs.
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// RealIP replaces RemoteAddr with the client address from X-Forwarded-For or
+// X-Real-IP, but only for requests that come from a trusted proxy; anyone else
+// could set those headers to dodge per-IP rate limits or forge audit entries.
+// In X-Forwarded-For the rightmost address that is not itself a trusted proxy
+// is the client.
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isTrustedProxy(trusted, clientIP(r)) {
+				if ip := forwardedIP(r, trusted); ip != "" {
+					r.RemoteAddr = ip
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forwardedIP(r *http.Request, trusted []*net.IPNet) string {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			return ""
+		}
+		if !isTrustedProxy(trusted, hop) {
+			return hop
+		}
+	}
+	if len(hops) > 0 {
+		// Every hop is a proxy; the first one is as close to the client as we get
+		return strings.TrimSpace(hops[0])
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return ""
+}
+
+func isTrustedProxy(trusted []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientInfo stores the caller's IP and user agent in the request context for
+// code that has no access to the request, such as audit logging and session
+// tracking. It must run after RealIP.
+func ClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ClientIPKey, clientIP(r))
+		ctx = context.WithValue(ctx, UserAgentKey, r.UserAgent())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func GetClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(ClientIPKey).(string)
+	return ip
+}
+
+func GetUserAgent(ctx context.Context) string {
+	ua, _ := ctx.Value(UserAgentKey).(string)
+	return ua
+}
+
+func clientIP(r *http.Request) string {
+	// RealIP has already replaced RemoteAddr with the forwarded address, if trusted
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
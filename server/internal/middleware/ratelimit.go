@@ -3,77 +3,219 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
+// KeyFunc identifies who a request is counted against. An empty key skips limiting.
+type KeyFunc func(r *http.Request) string
+
+// RateLimitPolicy is a named token bucket: up to Limit requests in a burst,
+// refilled evenly over Window. Each policy has its own buckets.
+type RateLimitPolicy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    KeyFunc
+}
+
+// KeyByIP counts requests per client IP.
+func KeyByIP(r *http.Request) string {
+	return clientIP(r)
+}
+
+// KeyByUser counts requests per authenticated user, falling back to the client IP.
+func KeyByUser(r *http.Request) string {
+	if userID := GetUserID(r.Context()); userID != uuid.Nil {
+		return "user:" + userID.String()
+	}
+	return "ip:" + clientIP(r)
+}
+
+// KeyByURLParam counts requests per value of a route parameter, e.g. a webhook token.
+func KeyByURLParam(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return chi.URLParam(r, name)
+	}
+}
+
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+type rateLimitStore interface {
+	take(ctx context.Context, key string, limit int, window time.Duration) (rateLimitResult, error)
+}
+
+// RateLimiter enforces RateLimitPolicy buckets. Buckets live in Redis so limits
+// hold across instances; without Redis, or while Redis is unreachable, they are
+// kept in memory on each instance.
 type RateLimiter struct {
-	redis  *redis.Client
-	limit  int
-	window time.Duration
+	store  rateLimitStore
+	memory *memoryRateLimitStore
+}
+
+func NewRateLimiter(redisClient *redis.Client) *RateLimiter {
+	mem := newMemoryRateLimitStore()
+	rl := &RateLimiter{store: mem, memory: mem}
+	if redisClient != nil {
+		rl.store = &redisRateLimitStore{client: redisClient}
+	}
+	return rl
 }
 
-func NewRateLimiter(redisClient *redis.Client, limit int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
-		redis:  redisClient,
-		limit:  limit,
-		window: window,
+// Limit returns middleware enforcing the policy. A policy with a zero limit is disabled.
+func (rl *RateLimiter) Limit(policy RateLimitPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if policy.Limit <= 0 || policy.Window <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := policy.Key(r)
+			if id == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := fmt.Sprintf("ratelimit:%s:%s", policy.Name, id)
+
+			res, err := rl.store.take(r.Context(), key, policy.Limit, policy.Window)
+			if err != nil && rl.store != rl.memory {
+				slog.Warn("rate limiter: redis unavailable, using local buckets", "error", err, "policy", policy.Name)
+				res, err = rl.memory.take(r.Context(), key, policy.Limit, policy.Window)
+			}
+			if err != nil {
+				http.Error(w, `{"error":"service unavailable"}`, http.StatusServiceUnavailable)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(policy.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.remaining))
+
+			if !res.allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.retryAfter.Seconds()))))
+				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
-// Lua script for atomic increment with expiry.
-// Returns the current count after increment.
-// Sets expiry only on first increment (when count becomes 1).
-var incrWithExpireScript = redis.NewScript(`
-local count = redis.call("INCR", KEYS[1])
-if count == 1 then
-    redis.call("PEXPIRE", KEYS[1], ARGV[1])
+// Token bucket stored as a hash of the remaining tokens and the last refill
+// time. Redis' own clock is used so every instance refills consistently.
+// Returns {allowed, remaining, retry_after_ms}.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+    tokens = capacity
+    ts = now
+end
+
+local rate = capacity / window_ms
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry_ms = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+else
+    retry_ms = math.ceil((1 - tokens) / rate)
 end
-return count
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], window_ms)
+return {allowed, math.floor(tokens), retry_ms}
 `)
 
-func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := rl.getKey(r)
-		ctx := r.Context()
+type redisRateLimitStore struct {
+	client *redis.Client
+}
+
+func (s *redisRateLimitStore) take(ctx context.Context, key string, limit int, window time.Duration) (rateLimitResult, error) {
+	vals, err := tokenBucketScript.Run(ctx, s.client, []string{key}, limit, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return rateLimitResult{}, err
+	}
+	if len(vals) != 3 {
+		return rateLimitResult{}, fmt.Errorf("unexpected rate limit reply: %v", vals)
+	}
+	return rateLimitResult{
+		allowed:    vals[0] == 1,
+		remaining:  int(vals[1]),
+		retryAfter: time.Duration(vals[2]) * time.Millisecond,
+	}, nil
+}
 
-		count, err := rl.increment(ctx, key)
-		if err != nil {
-			// If Redis is down, reject the request (fail closed)
-			http.Error(w, `{"error":"service unavailable"}`, http.StatusServiceUnavailable)
-			return
-		}
+// memoryRateLimitStore keeps token buckets in process memory. Buckets that have
+// refilled completely carry no state and are swept periodically.
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
 
-		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rl.limit))
-		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(0, rl.limit-int(count))))
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	window time.Duration
+}
 
-		if int(count) > rl.limit {
-			w.Header().Set("Retry-After", strconv.Itoa(int(rl.window.Seconds())))
-			http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
-			return
-		}
+const rateLimitSweepInterval = time.Minute
 
-		next.ServeHTTP(w, r)
-	})
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: make(map[string]*tokenBucket), lastSweep: time.Now()}
 }
 
-func (rl *RateLimiter) getKey(r *http.Request) string {
-	// Use user ID if authenticated, otherwise IP
-	if userID := GetUserID(r.Context()); userID != uuid.Nil {
-		return fmt.Sprintf("ratelimit:%s", userID.String())
+func (s *memoryRateLimitStore) take(_ context.Context, key string, limit int, window time.Duration) (rateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= rateLimitSweepInterval {
+		for k, b := range s.buckets {
+			if now.Sub(b.last) >= b.window {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
 	}
-	return fmt.Sprintf("ratelimit:%s", r.RemoteAddr)
-}
 
-func (rl *RateLimiter) increment(ctx context.Context, key string) (int64, error) {
-	windowMs := rl.window.Milliseconds()
-	result, err := incrWithExpireScript.Run(ctx, rl.redis, []string{key}, windowMs).Int64()
-	if err != nil {
-		return 0, err
+	capacity := float64(limit)
+	rate := capacity / float64(window) // tokens per nanosecond
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now, window: window}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return rateLimitResult{
+			remaining:  0,
+			retryAfter: time.Duration(math.Ceil((1 - b.tokens) / rate)),
+		}, nil
 	}
-	return result, nil
+	b.tokens--
+	return rateLimitResult{allowed: true, remaining: int(b.tokens)}, nil
 }
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// API token scopes. Read scopes allow GET requests to an area, write scopes
+// everything else; a write scope does not include its read scope.
+const (
+	ScopeChannelsRead     = "channels:read"
+	ScopeChannelsWrite    = "channels:write"
+	ScopeMessagesRead     = "messages:read"
+	ScopeMessagesWrite    = "messages:write"
+	ScopeFilesRead        = "files:read"
+	ScopeFilesWrite       = "files:write"
+	ScopeUsersRead        = "users:read"
+	ScopeUsersWrite       = "users:write"
+	ScopeGroupsRead       = "groups:read"
+	ScopeGroupsWrite      = "groups:write"
+	ScopeSearchRead       = "search:read"
+	ScopeCallsRead        = "calls:read"
+	ScopeWebhooksRead     = "webhooks:read"
+	ScopeWebhooksWrite    = "webhooks:write"
+	ScopeCommandsRead     = "commands:read"
+	ScopeCommandsWrite    = "commands:write"
+	ScopeInvitationsRead  = "invitations:read"
+	ScopeInvitationsWrite = "invitations:write"
+	ScopeEventsRead       = "events:read" // WebSocket connections
+	ScopeAdmin            = "admin"       // admin endpoints, for admins only
+)
+
+// APITokenScopes lists every scope a token can be granted.
+var APITokenScopes = []string{
+	ScopeChannelsRead, ScopeChannelsWrite,
+	ScopeMessagesRead, ScopeMessagesWrite,
+	ScopeFilesRead, ScopeFilesWrite,
+	ScopeUsersRead, ScopeUsersWrite,
+	ScopeGroupsRead, ScopeGroupsWrite,
+	ScopeSearchRead,
+	ScopeCallsRead,
+	ScopeWebhooksRead, ScopeWebhooksWrite,
+	ScopeCommandsRead, ScopeCommandsWrite,
+	ScopeInvitationsRead, ScopeInvitationsWrite,
+	ScopeEventsRead,
+	ScopeAdmin,
+}
+
+// APIToken is a long-lived token that acts as its user within its scopes.
+// Token is only set in the response that creates it; Prefix identifies it
+// afterwards.
+type APIToken struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatorID  uuid.UUID  `json:"creator_id"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPITokenRequest creates a token. Without expires_in_days it never
+// expires.
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" validate:"required,min=2,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0,max=3650"`
+}
+
+type CreateBotRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+}
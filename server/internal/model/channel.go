@@ -9,26 +9,30 @@ import (
 type ChannelType string
 
 const (
-	ChannelPublic   ChannelType = "public"
-	ChannelPrivate  ChannelType = "private"
-	ChannelSystem   ChannelType = "system"
-	ChannelDM       ChannelType = "dm"
-	ChannelGroupDM  ChannelType = "group_dm"
+	ChannelPublic  ChannelType = "public"
+	ChannelPrivate ChannelType = "private"
+	ChannelSystem  ChannelType = "system"
+	ChannelDM      ChannelType = "dm"
+	ChannelGroupDM ChannelType = "group_dm"
 )
 
 type Channel struct {
-	ID          uuid.UUID   `json:"id"`
-	Name        *string     `json:"name"`
-	Topic       string      `json:"topic"`
-	Description string      `json:"description"`
-	Type        ChannelType `json:"type"`
-	IsReadonly  bool        `json:"is_readonly"`
-	CreatorID   *uuid.UUID  `json:"creator_id,omitempty"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
-	UnreadCount int         `json:"unread_count,omitempty"`
-	MemberCount int         `json:"member_count,omitempty"`
-	Members     []User      `json:"members,omitempty"`
+	ID              uuid.UUID   `json:"id"`
+	Name            *string     `json:"name"`
+	Topic           string      `json:"topic"`
+	Description     string      `json:"description"`
+	Type            ChannelType `json:"type"`
+	IsReadonly      bool        `json:"is_readonly"`
+	AdminsOnly      bool        `json:"admins_only"`
+	ThreadsOnly     bool        `json:"threads_only"`
+	SlowModeSeconds int         `json:"slow_mode_seconds"`
+	MaxAttachments  int         `json:"max_attachments"`
+	CreatorID       *uuid.UUID  `json:"creator_id,omitempty"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+	UnreadCount     int         `json:"unread_count,omitempty"`
+	MemberCount     int         `json:"member_count,omitempty"`
+	Members         []User      `json:"members,omitempty"`
 }
 
 type CreateDMRequest struct {
@@ -40,18 +44,35 @@ type CreateGroupDMRequest struct {
 }
 
 type CreateChannelRequest struct {
-	Name        string      `json:"name" validate:"required,min=2,max=100"`
-	Topic       string      `json:"topic" validate:"max=500"`
-	Description string      `json:"description" validate:"max=2000"`
-	Type        ChannelType `json:"type" validate:"required,oneof=public private system"`
-	IsReadonly  bool        `json:"is_readonly"`
+	Name            string      `json:"name" validate:"required,min=2,max=100"`
+	Topic           string      `json:"topic" validate:"max=500"`
+	Description     string      `json:"description" validate:"max=2000"`
+	Type            ChannelType `json:"type" validate:"required,oneof=public private system"`
+	IsReadonly      bool        `json:"is_readonly"`
+	AdminsOnly      bool        `json:"admins_only"`
+	ThreadsOnly     bool        `json:"threads_only"`
+	SlowModeSeconds int         `json:"slow_mode_seconds" validate:"min=0,max=21600"`
+	MaxAttachments  int         `json:"max_attachments" validate:"min=0,max=100"`
 }
 
 type UpdateChannelRequest struct {
-	Name        *string `json:"name" validate:"omitempty,min=2,max=100"`
-	Topic       *string `json:"topic" validate:"omitempty,max=500"`
-	Description *string `json:"description" validate:"omitempty,max=2000"`
-	IsReadonly  *bool   `json:"is_readonly"`
+	Name            *string `json:"name" validate:"omitempty,min=2,max=100"`
+	Topic           *string `json:"topic" validate:"omitempty,max=500"`
+	Description     *string `json:"description" validate:"omitempty,max=2000"`
+	IsReadonly      *bool   `json:"is_readonly"`
+	AdminsOnly      *bool   `json:"admins_only"`
+	ThreadsOnly     *bool   `json:"threads_only"`
+	SlowModeSeconds *int    `json:"slow_mode_seconds" validate:"omitempty,min=0,max=21600"`
+	MaxAttachments  *int    `json:"max_attachments" validate:"omitempty,min=0,max=100"`
+}
+
+// PostingPolicy is the set of restrictions checked when a member posts.
+type PostingPolicy struct {
+	IsReadonly      bool // only members with post_readonly may post
+	AdminsOnly      bool // only workspace admins may post
+	ThreadsOnly     bool // new top-level messages need post_readonly; replies are open
+	SlowModeSeconds int  // minimum seconds between a member's messages; 0 disables
+	MaxAttachments  int  // per message; 0 means no limit
 }
 
 type ChannelMember struct {
@@ -63,6 +84,24 @@ type ChannelMember struct {
 	User       *User     `json:"user,omitempty"`
 }
 
+// Reasons carried in member.joined and member.left events.
+const (
+	MemberReasonJoined  = "joined"
+	MemberReasonInvited = "invited"
+	MemberReasonLeft    = "left"
+	MemberReasonRemoved = "removed"
+)
+
+// MemberEvent is the payload of member.joined and member.left. ActorID is the
+// user who invited or removed the member; it is omitted when members join or
+// leave on their own.
+type MemberEvent struct {
+	ChannelID uuid.UUID  `json:"channel_id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ActorID   *uuid.UUID `json:"actor_id,omitempty"`
+	Reason    string     `json:"reason"`
+}
+
 type InviteMemberRequest struct {
 	UserID uuid.UUID `json:"user_id" validate:"required"`
 }
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CommandResponseType string
+
+const (
+	ResponseEphemeral CommandResponseType = "ephemeral"
+	ResponseInChannel CommandResponseType = "in_channel"
+)
+
+// SlashCommand is an admin-registered command backed by an external URL.
+type SlashCommand struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Usage       string    `json:"usage"`
+	URL         string    `json:"url"`
+	Token       string    `json:"token,omitempty"`
+	CreatorID   uuid.UUID `json:"creator_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type CreateSlashCommandRequest struct {
+	Name        string `json:"name" validate:"required,min=2,max=32"`
+	Description string `json:"description" validate:"max=200"`
+	Usage       string `json:"usage" validate:"max=200"`
+	URL         string `json:"url" validate:"required,url,max=2000"`
+}
+
+// CommandInfo describes a command for composer autocomplete.
+type CommandInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Usage       string `json:"usage"`
+	BuiltIn     bool   `json:"built_in"`
+}
+
+// CommandInvocation is a parsed "/name args" message.
+type CommandInvocation struct {
+	Name      string
+	Args      string
+	ChannelID uuid.UUID
+	UserID    uuid.UUID
+	UserRole  string
+}
+
+type CommandResponse struct {
+	ResponseType CommandResponseType `json:"response_type"`
+	Text         string              `json:"text"`
+}
+
+type Reminder struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	ChannelID   uuid.UUID  `json:"channel_id"`
+	Text        string     `json:"text"`
+	RemindAt    time.Time  `json:"remind_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -12,18 +12,28 @@ const (
 	EventReactionRemoved EventType = "reaction.removed"
 	EventTyping          EventType = "typing"
 	EventPresenceUpdate  EventType = "presence.update"
+	EventPresencePing    EventType = "presence.ping"
 	EventChannelCreated  EventType = "channel.created"
 	EventChannelUpdated  EventType = "channel.updated"
 	EventChannelDeleted  EventType = "channel.deleted"
 	EventMemberJoined    EventType = "member.joined"
 	EventMemberLeft      EventType = "member.left"
 
+	// Ephemeral messages are delivered to a single user and never stored
+	EventMessageEphemeral EventType = "message.ephemeral"
+
+	// Sent on reconnect when missed events can no longer be replayed
+	EventResyncRequired EventType = "resync.required"
+
 	// DM events
 	EventDMCreated EventType = "dm.created"
 
 	// Mention events
 	EventMentionNew EventType = "mention.new"
 
+	// Reminder events (set via /remind)
+	EventReminderDue EventType = "reminder.due"
+
 	// Call events
 	EventCallInitiate     EventType = "call.initiate"
 	EventCallRinging      EventType = "call.ringing"
@@ -39,8 +49,12 @@ const (
 	EventCallMissed       EventType = "call.missed"
 )
 
+// WebSocketEvent is the frame exchanged over the WebSocket. Seq is set on
+// server events that can be replayed: it increases per channel for channel
+// events and per user for user-targeted events.
 type WebSocketEvent struct {
 	Type      EventType       `json:"type"`
 	ChannelID string          `json:"channel_id,omitempty"`
+	Seq       int64           `json:"seq,omitempty"`
 	Payload   json.RawMessage `json:"payload"`
 }
@@ -6,15 +6,70 @@ import (
 	"github.com/google/uuid"
 )
 
+// FileAttachment is an uploaded file. ContentType is sniffed from the file's
+// contents. Images also have their dimensions and, if they could be decoded,
+// thumbnails in ThumbnailSizes (the longest side, in pixels).
 type FileAttachment struct {
-	ID          uuid.UUID  `json:"id"`
-	MessageID   *uuid.UUID `json:"message_id,omitempty"`
-	ChannelID   uuid.UUID  `json:"channel_id"`
-	UserID      uuid.UUID  `json:"user_id"`
-	Filename    string     `json:"filename"`
-	ContentType string     `json:"content_type"`
-	SizeBytes   int64      `json:"size_bytes"`
-	StorageKey  string     `json:"-"`
-	DownloadURL string     `json:"download_url,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID             uuid.UUID  `json:"id"`
+	MessageID      *uuid.UUID `json:"message_id,omitempty"`
+	ChannelID      uuid.UUID  `json:"channel_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Filename       string     `json:"filename"`
+	ContentType    string     `json:"content_type"`
+	SizeBytes      int64      `json:"size_bytes"`
+	Width          *int       `json:"width,omitempty"`
+	Height         *int       `json:"height,omitempty"`
+	StorageKey     string     `json:"-"`
+	ThumbnailSizes []int      `json:"-"`
+	DownloadURL    string     `json:"download_url,omitempty"`
+	ThumbnailURL   string     `json:"thumbnail_url,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// SetThumbnailURL points ThumbnailURL at the thumbnail endpoint if the file
+// has thumbnails.
+func (a *FileAttachment) SetThumbnailURL() {
+	if len(a.ThumbnailSizes) > 0 {
+		a.ThumbnailURL = "/api/v1/files/" + a.ID.String() + "/thumbnail"
+	}
+}
+
+// FileUpload is a direct-to-storage upload in progress. A single-part upload
+// is sent with one PUT to URL. A multipart upload is sent in PartCount parts
+// of PartSize bytes (the last may be smaller), each PUT to its own URL, and
+// can be resumed by uploading only the parts missing from UploadedParts.
+type FileUpload struct {
+	ID            uuid.UUID    `json:"id"`
+	ChannelID     uuid.UUID    `json:"channel_id"`
+	UserID        uuid.UUID    `json:"user_id"`
+	Filename      string       `json:"filename"`
+	ContentType   string       `json:"content_type"`
+	SizeBytes     int64        `json:"size_bytes"`
+	StorageKey    string       `json:"-"`
+	MultipartID   string       `json:"-"`
+	Multipart     bool         `json:"multipart"`
+	PartSize      int64        `json:"part_size,omitempty"`
+	PartCount     int          `json:"part_count,omitempty"`
+	URL           string       `json:"url,omitempty"`
+	UploadedParts []UploadPart `json:"uploaded_parts,omitempty"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// UploadPart is one part of a multipart upload: either one already uploaded,
+// with its size, or one to upload, with a presigned PUT URL.
+type UploadPart struct {
+	PartNumber int    `json:"part_number"`
+	Size       int64  `json:"size,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+type CreateUploadRequest struct {
+	Filename    string `json:"filename" validate:"required,max=255"`
+	ContentType string `json:"content_type" validate:"required,max=100"`
+	SizeBytes   int64  `json:"size_bytes" validate:"required,min=1"`
+}
+
+type UploadPartsRequest struct {
+	PartNumbers []int `json:"part_numbers" validate:"required,min=1,max=100,dive,min=1"`
 }
@@ -19,12 +19,27 @@ type Message struct {
 	EditedAt      *time.Time       `json:"edited_at,omitempty"`
 	DeletedAt     *time.Time       `json:"deleted_at,omitempty"`
 	CreatedAt     time.Time        `json:"created_at"`
+	PinnedAt      *time.Time       `json:"pinned_at,omitempty"`
+	PinnedBy      *uuid.UUID       `json:"pinned_by,omitempty"`
 	User          *User            `json:"user,omitempty"`
 	Reactions     []ReactionGroup  `json:"reactions,omitempty"`
 	Attachments   []FileAttachment `json:"attachments,omitempty"`
 	ReplyCount    int              `json:"reply_count"`
 }
 
+// EphemeralMessage is shown to a single user (e.g. a bot reply or command error)
+// and is never written to the messages table. UserID is the author; nil means
+// the message comes from the system.
+type EphemeralMessage struct {
+	ID          uuid.UUID  `json:"id"`
+	ChannelID   uuid.UUID  `json:"channel_id"`
+	UserID      *uuid.UUID `json:"user_id,omitempty"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"`
+	Content     string     `json:"content"`
+	IsEphemeral bool       `json:"is_ephemeral"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
 type CreateMessageRequest struct {
 	Content       string      `json:"content" validate:"required,min=1,max=10000"`
 	ParentID      *uuid.UUID  `json:"parent_id"`
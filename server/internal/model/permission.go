@@ -0,0 +1,79 @@
+package model
+
+// ChannelRole is a member's role within a single channel, independent of the
+// workspace-wide UserRole.
+type ChannelRole string
+
+const (
+	ChannelRoleOwner  ChannelRole = "owner"
+	ChannelRoleAdmin  ChannelRole = "admin"
+	ChannelRoleMember ChannelRole = "member"
+)
+
+// ChannelPermission is a capability checked against a member's channel role.
+type ChannelPermission string
+
+const (
+	PermEditChannel    ChannelPermission = "edit_channel" // name, topic, description, posting policies
+	PermInviteMembers  ChannelPermission = "invite_members"
+	PermKickMembers    ChannelPermission = "kick_members"
+	PermManageRoles    ChannelPermission = "manage_roles"
+	PermDeleteChannel  ChannelPermission = "delete_channel"
+	PermPinMessages    ChannelPermission = "pin_messages"
+	PermDeleteMessages ChannelPermission = "delete_messages" // delete other members' messages
+	PermPostReadonly   ChannelPermission = "post_readonly"   // post despite read-only, threads-only and slow mode
+	PermManageWebhooks ChannelPermission = "manage_webhooks"
+	PermStartCalls     ChannelPermission = "start_calls"
+)
+
+var memberPermissions = []ChannelPermission{
+	PermInviteMembers,
+	PermPinMessages,
+	PermStartCalls,
+}
+
+var adminPermissions = append([]ChannelPermission{
+	PermEditChannel,
+	PermKickMembers,
+	PermDeleteMessages,
+	PermPostReadonly,
+	PermManageWebhooks,
+}, memberPermissions...)
+
+var ownerPermissions = append([]ChannelPermission{
+	PermManageRoles,
+	PermDeleteChannel,
+}, adminPermissions...)
+
+// Permissions returns the capabilities granted by the role.
+func (r ChannelRole) Permissions() []ChannelPermission {
+	switch r {
+	case ChannelRoleOwner:
+		return ownerPermissions
+	case ChannelRoleAdmin:
+		return adminPermissions
+	case ChannelRoleMember:
+		return memberPermissions
+	default:
+		return nil
+	}
+}
+
+func (r ChannelRole) Can(perm ChannelPermission) bool {
+	for _, p := range r.Permissions() {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelPermissions is the caller's effective role and capabilities in a channel.
+type ChannelPermissions struct {
+	Role        ChannelRole         `json:"role,omitempty"`
+	Permissions []ChannelPermission `json:"permissions"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role ChannelRole `json:"role" validate:"required,oneof=owner admin member"`
+}
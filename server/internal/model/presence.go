@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PresenceStatus string
+
+const (
+	PresenceActive  PresenceStatus = "active"
+	PresenceAway    PresenceStatus = "away"
+	PresenceDND     PresenceStatus = "dnd"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// Presence is a user's effective presence. Status combines the connection state,
+// the manual status and idle detection; ManualStatus is what the user chose.
+type Presence struct {
+	UserID          uuid.UUID      `json:"user_id"`
+	Online          bool           `json:"online"`
+	Status          PresenceStatus `json:"status"`
+	ManualStatus    PresenceStatus `json:"manual_status"`
+	DNDUntil        *time.Time     `json:"dnd_until,omitempty"`
+	StatusText      string         `json:"status_text"`
+	StatusEmoji     string         `json:"status_emoji"`
+	StatusExpiresAt *time.Time     `json:"status_expires_at,omitempty"`
+	LastActiveAt    *time.Time     `json:"last_active_at,omitempty"`
+}
+
+type UpdatePresenceRequest struct {
+	Status   PresenceStatus `json:"status" validate:"required,oneof=active away dnd"`
+	DNDUntil *time.Time     `json:"dnd_until"`
+}
+
+type UpdateCustomStatusRequest struct {
+	Text      string     `json:"text" validate:"max=100"`
+	Emoji     string     `json:"emoji" validate:"max=64"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SCIMToken authenticates an identity provider's SCIM requests. Token is only
+// set in the response that creates it.
+type SCIMToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatorID  uuid.UUID  `json:"creator_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type CreateSCIMTokenRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+}
@@ -15,16 +15,17 @@ const (
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Email        string    `json:"email"`
-	Name         string    `json:"name"`
-	PasswordHash string    `json:"-"`
-	GoogleID     *string   `json:"-"`
-	AvatarURL    string    `json:"avatar_url"`
-	Role         UserRole  `json:"role"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	PasswordHash  string    `json:"-"`
+	GoogleID      *string   `json:"-"`
+	AvatarURL     string    `json:"avatar_url"`
+	Role          UserRole  `json:"role"`
+	IsActive      bool      `json:"is_active"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type RegisterRequest struct {
@@ -34,15 +35,69 @@ type RegisterRequest struct {
 	InviteToken *string `json:"invite_token,omitempty"`
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ConfirmPasswordResetRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 
 type AuthResponse struct {
-	User         User   `json:"user"`
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	User          User     `json:"user"`
+	AccessToken   string   `json:"access_token"`
+	RefreshToken  string   `json:"refresh_token"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // only when 2FA was set up during login
+}
+
+// TwoFactorChallenge is returned by login instead of tokens when a second
+// factor is needed. With SetupRequired the user has no authenticator yet and
+// must enroll first, because the workspace requires 2FA.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	SetupRequired     bool      `json:"setup_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required,max=32"` // TOTP or recovery code
+}
+
+type TwoFactorSetupRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+// TwoFactorEnrollment is the secret to add to an authenticator app, also as an
+// otpauth:// URI for QR codes.
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type RefreshRequest struct {
@@ -54,6 +109,33 @@ type UpdateUserRequest struct {
 	AvatarURL *string `json:"avatar_url" validate:"omitempty,max=500"`
 }
 
+// UpdateUserRoleRequest sets a user's workspace role. Bot accounts keep RoleBot.
+type UpdateUserRoleRequest struct {
+	Role UserRole `json:"role" validate:"required,oneof=admin member"`
+}
+
+// ResetPasswordRequest sets a new password for a user on their behalf.
+type ResetPasswordRequest struct {
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
 type GoogleOAuthRequest struct {
 	Credential string `json:"credential" validate:"required"`
 }
+
+// SSOProvider is a configured single sign-on provider, for login buttons.
+type SSOProvider struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type SSOAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// OIDCCallbackRequest carries the query parameters the provider redirected
+// back with.
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
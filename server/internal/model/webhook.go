@@ -8,13 +8,14 @@ import (
 )
 
 type Webhook struct {
-	ID        uuid.UUID `json:"id"`
-	ChannelID uuid.UUID `json:"channel_id"`
-	Name      string    `json:"name"`
-	Token     string    `json:"token,omitempty"`
-	CreatorID uuid.UUID `json:"creator_id"`
-	IsActive  bool      `json:"is_active"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID  `json:"id"`
+	ChannelID uuid.UUID  `json:"channel_id"`
+	Name      string     `json:"name"`
+	Token     string     `json:"token,omitempty"`
+	CreatorID uuid.UUID  `json:"creator_id"`
+	BotUserID *uuid.UUID `json:"bot_user_id,omitempty"`
+	IsActive  bool       `json:"is_active"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 type CreateWebhookRequest struct {
@@ -29,3 +30,49 @@ type WebhookPayload struct {
 	Message  string          `json:"message" validate:"required,max=5000"`
 	Metadata json.RawMessage `json:"metadata,omitempty"`
 }
+
+type OutgoingWebhook struct {
+	ID        uuid.UUID `json:"id"`
+	ChannelID uuid.UUID `json:"channel_id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatorID uuid.UUID `json:"creator_id"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// The creator's workspace role and whether their account is active, for
+	// re-checking their access when events are dispatched
+	CreatorRole   string `json:"-"`
+	CreatorActive bool   `json:"-"`
+}
+
+type CreateOutgoingWebhookRequest struct {
+	ChannelID uuid.UUID `json:"channel_id" validate:"required"`
+	Name      string    `json:"name" validate:"required,min=2,max=100"`
+	URL       string    `json:"url" validate:"required,url,max=2000"`
+	Events    []string  `json:"events" validate:"required,min=1,dive,oneof=message.new message.updated message.deleted reaction.added reaction.removed channel.updated channel.deleted member.joined member.left mention.new call.ringing call.accepted call.declined call.ended call.missed"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// WorkspaceSettings are workspace-wide policies managed by admins.
+type WorkspaceSettings struct {
+	RequireTwoFactor bool      `json:"require_two_factor"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type UpdateWorkspaceSettingsRequest struct {
+	RequireTwoFactor *bool `json:"require_two_factor"`
+}
@@ -0,0 +1,301 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"github.com/feather-chat/feather/internal/config"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrInvalidCode    = errors.New("invalid authorization code")
+	ErrMissingEmail   = errors.New("identity provider returned no email")
+	ErrUnavailable    = errors.New("identity provider unavailable")
+)
+
+const (
+	// metadataTTL is how long discovery metadata and keys are cached.
+	metadataTTL = time.Hour
+	// minKeyRefresh limits refetching the key set for unknown key IDs, which
+	// anyone can put in a token header.
+	minKeyRefresh = time.Minute
+)
+
+// Identity is a user as asserted by the identity provider's ID token.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// metadata is the part of the discovery document we use.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is one configured OpenID Connect identity provider. It signs users
+// in with the authorization code flow and PKCE, and verifies ID tokens against
+// the provider's published keys. Discovery metadata and keys are fetched
+// lazily and cached.
+type Provider struct {
+	cfg         config.OIDCProviderConfig
+	redirectURL string
+	client      *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	metaFetched time.Time
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+func NewProvider(cfg config.OIDCProviderConfig, redirectURL string) *Provider {
+	return &Provider{
+		cfg:         cfg,
+		redirectURL: redirectURL,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) ID() string   { return p.cfg.ID }
+func (p *Provider) Name() string { return p.cfg.Name }
+
+// AllowedDomains lists the email domains that may sign up.
+func (p *Provider) AllowedDomains() []string {
+	return p.cfg.AllowedDomains
+}
+
+// GroupMapping maps the provider's group names to Feather user group names.
+func (p *Provider) GroupMapping() map[string]string {
+	return p.cfg.GroupMapping
+}
+
+// AuthCodeURL returns the provider's authorization URL for a login with the
+// given state, nonce and PKCE verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	oc, err := p.oauthConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oc.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	), nil
+}
+
+// Exchange redeems an authorization code and returns the verified identity
+// from its ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	oc, err := p.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := oc.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		var re *oauth2.RetrieveError
+		if errors.As(err, &re) && re.Response != nil && re.Response.StatusCode < 500 {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCode, err)
+		}
+		return nil, fmt.Errorf("%w: exchange code: %v", ErrUnavailable, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidIDToken)
+	}
+	return p.Verify(ctx, rawIDToken, nonce)
+}
+
+// Verify checks an ID token's signature, issuer, audience, expiry and nonce
+// and maps its claims.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(rawIDToken,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.key(ctx, meta.JWKSURI, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return p.mapClaims(claims)
+}
+
+// mapClaims reads the identity from the configured claims.
+func (p *Provider) mapClaims(claims jwt.MapClaims) (*Identity, error) {
+	id := &Identity{}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+
+	id.Email, _ = claims[p.claim(p.cfg.EmailClaim, "email")].(string)
+	if id.Email == "" {
+		return nil, ErrMissingEmail
+	}
+	// Without email_verified the address is unverified, unless the provider is
+	// configured to vouch for every address it issues
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	default:
+		id.EmailVerified = p.cfg.TrustEmail
+	}
+
+	id.Name, _ = claims[p.claim(p.cfg.NameClaim, "name")].(string)
+	if id.Name == "" {
+		id.Name = id.Email
+	}
+
+	switch v := claims[p.claim(p.cfg.GroupsClaim, "groups")].(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		id.Groups = []string{v}
+	}
+	return id, nil
+}
+
+func (p *Provider) claim(configured, fallback string) string {
+	if configured != "" {
+		return configured
+	}
+	return fallback
+}
+
+func (p *Provider) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.redirectURL,
+		Scopes:       scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  meta.AuthorizationEndpoint,
+			TokenURL: meta.TokenEndpoint,
+		},
+	}, nil
+}
+
+// metadata returns the cached discovery document, fetching it when stale.
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil && time.Since(p.metaFetched) < metadataTTL {
+		return p.meta, nil
+	}
+
+	url := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	body, err := p.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("%w: fetch discovery document: %v", ErrUnavailable, err)
+	}
+	var meta metadata
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return nil, fmt.Errorf("%w: decode discovery document: %v", ErrUnavailable, err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("%w: discovery issuer %q does not match configured issuer %q", ErrUnavailable, meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document is missing endpoints", ErrUnavailable)
+	}
+
+	p.meta = &meta
+	p.metaFetched = time.Now()
+	return p.meta, nil
+}
+
+// key returns the signing key with the key ID. The key set is refetched when
+// stale or when the ID is unknown, since providers rotate keys.
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok && time.Since(p.keysFetched) < metadataTTL {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) >= minKeyRefresh {
+		body, err := p.get(ctx, jwksURI)
+		if err != nil {
+			return nil, fmt.Errorf("fetch jwks: %w", err)
+		}
+		keys, err := parseJWKS(body)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = keys
+		p.keysFetched = time.Now()
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,127 @@
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/middleware"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+type Handler struct {
+	service  *Service
+	validate *validator.Validate
+}
+
+func NewHandler(service *Service, validate *validator.Validate) *Handler {
+	return &Handler{service: service, validate: validate}
+}
+
+// Get returns presence for ?ids=a,b,c, or for every online user when ids is omitted.
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	idsParam := r.URL.Query().Get("ids")
+
+	var (
+		presences []model.Presence
+		err       error
+	)
+	if idsParam == "" {
+		presences, err = h.service.ListOnline(r.Context())
+	} else {
+		var ids []uuid.UUID
+		for _, raw := range strings.Split(idsParam, ",") {
+			id, parseErr := uuid.Parse(strings.TrimSpace(raw))
+			if parseErr != nil {
+				writeError(w, "invalid user id in ids", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+		presences, err = h.service.Get(r.Context(), ids)
+	}
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, presences, http.StatusOK)
+}
+
+func (h *Handler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	var req model.UpdatePresenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	p, err := h.service.SetStatus(r.Context(), userID, req)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, p, http.StatusOK)
+}
+
+func (h *Handler) SetCustomStatus(w http.ResponseWriter, r *http.Request) {
+	var req model.UpdateCustomStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	p, err := h.service.SetCustomStatus(r.Context(), userID, req)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, p, http.StatusOK)
+}
+
+func (h *Handler) ClearCustomStatus(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	p, err := h.service.ClearCustomStatus(r.Context(), userID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, p, http.StatusOK)
+}
+
+func handleServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidDNDUntil):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,123 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/feather-chat/feather/internal/model"
+)
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db: db}
+}
+
+// GetMany returns stored presence rows keyed by user. Users without a row are omitted.
+func (r *Repository) GetMany(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]*model.Presence, error) {
+	query := `
+		SELECT user_id, status, dnd_until, status_text, status_emoji, status_expires_at, last_active_at
+		FROM user_presence WHERE user_id = ANY($1)
+	`
+	rows, err := r.db.Query(ctx, query, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("get presence: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[uuid.UUID]*model.Presence, len(userIDs))
+	for rows.Next() {
+		var p model.Presence
+		if err := rows.Scan(&p.UserID, &p.ManualStatus, &p.DNDUntil, &p.StatusText, &p.StatusEmoji, &p.StatusExpiresAt, &p.LastActiveAt); err != nil {
+			return nil, fmt.Errorf("scan presence: %w", err)
+		}
+		result[p.UserID] = &p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate presence: %w", err)
+	}
+	return result, nil
+}
+
+func (r *Repository) SetStatus(ctx context.Context, userID uuid.UUID, status model.PresenceStatus, dndUntil *time.Time) error {
+	query := `
+		INSERT INTO user_presence (user_id, status, dnd_until, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET status = $2, dnd_until = $3, updated_at = NOW()
+	`
+	if _, err := r.db.Exec(ctx, query, userID, status, dndUntil); err != nil {
+		return fmt.Errorf("set presence status: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) SetCustomStatus(ctx context.Context, userID uuid.UUID, text, emoji string, expiresAt *time.Time) error {
+	query := `
+		INSERT INTO user_presence (user_id, status_text, status_emoji, status_expires_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			status_text = $2, status_emoji = $3, status_expires_at = $4, updated_at = NOW()
+	`
+	if _, err := r.db.Exec(ctx, query, userID, text, emoji, expiresAt); err != nil {
+		return fmt.Errorf("set custom status: %w", err)
+	}
+	return nil
+}
+
+// TouchActivity records client activity and returns the previous activity time.
+func (r *Repository) TouchActivity(ctx context.Context, userID uuid.UUID, at time.Time) (*time.Time, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var prev *time.Time
+	err = tx.QueryRow(ctx,
+		`SELECT last_active_at FROM user_presence WHERE user_id = $1 FOR UPDATE`, userID,
+	).Scan(&prev)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("get last activity: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_presence (user_id, last_active_at, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET last_active_at = $2
+	`, userID, at)
+	if err != nil {
+		return nil, fmt.Errorf("touch activity: %w", err)
+	}
+
+	return prev, tx.Commit(ctx)
+}
+
+// ListWentIdle returns users whose last activity falls in [from, to), i.e. who
+// crossed the idle threshold during a sweep window.
+func (r *Repository) ListWentIdle(ctx context.Context, from, to time.Time) ([]uuid.UUID, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT user_id FROM user_presence WHERE last_active_at >= $1 AND last_active_at < $2`,
+		from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list idle users: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan idle user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
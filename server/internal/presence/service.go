@@ -0,0 +1,238 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/model"
+)
+
+var ErrInvalidDNDUntil = errors.New("dnd_until must be in the future and only set with status dnd")
+
+const (
+	// Users with no client activity for idleTimeout are shown as away
+	idleTimeout = 10 * time.Minute
+	// Activity pings are written at most once per interval per user
+	activityWriteInterval = time.Minute
+	idleSweepInterval     = time.Minute
+	opTimeout             = 5 * time.Second
+	maxLookupIDs          = 200
+)
+
+// ConnectionTracker reports which users are connected and reaches every client.
+type ConnectionTracker interface {
+	GetOnlineUsers() []uuid.UUID
+	BroadcastToAll(data []byte)
+}
+
+type Service struct {
+	repo      *Repository
+	conns     ConnectionTracker
+	lastWrite sync.Map // uuid.UUID -> time.Time of the last activity write
+}
+
+func NewService(repo *Repository, conns ConnectionTracker) *Service {
+	return &Service{repo: repo, conns: conns}
+}
+
+// Get returns the effective presence of each requested user, in request order.
+func (s *Service) Get(ctx context.Context, userIDs []uuid.UUID) ([]model.Presence, error) {
+	if len(userIDs) > maxLookupIDs {
+		userIDs = userIDs[:maxLookupIDs]
+	}
+
+	online := make(map[uuid.UUID]bool)
+	for _, id := range s.conns.GetOnlineUsers() {
+		online[id] = true
+	}
+
+	stored, err := s.repo.GetMany(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := make([]model.Presence, 0, len(userIDs))
+	for _, id := range userIDs {
+		result = append(result, effective(id, stored[id], online[id], now))
+	}
+	return result, nil
+}
+
+// ListOnline returns the presence of every connected user.
+func (s *Service) ListOnline(ctx context.Context) ([]model.Presence, error) {
+	return s.Get(ctx, s.conns.GetOnlineUsers())
+}
+
+func (s *Service) SetStatus(ctx context.Context, userID uuid.UUID, req model.UpdatePresenceRequest) (*model.Presence, error) {
+	if req.DNDUntil != nil && (req.Status != model.PresenceDND || !req.DNDUntil.After(time.Now())) {
+		return nil, ErrInvalidDNDUntil
+	}
+	if err := s.repo.SetStatus(ctx, userID, req.Status, req.DNDUntil); err != nil {
+		return nil, err
+	}
+	return s.broadcastUser(ctx, userID)
+}
+
+func (s *Service) SetCustomStatus(ctx context.Context, userID uuid.UUID, req model.UpdateCustomStatusRequest) (*model.Presence, error) {
+	if err := s.repo.SetCustomStatus(ctx, userID, req.Text, req.Emoji, req.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return s.broadcastUser(ctx, userID)
+}
+
+func (s *Service) ClearCustomStatus(ctx context.Context, userID uuid.UUID) (*model.Presence, error) {
+	return s.SetCustomStatus(ctx, userID, model.UpdateCustomStatusRequest{})
+}
+
+// HandleConnectionChange is called by the hub when a user's first connection
+// opens or last connection closes anywhere in the cluster.
+func (s *Service) HandleConnectionChange(userID uuid.UUID, online bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+
+	if online {
+		// Connecting counts as activity
+		s.lastWrite.Store(userID, time.Now())
+		if _, err := s.repo.TouchActivity(ctx, userID, time.Now()); err != nil {
+			slog.Error("presence: failed to record activity", "error", err, "user_id", userID)
+		}
+	} else {
+		s.lastWrite.Delete(userID)
+	}
+
+	if _, err := s.broadcastUser(ctx, userID); err != nil {
+		slog.Error("presence: failed to broadcast", "error", err, "user_id", userID)
+	}
+}
+
+// RecordActivity handles a client activity ping. Writes are throttled, and a
+// presence update is broadcast when the user comes back from being idle.
+func (s *Service) RecordActivity(userID uuid.UUID) {
+	now := time.Now()
+	if last, ok := s.lastWrite.Load(userID); ok && now.Sub(last.(time.Time)) < activityWriteInterval {
+		return
+	}
+	s.lastWrite.Store(userID, now)
+
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+
+	prev, err := s.repo.TouchActivity(ctx, userID, now)
+	if err != nil {
+		slog.Error("presence: failed to record activity", "error", err, "user_id", userID)
+		return
+	}
+	if prev == nil || now.Sub(*prev) >= idleTimeout {
+		if _, err := s.broadcastUser(ctx, userID); err != nil {
+			slog.Error("presence: failed to broadcast", "error", err, "user_id", userID)
+		}
+	}
+}
+
+// RunIdleSweeper broadcasts away updates for connected users who went idle,
+// until ctx is cancelled.
+func (s *Service) RunIdleSweeper(ctx context.Context) {
+	ticker := time.NewTicker(idleSweepInterval)
+	defer ticker.Stop()
+
+	windowEnd := time.Now().Add(-idleTimeout)
+	for {
+		select {
+		case <-ticker.C:
+			from := windowEnd
+			windowEnd = time.Now().Add(-idleTimeout)
+			s.sweepIdle(ctx, from, windowEnd)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Service) sweepIdle(ctx context.Context, from, to time.Time) {
+	ids, err := s.repo.ListWentIdle(ctx, from, to)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("presence: idle sweep failed", "error", err)
+		}
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	online := make(map[uuid.UUID]bool)
+	for _, id := range s.conns.GetOnlineUsers() {
+		online[id] = true
+	}
+	for _, id := range ids {
+		if !online[id] {
+			continue
+		}
+		if _, err := s.broadcastUser(ctx, id); err != nil {
+			slog.Error("presence: failed to broadcast", "error", err, "user_id", id)
+		}
+	}
+}
+
+// broadcastUser sends the user's current presence to every connected client.
+func (s *Service) broadcastUser(ctx context.Context, userID uuid.UUID) (*model.Presence, error) {
+	presences, err := s.Get(ctx, []uuid.UUID{userID})
+	if err != nil {
+		return nil, err
+	}
+	p := presences[0]
+
+	payload, _ := json.Marshal(p)
+	data, _ := json.Marshal(model.WebSocketEvent{
+		Type:    model.EventPresenceUpdate,
+		Payload: payload,
+	})
+	s.conns.BroadcastToAll(data)
+	return &p, nil
+}
+
+// effective combines stored presence with the connection state. Expired DND
+// and custom statuses are dropped at read time.
+func effective(userID uuid.UUID, stored *model.Presence, online bool, now time.Time) model.Presence {
+	p := model.Presence{
+		UserID:       userID,
+		Online:       online,
+		ManualStatus: model.PresenceActive,
+	}
+	if stored != nil {
+		p.ManualStatus = stored.ManualStatus
+		p.DNDUntil = stored.DNDUntil
+		p.LastActiveAt = stored.LastActiveAt
+		if stored.StatusExpiresAt == nil || stored.StatusExpiresAt.After(now) {
+			p.StatusText = stored.StatusText
+			p.StatusEmoji = stored.StatusEmoji
+			p.StatusExpiresAt = stored.StatusExpiresAt
+		}
+	}
+
+	if p.ManualStatus == model.PresenceDND && p.DNDUntil != nil && !p.DNDUntil.After(now) {
+		p.ManualStatus = model.PresenceActive
+		p.DNDUntil = nil
+	}
+
+	switch {
+	case !online:
+		p.Status = model.PresenceOffline
+	case p.ManualStatus == model.PresenceDND:
+		p.Status = model.PresenceDND
+	case p.ManualStatus == model.PresenceAway:
+		p.Status = model.PresenceAway
+	case p.LastActiveAt == nil || now.Sub(*p.LastActiveAt) >= idleTimeout:
+		p.Status = model.PresenceAway
+	default:
+		p.Status = model.PresenceActive
+	}
+	return p
+}
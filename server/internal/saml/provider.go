@@ -0,0 +1,409 @@
+package saml
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+
+	"github.com/feather-chat/feather/internal/config"
+)
+
+var (
+	ErrInvalidResponse = errors.New("invalid saml response")
+	ErrMissingEmail    = errors.New("identity provider returned no email")
+	ErrUnavailable     = errors.New("identity provider unavailable")
+)
+
+// metadataTTL is how long metadata fetched from a URL is cached.
+const metadataTTL = 24 * time.Hour
+
+// Attributes tried when none is configured, in order. They cover the names and
+// OIDs used by ADFS/Azure AD, Okta, Keycloak and Shibboleth.
+var (
+	emailAttributes = []string{
+		"email", "mail", "emailAddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	nameAttributes = []string{
+		"displayName", "name", "cn",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+	}
+	givenNameAttributes = []string{
+		"givenName", "firstName",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+		"urn:oid:2.5.4.42",
+	}
+	surnameAttributes = []string{
+		"sn", "surname", "lastName",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+		"urn:oid:2.5.4.4",
+	}
+	groupsAttributes = []string{
+		"groups", "memberOf",
+		"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups",
+		"urn:oid:1.3.6.1.4.1.5923.1.5.1.1",
+	}
+)
+
+// Identity is a user as asserted by a validated SAML assertion. AssertionID
+// and ExpiresAt let callers refuse the same assertion twice while it is valid.
+type Identity struct {
+	Subject     string
+	Email       string
+	Name        string
+	Groups      []string
+	AssertionID string
+	ExpiresAt   time.Time
+}
+
+// Provider is one configured SAML identity provider, with Feather as the
+// service provider. Logins use the HTTP-Redirect binding for requests and the
+// HTTP-POST binding for responses, whose assertions must be signed by a
+// certificate in the provider's metadata.
+type Provider struct {
+	cfg         config.SAMLProviderConfig
+	metadataURL string
+	acsURL      string
+	cert        *x509.Certificate
+	key         *rsa.PrivateKey
+	client      *http.Client
+
+	mu         sync.Mutex
+	idp        *gosaml.EntityDescriptor
+	idpFetched time.Time
+}
+
+// NewProvider returns a provider whose service provider endpoints are below
+// baseURL. cert and key may be nil, in which case assertions cannot be
+// encrypted.
+func NewProvider(cfg config.SAMLProviderConfig, baseURL string, cert *x509.Certificate, key *rsa.PrivateKey) *Provider {
+	return &Provider{
+		cfg:         cfg,
+		metadataURL: baseURL + "/metadata",
+		acsURL:      baseURL + "/acs",
+		cert:        cert,
+		key:         key,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) ID() string   { return p.cfg.ID }
+func (p *Provider) Name() string { return p.cfg.Name }
+
+// AllowedDomains lists the email domains that may sign up.
+func (p *Provider) AllowedDomains() []string {
+	return p.cfg.AllowedDomains
+}
+
+// GroupMapping maps the provider's group names to Feather user group names.
+func (p *Provider) GroupMapping() map[string]string {
+	return p.cfg.GroupMapping
+}
+
+// TrustsEmail reports whether the provider's asserted emails count as
+// verified, which lets them sign in to existing accounts with that address.
+func (p *Provider) TrustsEmail() bool {
+	return p.cfg.TrustEmail
+}
+
+// AllowsIDPInitiated reports whether responses the provider sends unprompted
+// are accepted.
+func (p *Provider) AllowsIDPInitiated() bool {
+	return p.cfg.AllowIDPInitiated
+}
+
+// Metadata returns the service provider metadata to register with the
+// identity provider.
+func (p *Provider) Metadata() ([]byte, error) {
+	md := p.serviceProvider(nil).Metadata()
+	// Responses are only accepted through the HTTP-POST binding
+	for i := range md.SPSSODescriptors {
+		acs := md.SPSSODescriptors[i].AssertionConsumerServices[:0]
+		for _, ep := range md.SPSSODescriptors[i].AssertionConsumerServices {
+			if ep.Binding == gosaml.HTTPPostBinding {
+				acs = append(acs, ep)
+			}
+		}
+		md.SPSSODescriptors[i].AssertionConsumerServices = acs
+	}
+
+	buf, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal metadata: %w", err)
+	}
+	return append([]byte(xml.Header), buf...), nil
+}
+
+// AuthnRequest is an authentication request ready to be sent to the provider.
+type AuthnRequest struct {
+	ID  string
+	req *gosaml.AuthnRequest
+	sp  *gosaml.ServiceProvider
+}
+
+// RedirectURL returns the provider URL that takes the request, with relayState
+// to be posted back with the response.
+func (r *AuthnRequest) RedirectURL(relayState string) (string, error) {
+	u, err := r.req.Redirect(url.QueryEscape(relayState), r.sp)
+	if err != nil {
+		return "", fmt.Errorf("encode authn request: %w", err)
+	}
+	return u.String(), nil
+}
+
+// NewAuthnRequest creates an authentication request. Its ID must be passed to
+// ParseResponse to accept the response to it.
+func (p *Provider) NewAuthnRequest(ctx context.Context) (*AuthnRequest, error) {
+	idp, err := p.idpMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sp := p.serviceProvider(idp)
+
+	location := sp.GetSSOBindingLocation(gosaml.HTTPRedirectBinding)
+	if location == "" {
+		return nil, fmt.Errorf("%w: metadata has no HTTP-Redirect single sign-on service", ErrUnavailable)
+	}
+	req, err := sp.MakeAuthenticationRequest(location, gosaml.HTTPRedirectBinding, gosaml.HTTPPostBinding)
+	if err != nil {
+		return nil, fmt.Errorf("make authn request: %w", err)
+	}
+	return &AuthnRequest{ID: req.ID, req: req, sp: sp}, nil
+}
+
+// ParseResponse validates a base64 SAMLResponse posted to the assertion
+// consumer service and maps its assertion's attributes. requestID is the ID of
+// the request it answers, or empty for a provider-initiated login.
+func (p *Provider) ParseResponse(ctx context.Context, samlResponse, requestID string) (*Identity, error) {
+	if requestID == "" && !p.cfg.AllowIDPInitiated {
+		return nil, fmt.Errorf("%w: unsolicited responses are not allowed", ErrInvalidResponse)
+	}
+	raw, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode response: %v", ErrInvalidResponse, err)
+	}
+
+	idp, err := p.idpMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sp := p.serviceProvider(idp)
+	// The library skips InResponseTo checks entirely for provider-initiated logins
+	sp.AllowIDPInitiated = requestID == ""
+
+	assertion, err := sp.ParseXMLResponse(raw, []string{requestID})
+	if err != nil {
+		var ire *gosaml.InvalidResponseError
+		if errors.As(err, &ire) {
+			err = ire.PrivateErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return p.mapAssertion(assertion)
+}
+
+// mapAssertion reads the identity from the configured or default attributes.
+// The subject is the NameID, except for transient NameIDs, which change every
+// login; those users are identified by email instead.
+func (p *Provider) mapAssertion(a *gosaml.Assertion) (*Identity, error) {
+	attrs := map[string][]string{}
+	for _, stmt := range a.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			for _, v := range attr.Values {
+				if v.Value == "" {
+					continue
+				}
+				attrs[attr.Name] = append(attrs[attr.Name], v.Value)
+				if attr.FriendlyName != "" && attr.FriendlyName != attr.Name {
+					attrs[attr.FriendlyName] = append(attrs[attr.FriendlyName], v.Value)
+				}
+			}
+		}
+	}
+	first := func(names ...string) string {
+		for _, n := range names {
+			if vs := attrs[n]; len(vs) > 0 {
+				return strings.TrimSpace(vs[0])
+			}
+		}
+		return ""
+	}
+
+	var nameID *gosaml.NameID
+	if a.Subject != nil {
+		nameID = a.Subject.NameID
+	}
+
+	if a.ID == "" {
+		return nil, fmt.Errorf("%w: assertion has no ID", ErrInvalidResponse)
+	}
+	id := &Identity{AssertionID: a.ID, ExpiresAt: assertionExpiry(a)}
+	id.Email = first(p.attributes(p.cfg.EmailAttribute, emailAttributes)...)
+	if id.Email == "" && nameID != nil && strings.Contains(nameID.Value, "@") {
+		id.Email = strings.TrimSpace(nameID.Value)
+	}
+	if id.Email == "" {
+		return nil, ErrMissingEmail
+	}
+
+	switch {
+	case nameID == nil || nameID.Value == "" || nameID.Format == string(gosaml.TransientNameIDFormat):
+		id.Subject = strings.ToLower(id.Email)
+	default:
+		id.Subject = nameID.Value
+	}
+
+	id.Name = first(p.attributes(p.cfg.NameAttribute, nameAttributes)...)
+	if id.Name == "" {
+		id.Name = strings.TrimSpace(first(givenNameAttributes...) + " " + first(surnameAttributes...))
+	}
+	if id.Name == "" {
+		id.Name = id.Email
+	}
+
+	for _, n := range p.attributes(p.cfg.GroupsAttribute, groupsAttributes) {
+		if vs := attrs[n]; len(vs) > 0 {
+			id.Groups = vs
+			break
+		}
+	}
+	return id, nil
+}
+
+// assertionExpiry returns when the assertion can no longer pass validation:
+// its latest NotOnOrAfter plus the clock skew the checks allow.
+func assertionExpiry(a *gosaml.Assertion) time.Time {
+	var t time.Time
+	if a.Conditions != nil {
+		t = a.Conditions.NotOnOrAfter
+	}
+	if a.Subject != nil {
+		for _, sc := range a.Subject.SubjectConfirmations {
+			if d := sc.SubjectConfirmationData; d != nil && d.NotOnOrAfter.After(t) {
+				t = d.NotOnOrAfter
+			}
+		}
+	}
+	return t.Add(gosaml.MaxClockSkew)
+}
+
+func (p *Provider) attributes(configured string, defaults []string) []string {
+	if configured != "" {
+		return []string{configured}
+	}
+	return defaults
+}
+
+func (p *Provider) serviceProvider(idp *gosaml.EntityDescriptor) *gosaml.ServiceProvider {
+	metadataURL, _ := url.Parse(p.metadataURL)
+	acsURL, _ := url.Parse(p.acsURL)
+
+	nameIDFormat := gosaml.PersistentNameIDFormat
+	if p.cfg.NameIDFormat != "" {
+		nameIDFormat = gosaml.NameIDFormat(p.cfg.NameIDFormat)
+	}
+	return &gosaml.ServiceProvider{
+		EntityID:          p.cfg.EntityID,
+		Key:               p.key,
+		Certificate:       p.cert,
+		HTTPClient:        p.client,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idp,
+		AuthnNameIDFormat: nameIDFormat,
+	}
+}
+
+// idpMetadata returns the provider's metadata. A metadata file is read once;
+// metadata from a URL is refetched daily, and the previous copy is kept while
+// the URL is unreachable.
+func (p *Provider) idpMetadata(ctx context.Context) (*gosaml.EntityDescriptor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idp != nil && (p.cfg.MetadataURL == "" || time.Since(p.idpFetched) < metadataTTL) {
+		return p.idp, nil
+	}
+
+	var data []byte
+	var err error
+	if p.cfg.MetadataURL != "" {
+		data, err = p.get(ctx, p.cfg.MetadataURL)
+	} else {
+		data, err = os.ReadFile(p.cfg.MetadataFile)
+	}
+	if err == nil {
+		var idp *gosaml.EntityDescriptor
+		if idp, err = parseMetadata(data); err == nil {
+			p.idp = idp
+			p.idpFetched = time.Now()
+			return p.idp, nil
+		}
+	}
+
+	if p.idp != nil {
+		slog.Warn("failed to refresh saml metadata, using cached copy", "provider", p.cfg.ID, "error", err)
+		return p.idp, nil
+	}
+	return nil, fmt.Errorf("%w: load metadata: %v", ErrUnavailable, err)
+}
+
+// parseMetadata reads IdP metadata, which is either an EntityDescriptor or an
+// EntitiesDescriptor wrapping one.
+func parseMetadata(data []byte) (*gosaml.EntityDescriptor, error) {
+	if err := xrv.Validate(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("invalid metadata xml: %w", err)
+	}
+
+	var entity gosaml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil {
+		if len(entity.IDPSSODescriptors) == 0 {
+			return nil, errors.New("metadata has no IDPSSODescriptor")
+		}
+		return &entity, nil
+	}
+
+	var entities gosaml.EntitiesDescriptor
+	if err := xml.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("decode metadata: %w", err)
+	}
+	for i, e := range entities.EntityDescriptors {
+		if len(e.IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errors.New("metadata has no IDPSSODescriptor")
+}
+
+func (p *Provider) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+}
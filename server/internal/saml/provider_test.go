@@ -0,0 +1,225 @@
+package saml
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gosaml "github.com/crewjam/saml"
+
+	"github.com/feather-chat/feather/internal/config"
+)
+
+const (
+	testBaseURL   = "https://feather.example.com/api/v1/auth/saml/test"
+	testRequestID = "id-4f1c0b6e2a"
+	testEmail     = "ada@example.com"
+)
+
+// testIDP is an identity provider with a freshly generated signing key, and a
+// Provider that trusts it through its metadata.
+type testIDP struct {
+	idp      *gosaml.IdentityProvider
+	provider *Provider
+}
+
+func newTestIDP(t *testing.T) *testIDP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	idp := &gosaml.IdentityProvider{
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: *metadataURL,
+		SSOURL:      *ssoURL,
+	}
+
+	md, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatalf("marshal metadata: %v", err)
+	}
+	metadataFile := filepath.Join(t.TempDir(), "idp.xml")
+	if err := os.WriteFile(metadataFile, md, 0o600); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+
+	provider := NewProvider(config.SAMLProviderConfig{
+		ID:           "test",
+		Name:         "Test",
+		MetadataFile: metadataFile,
+	}, testBaseURL, nil, nil)
+	return &testIDP{idp: idp, provider: provider}
+}
+
+// assertion returns a valid assertion for testEmail answering testRequestID.
+func (ti *testIDP) assertion(now time.Time) *gosaml.Assertion {
+	return &gosaml.Assertion{
+		ID:           "id-assertion-1",
+		IssueInstant: now,
+		Version:      "2.0",
+		Issuer: gosaml.Issuer{
+			Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+			Value:  ti.idp.MetadataURL.String(),
+		},
+		Subject: &gosaml.Subject{
+			NameID: &gosaml.NameID{
+				Format: string(gosaml.PersistentNameIDFormat),
+				Value:  "user-1234",
+			},
+			SubjectConfirmations: []gosaml.SubjectConfirmation{{
+				Method: "urn:oasis:names:tc:SAML:2.0:cm:bearer",
+				SubjectConfirmationData: &gosaml.SubjectConfirmationData{
+					InResponseTo: testRequestID,
+					NotOnOrAfter: now.Add(5 * time.Minute),
+					Recipient:    testBaseURL + "/acs",
+				},
+			}},
+		},
+		Conditions: &gosaml.Conditions{
+			NotBefore:    now.Add(-time.Minute),
+			NotOnOrAfter: now.Add(5 * time.Minute),
+			AudienceRestrictions: []gosaml.AudienceRestriction{{
+				Audience: gosaml.Audience{Value: testBaseURL + "/metadata"},
+			}},
+		},
+		AuthnStatements: []gosaml.AuthnStatement{{
+			AuthnInstant: now,
+			SessionIndex: "session-1",
+		}},
+		AttributeStatements: []gosaml.AttributeStatement{{
+			Attributes: []gosaml.Attribute{
+				{Name: "email", Values: []gosaml.AttributeValue{{Type: "xs:string", Value: testEmail}}},
+				{Name: "displayName", Values: []gosaml.AttributeValue{{Type: "xs:string", Value: "Ada Lovelace"}}},
+			},
+		}},
+	}
+}
+
+// respond signs the assertion and wraps it in a signed response, encoded as
+// the SAMLResponse form value.
+func (ti *testIDP) respond(t *testing.T, a *gosaml.Assertion, inResponseTo string, now time.Time) string {
+	t.Helper()
+
+	req := &gosaml.IdpAuthnRequest{
+		IDP:             ti.idp,
+		Request:         gosaml.AuthnRequest{ID: inResponseTo},
+		SPSSODescriptor: &gosaml.SPSSODescriptor{},
+		ACSEndpoint: &gosaml.IndexedEndpoint{
+			Binding:  gosaml.HTTPPostBinding,
+			Location: testBaseURL + "/acs",
+		},
+		Assertion: a,
+		Now:       now,
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatalf("make response: %v", err)
+	}
+	return form.SAMLResponse
+}
+
+func TestParseResponseAcceptsValidResponse(t *testing.T) {
+	ti := newTestIDP(t)
+	now := time.Now()
+
+	id, err := ti.provider.ParseResponse(context.Background(), ti.respond(t, ti.assertion(now), testRequestID, now), testRequestID)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if id.Email != testEmail {
+		t.Errorf("email = %q, want %q", id.Email, testEmail)
+	}
+	if id.Subject != "user-1234" {
+		t.Errorf("subject = %q, want %q", id.Subject, "user-1234")
+	}
+	if id.Name != "Ada Lovelace" {
+		t.Errorf("name = %q, want %q", id.Name, "Ada Lovelace")
+	}
+}
+
+func TestParseResponseRejectsInvalidResponses(t *testing.T) {
+	ti := newTestIDP(t)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		response func() string
+	}{
+		{
+			name: "tampered signature",
+			response: func() string {
+				raw, _ := base64.StdEncoding.DecodeString(ti.respond(t, ti.assertion(now), testRequestID, now))
+				tampered := strings.Replace(string(raw), testEmail, "eve@example.com", 1)
+				return base64.StdEncoding.EncodeToString([]byte(tampered))
+			},
+		},
+		{
+			name: "wrong audience",
+			response: func() string {
+				a := ti.assertion(now)
+				a.Conditions.AudienceRestrictions[0].Audience.Value = "https://other.example.com/metadata"
+				return ti.respond(t, a, testRequestID, now)
+			},
+		},
+		{
+			name: "expired assertion",
+			response: func() string {
+				a := ti.assertion(now)
+				a.Conditions.NotBefore = now.Add(-time.Hour)
+				a.Conditions.NotOnOrAfter = now.Add(-30 * time.Minute)
+				a.Subject.SubjectConfirmations[0].SubjectConfirmationData.NotOnOrAfter = now.Add(-30 * time.Minute)
+				return ti.respond(t, a, testRequestID, now)
+			},
+		},
+		{
+			name: "wrong InResponseTo",
+			response: func() string {
+				a := ti.assertion(now)
+				a.Subject.SubjectConfirmations[0].SubjectConfirmationData.InResponseTo = "id-someone-else"
+				return ti.respond(t, a, "id-someone-else", now)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ti.provider.ParseResponse(context.Background(), tt.response(), testRequestID)
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidResponse)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/feather-chat/feather/internal/database"
+)
+
+type attrKind int
+
+const (
+	attrString    attrKind = iota // compared case-insensitively
+	attrCaseExact                 // compared as is
+	attrBool
+	attrTime
+	attrMember // group membership, eq and pr only
+)
+
+type attribute struct {
+	column string
+	kind   attrKind
+}
+
+// userAttributes are the User attributes a filter can use, lowercased.
+var userAttributes = map[string]attribute{
+	"id":                {"u.id::text", attrString},
+	"username":          {"u.email", attrString},
+	"emails":            {"u.email", attrString},
+	"emails.value":      {"u.email", attrString},
+	"externalid":        {"ui.subject", attrCaseExact},
+	"displayname":       {"u.name", attrString},
+	"name.formatted":    {"u.name", attrString},
+	"active":            {"u.is_active", attrBool},
+	"meta.created":      {"u.created_at", attrTime},
+	"meta.lastmodified": {"u.updated_at", attrTime},
+}
+
+// groupAttributes are the Group attributes a filter can use, lowercased.
+var groupAttributes = map[string]attribute{
+	"id":                {"g.id::text", attrString},
+	"displayname":       {"g.name", attrString},
+	"externalid":        {"g.external_id", attrCaseExact},
+	"members":           {"g.id", attrMember},
+	"members.value":     {"g.id", attrMember},
+	"meta.created":      {"g.created_at", attrTime},
+	"meta.lastmodified": {"g.updated_at", attrTime},
+}
+
+// compileFilter translates a SCIM filter (RFC 7644 section 3.4.2.2) into a SQL
+// condition over attrs, with placeholders numbered from $1. Value path filters
+// such as emails[type eq "work"] are not supported.
+func compileFilter(filter string, attrs map[string]attribute) (string, []interface{}, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	p := &filterParser{tokens: tokens, attrs: attrs}
+	sql, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return "", nil, errInvalidFilter("unexpected %q", tok.text)
+	}
+	return sql, p.args, nil
+}
+
+type token struct {
+	text   string
+	quoted bool // a JSON string; text is the decoded value
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '[' || c == ']':
+			return nil, errInvalidFilter("value path filters are not supported")
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, errInvalidFilter("unterminated string")
+			}
+			var v string
+			if err := json.Unmarshal([]byte(s[i:j+1]), &v); err != nil {
+				return nil, errInvalidFilter("invalid string %s", s[i:j+1])
+			}
+			tokens = append(tokens, token{text: v, quoted: true})
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n()[]\"", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{text: s[i:j]})
+			i = j
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errInvalidFilter("empty filter")
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+	attrs  map[string]attribute
+	args   []interface{}
+}
+
+func (p *filterParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *filterParser) next() (token, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return token{}, errInvalidFilter("unexpected end of filter")
+	}
+	p.pos++
+	return tok, nil
+}
+
+// keyword reports whether the next token is the unquoted word kw, and consumes it.
+func (p *filterParser) keyword(kw string) bool {
+	tok, ok := p.peek()
+	if ok && !tok.quoted && strings.EqualFold(tok.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (string, error) {
+	if p.keyword("not") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + inner, nil
+	}
+	if p.keyword("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if !p.keyword(")") {
+			return "", errInvalidFilter("missing closing parenthesis")
+		}
+		return "(" + inner + ")", nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (string, error) {
+	tok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if tok.quoted {
+		return "", errInvalidFilter("expected an attribute, got %q", tok.text)
+	}
+	attr, ok := p.attrs[attributeName(tok.text)]
+	if !ok {
+		return "", errInvalidFilter("unsupported attribute %q", tok.text)
+	}
+
+	opTok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	op := strings.ToLower(opTok.text)
+	if opTok.quoted {
+		return "", errInvalidFilter("expected an operator, got %q", opTok.text)
+	}
+	if op == "pr" {
+		return present(attr), nil
+	}
+
+	valTok, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	value, err := filterValue(valTok)
+	if err != nil {
+		return "", err
+	}
+	return p.compare(attr, op, value)
+}
+
+// attributeName lowercases an attribute path and strips its schema URN, so
+// urn:ietf:params:scim:schemas:core:2.0:User:userName becomes username.
+func attributeName(path string) string {
+	path = strings.ToLower(path)
+	if strings.HasPrefix(path, "urn:") {
+		path = path[strings.LastIndex(path, ":")+1:]
+	}
+	return path
+}
+
+func filterValue(tok token) (interface{}, error) {
+	if tok.quoted {
+		return tok.text, nil
+	}
+	switch strings.ToLower(tok.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	var n float64
+	if err := json.Unmarshal([]byte(tok.text), &n); err != nil {
+		return nil, errInvalidFilter("invalid value %q", tok.text)
+	}
+	return n, nil
+}
+
+func present(attr attribute) string {
+	switch attr.kind {
+	case attrBool, attrTime:
+		return attr.column + " IS NOT NULL"
+	case attrMember:
+		return "EXISTS (SELECT 1 FROM user_group_members gm WHERE gm.group_id = " + attr.column + ")"
+	default:
+		return "(" + attr.column + " IS NOT NULL AND " + attr.column + " <> '')"
+	}
+}
+
+var comparisons = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+func (p *filterParser) compare(attr attribute, op string, value interface{}) (string, error) {
+	sqlOp, isComparison := comparisons[op]
+	isMatch := op == "co" || op == "sw" || op == "ew"
+	if !isComparison && !isMatch {
+		return "", errInvalidFilter("unsupported operator %q", op)
+	}
+
+	switch attr.kind {
+	case attrBool:
+		b, ok := value.(bool)
+		if !ok || (op != "eq" && op != "ne") {
+			return "", errInvalidFilter("boolean attributes only support eq and ne with true or false")
+		}
+		return fmt.Sprintf("%s %s %s", attr.column, sqlOp, p.arg(b)), nil
+
+	case attrTime:
+		s, _ := value.(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil || !isComparison {
+			return "", errInvalidFilter("date attributes need a comparison with an RFC 3339 timestamp")
+		}
+		return fmt.Sprintf("%s %s %s", attr.column, sqlOp, p.arg(t)), nil
+
+	case attrMember:
+		s, ok := value.(string)
+		if !ok || op != "eq" {
+			return "", errInvalidFilter("members only supports eq with a user id")
+		}
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM user_group_members gm WHERE gm.group_id = %s AND gm.user_id::text = %s)",
+			attr.column, p.arg(strings.ToLower(s))), nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", errInvalidFilter("%s needs a string value", op)
+	}
+	column, placeholder := attr.column, ""
+	if isMatch {
+		pattern := database.EscapeLike(s)
+		switch op {
+		case "co":
+			pattern = "%" + pattern + "%"
+		case "sw":
+			pattern = pattern + "%"
+		case "ew":
+			pattern = "%" + pattern
+		}
+		placeholder = p.arg(pattern)
+	} else {
+		placeholder = p.arg(s)
+	}
+	if attr.kind == attrString {
+		column, placeholder = "LOWER("+column+")", "LOWER("+placeholder+")"
+	}
+	if isMatch {
+		return fmt.Sprintf("%s LIKE %s ESCAPE '\\'", column, placeholder), nil
+	}
+	return fmt.Sprintf("%s %s %s", column, sqlOp, placeholder), nil
+}
+
+func (p *filterParser) arg(v interface{}) string {
+	p.args = append(p.args, v)
+	return fmt.Sprintf("$%d", len(p.args))
+}
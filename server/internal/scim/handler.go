@@ -0,0 +1,328 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/middleware"
+	"github.com/feather-chat/feather/internal/model"
+)
+
+const maxBodySize = 1 << 20
+
+type contextKey string
+
+const tokenKey contextKey = "scim_token"
+
+type Handler struct {
+	service  *Service
+	validate *validator.Validate
+}
+
+func NewHandler(service *Service, validate *validator.Validate) *Handler {
+	return &Handler{service: service, validate: validate}
+}
+
+// Authenticate requires a SCIM bearer token created by an admin.
+func (h *Handler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeSCIMError(w, &Error{Status: http.StatusUnauthorized, Detail: "missing bearer token"})
+			return
+		}
+		t, err := h.service.Authenticate(r.Context(), token)
+		if err != nil {
+			writeSCIMError(w, err)
+			return
+		}
+		if t == nil {
+			writeSCIMError(w, &Error{Status: http.StatusUnauthorized, Detail: "invalid bearer token"})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey, t)))
+	})
+}
+
+func getToken(ctx context.Context) *model.SCIMToken {
+	t, _ := ctx.Value(tokenKey).(*model.SCIMToken)
+	return t
+}
+
+// ServiceProviderConfig describes the SCIM features Feather supports.
+func (h *Handler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeSCIM(w, map[string]interface{}{
+		"schemas":        []string{SchemaServiceProviderConfig},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": maxPageSize},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "A SCIM token created by a workspace admin",
+			"primary":     true,
+		}},
+	}, http.StatusOK)
+}
+
+func (h *Handler) ResourceTypes(w http.ResponseWriter, r *http.Request) {
+	types := []map[string]interface{}{
+		{"schemas": []string{SchemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users", "schema": SchemaUser},
+		{"schemas": []string{SchemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": SchemaGroup},
+	}
+	writeSCIM(w, listResponse(types, len(types), len(types), 1), http.StatusOK)
+}
+
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	startIndex, count := pagination(r)
+	list, err := h.service.ListUsers(r.Context(), r.URL.Query().Get("filter"), startIndex, count)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, list, http.StatusOK)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	u, err := h.service.GetUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, u, http.StatusOK)
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req User
+	if !decode(w, r, &req) {
+		return
+	}
+	u, err := h.service.CreateUser(r.Context(), req, getToken(r.Context()))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, u, http.StatusCreated)
+}
+
+func (h *Handler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	var req User
+	if !decode(w, r, &req) {
+		return
+	}
+	u, err := h.service.ReplaceUser(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, u, http.StatusOK)
+}
+
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	var req PatchRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	u, err := h.service.PatchUser(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, u, http.StatusOK)
+}
+
+// DeleteUser deactivates the user.
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteUser(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	startIndex, count := pagination(r)
+	list, err := h.service.ListGroups(r.Context(), r.URL.Query().Get("filter"), startIndex, count, excludeMembers(r))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, list, http.StatusOK)
+}
+
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	g, err := h.service.GetGroup(r.Context(), chi.URLParam(r, "id"), excludeMembers(r))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, g, http.StatusOK)
+}
+
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req Group
+	if !decode(w, r, &req) {
+		return
+	}
+	g, err := h.service.CreateGroup(r.Context(), req, getToken(r.Context()))
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, g, http.StatusCreated)
+}
+
+func (h *Handler) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var req Group
+	if !decode(w, r, &req) {
+		return
+	}
+	g, err := h.service.ReplaceGroup(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, g, http.StatusOK)
+}
+
+func (h *Handler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	var req PatchRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	g, err := h.service.PatchGroup(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	writeSCIM(w, g, http.StatusOK)
+}
+
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteGroup(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeSCIMError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTokens lists the SCIM tokens for the admin settings.
+func (h *Handler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.service.ListTokens(r.Context())
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if tokens == nil {
+		tokens = []model.SCIMToken{}
+	}
+	writeJSON(w, tokens, http.StatusOK)
+}
+
+func (h *Handler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateSCIMTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.service.CreateToken(r.Context(), req, middleware.GetUserID(r.Context()))
+	if err != nil {
+		writeError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, t, http.StatusCreated)
+}
+
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := uuid.Parse(chi.URLParam(r, "tokenID"))
+	if err != nil {
+		writeError(w, "invalid token id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.RevokeToken(r.Context(), tokenID, middleware.GetUserID(r.Context()))
+	switch {
+	case errors.Is(err, ErrTokenNotFound):
+		writeError(w, "scim token not found", http.StatusNotFound)
+	case err != nil:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// pagination reads startIndex and count; a missing count is -1, meaning the
+// default page size.
+func pagination(r *http.Request) (int, int) {
+	q := r.URL.Query()
+	startIndex, err := strconv.Atoi(q.Get("startIndex"))
+	if err != nil {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(q.Get("count"))
+	if err != nil {
+		count = -1
+	}
+	return startIndex, count
+}
+
+func excludeMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if attributeName(strings.TrimSpace(attr)) == "members" {
+			return true
+		}
+	}
+	return false
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		writeSCIMError(w, &Error{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: "invalid request body"})
+		return false
+	}
+	return true
+}
+
+func writeSCIM(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeSCIMError(w http.ResponseWriter, err error) {
+	var scimErr *Error
+	if !errors.As(err, &scimErr) {
+		slog.Error("scim request failed", "error", err)
+		scimErr = &Error{Status: http.StatusInternalServerError, Detail: "internal server error"}
+	}
+	writeSCIM(w, scimErr, scimErr.Status)
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,280 @@
+package scim
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// userState is the part of a user SCIM can change. PATCH operations apply to
+// it in order before anything is written.
+type userState struct {
+	Email      string
+	Name       string
+	GivenName  string
+	FamilyName string
+	ExternalID string
+	Active     bool
+}
+
+// groupState is the part of a group SCIM can change.
+type groupState struct {
+	Name       string
+	ExternalID string
+	Members    map[uuid.UUID]bool
+}
+
+var (
+	emailValuePath  = regexp.MustCompile(`^emails\[.*\]\.value$`)
+	memberValuePath = regexp.MustCompile(`^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+)
+
+func validateOp(op PatchOperation) (string, error) {
+	switch o := strings.ToLower(op.Op); o {
+	case "add", "replace", "remove":
+		return o, nil
+	default:
+		return "", errInvalidValue("unsupported patch op %q", op.Op)
+	}
+}
+
+// splitPathless expands an operation without a path, whose value is an object
+// of attributes, into one operation per attribute.
+func splitPathless(op PatchOperation) ([]PatchOperation, error) {
+	if op.Path != "" {
+		return []PatchOperation{op}, nil
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &attrs); err != nil {
+		return nil, errInvalidValue("patch operations without a path need an object value")
+	}
+	ops := make([]PatchOperation, 0, len(attrs))
+	for path, value := range attrs {
+		ops = append(ops, PatchOperation{Op: op.Op, Path: path, Value: value})
+	}
+	return ops, nil
+}
+
+// applyUserPatch applies operations to a user. Attributes Feather does not
+// store are ignored, so directories that send their full schema still work.
+func applyUserPatch(s *userState, ops []PatchOperation) error {
+	for _, op := range ops {
+		kind, err := validateOp(op)
+		if err != nil {
+			return err
+		}
+		expanded, err := splitPathless(op)
+		if err != nil {
+			return err
+		}
+		for _, op := range expanded {
+			if err := applyUserOp(s, kind, attributeName(op.Path), op.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyUserOp(s *userState, op, path string, value json.RawMessage) error {
+	if op == "remove" {
+		switch path {
+		case "externalid":
+			s.ExternalID = ""
+		case "username", "emails", "active", "displayname", "name", "name.formatted":
+			return errInvalidValue("%s cannot be removed", path)
+		}
+		return nil
+	}
+
+	switch {
+	case path == "active":
+		active, err := decodeBool(value)
+		if err != nil {
+			return err
+		}
+		s.Active = active
+	case path == "username" || emailValuePath.MatchString(path):
+		return decodeString(value, &s.Email)
+	case path == "emails":
+		var emails []Email
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return errInvalidValue("emails must be a list of emails")
+		}
+		if email := primaryEmail(emails); email != "" {
+			s.Email = email
+		}
+	case path == "displayname" || path == "name.formatted":
+		return decodeString(value, &s.Name)
+	case path == "name":
+		var name Name
+		if err := json.Unmarshal(value, &name); err != nil {
+			return errInvalidValue("name must be an object")
+		}
+		s.GivenName, s.FamilyName = name.GivenName, name.FamilyName
+		if name.Formatted != "" {
+			s.Name = name.Formatted
+		} else if full := joinName(name.GivenName, name.FamilyName); full != "" {
+			s.Name = full
+		}
+	case path == "name.givenname":
+		if err := decodeString(value, &s.GivenName); err != nil {
+			return err
+		}
+		s.Name = joinName(s.GivenName, s.FamilyName)
+	case path == "name.familyname":
+		if err := decodeString(value, &s.FamilyName); err != nil {
+			return err
+		}
+		s.Name = joinName(s.GivenName, s.FamilyName)
+	case path == "externalid":
+		return decodeString(value, &s.ExternalID)
+	}
+	return nil
+}
+
+// applyGroupPatch applies operations to a group. Members that are not users
+// are ignored when the membership is written.
+func applyGroupPatch(s *groupState, ops []PatchOperation) error {
+	for _, op := range ops {
+		kind, err := validateOp(op)
+		if err != nil {
+			return err
+		}
+		expanded, err := splitPathless(op)
+		if err != nil {
+			return err
+		}
+		for _, op := range expanded {
+			if err := applyGroupOp(s, kind, op.Path, op.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyGroupOp(s *groupState, op, rawPath string, value json.RawMessage) error {
+	path := attributeName(rawPath)
+
+	if m := memberValuePath.FindStringSubmatch(path); m != nil {
+		if op != "remove" {
+			return errInvalidPath(rawPath)
+		}
+		if id, err := uuid.Parse(m[1]); err == nil {
+			delete(s.Members, id)
+		}
+		return nil
+	}
+
+	switch path {
+	case "displayname":
+		if op == "remove" {
+			return errInvalidValue("displayName cannot be removed")
+		}
+		return decodeString(value, &s.Name)
+	case "externalid":
+		if op == "remove" {
+			s.ExternalID = ""
+			return nil
+		}
+		return decodeString(value, &s.ExternalID)
+	case "members":
+		if op == "remove" && len(value) == 0 {
+			s.Members = map[uuid.UUID]bool{}
+			return nil
+		}
+		ids, err := decodeMembers(value)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case "replace":
+			s.Members = map[uuid.UUID]bool{}
+			fallthrough
+		case "add":
+			for _, id := range ids {
+				s.Members[id] = true
+			}
+		case "remove":
+			for _, id := range ids {
+				delete(s.Members, id)
+			}
+		}
+		return nil
+	}
+	if strings.Contains(path, "[") {
+		return errInvalidPath(rawPath)
+	}
+	return nil
+}
+
+func decodeMembers(value json.RawMessage) ([]uuid.UUID, error) {
+	var refs []Ref
+	if err := json.Unmarshal(value, &refs); err != nil {
+		var ref Ref
+		if err := json.Unmarshal(value, &ref); err != nil {
+			return nil, errInvalidValue("members must be a list of {\"value\": id}")
+		}
+		refs = []Ref{ref}
+	}
+	ids := make([]uuid.UUID, 0, len(refs))
+	for _, ref := range refs {
+		id, err := uuid.Parse(ref.Value)
+		if err != nil {
+			return nil, errInvalidValue("invalid member id %q", ref.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func decodeString(value json.RawMessage, dst *string) error {
+	if err := json.Unmarshal(value, dst); err != nil {
+		return errInvalidValue("expected a string, got %s", value)
+	}
+	return nil
+}
+
+// decodeBool accepts JSON booleans and the "True"/"False" strings some
+// directories send.
+func decodeBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, errInvalidValue("expected a boolean, got %s", value)
+}
+
+func primaryEmail(emails []Email) string {
+	for _, e := range emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+func joinName(given, family string) string {
+	return strings.TrimSpace(given + " " + family)
+}
+
+// splitName guesses given and family names from a full name.
+func splitName(name string) (string, string) {
+	given, family, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return given, strings.TrimSpace(family)
+}
@@ -0,0 +1,477 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/feather-chat/feather/internal/model"
+)
+
+// identityProvider is the user_identities provider that holds the directory's
+// external ID for users it provisions.
+const identityProvider = "scim"
+
+var errDuplicate = errors.New("duplicate value")
+
+// userRow is a user with the directory's external ID.
+type userRow struct {
+	ID         uuid.UUID
+	Email      string
+	Name       string
+	IsActive   bool
+	ExternalID string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// groupRow is a user group with the directory's external ID.
+type groupRow struct {
+	ID         uuid.UUID
+	Name       string
+	ExternalID string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type Repository struct {
+	db *pgxpool.Pool
+}
+
+func NewRepository(db *pgxpool.Pool) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateToken(ctx context.Context, t *model.SCIMToken, tokenHash string) error {
+	query := `
+		INSERT INTO scim_tokens (id, name, token_hash, creator_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.Exec(ctx, query, t.ID, t.Name, tokenHash, t.CreatorID, t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create scim token: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetTokenByHash(ctx context.Context, tokenHash string) (*model.SCIMToken, error) {
+	query := `SELECT id, name, creator_id, created_at, last_used_at FROM scim_tokens WHERE token_hash = $1`
+	var t model.SCIMToken
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(&t.ID, &t.Name, &t.CreatorID, &t.CreatedAt, &t.LastUsedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get scim token: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *Repository) ListTokens(ctx context.Context) ([]model.SCIMToken, error) {
+	query := `SELECT id, name, creator_id, created_at, last_used_at FROM scim_tokens ORDER BY created_at DESC`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list scim tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []model.SCIMToken
+	for rows.Next() {
+		var t model.SCIMToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatorID, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("scan scim token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteToken deletes a token and returns it, or nil if there was none.
+func (r *Repository) DeleteToken(ctx context.Context, id uuid.UUID) (*model.SCIMToken, error) {
+	query := `DELETE FROM scim_tokens WHERE id = $1 RETURNING id, name, creator_id, created_at, last_used_at`
+	var t model.SCIMToken
+	err := r.db.QueryRow(ctx, query, id).Scan(&t.ID, &t.Name, &t.CreatorID, &t.CreatedAt, &t.LastUsedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("delete scim token: %w", err)
+	}
+	return &t, nil
+}
+
+// TouchToken records that a token was used, at most once a minute.
+func (r *Repository) TouchToken(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE scim_tokens SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	if _, err := r.db.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("touch scim token: %w", err)
+	}
+	return nil
+}
+
+const userSelect = `
+	SELECT u.id, u.email, u.name, u.is_active, COALESCE(ui.subject, ''), u.created_at, u.updated_at
+	FROM users u
+	LEFT JOIN user_identities ui ON ui.user_id = u.id AND ui.provider = 'scim'
+	WHERE u.role <> 'bot'
+`
+
+func scanUser(row pgx.Row) (*userRow, error) {
+	var u userRow
+	if err := row.Scan(&u.ID, &u.Email, &u.Name, &u.IsActive, &u.ExternalID, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUser returns a user by ID. Bot accounts are not visible over SCIM.
+func (r *Repository) GetUser(ctx context.Context, id uuid.UUID) (*userRow, error) {
+	u, err := scanUser(r.db.QueryRow(ctx, userSelect+" AND u.id = $1", id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get scim user: %w", err)
+	}
+	return u, nil
+}
+
+// ListUsers returns a page of users matching the compiled filter, and the
+// number of users that match it.
+func (r *Repository) ListUsers(ctx context.Context, cond string, args []interface{}, limit, offset int) ([]userRow, int, error) {
+	where := ""
+	if cond != "" {
+		where = " AND " + cond
+	}
+
+	var total int
+	countQuery := `
+		SELECT COUNT(*) FROM users u
+		LEFT JOIN user_identities ui ON ui.user_id = u.id AND ui.provider = 'scim'
+		WHERE u.role <> 'bot'` + where
+	if err := r.db.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count scim users: %w", err)
+	}
+	if limit == 0 {
+		return nil, total, nil
+	}
+
+	args = append(args, limit, offset)
+	query := userSelect + where + fmt.Sprintf(" ORDER BY u.created_at ASC, u.id ASC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list scim users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []userRow
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan scim user: %w", err)
+		}
+		users = append(users, *u)
+	}
+	return users, total, rows.Err()
+}
+
+// EmailTaken reports whether another user has the email, ignoring case.
+func (r *Repository) EmailTaken(ctx context.Context, email string, exceptID uuid.UUID) (bool, error) {
+	var taken bool
+	err := r.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)`,
+		email, exceptID,
+	).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("check email: %w", err)
+	}
+	return taken, nil
+}
+
+// CreateUser creates a member without a password; they sign in through the
+// directory's single sign-on, or reset their password by email. The directory
+// vouches for the email address.
+func (r *Repository) CreateUser(ctx context.Context, u *userRow) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO users (id, email, name, role, is_active, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), $6, $6)
+	`
+	if _, err := tx.Exec(ctx, query, u.ID, u.Email, u.Name, model.RoleMember, u.IsActive, u.CreatedAt); err != nil {
+		if isUniqueViolation(err) {
+			return errDuplicate
+		}
+		return fmt.Errorf("create scim user: %w", err)
+	}
+	if err := setExternalID(ctx, tx, u.ID, u.ExternalID, u.Email); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UpdateUser writes the user's email, name and external ID. Activation goes
+// through the user service, which also signs deactivated users out.
+func (r *Repository) UpdateUser(ctx context.Context, u *userRow) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE users SET email = $1, name = $2, updated_at = NOW() WHERE id = $3`
+	if _, err := tx.Exec(ctx, query, u.Email, u.Name, u.ID); err != nil {
+		if isUniqueViolation(err) {
+			return errDuplicate
+		}
+		return fmt.Errorf("update scim user: %w", err)
+	}
+	if err := setExternalID(ctx, tx, u.ID, u.ExternalID, u.Email); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func setExternalID(ctx context.Context, tx pgx.Tx, userID uuid.UUID, externalID, email string) error {
+	_, err := tx.Exec(ctx, `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, userID, identityProvider)
+	if err != nil {
+		return fmt.Errorf("delete scim identity: %w", err)
+	}
+	if externalID == "" {
+		return nil
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)`,
+		userID, identityProvider, externalID, email,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return errDuplicate
+		}
+		return fmt.Errorf("set scim external id: %w", err)
+	}
+	return nil
+}
+
+// GetUserGroups returns the groups each user belongs to.
+func (r *Repository) GetUserGroups(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID][]groupRow, error) {
+	query := `
+		SELECT gm.user_id, g.id, g.name, COALESCE(g.external_id, ''), g.created_at, g.updated_at
+		FROM user_group_members gm
+		JOIN user_groups g ON g.id = gm.group_id
+		WHERE gm.user_id = ANY($1)
+		ORDER BY g.name ASC
+	`
+	rows, err := r.db.Query(ctx, query, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("get user groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[uuid.UUID][]groupRow)
+	for rows.Next() {
+		var userID uuid.UUID
+		var g groupRow
+		if err := rows.Scan(&userID, &g.ID, &g.Name, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan user group: %w", err)
+		}
+		groups[userID] = append(groups[userID], g)
+	}
+	return groups, rows.Err()
+}
+
+const groupSelect = `SELECT g.id, g.name, COALESCE(g.external_id, ''), g.created_at, g.updated_at FROM user_groups g`
+
+func scanGroup(row pgx.Row) (*groupRow, error) {
+	var g groupRow
+	if err := row.Scan(&g.ID, &g.Name, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *Repository) GetGroup(ctx context.Context, id uuid.UUID) (*groupRow, error) {
+	g, err := scanGroup(r.db.QueryRow(ctx, groupSelect+" WHERE g.id = $1", id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get scim group: %w", err)
+	}
+	return g, nil
+}
+
+// ListGroups returns a page of groups matching the compiled filter, and the
+// number of groups that match it.
+func (r *Repository) ListGroups(ctx context.Context, cond string, args []interface{}, limit, offset int) ([]groupRow, int, error) {
+	where := ""
+	if cond != "" {
+		where = " WHERE " + cond
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, "SELECT COUNT(*) FROM user_groups g"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count scim groups: %w", err)
+	}
+	if limit == 0 {
+		return nil, total, nil
+	}
+
+	args = append(args, limit, offset)
+	query := groupSelect + where + fmt.Sprintf(" ORDER BY g.created_at ASC, g.id ASC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list scim groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []groupRow
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan scim group: %w", err)
+		}
+		groups = append(groups, *g)
+	}
+	return groups, total, rows.Err()
+}
+
+// GetGroupMembers returns the members of each group.
+func (r *Repository) GetGroupMembers(ctx context.Context, groupIDs []uuid.UUID) (map[uuid.UUID][]userRow, error) {
+	query := `
+		SELECT gm.group_id, u.id, u.email, u.name
+		FROM user_group_members gm
+		JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = ANY($1)
+		ORDER BY u.name ASC
+	`
+	rows, err := r.db.Query(ctx, query, groupIDs)
+	if err != nil {
+		return nil, fmt.Errorf("get scim group members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make(map[uuid.UUID][]userRow)
+	for rows.Next() {
+		var groupID uuid.UUID
+		var u userRow
+		if err := rows.Scan(&groupID, &u.ID, &u.Email, &u.Name); err != nil {
+			return nil, fmt.Errorf("scan scim group member: %w", err)
+		}
+		members[groupID] = append(members[groupID], u)
+	}
+	return members, rows.Err()
+}
+
+// CreateGroup creates a group with the given members. The token's creator is
+// recorded as the group's creator but is not added to it. Member IDs that are
+// not users are skipped.
+func (r *Repository) CreateGroup(ctx context.Context, g *groupRow, creatorID uuid.UUID, memberIDs []uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO user_groups (id, name, description, creator_id, external_id, created_at, updated_at)
+		VALUES ($1, $2, '', $3, NULLIF($4, ''), $5, $5)
+	`
+	if _, err := tx.Exec(ctx, query, g.ID, g.Name, creatorID, g.ExternalID, g.CreatedAt); err != nil {
+		if isUniqueViolation(err) {
+			return errDuplicate
+		}
+		return fmt.Errorf("create scim group: %w", err)
+	}
+	if err := addMembers(ctx, tx, g.ID, memberIDs); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UpdateGroup writes the group's name and external ID and changes its
+// membership.
+func (r *Repository) UpdateGroup(ctx context.Context, g *groupRow, add, remove []uuid.UUID) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE user_groups SET name = $1, external_id = NULLIF($2, ''), updated_at = NOW() WHERE id = $3`
+	if _, err := tx.Exec(ctx, query, g.Name, g.ExternalID, g.ID); err != nil {
+		if isUniqueViolation(err) {
+			return errDuplicate
+		}
+		return fmt.Errorf("update scim group: %w", err)
+	}
+	if len(remove) > 0 {
+		_, err := tx.Exec(ctx, `DELETE FROM user_group_members WHERE group_id = $1 AND user_id = ANY($2)`, g.ID, remove)
+		if err != nil {
+			return fmt.Errorf("remove scim group members: %w", err)
+		}
+	}
+	if err := addMembers(ctx, tx, g.ID, add); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func addMembers(ctx context.Context, tx pgx.Tx, groupID uuid.UUID, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	query := `
+		INSERT INTO user_group_members (group_id, user_id)
+		SELECT $1, id FROM users WHERE id = ANY($2)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.Exec(ctx, query, groupID, userIDs); err != nil {
+		return fmt.Errorf("add scim group members: %w", err)
+	}
+	return nil
+}
+
+// GetGroupMemberIDs returns the IDs of a group's members.
+func (r *Repository) GetGroupMemberIDs(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.Query(ctx, `SELECT user_id FROM user_group_members WHERE group_id = $1`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("get scim group member ids: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan scim group member id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *Repository) DeleteGroup(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.db.Exec(ctx, "DELETE FROM user_groups WHERE id = $1", id); err != nil {
+		return fmt.Errorf("delete scim group: %w", err)
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
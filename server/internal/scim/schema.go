@@ -0,0 +1,129 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Schema URNs from RFC 7643 and RFC 7644.
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Meta is the resource metadata every SCIM resource carries.
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Ref points to another resource: a group of a user, or a member of a group.
+type Ref struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User is a Feather user as a SCIM User resource. userName is the user's
+// email. Active is a pointer so requests that omit it can be told apart.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Groups      []Ref    `json:"groups,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Group is a Feather user group as a SCIM Group resource.
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Ref    `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Error is a SCIM error response. Services return it for errors the client
+// can act on; scimType is one of the RFC 7644 error types.
+type Error struct {
+	Status   int
+	SCIMType string
+	Detail   string
+}
+
+func (e *Error) Error() string { return e.Detail }
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		SCIMType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail"`
+	}{[]string{SchemaError}, fmt.Sprint(e.Status), e.SCIMType, e.Detail})
+}
+
+func errNotFound(resource, id string) *Error {
+	return &Error{Status: http.StatusNotFound, Detail: fmt.Sprintf("%s %s not found", resource, id)}
+}
+
+func errInvalidValue(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: fmt.Sprintf(format, args...)}
+}
+
+func errInvalidFilter(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: fmt.Sprintf(format, args...)}
+}
+
+func errInvalidPath(path string) *Error {
+	return &Error{Status: http.StatusBadRequest, SCIMType: "invalidPath", Detail: fmt.Sprintf("unsupported path %q", path)}
+}
+
+func errUniqueness(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusConflict, SCIMType: "uniqueness", Detail: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,632 @@
+package scim
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/audit"
+	"github.com/feather-chat/feather/internal/auth"
+	"github.com/feather-chat/feather/internal/model"
+	"github.com/feather-chat/feather/internal/user"
+)
+
+var ErrTokenNotFound = errors.New("scim token not found")
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+	maxNameLength   = 100
+)
+
+// UserLifecycle deactivates and reactivates accounts, revoking the sessions of
+// deactivated users.
+type UserLifecycle interface {
+	Deactivate(ctx context.Context, targetID, actorID uuid.UUID) (*model.User, error)
+	Reactivate(ctx context.Context, targetID, actorID uuid.UUID) (*model.User, error)
+}
+
+// AuditLogger records administrative actions.
+type AuditLogger interface {
+	Log(ctx context.Context, entry audit.Entry)
+}
+
+// Service provisions users and groups for an identity provider. Directory
+// changes have no Feather actor, so they are audited without one.
+type Service struct {
+	repo     *Repository
+	accounts UserLifecycle
+	baseURL  string
+	auditLog AuditLogger
+}
+
+// NewService creates the SCIM service. baseURL is the public URL of the SCIM
+// endpoints, used for resource locations.
+func NewService(repo *Repository, accounts UserLifecycle, baseURL string) *Service {
+	return &Service{repo: repo, accounts: accounts, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// SetAuditLogger enables audit entries for provisioning and token changes.
+func (s *Service) SetAuditLogger(al AuditLogger) {
+	s.auditLog = al
+}
+
+// Authenticate returns the token a bearer token belongs to, or nil.
+func (s *Service) Authenticate(ctx context.Context, token string) (*model.SCIMToken, error) {
+	t, err := s.repo.GetTokenByHash(ctx, auth.HashToken(token))
+	if err != nil || t == nil {
+		return nil, err
+	}
+	if err := s.repo.TouchToken(ctx, t.ID); err != nil {
+		slog.Warn("failed to record scim token use", "error", err)
+	}
+	return t, nil
+}
+
+// CreateToken creates a bearer token for an identity provider. The token is
+// only returned here.
+func (s *Service) CreateToken(ctx context.Context, req model.CreateSCIMTokenRequest, actorID uuid.UUID) (*model.SCIMToken, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	t := &model.SCIMToken{
+		ID:        uuid.New(),
+		Name:      req.Name,
+		CreatorID: actorID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.CreateToken(ctx, t, auth.HashToken(token)); err != nil {
+		return nil, err
+	}
+	t.Token = token
+
+	s.audit(ctx, actorID, audit.ActionSCIMTokenCreated, audit.EntitySCIMToken, t.ID, map[string]interface{}{"name": t.Name})
+	return t, nil
+}
+
+func (s *Service) ListTokens(ctx context.Context) ([]model.SCIMToken, error) {
+	return s.repo.ListTokens(ctx)
+}
+
+// RevokeToken deletes a token; the provider's next request is rejected.
+func (s *Service) RevokeToken(ctx context.Context, id, actorID uuid.UUID) error {
+	t, err := s.repo.DeleteToken(ctx, id)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return ErrTokenNotFound
+	}
+	s.audit(ctx, actorID, audit.ActionSCIMTokenRevoked, audit.EntitySCIMToken, t.ID, map[string]interface{}{"name": t.Name})
+	return nil
+}
+
+// ListUsers returns the users matching a filter, from the 1-based startIndex.
+func (s *Service) ListUsers(ctx context.Context, filter string, startIndex, count int) (*ListResponse, error) {
+	cond, args, err := s.compile(filter, userAttributes)
+	if err != nil {
+		return nil, err
+	}
+	startIndex, count = page(startIndex, count)
+	rows, total, err := s.repo.ListUsers(ctx, cond, args, count, startIndex-1)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.userResources(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []User{}
+	}
+	return listResponse(users, len(users), total, startIndex), nil
+}
+
+func (s *Service) GetUser(ctx context.Context, id string) (*User, error) {
+	row, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.userResource(ctx, row)
+}
+
+// CreateUser provisions a member. The directory's users sign in through its
+// single sign-on, so they get no password.
+func (s *Service) CreateUser(ctx context.Context, req User, token *model.SCIMToken) (*User, error) {
+	state := userStateFrom(req, true)
+	if err := s.validateUser(ctx, &state, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	row := &userRow{
+		ID:         uuid.New(),
+		Email:      state.Email,
+		Name:       state.Name,
+		IsActive:   state.Active,
+		ExternalID: state.ExternalID,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.repo.CreateUser(ctx, row); err != nil {
+		if errors.Is(err, errDuplicate) {
+			return nil, errUniqueness("a user with this userName or externalId already exists")
+		}
+		return nil, err
+	}
+
+	s.audit(ctx, uuid.Nil, audit.ActionUserProvisioned, audit.EntityUser, row.ID, map[string]interface{}{
+		"email":      row.Email,
+		"scim_token": token.Name,
+	})
+	return s.GetUser(ctx, row.ID.String())
+}
+
+// ReplaceUser replaces a user's attributes. Leaving out active keeps the
+// current state.
+func (s *Service) ReplaceUser(ctx context.Context, id string, req User) (*User, error) {
+	row, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	state := userStateFrom(req, row.IsActive)
+	return s.saveUser(ctx, row, state)
+}
+
+func (s *Service) PatchUser(ctx context.Context, id string, req PatchRequest) (*User, error) {
+	row, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	given, family := splitName(row.Name)
+	state := userState{
+		Email:      row.Email,
+		Name:       row.Name,
+		GivenName:  given,
+		FamilyName: family,
+		ExternalID: row.ExternalID,
+		Active:     row.IsActive,
+	}
+	if err := applyUserPatch(&state, req.Operations); err != nil {
+		return nil, err
+	}
+	return s.saveUser(ctx, row, state)
+}
+
+// DeleteUser deactivates the user. Their messages stay, so accounts are never
+// deleted.
+func (s *Service) DeleteUser(ctx context.Context, id string) error {
+	row, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.setActive(ctx, row.ID, false)
+}
+
+func (s *Service) saveUser(ctx context.Context, row *userRow, state userState) (*User, error) {
+	if err := s.validateUser(ctx, &state, row.ID); err != nil {
+		return nil, err
+	}
+
+	if state.Email != row.Email || state.Name != row.Name || state.ExternalID != row.ExternalID {
+		row.Email, row.Name, row.ExternalID = state.Email, state.Name, state.ExternalID
+		if err := s.repo.UpdateUser(ctx, row); err != nil {
+			if errors.Is(err, errDuplicate) {
+				return nil, errUniqueness("a user with this userName or externalId already exists")
+			}
+			return nil, err
+		}
+	}
+	if state.Active != row.IsActive {
+		if err := s.setActive(ctx, row.ID, state.Active); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetUser(ctx, row.ID.String())
+}
+
+func (s *Service) setActive(ctx context.Context, id uuid.UUID, active bool) error {
+	var err error
+	if active {
+		_, err = s.accounts.Reactivate(ctx, id, uuid.Nil)
+	} else {
+		_, err = s.accounts.Deactivate(ctx, id, uuid.Nil)
+	}
+	if errors.Is(err, user.ErrLastAdmin) {
+		return &Error{Status: http.StatusBadRequest, SCIMType: "mutability", Detail: err.Error()}
+	}
+	return err
+}
+
+// validateUser fills in a missing name and rejects values Feather cannot store.
+func (s *Service) validateUser(ctx context.Context, state *userState, id uuid.UUID) error {
+	state.Email = strings.TrimSpace(state.Email)
+	state.Name = strings.TrimSpace(state.Name)
+	local, _, ok := strings.Cut(state.Email, "@")
+	if !ok || local == "" || len(state.Email) > 255 {
+		return errInvalidValue("userName or a primary email must be an email address")
+	}
+	if state.Name == "" {
+		state.Name = local
+	}
+	if len(state.Name) > maxNameLength {
+		return errInvalidValue("name must be at most %d characters", maxNameLength)
+	}
+	if len(state.ExternalID) > 255 {
+		return errInvalidValue("externalId must be at most 255 characters")
+	}
+
+	taken, err := s.repo.EmailTaken(ctx, state.Email, id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errUniqueness("a user with userName %q already exists", state.Email)
+	}
+	return nil
+}
+
+// userStateFrom reads a User resource sent by the directory. userName is used
+// as the email when it is one; otherwise the primary email is.
+func userStateFrom(u User, active bool) userState {
+	state := userState{ExternalID: u.ExternalID, Active: active}
+	if u.Active != nil {
+		state.Active = *u.Active
+	}
+	if strings.Contains(u.UserName, "@") {
+		state.Email = u.UserName
+	} else {
+		state.Email = primaryEmail(u.Emails)
+	}
+	switch {
+	case u.DisplayName != "":
+		state.Name = u.DisplayName
+	case u.Name != nil && u.Name.Formatted != "":
+		state.Name = u.Name.Formatted
+	case u.Name != nil:
+		state.Name = joinName(u.Name.GivenName, u.Name.FamilyName)
+	}
+	return state
+}
+
+func (s *Service) getUser(ctx context.Context, id string) (*userRow, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errNotFound("User", id)
+	}
+	row, err := s.repo.GetUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		return nil, errNotFound("User", id)
+	}
+	return row, nil
+}
+
+func (s *Service) userResource(ctx context.Context, row *userRow) (*User, error) {
+	users, err := s.userResources(ctx, []userRow{*row})
+	if err != nil {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// userResources builds User resources, with their groups.
+func (s *Service) userResources(ctx context.Context, rows []userRow) ([]User, error) {
+	ids := make([]uuid.UUID, len(rows))
+	for i, r := range rows {
+		ids[i] = r.ID
+	}
+	groups, err := s.repo.GetUserGroups(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]User, len(rows))
+	for i, r := range rows {
+		given, family := splitName(r.Name)
+		active := r.IsActive
+		users[i] = User{
+			Schemas:     []string{SchemaUser},
+			ID:          r.ID.String(),
+			ExternalID:  r.ExternalID,
+			UserName:    r.Email,
+			Name:        &Name{Formatted: r.Name, GivenName: given, FamilyName: family},
+			DisplayName: r.Name,
+			Emails:      []Email{{Value: r.Email, Type: "work", Primary: true}},
+			Active:      &active,
+			Meta:        s.meta("User", r.ID, r.CreatedAt, r.UpdatedAt),
+		}
+		for _, g := range groups[r.ID] {
+			users[i].Groups = append(users[i].Groups, Ref{
+				Value:   g.ID.String(),
+				Display: g.Name,
+				Ref:     s.location("Groups", g.ID),
+			})
+		}
+	}
+	return users, nil
+}
+
+// ListGroups returns the groups matching a filter, from the 1-based
+// startIndex. Members are left out when excludeMembers is set.
+func (s *Service) ListGroups(ctx context.Context, filter string, startIndex, count int, excludeMembers bool) (*ListResponse, error) {
+	cond, args, err := s.compile(filter, groupAttributes)
+	if err != nil {
+		return nil, err
+	}
+	startIndex, count = page(startIndex, count)
+	rows, total, err := s.repo.ListGroups(ctx, cond, args, count, startIndex-1)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.groupResources(ctx, rows, excludeMembers)
+	if err != nil {
+		return nil, err
+	}
+	if groups == nil {
+		groups = []Group{}
+	}
+	return listResponse(groups, len(groups), total, startIndex), nil
+}
+
+func (s *Service) GetGroup(ctx context.Context, id string, excludeMembers bool) (*Group, error) {
+	row, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.groupResources(ctx, []groupRow{*row}, excludeMembers)
+	if err != nil {
+		return nil, err
+	}
+	return &groups[0], nil
+}
+
+// CreateGroup creates a user group, so its members can be @mentioned. The
+// token's creator is recorded as the group's creator.
+func (s *Service) CreateGroup(ctx context.Context, req Group, token *model.SCIMToken) (*Group, error) {
+	members, err := memberIDs(req.Members)
+	if err != nil {
+		return nil, err
+	}
+	row := &groupRow{
+		ID:         uuid.New(),
+		Name:       strings.TrimSpace(req.DisplayName),
+		ExternalID: req.ExternalID,
+		CreatedAt:  time.Now(),
+	}
+	if err := validateGroup(row); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateGroup(ctx, row, token.CreatorID, members); err != nil {
+		if errors.Is(err, errDuplicate) {
+			return nil, errUniqueness("a group with this displayName or externalId already exists")
+		}
+		return nil, err
+	}
+	return s.GetGroup(ctx, row.ID.String(), false)
+}
+
+func (s *Service) ReplaceGroup(ctx context.Context, id string, req Group) (*Group, error) {
+	row, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	members, err := memberIDs(req.Members)
+	if err != nil {
+		return nil, err
+	}
+	state := groupState{Name: req.DisplayName, ExternalID: req.ExternalID, Members: map[uuid.UUID]bool{}}
+	for _, m := range members {
+		state.Members[m] = true
+	}
+	return s.saveGroup(ctx, row, state)
+}
+
+func (s *Service) PatchGroup(ctx context.Context, id string, req PatchRequest) (*Group, error) {
+	row, err := s.getGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.repo.GetGroupMemberIDs(ctx, row.ID)
+	if err != nil {
+		return nil, err
+	}
+	state := groupState{Name: row.Name, ExternalID: row.ExternalID, Members: map[uuid.UUID]bool{}}
+	for _, m := range current {
+		state.Members[m] = true
+	}
+	if err := applyGroupPatch(&state, req.Operations); err != nil {
+		return nil, err
+	}
+	return s.saveGroup(ctx, row, state)
+}
+
+func (s *Service) DeleteGroup(ctx context.Context, id string) error {
+	row, err := s.getGroup(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteGroup(ctx, row.ID)
+}
+
+// saveGroup writes a group's new state, changing only the memberships that
+// differ.
+func (s *Service) saveGroup(ctx context.Context, row *groupRow, state groupState) (*Group, error) {
+	row.Name, row.ExternalID = strings.TrimSpace(state.Name), state.ExternalID
+	if err := validateGroup(row); err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.GetGroupMemberIDs(ctx, row.ID)
+	if err != nil {
+		return nil, err
+	}
+	var add, remove []uuid.UUID
+	for _, id := range current {
+		if !state.Members[id] {
+			remove = append(remove, id)
+		}
+		delete(state.Members, id)
+	}
+	for id := range state.Members {
+		add = append(add, id)
+	}
+
+	if err := s.repo.UpdateGroup(ctx, row, add, remove); err != nil {
+		if errors.Is(err, errDuplicate) {
+			return nil, errUniqueness("a group with this displayName or externalId already exists")
+		}
+		return nil, err
+	}
+	return s.GetGroup(ctx, row.ID.String(), false)
+}
+
+func validateGroup(g *groupRow) error {
+	if g.Name == "" {
+		return errInvalidValue("displayName is required")
+	}
+	if len(g.Name) > maxNameLength {
+		return errInvalidValue("displayName must be at most %d characters", maxNameLength)
+	}
+	if len(g.ExternalID) > 255 {
+		return errInvalidValue("externalId must be at most 255 characters")
+	}
+	return nil
+}
+
+func memberIDs(refs []Ref) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(refs))
+	for _, ref := range refs {
+		id, err := uuid.Parse(ref.Value)
+		if err != nil {
+			return nil, errInvalidValue("invalid member id %q", ref.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *Service) getGroup(ctx context.Context, id string) (*groupRow, error) {
+	gid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errNotFound("Group", id)
+	}
+	row, err := s.repo.GetGroup(ctx, gid)
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		return nil, errNotFound("Group", id)
+	}
+	return row, nil
+}
+
+// groupResources builds Group resources, with their members unless excluded.
+func (s *Service) groupResources(ctx context.Context, rows []groupRow, excludeMembers bool) ([]Group, error) {
+	var members map[uuid.UUID][]userRow
+	if !excludeMembers && len(rows) > 0 {
+		ids := make([]uuid.UUID, len(rows))
+		for i, r := range rows {
+			ids[i] = r.ID
+		}
+		var err error
+		if members, err = s.repo.GetGroupMembers(ctx, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	groups := make([]Group, len(rows))
+	for i, r := range rows {
+		groups[i] = Group{
+			Schemas:     []string{SchemaGroup},
+			ID:          r.ID.String(),
+			ExternalID:  r.ExternalID,
+			DisplayName: r.Name,
+			Meta:        s.meta("Group", r.ID, r.CreatedAt, r.UpdatedAt),
+		}
+		for _, m := range members[r.ID] {
+			groups[i].Members = append(groups[i].Members, Ref{
+				Value:   m.ID.String(),
+				Display: m.Name,
+				Ref:     s.location("Users", m.ID),
+			})
+		}
+	}
+	return groups, nil
+}
+
+func (s *Service) compile(filter string, attrs map[string]attribute) (string, []interface{}, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", nil, nil
+	}
+	return compileFilter(filter, attrs)
+}
+
+func (s *Service) meta(resourceType string, id uuid.UUID, created, modified time.Time) *Meta {
+	endpoint := resourceType + "s"
+	return &Meta{
+		ResourceType: resourceType,
+		Created:      created,
+		LastModified: modified,
+		Location:     s.location(endpoint, id),
+	}
+}
+
+func (s *Service) location(endpoint string, id uuid.UUID) string {
+	return s.baseURL + "/" + endpoint + "/" + id.String()
+}
+
+// page clamps SCIM pagination: startIndex is 1-based and count may be 0 to
+// only ask for the total.
+func page(startIndex, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = defaultPageSize
+	}
+	if count > maxPageSize {
+		count = maxPageSize
+	}
+	return startIndex, count
+}
+
+func listResponse(resources interface{}, n, total, startIndex int) *ListResponse {
+	return &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: n,
+		Resources:    resources,
+	}
+}
+
+func (s *Service) audit(ctx context.Context, actorID uuid.UUID, action, entityType string, entityID uuid.UUID, metadata map[string]interface{}) {
+	if s.auditLog == nil {
+		return
+	}
+	s.auditLog.Log(ctx, audit.Entry{
+		UserID:     actorID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Metadata:   metadata,
+	})
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -46,6 +46,8 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 		params.HasLink = true
 	} else if has == "code" {
 		params.HasCode = true
+	} else if has == "file" {
+		params.HasFile = true
 	}
 
 	if limitStr := q.Get("limit"); limitStr != "" {
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/feather-chat/feather/internal/database"
 	"github.com/feather-chat/feather/internal/model"
 )
 
@@ -26,6 +27,7 @@ type SearchParams struct {
 	AuthorID  *uuid.UUID
 	HasLink   bool
 	HasCode   bool
+	HasFile   bool
 	Limit     int
 	Offset    int
 }
@@ -55,11 +57,18 @@ func (r *Repository) Search(ctx context.Context, params SearchParams) (*SearchRe
 	args = append(args, params.UserID)
 	argIdx++
 
-	// Full-text search
+	// Full-text search, or part of the name of an attached file. The two are
+	// separate branches of a UNION so the search_vector index is still used.
 	if params.Query != "" {
-		conditions = append(conditions, fmt.Sprintf("m.search_vector @@ plainto_tsquery('english', $%d)", argIdx))
-		args = append(args, params.Query)
-		argIdx++
+		conditions = append(conditions, fmt.Sprintf(`
+			m.id IN (
+				SELECT id FROM messages WHERE search_vector @@ plainto_tsquery('english', $%d)
+				UNION
+				SELECT fa.message_id FROM file_attachments fa WHERE fa.filename ILIKE $%d
+			)
+		`, argIdx, argIdx+1))
+		args = append(args, params.Query, "%"+database.EscapeLike(params.Query)+"%")
+		argIdx += 2
 	}
 
 	// Channel filter
@@ -86,6 +95,11 @@ func (r *Repository) Search(ctx context.Context, params SearchParams) (*SearchRe
 		conditions = append(conditions, "m.content LIKE '%```%'")
 	}
 
+	// has:file filter
+	if params.HasFile {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM file_attachments fa WHERE fa.message_id = m.id)")
+	}
+
 	whereClause := strings.Join(conditions, " AND ")
 
 	// Count query
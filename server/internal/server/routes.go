@@ -8,14 +8,31 @@ import (
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 
 	"github.com/feather-chat/feather/internal/middleware"
+	"github.com/feather-chat/feather/internal/model"
 )
 
 func (s *Server) setupRoutes() {
 	r := s.router
 
+	limiter := middleware.NewRateLimiter(s.redis)
+	rl := s.cfg.RateLimit
+	publicLimit := limiter.Limit(middleware.RateLimitPolicy{Name: "public", Limit: rl.Unauthenticated, Window: rl.Window, Key: middleware.KeyByIP})
+	authLimit := limiter.Limit(middleware.RateLimitPolicy{Name: "auth", Limit: rl.Auth, Window: rl.Window, Key: middleware.KeyByIP})
+	hookLimit := limiter.Limit(middleware.RateLimitPolicy{Name: "hooks", Limit: rl.Webhooks, Window: rl.Window, Key: middleware.KeyByURLParam("token")})
+	userLimit := limiter.Limit(middleware.RateLimitPolicy{Name: "user", Limit: rl.Authenticated, Window: rl.Window, Key: middleware.KeyByUser})
+	messageLimit := limiter.Limit(middleware.RateLimitPolicy{Name: "messages", Limit: rl.Messages, Window: rl.Window, Key: middleware.KeyByUser})
+	uploadLimit := limiter.Limit(middleware.RateLimitPolicy{Name: "uploads", Limit: rl.Uploads, Window: rl.Window, Key: middleware.KeyByUser})
+
 	// WebSocket (no Compress middleware - needs http.Hijacker)
 	r.Get("/api/v1/ws", s.wsHandler.ServeHTTP)
 
+	// Files of local and in-memory storage, through signed URLs (no Compress
+	// middleware - responses are raw files, and may be ranges)
+	if s.objectHandler != nil {
+		r.Get("/api/v1/storage/objects/*", s.objectHandler.Get)
+		r.Put("/api/v1/storage/objects/*", s.objectHandler.Put)
+	}
+
 	// All other routes use Compress
 	r.Group(func(r chi.Router) {
 		r.Use(chimiddleware.Compress(5))
@@ -26,110 +43,232 @@ func (s *Server) setupRoutes() {
 			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 		})
 
-		// Public routes
-		r.Route("/api/v1/auth", func(r chi.Router) {
-			r.Post("/register", s.authHandler.Register)
-			r.Post("/login", s.authHandler.Login)
-			r.Post("/refresh", s.authHandler.RefreshToken)
-			r.Post("/oauth/google", s.authHandler.GoogleOAuth)
+		// SCIM provisioning (bearer token auth), called by the identity provider
+		r.Route("/scim/v2", func(r chi.Router) {
+			r.Use(s.scimHandler.Authenticate)
+			r.Get("/ServiceProviderConfig", s.scimHandler.ServiceProviderConfig)
+			r.Get("/ResourceTypes", s.scimHandler.ResourceTypes)
+
+			r.Get("/Users", s.scimHandler.ListUsers)
+			r.Post("/Users", s.scimHandler.CreateUser)
+			r.Get("/Users/{id}", s.scimHandler.GetUser)
+			r.Put("/Users/{id}", s.scimHandler.ReplaceUser)
+			r.Patch("/Users/{id}", s.scimHandler.PatchUser)
+			r.Delete("/Users/{id}", s.scimHandler.DeleteUser)
+
+			r.Get("/Groups", s.scimHandler.ListGroups)
+			r.Post("/Groups", s.scimHandler.CreateGroup)
+			r.Get("/Groups/{id}", s.scimHandler.GetGroup)
+			r.Put("/Groups/{id}", s.scimHandler.ReplaceGroup)
+			r.Patch("/Groups/{id}", s.scimHandler.PatchGroup)
+			r.Delete("/Groups/{id}", s.scimHandler.DeleteGroup)
 		})
 
-		// Incoming webhook (token auth in URL)
-		r.Post("/api/v1/hooks/{token}", s.webhookHandler.HandleIncoming)
+		// Incoming webhook (token auth in URL), limited per token rather than per IP
+		r.With(hookLimit).Post("/api/v1/hooks/{token}", s.webhookHandler.HandleIncoming)
+
+		// Public routes
+		r.Group(func(r chi.Router) {
+			r.Use(publicLimit)
+
+			r.Route("/api/v1/auth", func(r chi.Router) {
+				r.Use(authLimit)
+				r.Post("/register", s.authHandler.Register)
+				r.Post("/login", s.authHandler.Login)
+				r.Post("/login/2fa", s.authHandler.LoginTwoFactor)
+				r.Post("/login/2fa/setup", s.authHandler.LoginTwoFactorSetup)
+				r.Post("/refresh", s.authHandler.RefreshToken)
+				r.Post("/oauth/google", s.authHandler.GoogleOAuth)
+				r.Get("/oidc/providers", s.authHandler.ListOIDCProviders)
+				r.Get("/oidc/{provider}/authorize", s.authHandler.OIDCAuthorize)
+				r.Post("/oidc/{provider}/callback", s.authHandler.OIDCCallback)
+				r.Get("/saml/providers", s.authHandler.ListSAMLProviders)
+				r.Get("/saml/{provider}/metadata", s.authHandler.SAMLMetadata)
+				r.Get("/saml/{provider}/authorize", s.authHandler.SAMLAuthorize)
+				r.Post("/saml/{provider}/acs", s.authHandler.SAMLACS)
+				r.Post("/password/forgot", s.authHandler.ForgotPassword)
+				r.Post("/password/reset", s.authHandler.ResetPassword)
+				r.Post("/verify-email", s.authHandler.VerifyEmail)
+			})
 
-		// Public invitation endpoints (validate only - accept requires auth)
-		r.Get("/api/v1/invitations/validate/{token}", s.invitationHandler.Validate)
+			// Public invitation endpoints (validate only - accept requires auth)
+			r.Get("/api/v1/invitations/validate/{token}", s.invitationHandler.Validate)
+		})
 	})
 
-	// Protected routes
+	// Protected routes. API tokens need the route's scope: read scopes for GET,
+	// write scopes for the rest.
 	r.Group(func(r chi.Router) {
 		r.Use(chimiddleware.Compress(5))
-		r.Use(middleware.Auth(s.cfg.JWT.Secret))
+		r.Use(middleware.Auth(s.cfg.JWT.Secret, s.revocations, s.apiTokenService))
+		r.Use(userLimit)
+
+		scopes := middleware.RequireScopes
+		scope := middleware.RequireScope
 
-		// Auth
-		r.Post("/api/v1/auth/logout", s.authHandler.Logout)
-		r.Get("/api/v1/auth/me", s.authHandler.Me)
+		// Auth (sessions only, except the current user)
+		r.With(scope(model.ScopeUsersRead)).Get("/api/v1/auth/me", s.authHandler.Me)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.SessionOnly)
+			r.Post("/api/v1/auth/logout", s.authHandler.Logout)
+			r.Post("/api/v1/auth/logout-all", s.authHandler.LogoutAll)
+			r.Get("/api/v1/auth/sessions", s.authHandler.ListSessions)
+			r.Delete("/api/v1/auth/sessions/{sessionID}", s.authHandler.RevokeSession)
+			r.Post("/api/v1/auth/verify-email/resend", s.authHandler.ResendVerification)
+			r.Get("/api/v1/auth/2fa", s.authHandler.TwoFactorStatus)
+			r.Post("/api/v1/auth/2fa/enroll", s.authHandler.EnrollTwoFactor)
+			r.Post("/api/v1/auth/2fa/verify", s.authHandler.VerifyTwoFactor)
+			r.Post("/api/v1/auth/2fa/disable", s.authHandler.DisableTwoFactor)
+			r.Post("/api/v1/auth/2fa/recovery-codes", s.authHandler.RegenerateRecoveryCodes)
+
+			// Personal access tokens
+			r.Get("/api/v1/tokens", s.apiTokenHandler.List)
+			r.Post("/api/v1/tokens", s.apiTokenHandler.Create)
+			r.Get("/api/v1/tokens/scopes", s.apiTokenHandler.Scopes)
+			r.Delete("/api/v1/tokens/{tokenID}", s.apiTokenHandler.Revoke)
+		})
 
 		// Users
-		r.Get("/api/v1/users", s.userHandler.List)
-		r.Get("/api/v1/users/{userID}", s.userHandler.GetByID)
-		r.Patch("/api/v1/users/me", s.userHandler.UpdateProfile)
+		r.Group(func(r chi.Router) {
+			r.Use(scopes(model.ScopeUsersRead, model.ScopeUsersWrite))
+			r.Get("/api/v1/users", s.userHandler.List)
+			r.Get("/api/v1/users/presence", s.presenceHandler.Get)
+			r.Get("/api/v1/users/{userID}", s.userHandler.GetByID)
+			r.Patch("/api/v1/users/me", s.userHandler.UpdateProfile)
+			r.Put("/api/v1/users/me/presence", s.presenceHandler.SetStatus)
+			r.Put("/api/v1/users/me/status", s.presenceHandler.SetCustomStatus)
+			r.Delete("/api/v1/users/me/status", s.presenceHandler.ClearCustomStatus)
+		})
 
 		// Channels
 		r.Route("/api/v1/channels", func(r chi.Router) {
-			r.Post("/", s.channelHandler.Create)
-			r.Get("/", s.channelHandler.List)
+			r.Group(func(r chi.Router) {
+				r.Use(scopes(model.ScopeChannelsRead, model.ScopeChannelsWrite))
+				r.Post("/", s.channelHandler.Create)
+				r.Get("/", s.channelHandler.List)
+			})
 
 			r.Route("/{channelID}", func(r chi.Router) {
-				r.Get("/", s.channelHandler.GetByID)
-				r.Patch("/", s.channelHandler.Update)
-				r.Delete("/", s.channelHandler.Delete)
+				r.Group(func(r chi.Router) {
+					r.Use(scopes(model.ScopeChannelsRead, model.ScopeChannelsWrite))
+					r.Get("/", s.channelHandler.GetByID)
+					r.Patch("/", s.channelHandler.Update)
+					r.Delete("/", s.channelHandler.Delete)
 
-				r.Post("/join", s.channelHandler.Join)
-				r.Post("/leave", s.channelHandler.Leave)
-				r.Post("/members", s.channelHandler.InviteMember)
-				r.Get("/members", s.channelHandler.GetMembers)
-				r.Post("/read", s.channelHandler.MarkRead)
+					r.Post("/join", s.channelHandler.Join)
+					r.Post("/leave", s.channelHandler.Leave)
+					r.Post("/members", s.channelHandler.InviteMember)
+					r.Get("/members", s.channelHandler.GetMembers)
+					r.Delete("/members/{userID}", s.channelHandler.RemoveMember)
+					r.Put("/members/{userID}/role", s.channelHandler.UpdateMemberRole)
+					r.Get("/permissions", s.channelHandler.GetPermissions)
+					r.Post("/read", s.channelHandler.MarkRead)
+				})
 
 				// Messages
-				r.Post("/messages", s.messageHandler.Create)
-				r.Get("/messages", s.messageHandler.List)
-				r.Patch("/messages/{messageID}", s.messageHandler.Update)
-				r.Delete("/messages/{messageID}", s.messageHandler.Delete)
+				r.Group(func(r chi.Router) {
+					r.Use(scopes(model.ScopeMessagesRead, model.ScopeMessagesWrite))
+					r.With(messageLimit).Post("/messages", s.messageHandler.Create)
+					r.Get("/messages", s.messageHandler.List)
+					r.Patch("/messages/{messageID}", s.messageHandler.Update)
+					r.Delete("/messages/{messageID}", s.messageHandler.Delete)
+					r.Post("/messages/{messageID}/pin", s.messageHandler.Pin)
+					r.Delete("/messages/{messageID}/pin", s.messageHandler.Unpin)
+					r.Get("/pins", s.messageHandler.ListPinned)
+				})
 
 				// File uploads
 				if s.fileHandler != nil {
-					r.Post("/files", s.fileHandler.Upload)
+					r.With(scope(model.ScopeFilesWrite), uploadLimit).Post("/files", s.fileHandler.Upload)
+					r.With(scope(model.ScopeFilesWrite), uploadLimit).Post("/uploads", s.fileHandler.CreateUpload)
+					r.With(scope(model.ScopeFilesRead)).Get("/files", s.fileHandler.ListChannel)
 				}
 
 				// Call history per channel
-				r.Get("/calls", s.callHandler.GetCallHistory)
+				r.With(scope(model.ScopeCallsRead)).Get("/calls", s.callHandler.GetCallHistory)
 			})
 		})
 
-		// Threads
-		r.Get("/api/v1/messages/{messageID}/thread", s.messageHandler.GetThread)
+		r.Group(func(r chi.Router) {
+			r.Use(scopes(model.ScopeMessagesRead, model.ScopeMessagesWrite))
+
+			// Threads
+			r.Get("/api/v1/messages/{messageID}/thread", s.messageHandler.GetThread)
+
+			// Reactions
+			r.Post("/api/v1/messages/{messageID}/reactions", s.reactionHandler.AddReaction)
+			r.Delete("/api/v1/messages/{messageID}/reactions/{emoji}", s.reactionHandler.RemoveReaction)
 
-		// Reactions
-		r.Post("/api/v1/messages/{messageID}/reactions", s.reactionHandler.AddReaction)
-		r.Delete("/api/v1/messages/{messageID}/reactions/{emoji}", s.reactionHandler.RemoveReaction)
+			// Mentions
+			r.Get("/api/v1/mentions", s.mentionHandler.GetUnread)
+			r.Post("/api/v1/mentions/read", s.mentionHandler.MarkRead)
+		})
 
 		// Search
-		r.Get("/api/v1/search", s.searchHandler.Search)
+		r.With(scope(model.ScopeSearchRead)).Get("/api/v1/search", s.searchHandler.Search)
 
 		// Webhooks management
 		r.Route("/api/v1/webhooks", func(r chi.Router) {
+			r.Use(scopes(model.ScopeWebhooksRead, model.ScopeWebhooksWrite))
 			r.Post("/", s.webhookHandler.Create)
 			r.Get("/", s.webhookHandler.List)
 			r.Delete("/{webhookID}", s.webhookHandler.Delete)
+
+			// Outgoing webhooks
+			r.Route("/outgoing", func(r chi.Router) {
+				r.Post("/", s.webhookHandler.CreateOutgoing)
+				r.Get("/", s.webhookHandler.ListOutgoing)
+				r.Delete("/{webhookID}", s.webhookHandler.DeleteOutgoing)
+				r.Get("/{webhookID}/deliveries", s.webhookHandler.ListDeliveries)
+				r.Post("/{webhookID}/deliveries/{deliveryID}/redeliver", s.webhookHandler.Redeliver)
+			})
+		})
+
+		// Slash commands
+		r.Route("/api/v1/commands", func(r chi.Router) {
+			r.Use(scopes(model.ScopeCommandsRead, model.ScopeCommandsWrite))
+			r.Get("/", s.commandHandler.List)
+			r.Get("/custom", s.commandHandler.ListCustom)
+			r.Post("/", s.commandHandler.Create)
+			r.Delete("/{commandID}", s.commandHandler.Delete)
 		})
 
-		// File downloads
+		// File listing, downloads and direct uploads; every upload step needs files:write
 		if s.fileHandler != nil {
-			r.Get("/api/v1/files/{fileID}/download", s.fileHandler.Download)
+			r.With(scope(model.ScopeFilesRead)).Get("/api/v1/files", s.fileHandler.List)
+			r.With(scope(model.ScopeFilesRead)).Get("/api/v1/files/{fileID}/download", s.fileHandler.Download)
+			r.With(scope(model.ScopeFilesRead)).Get("/api/v1/files/{fileID}/thumbnail", s.fileHandler.Thumbnail)
+			r.Route("/api/v1/uploads/{uploadID}", func(r chi.Router) {
+				r.Use(scope(model.ScopeFilesWrite))
+				r.Get("/", s.fileHandler.GetUpload)
+				r.Delete("/", s.fileHandler.CancelUpload)
+				r.Post("/parts", s.fileHandler.UploadParts)
+				r.Post("/complete", s.fileHandler.CompleteUpload)
+			})
 		}
 
-		// Invitations (authenticated)
+		// Invitations (authenticated); accepting one is for people, not tokens
 		r.Route("/api/v1/invitations", func(r chi.Router) {
-			r.Post("/", s.invitationHandler.Create)
-			r.Get("/", s.invitationHandler.List)
-			r.Delete("/{id}", s.invitationHandler.Revoke)
-			r.Post("/accept/{token}", s.invitationHandler.Accept)
+			r.Group(func(r chi.Router) {
+				r.Use(scopes(model.ScopeInvitationsRead, model.ScopeInvitationsWrite))
+				r.Post("/", s.invitationHandler.Create)
+				r.Get("/", s.invitationHandler.List)
+				r.Delete("/{id}", s.invitationHandler.Revoke)
+			})
+			r.With(middleware.SessionOnly).Post("/accept/{token}", s.invitationHandler.Accept)
 		})
 
 		// Direct Messages
 		r.Route("/api/v1/dms", func(r chi.Router) {
+			r.Use(scopes(model.ScopeChannelsRead, model.ScopeChannelsWrite))
 			r.Post("/", s.dmHandler.CreateDM)
 			r.Post("/group", s.dmHandler.CreateGroupDM)
 			r.Get("/", s.dmHandler.ListDMs)
 		})
 
-		// Mentions
-		r.Get("/api/v1/mentions", s.mentionHandler.GetUnread)
-		r.Post("/api/v1/mentions/read", s.mentionHandler.MarkRead)
-
 		// User Groups
 		r.Route("/api/v1/groups", func(r chi.Router) {
+			r.Use(scopes(model.ScopeGroupsRead, model.ScopeGroupsWrite))
 			r.Post("/", s.userGroupHandler.Create)
 			r.Get("/", s.userGroupHandler.List)
 
@@ -143,7 +282,46 @@ func (s *Server) setupRoutes() {
 		})
 
 		// Calls
-		r.Get("/api/v1/calls/active", s.callHandler.GetActiveCall)
-		r.Get("/api/v1/rtc/config", s.callHandler.GetRTCConfig)
+		r.Group(func(r chi.Router) {
+			r.Use(scope(model.ScopeCallsRead))
+			r.Get("/api/v1/calls/active", s.callHandler.GetActiveCall)
+			r.Get("/api/v1/rtc/config", s.callHandler.GetRTCConfig)
+		})
+
+		// Workspace administration (API tokens need the admin scope)
+		r.Route("/api/v1/admin", func(r chi.Router) {
+			r.Use(middleware.AdminOnly)
+			r.Get("/audit", s.auditHandler.List)
+			r.Get("/audit/export", s.auditHandler.Export)
+			r.Get("/settings", s.authHandler.GetWorkspaceSettings)
+			r.Patch("/settings", s.authHandler.UpdateWorkspaceSettings)
+
+			r.Route("/users", func(r chi.Router) {
+				r.Get("/", s.userHandler.AdminList)
+				r.Route("/{userID}", func(r chi.Router) {
+					r.Get("/", s.userHandler.GetByID)
+					r.Post("/deactivate", s.userHandler.Deactivate)
+					r.Post("/reactivate", s.userHandler.Reactivate)
+					r.Put("/role", s.userHandler.UpdateRole)
+					r.Post("/logout", s.userHandler.ForceLogout)
+					r.Post("/password", s.userHandler.ResetPassword)
+				})
+			})
+
+			r.Route("/scim/tokens", func(r chi.Router) {
+				r.Get("/", s.scimHandler.ListTokens)
+				r.Post("/", s.scimHandler.CreateToken)
+				r.Delete("/{tokenID}", s.scimHandler.RevokeToken)
+			})
+
+			// Bot accounts and their tokens
+			r.Route("/bots", func(r chi.Router) {
+				r.Get("/", s.apiTokenHandler.ListBots)
+				r.Post("/", s.apiTokenHandler.CreateBot)
+				r.Get("/{botID}/tokens", s.apiTokenHandler.ListBotTokens)
+				r.Post("/{botID}/tokens", s.apiTokenHandler.CreateBotToken)
+				r.Delete("/{botID}/tokens/{tokenID}", s.apiTokenHandler.RevokeBotToken)
+			})
+		})
 	})
 }
@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -16,19 +18,26 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 
+	"github.com/feather-chat/feather/internal/apitoken"
 	"github.com/feather-chat/feather/internal/audit"
 	"github.com/feather-chat/feather/internal/auth"
 	"github.com/feather-chat/feather/internal/call"
 	"github.com/feather-chat/feather/internal/channel"
+	"github.com/feather-chat/feather/internal/command"
 	"github.com/feather-chat/feather/internal/config"
 	"github.com/feather-chat/feather/internal/dm"
 	"github.com/feather-chat/feather/internal/file"
 	"github.com/feather-chat/feather/internal/invitation"
+	"github.com/feather-chat/feather/internal/mailer"
 	"github.com/feather-chat/feather/internal/mention"
 	"github.com/feather-chat/feather/internal/message"
 	"github.com/feather-chat/feather/internal/middleware"
 	"github.com/feather-chat/feather/internal/model"
+	"github.com/feather-chat/feather/internal/oidc"
+	"github.com/feather-chat/feather/internal/presence"
 	"github.com/feather-chat/feather/internal/reaction"
+	"github.com/feather-chat/feather/internal/saml"
+	"github.com/feather-chat/feather/internal/scim"
 	"github.com/feather-chat/feather/internal/search"
 	"github.com/feather-chat/feather/internal/user"
 	"github.com/feather-chat/feather/internal/usergroup"
@@ -45,6 +54,10 @@ type Server struct {
 	hub        *websocket.Hub
 	validate   *validator.Validate
 
+	// Background workers are stopped by cancelling this context on shutdown
+	workerCtx    context.Context
+	workerCancel context.CancelFunc
+
 	// Handlers
 	authHandler       *auth.Handler
 	channelHandler    *channel.Handler
@@ -54,20 +67,33 @@ type Server struct {
 	webhookHandler    *webhook.Handler
 	searchHandler     *search.Handler
 	fileHandler       *file.Handler
+	objectHandler     *file.ObjectHandler
 	wsHandler         *websocket.WSHandler
 	invitationHandler *invitation.Handler
 	dmHandler         *dm.Handler
 	mentionHandler    *mention.Handler
 	userGroupHandler  *usergroup.Handler
 	callHandler       *call.Handler
+	commandHandler    *command.Handler
+	presenceHandler   *presence.Handler
+	auditHandler      *audit.Handler
+	scimHandler       *scim.Handler
+	apiTokenHandler   *apitoken.Handler
 
 	// Services
-	channelService *channel.Service
-	callService    *call.Service
-	auditLogger    *audit.Logger
+	channelService  *channel.Service
+	userService     *user.Service
+	callService     *call.Service
+	webhookService  *webhook.Service
+	commandService  *command.Service
+	presenceService *presence.Service
+	auditLogger     *audit.Logger
+	revocations     *auth.RevocationStore
+	apiTokenService *apitoken.Service
+	fileService     *file.Service
 }
 
-func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, fileStorage *file.Storage) *Server {
+func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, fileStorage file.Storage, mail mailer.Mailer) *Server {
 	s := &Server{
 		cfg:      cfg,
 		router:   chi.NewRouter(),
@@ -75,8 +101,9 @@ func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, fileSt
 		redis:    redisClient,
 		validate: validator.New(),
 	}
+	s.workerCtx, s.workerCancel = context.WithCancel(context.Background())
 
-	s.initServices(fileStorage)
+	s.initServices(fileStorage, mail)
 	s.setupMiddleware()
 	s.setupRoutes()
 
@@ -91,7 +118,7 @@ func New(cfg *config.Config, db *pgxpool.Pool, redisClient *redis.Client, fileSt
 	return s
 }
 
-func (s *Server) initServices(fileStorage *file.Storage) {
+func (s *Server) initServices(fileStorage file.Storage, mail mailer.Mailer) {
 	// WebSocket hub
 	s.hub = websocket.NewHub(s.redis)
 
@@ -100,6 +127,7 @@ func (s *Server) initServices(fileStorage *file.Storage) {
 
 	// Token service
 	tokenService := auth.NewTokenService(s.cfg.JWT.Secret, s.cfg.JWT.AccessTTL, s.cfg.JWT.RefreshTTL)
+	s.revocations = auth.NewRevocationStore(s.redis, s.cfg.JWT.AccessTTL)
 
 	// Repositories
 	authRepo := auth.NewRepository(s.db)
@@ -113,24 +141,37 @@ func (s *Server) initServices(fileStorage *file.Storage) {
 	mentionRepo := mention.NewRepository(s.db)
 	userGroupRepo := usergroup.NewRepository(s.db)
 	callRepo := call.NewRepository(s.db)
+	commandRepo := command.NewRepository(s.db)
+	presenceRepo := presence.NewRepository(s.db)
 
 	// Services
-	authService := auth.NewService(authRepo, tokenService)
-	s.channelService = channel.NewService(channelRepo)
-	userService := user.NewService(userRepo)
+	// Channel events go to subscribed clients and fan out to outgoing webhooks
+	broadcastFn := func(channelID uuid.UUID, event model.WebSocketEvent) {
+		s.hub.BroadcastEvent(channelID, event)
+		if s.webhookService != nil {
+			s.webhookService.DispatchEvent(channelID, event)
+		}
+	}
+
+	authService := auth.NewService(authRepo, tokenService, s.revocations, auth.NewAttemptCounter(s.redis), auth.NewReplayCache(s.redis))
+	authService.SetConnectionCloser(s.hub)
+	s.channelService = channel.NewService(channelRepo, broadcastFn, s.hub)
+	s.userService = user.NewService(userRepo, authService)
 	searchService := search.NewService(searchRepo)
 	invitationService := invitation.NewService(invitationRepo, s.channelService, s.cfg.Server.AppURL)
 
-	// Message service with broadcast
-	broadcastFn := func(channelID uuid.UUID, event model.WebSocketEvent) {
-		s.hub.BroadcastEvent(channelID, event)
+	// Direct delivery to one user's connections (ephemeral messages, call signaling)
+	sendToUserFn := func(userID uuid.UUID, data []byte) {
+		s.hub.SendToUser(userID, data)
 	}
-	messageService := message.NewService(messageRepo, s.channelService, broadcastFn)
+
+	messageService := message.NewService(messageRepo, s.channelService, broadcastFn, sendToUserFn)
 	reactionService := reaction.NewService(s.db, broadcastFn)
 
 	// Mention service (processes @mentions in messages)
 	mentionService := mention.NewService(mentionRepo, broadcastFn)
 	messageService.SetMentionProcessor(mentionService)
+	mentionService.SetEphemeralSender(messageService)
 
 	// DM service with subscribe callback
 	subscribeFn := func(userID uuid.UUID, channelID uuid.UUID) {
@@ -142,9 +183,6 @@ func (s *Server) initServices(fileStorage *file.Storage) {
 	userGroupService := usergroup.NewService(userGroupRepo)
 
 	// Call service
-	sendToUserFn := func(userID uuid.UUID, data []byte) {
-		s.hub.SendToUser(userID, data)
-	}
 	s.callService = call.NewService(callRepo, broadcastFn, sendToUserFn)
 	s.callService.SetMemberChecker(s.channelService)
 
@@ -153,28 +191,134 @@ func (s *Server) initServices(fileStorage *file.Storage) {
 		s.handleCallWSEvent(userID, event)
 	})
 
-	// Webhook service (bot user ID will be set after seeding)
-	webhookService := webhook.NewService(webhookRepo, uuid.Nil, nil)
+	// Presence (connection state from the hub, statuses and idle detection)
+	s.presenceService = presence.NewService(presenceRepo, s.hub)
+	s.hub.SetPresenceHandler(s.presenceService.HandleConnectionChange)
+	s.hub.SetActivityHandler(s.presenceService.RecordActivity)
+
+	// Slash commands (messages starting with "/name" run a command instead of posting)
+	s.commandService = command.NewService(commandRepo, s.channelService, sendToUserFn)
+	s.commandService.SetOnlineUsers(s.hub.GetOnlineUsers)
+	messageService.SetCommandExecutor(s.commandService)
+
+	// Webhook service (posts alerts through per-webhook bot users)
+	s.webhookService = webhook.NewService(webhookRepo, messageService)
+	s.webhookService.SetMemberChecker(s.channelService)
+
+	// Audit trail for logins and administrative actions
+	authService.SetAuditLogger(s.auditLogger)
+	s.channelService.SetAuditLogger(s.auditLogger)
+	messageService.SetAuditLogger(s.auditLogger)
+	s.webhookService.SetAuditLogger(s.auditLogger)
+	invitationService.SetAuditLogger(s.auditLogger)
+	s.userService.SetAuditLogger(s.auditLogger)
+	auditService := audit.NewService(audit.NewRepository(s.db))
+
+	// Single sign-on through OIDC and SAML providers; their groups can drive
+	// user groups
+	authService.SetOIDCProviders(s.oidcProviders())
+	authService.SetSAMLProviders(s.samlProviders())
+	authService.SetGroupSyncer(userGroupService)
+
+	// SCIM provisioning of users and user groups by the identity provider
+	scimService := scim.NewService(scim.NewRepository(s.db), s.userService, s.cfg.Server.AppURL+"/scim/v2")
+	scimService.SetAuditLogger(s.auditLogger)
+
+	// Scoped API tokens for scripts and bot accounts, accepted by the API and
+	// the WebSocket handshake
+	s.apiTokenService = apitoken.NewService(apitoken.NewRepository(s.db))
+	s.apiTokenService.SetConnectionCloser(s.hub)
+	s.apiTokenService.SetAuditLogger(s.auditLogger)
+
+	// Password reset, email verification and invitation emails
+	authService.SetMailer(mail, s.cfg.Server.AppURL)
+	invitationService.SetMailer(mail)
 
 	// Handlers
 	s.authHandler = auth.NewHandler(authService, s.validate, s.channelService, s.cfg.OAuth.GoogleClientID)
 	s.authHandler.SetInvitationAcceptor(invitationService)
+	s.authHandler.SetAppURL(s.cfg.Server.AppURL)
 	s.channelHandler = channel.NewHandler(s.channelService, s.validate)
 	s.messageHandler = message.NewHandler(messageService, s.validate)
 	s.reactionHandler = reaction.NewHandler(reactionService, s.validate)
-	s.userHandler = user.NewHandler(userService, s.validate)
-	s.webhookHandler = webhook.NewHandler(webhookService, s.validate)
+	s.userHandler = user.NewHandler(s.userService, s.validate)
+	s.webhookHandler = webhook.NewHandler(s.webhookService, s.validate)
 	s.searchHandler = search.NewHandler(searchService)
-	s.wsHandler = websocket.NewHandler(s.hub, s.cfg.JWT.Secret, userService)
+	s.wsHandler = websocket.NewHandler(s.hub, s.cfg.JWT.Secret, s.userService)
+	s.wsHandler.SetRevocationChecker(s.revocations)
+	s.wsHandler.SetAPITokenValidator(s.apiTokenService)
 	s.invitationHandler = invitation.NewHandler(invitationService, s.validate)
 	s.dmHandler = dm.NewHandler(dmService, s.validate)
 	s.mentionHandler = mention.NewHandler(mentionService, s.validate)
 	s.userGroupHandler = usergroup.NewHandler(userGroupService, s.validate)
 	s.callHandler = call.NewHandler(s.callService, s.cfg.WebRTC)
+	s.commandHandler = command.NewHandler(s.commandService, s.validate)
+	s.presenceHandler = presence.NewHandler(s.presenceService, s.validate)
+	s.auditHandler = audit.NewHandler(auditService)
+	s.scimHandler = scim.NewHandler(scimService, s.validate)
+	s.apiTokenHandler = apitoken.NewHandler(s.apiTokenService, s.validate)
 
 	if fileStorage != nil {
-		s.fileHandler = file.NewHandler(fileStorage, s.db, s.cfg.Upload.MaxSize)
+		s.fileService = file.NewService(file.NewRepository(s.db), fileStorage, s.channelService, s.cfg.Upload)
+		messageService.SetAttachmentRemover(s.fileService)
+		s.fileHandler = file.NewHandler(s.fileService, s.validate, s.cfg.Upload.MaxSize)
+		if served, ok := fileStorage.(file.ServedStorage); ok {
+			s.objectHandler = file.NewObjectHandler(served, s.cfg.Upload.MaxDirectSize)
+		}
+	}
+}
+
+// oidcProviders builds the configured OIDC providers, skipping incomplete ones.
+func (s *Server) oidcProviders() []*oidc.Provider {
+	var providers []*oidc.Provider
+	for _, pc := range s.cfg.OAuth.OIDCProviders {
+		if pc.ID == "" || pc.Issuer == "" || pc.ClientID == "" {
+			slog.Warn("skipping oidc provider with missing id, issuer or client_id", "id", pc.ID)
+			continue
+		}
+		if pc.Name == "" {
+			pc.Name = pc.ID
+		}
+		redirectURL := pc.RedirectURL
+		if redirectURL == "" {
+			redirectURL = s.cfg.Server.AppURL + "/login/oidc/" + pc.ID
+		}
+		providers = append(providers, oidc.NewProvider(pc, redirectURL))
+	}
+	return providers
+}
+
+// samlProviders builds the configured SAML providers, skipping incomplete ones.
+// Their endpoints are served below the app URL, which proxies /api.
+func (s *Server) samlProviders() []*saml.Provider {
+	cfg := s.cfg.SAML
+	if len(cfg.Providers) == 0 {
+		return nil
+	}
+
+	var cert *x509.Certificate
+	var key *rsa.PrivateKey
+	if cfg.Certificate != "" || cfg.PrivateKey != "" {
+		var err error
+		cert, key, err = saml.LoadKeyPair(cfg.Certificate, cfg.PrivateKey)
+		if err != nil {
+			slog.Error("saml assertions cannot be encrypted", "error", err)
+		}
+	}
+
+	var providers []*saml.Provider
+	for _, pc := range cfg.Providers {
+		if pc.ID == "" || (pc.MetadataURL == "" && pc.MetadataFile == "") {
+			slog.Warn("skipping saml provider with missing id or metadata", "id", pc.ID)
+			continue
+		}
+		if pc.Name == "" {
+			pc.Name = pc.ID
+		}
+		baseURL := s.cfg.Server.AppURL + "/api/v1/auth/saml/" + pc.ID
+		providers = append(providers, saml.NewProvider(pc, baseURL, cert, key))
 	}
+	return providers
 }
 
 func (s *Server) handleCallWSEvent(userID uuid.UUID, event model.WebSocketEvent) {
@@ -186,7 +330,12 @@ func (s *Server) handleCallWSEvent(userID uuid.UUID, event model.WebSocketEvent)
 		if err := json.Unmarshal(event.Payload, &req); err != nil {
 			return
 		}
-		s.callService.Initiate(ctx, req, userID)
+		// The caller's workspace role may have changed since they connected
+		u, err := s.userService.GetByID(ctx, userID)
+		if err != nil {
+			return
+		}
+		s.callService.Initiate(ctx, req, userID, string(u.Role))
 
 	case model.EventCallAccept:
 		var payload struct {
@@ -227,7 +376,13 @@ func (s *Server) handleCallWSEvent(userID uuid.UUID, event model.WebSocketEvent)
 
 func (s *Server) setupMiddleware() {
 	s.router.Use(chimiddleware.RequestID)
-	s.router.Use(chimiddleware.RealIP)
+	trustedProxies, err := middleware.ParseTrustedProxies(s.cfg.Server.TrustedProxies)
+	if err != nil {
+		slog.Error("ignoring server.trusted_proxies; forwarded client addresses are not trusted", "error", err)
+		trustedProxies = nil
+	}
+	s.router.Use(middleware.RealIP(trustedProxies))
+	s.router.Use(middleware.ClientInfo)
 	s.router.Use(middleware.Logging)
 	s.router.Use(chimiddleware.Recoverer)
 	s.router.Use(cors.Handler(middleware.CORS()))
@@ -247,12 +402,30 @@ func (s *Server) Start() error {
 	// Recover any calls stuck in ringing state from a prior shutdown
 	s.callService.RecoverStaleCalls(ctx)
 
+	// Ensure every webhook has a bot user to post as
+	s.webhookService.SeedBotUsers(ctx)
+
+	// Deliver queued outgoing webhook events
+	go s.webhookService.RunDeliveryWorker(s.workerCtx)
+
+	// Deliver due /remind reminders
+	go s.commandService.RunReminderWorker(s.workerCtx)
+
+	// Announce users who go idle
+	go s.presenceService.RunIdleSweeper(s.workerCtx)
+
+	// Discard abandoned uploads and files never attached to a message
+	if s.fileService != nil {
+		go s.fileService.RunCleanupWorker(s.workerCtx)
+	}
+
 	slog.Info("server starting", "port", s.cfg.Server.Port)
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	slog.Info("server shutting down")
+	s.workerCancel()
 	s.hub.Stop()
 	return s.httpServer.Shutdown(ctx)
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -81,6 +82,169 @@ func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, user, http.StatusOK)
 }
 
+// AdminList lists every user, including deactivated accounts.
+// Query: q (name or email), role, status (active, deactivated), limit, offset.
+func (h *Handler) AdminList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := ListFilter{Query: q.Get("q")}
+
+	switch role := model.UserRole(q.Get("role")); role {
+	case "":
+	case model.RoleAdmin, model.RoleMember, model.RoleBot:
+		f.Role = role
+	default:
+		writeError(w, "role must be admin, member or bot", http.StatusBadRequest)
+		return
+	}
+
+	switch q.Get("status") {
+	case "":
+	case "active":
+		active := true
+		f.Active = &active
+	case "deactivated":
+		active := false
+		f.Active = &active
+	default:
+		writeError(w, "status must be active or deactivated", http.StatusBadRequest)
+		return
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeError(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		f.Limit = limit
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			writeError(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		f.Offset = offset
+	}
+
+	users, err := h.service.AdminList(r.Context(), f)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if users == nil {
+		users = []model.User{}
+	}
+	writeJSON(w, users, http.StatusOK)
+}
+
+func (h *Handler) Deactivate(w http.ResponseWriter, r *http.Request) {
+	targetID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.Deactivate(r.Context(), targetID, middleware.GetUserID(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, user, http.StatusOK)
+}
+
+func (h *Handler) Reactivate(w http.ResponseWriter, r *http.Request) {
+	targetID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.Reactivate(r.Context(), targetID, middleware.GetUserID(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, user, http.StatusOK)
+}
+
+func (h *Handler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	targetID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var req model.UpdateUserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.SetRole(r.Context(), targetID, req.Role, middleware.GetUserID(r.Context()))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, user, http.StatusOK)
+}
+
+// ForceLogout revokes every session of the user.
+func (h *Handler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	targetID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ForceLogout(r.Context(), targetID, middleware.GetUserID(r.Context())); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	targetID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeError(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var req model.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), targetID, req.Password, middleware.GetUserID(r.Context())); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrModifySelf), errors.Is(err, ErrBotAccount):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrLastAdmin):
+		writeError(w, err.Error(), http.StatusConflict)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
 func writeJSON(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -3,6 +3,7 @@ package user
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -21,13 +22,13 @@ func NewRepository(db *pgxpool.Pool) *Repository {
 
 func (r *Repository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	query := `
-		SELECT id, email, name, password_hash, google_id, avatar_url, role, is_active, created_at, updated_at
+		SELECT id, email, name, password_hash, google_id, avatar_url, role, is_active, email_verified_at IS NOT NULL, created_at, updated_at
 		FROM users WHERE id = $1
 	`
 	var user model.User
 	err := r.db.QueryRow(ctx, query, id).Scan(
 		&user.ID, &user.Email, &user.Name, &user.PasswordHash, &user.GoogleID,
-		&user.AvatarURL, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+		&user.AvatarURL, &user.Role, &user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -40,7 +41,7 @@ func (r *Repository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, er
 
 func (r *Repository) List(ctx context.Context, search string) ([]model.User, error) {
 	query := `
-		SELECT id, email, name, '', NULL::varchar, avatar_url, role, is_active, created_at, updated_at
+		SELECT id, email, name, '', NULL::varchar, avatar_url, role, is_active, email_verified_at IS NOT NULL, created_at, updated_at
 		FROM users WHERE is_active = true
 	`
 	var args []interface{}
@@ -59,7 +60,7 @@ func (r *Repository) List(ctx context.Context, search string) ([]model.User, err
 	var users []model.User
 	for rows.Next() {
 		var u model.User
-		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.PasswordHash, &u.GoogleID, &u.AvatarURL, &u.Role, &u.IsActive, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.PasswordHash, &u.GoogleID, &u.AvatarURL, &u.Role, &u.IsActive, &u.EmailVerified, &u.CreatedAt, &u.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan user: %w", err)
 		}
 		users = append(users, u)
@@ -70,6 +71,134 @@ func (r *Repository) List(ctx context.Context, search string) ([]model.User, err
 	return users, nil
 }
 
+// ListFilter narrows the admin user listing. Zero values match everything,
+// including deactivated accounts.
+type ListFilter struct {
+	Query  string // substring of name or email
+	Role   model.UserRole
+	Active *bool
+	Limit  int
+	Offset int
+}
+
+// ListAll returns users matching the filter, ordered by name.
+func (r *Repository) ListAll(ctx context.Context, f ListFilter) ([]model.User, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.Query != "" {
+		args = append(args, "%"+f.Query+"%")
+		conds = append(conds, fmt.Sprintf("(LOWER(name) LIKE LOWER($%d) OR LOWER(email) LIKE LOWER($%d))", len(args), len(args)))
+	}
+	if f.Role != "" {
+		args = append(args, f.Role)
+		conds = append(conds, fmt.Sprintf("role = $%d", len(args)))
+	}
+	if f.Active != nil {
+		args = append(args, *f.Active)
+		conds = append(conds, fmt.Sprintf("is_active = $%d", len(args)))
+	}
+
+	query := `
+		SELECT id, email, name, '', NULL::varchar, avatar_url, role, is_active, email_verified_at IS NOT NULL, created_at, updated_at
+		FROM users
+	`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit, f.Offset)
+	query += fmt.Sprintf(" ORDER BY name ASC, id ASC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list all users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		var u model.User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.PasswordHash, &u.GoogleID, &u.AvatarURL, &u.Role, &u.IsActive, &u.EmailVerified, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate users: %w", err)
+	}
+	return users, nil
+}
+
+func (r *Repository) SetActive(ctx context.Context, id uuid.UUID, active bool) error {
+	query := `UPDATE users SET is_active = $1, updated_at = NOW() WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, active, id)
+	if err != nil {
+		return fmt.Errorf("set user active: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) error {
+	query := `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, hash, id)
+	if err != nil {
+		return fmt.Errorf("set user password: %w", err)
+	}
+	return nil
+}
+
+// SetActiveKeepingAdmin is SetActive, but refuses with ErrLastAdmin to
+// deactivate the only active admin.
+func (r *Repository) SetActiveKeepingAdmin(ctx context.Context, id uuid.UUID, active bool) error {
+	return r.updateKeepingAdmin(ctx, id, `UPDATE users SET is_active = $1, updated_at = NOW() WHERE id = $2`, active)
+}
+
+// SetRole changes the user's role, refusing with ErrLastAdmin to demote the
+// only active admin.
+func (r *Repository) SetRole(ctx context.Context, id uuid.UUID, role model.UserRole) error {
+	return r.updateKeepingAdmin(ctx, id, `UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2`, role)
+}
+
+// updateKeepingAdmin runs an update that may take the user out of the active
+// admins. The active admins are locked while they are counted, so two
+// concurrent changes cannot both see another admin left and remove the last two.
+func (r *Repository) updateKeepingAdmin(ctx context.Context, id uuid.UUID, query string, value interface{}) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT id FROM users WHERE role = $1 AND is_active = true FOR UPDATE`, model.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("lock admins: %w", err)
+	}
+	admins := 0
+	isAdmin := false
+	for rows.Next() {
+		var adminID uuid.UUID
+		if err := rows.Scan(&adminID); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan admin: %w", err)
+		}
+		admins++
+		isAdmin = isAdmin || adminID == id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate admins: %w", err)
+	}
+	if isAdmin && admins <= 1 {
+		return ErrLastAdmin
+	}
+
+	if _, err := tx.Exec(ctx, query, value, id); err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
 func (r *Repository) Update(ctx context.Context, user *model.User) error {
 	query := `UPDATE users SET name = $1, avatar_url = $2, updated_at = NOW() WHERE id = $3`
 	_, err := r.db.Exec(ctx, query, user.Name, user.AvatarURL, user.ID)
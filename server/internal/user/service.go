@@ -3,20 +3,52 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 
+	"github.com/feather-chat/feather/internal/audit"
 	"github.com/feather-chat/feather/internal/model"
 )
 
-var ErrUserNotFound = errors.New("user not found")
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrModifySelf   = errors.New("cannot change your own account")
+	ErrLastAdmin    = errors.New("workspace must keep at least one active admin")
+	ErrBotAccount   = errors.New("not supported for bot accounts")
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+// SessionRevoker signs users out before their tokens expire. RevokeAllSessions
+// also closes the user's live connections.
+type SessionRevoker interface {
+	RevokeAccessTokens(ctx context.Context, userID uuid.UUID) error
+	RevokeAllSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+// AuditLogger records administrative actions.
+type AuditLogger interface {
+	Log(ctx context.Context, entry audit.Entry)
+}
 
 type Service struct {
-	repo *Repository
+	repo     *Repository
+	sessions SessionRevoker
+	auditLog AuditLogger
+}
+
+func NewService(repo *Repository, sessions SessionRevoker) *Service {
+	return &Service{repo: repo, sessions: sessions}
 }
 
-func NewService(repo *Repository) *Service {
-	return &Service{repo: repo}
+// SetAuditLogger enables audit entries for account administration.
+func (s *Service) SetAuditLogger(al AuditLogger) {
+	s.auditLog = al
 }
 
 func (s *Service) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
@@ -60,3 +92,175 @@ func (s *Service) Update(ctx context.Context, id uuid.UUID, req model.UpdateUser
 func (s *Service) GetUserChannelIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
 	return s.repo.GetUserChannelIDs(ctx, userID)
 }
+
+// AdminList returns users matching the filter, including deactivated accounts.
+func (s *Service) AdminList(ctx context.Context, f ListFilter) ([]model.User, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultAdminPageSize
+	}
+	if f.Limit > maxAdminPageSize {
+		f.Limit = maxAdminPageSize
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	return s.repo.ListAll(ctx, f)
+}
+
+// Deactivate disables an account: the user can no longer sign in, every
+// session is revoked and their live connections are closed.
+func (s *Service) Deactivate(ctx context.Context, targetID, actorID uuid.UUID) (*model.User, error) {
+	user, err := s.adminTarget(ctx, targetID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return user, nil
+	}
+	if err := s.repo.SetActiveKeepingAdmin(ctx, targetID, false); err != nil {
+		return nil, err
+	}
+	user.IsActive = false
+
+	if err := s.signOut(ctx, targetID); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, actorID, audit.ActionUserDeactivated, user, nil)
+	return user, nil
+}
+
+// Reactivate lets a deactivated user sign in again.
+func (s *Service) Reactivate(ctx context.Context, targetID, actorID uuid.UUID) (*model.User, error) {
+	user, err := s.adminTarget(ctx, targetID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsActive {
+		return user, nil
+	}
+
+	if err := s.repo.SetActive(ctx, targetID, true); err != nil {
+		return nil, err
+	}
+	user.IsActive = true
+
+	s.audit(ctx, actorID, audit.ActionUserReactivated, user, nil)
+	return user, nil
+}
+
+// SetRole promotes or demotes a user between admin and member. Their access
+// tokens carry the old role, so they are revoked; clients pick up the new role
+// on refresh.
+func (s *Service) SetRole(ctx context.Context, targetID uuid.UUID, role model.UserRole, actorID uuid.UUID) (*model.User, error) {
+	user, err := s.adminTarget(ctx, targetID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == model.RoleBot {
+		return nil, ErrBotAccount
+	}
+	if user.Role == role {
+		return user, nil
+	}
+	if err := s.repo.SetRole(ctx, targetID, role); err != nil {
+		return nil, err
+	}
+	previous := user.Role
+	user.Role = role
+
+	if s.sessions != nil {
+		if err := s.sessions.RevokeAccessTokens(ctx, targetID); err != nil {
+			return nil, err
+		}
+	}
+
+	s.audit(ctx, actorID, audit.ActionUserRoleChanged, user, map[string]interface{}{
+		"role":          role,
+		"previous_role": previous,
+	})
+	return user, nil
+}
+
+// ForceLogout signs the user out of every session and device.
+func (s *Service) ForceLogout(ctx context.Context, targetID, actorID uuid.UUID) error {
+	user, err := s.adminTarget(ctx, targetID, actorID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.signOut(ctx, targetID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actorID, audit.ActionUserSessionsRevoked, user, nil)
+	return nil
+}
+
+// ResetPassword sets a new password for the user and signs them out
+// everywhere, so only the new password works from now on.
+func (s *Service) ResetPassword(ctx context.Context, targetID uuid.UUID, password string, actorID uuid.UUID) error {
+	user, err := s.adminTarget(ctx, targetID, actorID)
+	if err != nil {
+		return err
+	}
+	if user.Role == model.RoleBot {
+		return ErrBotAccount
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	if err := s.repo.SetPasswordHash(ctx, targetID, string(hash)); err != nil {
+		return err
+	}
+
+	if err := s.signOut(ctx, targetID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, actorID, audit.ActionUserPasswordReset, user, nil)
+	return nil
+}
+
+// adminTarget loads the user an admin action applies to. Admins cannot act on
+// their own account, so they cannot lock themselves out.
+func (s *Service) adminTarget(ctx context.Context, targetID, actorID uuid.UUID) (*model.User, error) {
+	if targetID == actorID {
+		return nil, ErrModifySelf
+	}
+	user, err := s.repo.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// signOut revokes every session of the user and closes their connections.
+func (s *Service) signOut(ctx context.Context, userID uuid.UUID) error {
+	if s.sessions == nil {
+		return nil
+	}
+	return s.sessions.RevokeAllSessions(ctx, userID)
+}
+
+func (s *Service) audit(ctx context.Context, actorID uuid.UUID, action string, user *model.User, metadata map[string]interface{}) {
+	if s.auditLog == nil {
+		return
+	}
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["email"] = user.Email
+	s.auditLog.Log(ctx, audit.Entry{
+		UserID:     actorID,
+		Action:     action,
+		EntityType: audit.EntityUser,
+		EntityID:   user.ID,
+		Metadata:   metadata,
+	})
+}
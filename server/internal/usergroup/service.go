@@ -3,6 +3,7 @@ package usergroup
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
@@ -134,3 +135,27 @@ func (s *Service) AddMember(ctx context.Context, groupID, userID uuid.UUID) erro
 func (s *Service) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
 	return s.repo.RemoveMember(ctx, groupID, userID)
 }
+
+// SyncMemberships adds the user to or removes them from each named group, as
+// directed by an identity provider. Groups that don't exist are skipped.
+func (s *Service) SyncMemberships(ctx context.Context, userID uuid.UUID, memberships map[string]bool) error {
+	for name, member := range memberships {
+		g, err := s.repo.GetByName(ctx, name)
+		if err != nil {
+			return err
+		}
+		if g == nil {
+			slog.Warn("mapped user group does not exist", "group", name)
+			continue
+		}
+		if member {
+			err = s.repo.AddMember(ctx, g.ID, userID)
+		} else {
+			err = s.repo.RemoveMember(ctx, g.ID, userID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/feather-chat/feather/internal/model"
+)
+
+const (
+	deliveryPollInterval = 2 * time.Second
+	deliveryBatchSize    = 20
+	deliveryLease        = 5 * time.Minute
+	deliveryTimeout      = 10 * time.Second
+	maxDeliveryAttempts  = 8
+	baseRetryDelay       = 10 * time.Second
+	maxRetryDelay        = time.Hour
+	maxErrorLength       = 500
+
+	SignatureHeader = "X-Feather-Signature"
+	TimestampHeader = "X-Feather-Timestamp"
+	EventHeader     = "X-Feather-Event"
+	DeliveryHeader  = "X-Feather-Delivery"
+)
+
+// deliveryBody is the JSON document POSTed to outgoing webhook URLs.
+type deliveryBody struct {
+	ID        uuid.UUID       `json:"id"`
+	WebhookID uuid.UUID       `json:"webhook_id"`
+	Event     model.EventType `json:"event"`
+	ChannelID uuid.UUID       `json:"channel_id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// DispatchEvent queues a delivery for every outgoing webhook on the channel that
+// subscribes to the event type. It is called for every broadcast event, so the
+// work is done in the background.
+func (s *Service) DispatchEvent(channelID uuid.UUID, event model.WebSocketEvent) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+		defer cancel()
+
+		webhooks, err := s.repo.ListOutgoingForEvent(ctx, channelID, string(event.Type))
+		if err != nil {
+			slog.Error("failed to look up outgoing webhooks", "error", err, "channel_id", channelID)
+			return
+		}
+
+		now := time.Now()
+		for _, wh := range webhooks {
+			allowed, err := s.creatorCanReceive(ctx, &wh)
+			if err != nil {
+				slog.Error("failed to check outgoing webhook creator", "error", err, "webhook_id", wh.ID)
+				continue
+			}
+			if !allowed {
+				slog.Warn("disabling outgoing webhook whose creator lost access to the channel", "webhook_id", wh.ID, "channel_id", channelID)
+				if err := s.repo.DisableOutgoing(ctx, wh.ID); err != nil {
+					slog.Error("failed to disable outgoing webhook", "error", err, "webhook_id", wh.ID)
+				}
+				continue
+			}
+
+			d := &model.WebhookDelivery{
+				ID:            uuid.New(),
+				WebhookID:     wh.ID,
+				EventType:     string(event.Type),
+				Status:        model.DeliveryPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+			}
+			d.Payload, err = json.Marshal(deliveryBody{
+				ID:        d.ID,
+				WebhookID: wh.ID,
+				Event:     event.Type,
+				ChannelID: channelID,
+				Timestamp: now.UTC(),
+				Data:      event.Payload,
+			})
+			if err != nil {
+				slog.Error("failed to marshal delivery body", "error", err)
+				continue
+			}
+			if err := s.repo.EnqueueDelivery(ctx, d); err != nil {
+				slog.Error("failed to enqueue webhook delivery", "error", err, "webhook_id", wh.ID)
+			}
+		}
+	}()
+}
+
+// creatorCanReceive reports whether the webhook's creator may still receive the
+// channel's events: their account must be active, and they must still be a
+// member of the channel with the manage_webhooks permission.
+func (s *Service) creatorCanReceive(ctx context.Context, wh *model.OutgoingWebhook) (bool, error) {
+	if !wh.CreatorActive {
+		return false, nil
+	}
+	if s.memberChecker != nil {
+		isMember, err := s.memberChecker.IsMember(ctx, wh.ChannelID, wh.CreatorID)
+		if err != nil {
+			return false, err
+		}
+		if !isMember {
+			return false, nil
+		}
+	}
+	err := s.checkManage(ctx, wh.ChannelID, wh.CreatorID, wh.CreatorRole)
+	if errors.Is(err, ErrForbidden) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RunDeliveryWorker drains the delivery queue until ctx is cancelled.
+func (s *Service) RunDeliveryWorker(ctx context.Context) {
+	ticker := time.NewTicker(deliveryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.processDueDeliveries(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Service) processDueDeliveries(ctx context.Context) {
+	deliveries, err := s.repo.ClaimDueDeliveries(ctx, deliveryBatchSize, deliveryLease)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("failed to claim webhook deliveries", "error", err)
+		}
+		return
+	}
+
+	for i := range deliveries {
+		s.attemptDelivery(ctx, &deliveries[i])
+	}
+}
+
+func (s *Service) attemptDelivery(ctx context.Context, d *model.WebhookDelivery) {
+	wh, err := s.repo.GetOutgoingByID(ctx, d.WebhookID)
+	if err != nil {
+		slog.Error("failed to load outgoing webhook", "error", err, "webhook_id", d.WebhookID)
+		return // lease expiry will retry
+	}
+	if wh == nil || !wh.IsActive {
+		_ = s.repo.MarkFailed(ctx, d.ID, model.DeliveryDead, nil, "webhook deleted or inactive", time.Now())
+		return
+	}
+
+	status, err := s.post(ctx, wh, d)
+	if err == nil {
+		if err := s.repo.MarkDelivered(ctx, d.ID, status); err != nil {
+			slog.Error("failed to mark delivery succeeded", "error", err, "delivery_id", d.ID)
+		}
+		return
+	}
+
+	var respStatus *int
+	if status != 0 {
+		respStatus = &status
+	}
+	msg := err.Error()
+	if len(msg) > maxErrorLength {
+		msg = msg[:maxErrorLength]
+	}
+
+	attempts := d.Attempts + 1
+	if attempts >= maxDeliveryAttempts {
+		slog.Warn("webhook delivery moved to dead-letter list", "delivery_id", d.ID, "webhook_id", wh.ID, "error", msg)
+		_ = s.repo.MarkFailed(ctx, d.ID, model.DeliveryDead, respStatus, msg, time.Now())
+		return
+	}
+	_ = s.repo.MarkFailed(ctx, d.ID, model.DeliveryPending, respStatus, msg, time.Now().Add(retryDelay(attempts)))
+}
+
+// post sends the signed delivery. A non-2xx response is returned as an error
+// along with the status code.
+func (s *Service) post(ctx context.Context, wh *model.OutgoingWebhook, d *model.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Feather-Webhooks/1.0")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, d.ID.String())
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(wh.Secret, timestamp, d.Payload))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("post: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// NewPublicClient returns an HTTP client that only connects to public
+// addresses, so an admin- or user-supplied URL cannot reach services on
+// Feather's own network; the check runs on the resolved address of every
+// connection, including redirects. Webhook deliveries and custom slash
+// commands are sent with it.
+func NewPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: refusePrivateAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would be dialed instead of the URL's host
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which is not
+// covered by netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
+
+// Sign computes the hex HMAC-SHA256 of "<timestamp>.<body>" with the webhook secret.
+// Receivers recompute it to verify the X-Feather-Signature header and reject stale timestamps.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay returns the exponential backoff before the given attempt number is retried.
+func retryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay << (attempts - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 
+	"github.com/feather-chat/feather/internal/channel"
 	"github.com/feather-chat/feather/internal/middleware"
 	"github.com/feather-chat/feather/internal/model"
 )
@@ -34,9 +36,10 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID := middleware.GetUserID(r.Context())
-	wh, err := h.service.Create(r.Context(), req, userID)
+	userRole := middleware.GetUserRole(r.Context())
+	wh, err := h.service.Create(r.Context(), req, userID, userRole)
 	if err != nil {
-		writeError(w, "internal server error", http.StatusInternalServerError)
+		handleServiceError(w, err)
 		return
 	}
 
@@ -67,17 +70,126 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	userRole := middleware.GetUserRole(r.Context())
 
 	if err := h.service.Delete(r.Context(), webhookID, userID, userRole); err != nil {
-		if errors.Is(err, ErrWebhookNotFound) {
-			writeError(w, "webhook not found", http.StatusNotFound)
-			return
-		}
+		handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) CreateOutgoing(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateOutgoingWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+
+	wh, err := h.service.CreateOutgoing(r.Context(), req, userID, userRole)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, wh, http.StatusCreated)
+}
+
+func (h *Handler) ListOutgoing(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	webhooks, err := h.service.ListOutgoing(r.Context(), userID)
+	if err != nil {
 		writeError(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
+	if webhooks == nil {
+		webhooks = []model.OutgoingWebhook{}
+	}
+	writeJSON(w, webhooks, http.StatusOK)
+}
+
+func (h *Handler) DeleteOutgoing(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		writeError(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+
+	if err := h.service.DeleteOutgoing(r.Context(), webhookID, userID, userRole); err != nil {
+		handleServiceError(w, err)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		writeError(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch model.DeliveryStatus(status) {
+	case "", model.DeliveryPending, model.DeliverySucceeded, model.DeliveryDead:
+	default:
+		writeError(w, "invalid status filter", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+
+	deliveries, err := h.service.ListDeliveries(r.Context(), webhookID, status, limit, userID, userRole)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []model.WebhookDelivery{}
+	}
+	writeJSON(w, deliveries, http.StatusOK)
+}
+
+func (h *Handler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		writeError(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := uuid.Parse(chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		writeError(w, "invalid delivery id", http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.GetUserID(r.Context())
+	userRole := middleware.GetUserRole(r.Context())
+
+	if err := h.service.Redeliver(r.Context(), webhookID, deliveryID, userID, userRole); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func (h *Handler) HandleIncoming(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 	if token == "" {
@@ -107,6 +219,23 @@ func (h *Handler) HandleIncoming(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func handleServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrWebhookNotFound):
+		writeError(w, "webhook not found", http.StatusNotFound)
+	case errors.Is(err, channel.ErrChannelNotFound):
+		writeError(w, "channel not found", http.StatusNotFound)
+	case errors.Is(err, ErrDeliveryNotFound):
+		writeError(w, "delivery not found", http.StatusNotFound)
+	case errors.Is(err, ErrForbidden):
+		writeError(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, ErrInvalidURL):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
 func writeJSON(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -3,6 +3,7 @@ package webhook
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -19,22 +20,34 @@ func NewRepository(db *pgxpool.Pool) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) Create(ctx context.Context, wh *model.Webhook) error {
+// Create inserts the webhook together with its bot user in a single transaction.
+func (r *Repository) Create(ctx context.Context, wh *model.Webhook, bot *model.User) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertBotUser(ctx, tx, bot); err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO webhooks (id, channel_id, name, token, creator_id, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO webhooks (id, channel_id, name, token, creator_id, bot_user_id, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
-	_, err := r.db.Exec(ctx, query, wh.ID, wh.ChannelID, wh.Name, wh.Token, wh.CreatorID, wh.IsActive)
+	_, err = tx.Exec(ctx, query, wh.ID, wh.ChannelID, wh.Name, wh.Token, wh.CreatorID, wh.BotUserID, wh.IsActive)
 	if err != nil {
 		return fmt.Errorf("create webhook: %w", err)
 	}
-	return nil
+
+	return tx.Commit(ctx)
 }
 
 func (r *Repository) GetByToken(ctx context.Context, token string) (*model.Webhook, error) {
-	query := `SELECT id, channel_id, name, token, creator_id, is_active, created_at FROM webhooks WHERE token = $1 AND is_active = true`
+	query := `SELECT id, channel_id, name, token, creator_id, bot_user_id, is_active, created_at FROM webhooks WHERE token = $1 AND is_active = true`
 	var wh model.Webhook
-	err := r.db.QueryRow(ctx, query, token).Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.Token, &wh.CreatorID, &wh.IsActive, &wh.CreatedAt)
+	err := r.db.QueryRow(ctx, query, token).Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.Token, &wh.CreatorID, &wh.BotUserID, &wh.IsActive, &wh.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -45,7 +58,7 @@ func (r *Repository) GetByToken(ctx context.Context, token string) (*model.Webho
 }
 
 func (r *Repository) List(ctx context.Context, creatorID uuid.UUID) ([]model.Webhook, error) {
-	query := `SELECT id, channel_id, name, '', creator_id, is_active, created_at FROM webhooks WHERE creator_id = $1 ORDER BY created_at DESC`
+	query := `SELECT id, channel_id, name, '', creator_id, bot_user_id, is_active, created_at FROM webhooks WHERE creator_id = $1 ORDER BY created_at DESC`
 	rows, err := r.db.Query(ctx, query, creatorID)
 	if err != nil {
 		return nil, fmt.Errorf("list webhooks: %w", err)
@@ -55,7 +68,30 @@ func (r *Repository) List(ctx context.Context, creatorID uuid.UUID) ([]model.Web
 	var webhooks []model.Webhook
 	for rows.Next() {
 		var wh model.Webhook
-		if err := rows.Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.Token, &wh.CreatorID, &wh.IsActive, &wh.CreatedAt); err != nil {
+		if err := rows.Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.Token, &wh.CreatorID, &wh.BotUserID, &wh.IsActive, &wh.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, wh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// ListWithoutBotUser returns webhooks created before bot users were seeded per webhook.
+func (r *Repository) ListWithoutBotUser(ctx context.Context) ([]model.Webhook, error) {
+	query := `SELECT id, channel_id, name, '', creator_id, bot_user_id, is_active, created_at FROM webhooks WHERE bot_user_id IS NULL`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks without bot user: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		var wh model.Webhook
+		if err := rows.Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.Token, &wh.CreatorID, &wh.BotUserID, &wh.IsActive, &wh.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan webhook: %w", err)
 		}
 		webhooks = append(webhooks, wh)
@@ -66,18 +102,74 @@ func (r *Repository) List(ctx context.Context, creatorID uuid.UUID) ([]model.Web
 	return webhooks, nil
 }
 
+// AttachBotUser links bot to a webhook that has no bot user yet, creating it,
+// and returns the webhook's bot user ID. The webhook row is locked first, so
+// when deliveries race to attach one, the others wait and get the winner's
+// bot user instead of creating their own.
+func (r *Repository) AttachBotUser(ctx context.Context, webhookID uuid.UUID, bot *model.User) (uuid.UUID, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var existing *uuid.UUID
+	err = tx.QueryRow(ctx, `SELECT bot_user_id FROM webhooks WHERE id = $1 FOR UPDATE`, webhookID).Scan(&existing)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("lock webhook: %w", err)
+	}
+	if existing != nil {
+		return *existing, nil
+	}
+
+	if err := insertBotUser(ctx, tx, bot); err != nil {
+		return uuid.Nil, err
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE webhooks SET bot_user_id = $1 WHERE id = $2 AND bot_user_id IS NULL`, bot.ID, webhookID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("attach bot user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return uuid.Nil, fmt.Errorf("attach bot user: webhook %s changed concurrently", webhookID)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("commit tx: %w", err)
+	}
+	return bot.ID, nil
+}
+
+// Delete removes the webhook and deactivates its bot user. The bot user row is
+// kept so that messages it posted still resolve an author.
 func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE users SET is_active = false, updated_at = NOW()
+		 WHERE id = (SELECT bot_user_id FROM webhooks WHERE id = $1) AND role = 'bot'`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("deactivate bot user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", id)
 	if err != nil {
 		return fmt.Errorf("delete webhook: %w", err)
 	}
-	return nil
+
+	return tx.Commit(ctx)
 }
 
 func (r *Repository) GetByID(ctx context.Context, id uuid.UUID) (*model.Webhook, error) {
-	query := `SELECT id, channel_id, name, token, creator_id, is_active, created_at FROM webhooks WHERE id = $1`
+	query := `SELECT id, channel_id, name, token, creator_id, bot_user_id, is_active, created_at FROM webhooks WHERE id = $1`
 	var wh model.Webhook
-	err := r.db.QueryRow(ctx, query, id).Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.Token, &wh.CreatorID, &wh.IsActive, &wh.CreatedAt)
+	err := r.db.QueryRow(ctx, query, id).Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.Token, &wh.CreatorID, &wh.BotUserID, &wh.IsActive, &wh.CreatedAt)
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -86,3 +178,281 @@ func (r *Repository) GetByID(ctx context.Context, id uuid.UUID) (*model.Webhook,
 	}
 	return &wh, nil
 }
+
+func (r *Repository) CreateOutgoing(ctx context.Context, wh *model.OutgoingWebhook) error {
+	query := `
+		INSERT INTO outgoing_webhooks (id, channel_id, name, url, secret, events, creator_id, is_active, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.Exec(ctx, query,
+		wh.ID, wh.ChannelID, wh.Name, wh.URL, wh.Secret, wh.Events, wh.CreatorID, wh.IsActive, wh.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create outgoing webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetOutgoingByID(ctx context.Context, id uuid.UUID) (*model.OutgoingWebhook, error) {
+	query := `
+		SELECT id, channel_id, name, url, secret, events, creator_id, is_active, created_at
+		FROM outgoing_webhooks WHERE id = $1
+	`
+	var wh model.OutgoingWebhook
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&wh.ID, &wh.ChannelID, &wh.Name, &wh.URL, &wh.Secret, &wh.Events, &wh.CreatorID, &wh.IsActive, &wh.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get outgoing webhook: %w", err)
+	}
+	return &wh, nil
+}
+
+func (r *Repository) ListOutgoing(ctx context.Context, creatorID uuid.UUID) ([]model.OutgoingWebhook, error) {
+	query := `
+		SELECT id, channel_id, name, url, '', events, creator_id, is_active, created_at
+		FROM outgoing_webhooks WHERE creator_id = $1 ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(ctx, query, creatorID)
+	if err != nil {
+		return nil, fmt.Errorf("list outgoing webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []model.OutgoingWebhook
+	for rows.Next() {
+		var wh model.OutgoingWebhook
+		if err := rows.Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.URL, &wh.Secret, &wh.Events, &wh.CreatorID, &wh.IsActive, &wh.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan outgoing webhook: %w", err)
+		}
+		webhooks = append(webhooks, wh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate outgoing webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// ListOutgoingForEvent returns the active outgoing webhooks of a channel subscribed to an event type,
+// with their creator's role and status.
+func (r *Repository) ListOutgoingForEvent(ctx context.Context, channelID uuid.UUID, eventType string) ([]model.OutgoingWebhook, error) {
+	query := `
+		SELECT w.id, w.channel_id, w.name, w.url, w.secret, w.events, w.creator_id, w.is_active, w.created_at,
+			   u.role, u.is_active
+		FROM outgoing_webhooks w
+		JOIN users u ON u.id = w.creator_id
+		WHERE w.channel_id = $1 AND w.is_active = true AND $2 = ANY(w.events)
+	`
+	rows, err := r.db.Query(ctx, query, channelID, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("list outgoing webhooks for event: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []model.OutgoingWebhook
+	for rows.Next() {
+		var wh model.OutgoingWebhook
+		if err := rows.Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.URL, &wh.Secret, &wh.Events, &wh.CreatorID, &wh.IsActive, &wh.CreatedAt,
+			&wh.CreatorRole, &wh.CreatorActive); err != nil {
+			return nil, fmt.Errorf("scan outgoing webhook: %w", err)
+		}
+		webhooks = append(webhooks, wh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate outgoing webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// DisableOutgoing stops deliveries to an outgoing webhook without deleting it.
+func (r *Repository) DisableOutgoing(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, "UPDATE outgoing_webhooks SET is_active = false WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("disable outgoing webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) DeleteOutgoing(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM outgoing_webhooks WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete outgoing webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) EnqueueDelivery(ctx context.Context, d *model.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (id, webhook_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(ctx, query, d.ID, d.WebhookID, d.EventType, d.Payload, d.Status, d.NextAttemptAt, d.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("enqueue delivery: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueDeliveries leases up to limit pending deliveries whose next attempt is due.
+// The lease pushes next_attempt_at forward so that a crashed worker's deliveries
+// are picked up again once the lease expires; SKIP LOCKED lets several instances
+// drain the queue concurrently.
+func (r *Repository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries SET next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+				  response_status, last_error, delivered_at, created_at
+	`
+	rows, err := r.db.Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *Repository) MarkDelivered(ctx context.Context, id uuid.UUID, responseStatus int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'succeeded', attempts = attempts + 1, response_status = $2, last_error = NULL, delivered_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, responseStatus)
+	if err != nil {
+		return fmt.Errorf("mark delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed attempt, either scheduling a retry or moving the
+// delivery to the dead-letter list when status is DeliveryDead.
+func (r *Repository) MarkFailed(ctx context.Context, id uuid.UUID, status model.DeliveryStatus, responseStatus *int, lastError string, nextAttemptAt time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, response_status = $3, last_error = $4, next_attempt_at = $5
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, status, responseStatus, lastError, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("mark delivery failed: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetDelivery(ctx context.Context, id uuid.UUID) (*model.WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+			   response_status, last_error, delivered_at, created_at
+		FROM webhook_deliveries WHERE id = $1
+	`
+	d, err := scanDelivery(r.db.QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *Repository) ListDeliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int) ([]model.WebhookDelivery, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	query := `
+		SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+			   response_status, last_error, delivered_at, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+	rows, err := r.db.Query(ctx, query, webhookID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RequeueDelivery moves a dead-lettered delivery back into the queue with a fresh attempt budget.
+func (r *Repository) RequeueDelivery(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = NULL
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("requeue delivery: %w", err)
+	}
+	return nil
+}
+
+type scannable interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDelivery(row scannable) (*model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var payload []byte
+	err := row.Scan(
+		&d.ID, &d.WebhookID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.ResponseStatus, &d.LastError, &d.DeliveredAt, &d.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan delivery: %w", err)
+	}
+	d.Payload = payload
+	return &d, nil
+}
+
+func insertBotUser(ctx context.Context, tx pgx.Tx, bot *model.User) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO users (id, email, name, password_hash, role, is_active, created_at, updated_at)
+		 VALUES ($1, $2, $3, '', $4, $5, $6, $7)`,
+		bot.ID, bot.Email, bot.Name, bot.Role, bot.IsActive, bot.CreatedAt, bot.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create bot user: %w", err)
+	}
+	return nil
+}
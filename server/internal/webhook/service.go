@@ -7,33 +7,71 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/feather-chat/feather/internal/audit"
 	"github.com/feather-chat/feather/internal/model"
 )
 
 var (
-	ErrWebhookNotFound = errors.New("webhook not found")
-	ErrInvalidToken    = errors.New("invalid webhook token")
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrInvalidToken     = errors.New("invalid webhook token")
+	ErrForbidden        = errors.New("forbidden")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrInvalidURL       = errors.New("webhook url must be an http or https url")
 )
 
 type MessageCreator interface {
 	CreateAlertMessage(ctx context.Context, channelID, botUserID uuid.UUID, content string, severity string, metadata json.RawMessage) (*model.Message, error)
 }
 
+// ChannelMemberChecker checks a user's membership and permissions in a channel.
+type ChannelMemberChecker interface {
+	IsMember(ctx context.Context, channelID, userID uuid.UUID) (bool, error)
+	HasPermission(ctx context.Context, channelID, userID uuid.UUID, userRole string, perm model.ChannelPermission) (bool, error)
+}
+
+// AuditLogger records administrative actions.
+type AuditLogger interface {
+	Log(ctx context.Context, entry audit.Entry)
+}
+
 type Service struct {
-	repo      *Repository
-	botUserID uuid.UUID
-	msgCreate MessageCreator
+	repo          *Repository
+	msgCreate     MessageCreator
+	memberChecker ChannelMemberChecker
+	auditLog      AuditLogger
+	httpClient    *http.Client
+}
+
+func NewService(repo *Repository, msgCreate MessageCreator) *Service {
+	return &Service{
+		repo:       repo,
+		msgCreate:  msgCreate,
+		httpClient: NewPublicClient(deliveryTimeout),
+	}
 }
 
-func NewService(repo *Repository, botUserID uuid.UUID, msgCreate MessageCreator) *Service {
-	return &Service{repo: repo, botUserID: botUserID, msgCreate: msgCreate}
+// SetMemberChecker sets the channel permission checker for authorization.
+func (s *Service) SetMemberChecker(mc ChannelMemberChecker) {
+	s.memberChecker = mc
 }
 
-func (s *Service) Create(ctx context.Context, req model.CreateWebhookRequest, creatorID uuid.UUID) (*model.Webhook, error) {
+// SetAuditLogger enables audit entries for webhook creation and deletion.
+func (s *Service) SetAuditLogger(al AuditLogger) {
+	s.auditLog = al
+}
+
+func (s *Service) Create(ctx context.Context, req model.CreateWebhookRequest, creatorID uuid.UUID, userRole string) (*model.Webhook, error) {
+	if err := s.checkManage(ctx, req.ChannelID, creatorID, userRole); err != nil {
+		return nil, err
+	}
+
 	token, err := generateToken()
 	if err != nil {
 		return nil, err
@@ -49,10 +87,14 @@ func (s *Service) Create(ctx context.Context, req model.CreateWebhookRequest, cr
 		CreatedAt: time.Now(),
 	}
 
-	if err := s.repo.Create(ctx, wh); err != nil {
+	bot := newBotUser(wh)
+	wh.BotUserID = &bot.ID
+
+	if err := s.repo.Create(ctx, wh, bot); err != nil {
 		return nil, err
 	}
 
+	s.audit(ctx, audit.ActionWebhookCreated, audit.EntityWebhook, creatorID, wh.ID, wh.ChannelID, wh.Name)
 	return wh, nil
 }
 
@@ -68,10 +110,17 @@ func (s *Service) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID, us
 	if wh == nil {
 		return ErrWebhookNotFound
 	}
-	if wh.CreatorID != userID && userRole != string(model.RoleAdmin) {
-		return fmt.Errorf("forbidden")
+	if wh.CreatorID != userID {
+		if err := s.checkManage(ctx, wh.ChannelID, userID, userRole); err != nil {
+			return err
+		}
 	}
-	return s.repo.Delete(ctx, id)
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, audit.ActionWebhookDeleted, audit.EntityWebhook, userID, wh.ID, wh.ChannelID, wh.Name)
+	return nil
 }
 
 func (s *Service) HandleIncoming(ctx context.Context, token string, payload model.WebhookPayload) error {
@@ -83,16 +132,185 @@ func (s *Service) HandleIncoming(ctx context.Context, token string, payload mode
 		return ErrInvalidToken
 	}
 
+	if wh.BotUserID == nil {
+		// Webhook predates bot seeding and SeedBotUsers has not run yet
+		botUserID, err := s.repo.AttachBotUser(ctx, wh.ID, newBotUser(wh))
+		if err != nil {
+			return err
+		}
+		wh.BotUserID = &botUserID
+	}
+
 	content := fmt.Sprintf("**%s**\n\n%s", payload.Title, payload.Message)
 
 	if s.msgCreate != nil {
-		_, err = s.msgCreate.CreateAlertMessage(ctx, wh.ChannelID, s.botUserID, content, payload.Severity, payload.Metadata)
+		_, err = s.msgCreate.CreateAlertMessage(ctx, wh.ChannelID, *wh.BotUserID, content, payload.Severity, payload.Metadata)
 		return err
 	}
 
 	return nil
 }
 
+// SeedBotUsers creates a bot user for every webhook that does not have one yet.
+// Should be called on server startup so webhooks created before bot users existed can post.
+func (s *Service) SeedBotUsers(ctx context.Context) {
+	webhooks, err := s.repo.ListWithoutBotUser(ctx)
+	if err != nil {
+		slog.Error("failed to list webhooks without bot user", "error", err)
+		return
+	}
+
+	seeded := 0
+	for _, wh := range webhooks {
+		if _, err := s.repo.AttachBotUser(ctx, wh.ID, newBotUser(&wh)); err != nil {
+			slog.Error("failed to seed webhook bot user", "error", err, "webhook_id", wh.ID)
+			continue
+		}
+		seeded++
+	}
+	if seeded > 0 {
+		slog.Info("seeded webhook bot users", "count", seeded)
+	}
+}
+
+func (s *Service) CreateOutgoing(ctx context.Context, req model.CreateOutgoingWebhookRequest, creatorID uuid.UUID, userRole string) (*model.OutgoingWebhook, error) {
+	if err := s.checkManage(ctx, req.ChannelID, creatorID, userRole); err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	wh := &model.OutgoingWebhook{
+		ID:        uuid.New(),
+		ChannelID: req.ChannelID,
+		Name:      req.Name,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    req.Events,
+		CreatorID: creatorID,
+		IsActive:  true,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.repo.CreateOutgoing(ctx, wh); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, audit.ActionWebhookCreated, audit.EntityOutgoingWebhook, creatorID, wh.ID, wh.ChannelID, wh.Name)
+	return wh, nil
+}
+
+func (s *Service) ListOutgoing(ctx context.Context, creatorID uuid.UUID) ([]model.OutgoingWebhook, error) {
+	return s.repo.ListOutgoing(ctx, creatorID)
+}
+
+func (s *Service) DeleteOutgoing(ctx context.Context, id uuid.UUID, userID uuid.UUID, userRole string) error {
+	wh, err := s.getOwnedOutgoing(ctx, id, userID, userRole)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteOutgoing(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, audit.ActionWebhookDeleted, audit.EntityOutgoingWebhook, userID, wh.ID, wh.ChannelID, wh.Name)
+	return nil
+}
+
+// ListDeliveries returns the delivery log of an outgoing webhook, optionally filtered by status.
+func (s *Service) ListDeliveries(ctx context.Context, webhookID uuid.UUID, status string, limit int, userID uuid.UUID, userRole string) ([]model.WebhookDelivery, error) {
+	if _, err := s.getOwnedOutgoing(ctx, webhookID, userID, userRole); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(ctx, webhookID, status, limit)
+}
+
+// Redeliver puts a delivery (typically from the dead-letter list) back into the queue.
+func (s *Service) Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID, userID uuid.UUID, userRole string) error {
+	if _, err := s.getOwnedOutgoing(ctx, webhookID, userID, userRole); err != nil {
+		return err
+	}
+
+	d, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	if d == nil || d.WebhookID != webhookID {
+		return ErrDeliveryNotFound
+	}
+
+	return s.repo.RequeueDelivery(ctx, deliveryID)
+}
+
+func (s *Service) getOwnedOutgoing(ctx context.Context, id uuid.UUID, userID uuid.UUID, userRole string) (*model.OutgoingWebhook, error) {
+	wh, err := s.repo.GetOutgoingByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if wh == nil {
+		return nil, ErrWebhookNotFound
+	}
+	if wh.CreatorID != userID {
+		if err := s.checkManage(ctx, wh.ChannelID, userID, userRole); err != nil {
+			return nil, err
+		}
+	}
+	return wh, nil
+}
+
+// checkManage requires the manage_webhooks channel permission. Without a
+// checker only workspace admins pass.
+func (s *Service) checkManage(ctx context.Context, channelID, userID uuid.UUID, userRole string) error {
+	if userRole == string(model.RoleAdmin) {
+		return nil
+	}
+	if s.memberChecker == nil {
+		return ErrForbidden
+	}
+	allowed, err := s.memberChecker.HasPermission(ctx, channelID, userID, userRole, model.PermManageWebhooks)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// audit records a change to a webhook in the audit log.
+func (s *Service) audit(ctx context.Context, action, entityType string, actorID, webhookID, channelID uuid.UUID, name string) {
+	if s.auditLog == nil {
+		return
+	}
+	s.auditLog.Log(ctx, audit.Entry{
+		UserID:     actorID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   webhookID,
+		Metadata:   map[string]interface{}{"channel_id": channelID, "name": name},
+	})
+}
+
+// newBotUser builds the RoleBot user that authors a webhook's messages.
+func newBotUser(wh *model.Webhook) *model.User {
+	now := time.Now()
+	return &model.User{
+		ID:        uuid.New(),
+		Email:     fmt.Sprintf("webhook-%s@bots.feather.local", wh.ID),
+		Name:      wh.Name,
+		Role:      model.RoleBot,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
 func generateToken() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
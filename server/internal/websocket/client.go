@@ -22,6 +22,8 @@ const (
 type Client struct {
 	ID        uuid.UUID
 	UserID    uuid.UUID
+	SessionID uuid.UUID // the API token ID for API tokens; uuid.Nil for tokens issued before sessions existed
+	ReadOnly  bool      // client events are ignored (API tokens without messages:write)
 	UserName  string
 	conn      *ws.Conn
 	hub       *Hub
@@ -30,8 +32,26 @@ type Client struct {
 	mu        sync.RWMutex
 	ctx       context.Context
 	cancel    context.CancelFunc
+	closeOnce sync.Once
+
+	// While missed events are replayed, live frames are held here instead of
+	// being queued for the write pump
+	holdMu  sync.Mutex
+	holding bool
+	held    []heldFrame
+}
+
+// heldFrame is a live frame held back during replay, with the stream it was
+// sequenced on ("" for unsequenced frames).
+type heldFrame struct {
+	stream string
+	data   []byte
 }
 
+// maxHeldFrames bounds the live frames held during a replay. A client that
+// falls further behind is disconnected to reconnect and replay again.
+const maxHeldFrames = 1024
+
 func NewClient(conn *ws.Conn, hub *Hub, userID uuid.UUID, userName string) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
@@ -65,6 +85,85 @@ func (c *Client) IsSubscribed(channelID uuid.UUID) bool {
 	return c.channels[channelID]
 }
 
+// queue hands a frame on stream to the write pump, or holds it while a replay
+// is in progress. It reports false if the client cannot keep up.
+func (c *Client) queue(stream string, data []byte) bool {
+	c.holdMu.Lock()
+	defer c.holdMu.Unlock()
+
+	if c.holding {
+		if len(c.held) >= maxHeldFrames {
+			return false
+		}
+		c.held = append(c.held, heldFrame{stream: stream, data: data})
+		return true
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// holdForReplay holds live frames back until releaseHeld has drained them, so
+// they cannot overtake or repeat the replayed ones.
+func (c *Client) holdForReplay() {
+	c.holdMu.Lock()
+	defer c.holdMu.Unlock()
+	c.holding = true
+}
+
+// releaseHeld returns the frames held so far, without those already replayed:
+// replayed maps a stream to the last sequence number written from it. Once no
+// frames are left it returns nil and live frames flow to the write pump again.
+func (c *Client) releaseHeld(replayed map[string]int64) [][]byte {
+	c.holdMu.Lock()
+	defer c.holdMu.Unlock()
+
+	if len(c.held) == 0 {
+		c.holding = false
+		return nil
+	}
+	frames := make([][]byte, 0, len(c.held))
+	for _, f := range c.held {
+		seq := frameSeq(f.data)
+		if last, ok := replayed[f.stream]; ok && seq > 0 && seq <= last {
+			continue
+		}
+		frames = append(frames, f.data)
+	}
+	c.held = nil
+	return frames
+}
+
+// frameSeq returns the sequence number of a frame, or 0 if it has none.
+func frameSeq(data []byte) int64 {
+	var frame struct {
+		Seq int64 `json:"seq"`
+	}
+	json.Unmarshal(data, &frame)
+	return frame.Seq
+}
+
+// closeSlow disconnects a client whose send buffer is full, so it reconnects and
+// resumes from its last sequence number instead of silently missing events.
+func (c *Client) closeSlow() {
+	c.closeOnce.Do(func() {
+		slog.Warn("disconnecting slow websocket client", "user_id", c.UserID, "client_id", c.ID)
+		go c.conn.Close(ws.StatusTryAgainLater, "slow consumer")
+	})
+}
+
+// disconnect closes the connection from the server side. The read pump then
+// unregisters the client.
+func (c *Client) disconnect(code ws.StatusCode, reason string) {
+	c.closeOnce.Do(func() {
+		slog.Info("disconnecting websocket client", "user_id", c.UserID, "client_id", c.ID, "reason", reason)
+		go c.conn.Close(code, reason)
+	})
+}
+
 func (c *Client) ReadPump() {
 	defer func() {
 		c.hub.unregister <- c
@@ -88,10 +187,18 @@ func (c *Client) ReadPump() {
 			continue
 		}
 
+		if c.ReadOnly {
+			continue
+		}
+
 		// Handle client-sent events
 		switch event.Type {
 		case model.EventTyping:
 			c.handleTyping(event)
+		case model.EventPresencePing:
+			if c.hub.activityHandler != nil {
+				go c.hub.activityHandler(c.UserID)
+			}
 		case model.EventCallInitiate, model.EventCallAccept, model.EventCallDecline,
 			model.EventCallOffer, model.EventCallAnswer, model.EventCallICECandidate,
 			model.EventCallHangup:
@@ -0,0 +1,152 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Replay log sizing. Each stream (a channel or a user) keeps roughly the last
+// replayLogSize events; reconnecting clients that missed more must resync.
+const (
+	replayLogSize = 500
+	replayLogTTL  = 24 * time.Hour
+)
+
+// eventLog assigns per-stream sequence numbers and keeps a bounded history of
+// event frames for replay. Stored frames do not include the sequence number;
+// it is stamped on delivery.
+type eventLog interface {
+	// Append stores the frame and returns its sequence number.
+	Append(ctx context.Context, stream string, frame []byte) (int64, error)
+	// Since returns frames with a sequence number greater than after. complete is
+	// false when some of those events are no longer in the log.
+	Since(ctx context.Context, stream string, after int64) (entries []logEntry, complete bool, err error)
+}
+
+type logEntry struct {
+	Seq   int64
+	Frame []byte
+}
+
+func channelStream(id fmt.Stringer) string { return "channel:" + id.String() }
+func userStream(id fmt.Stringer) string    { return "user:" + id.String() }
+
+// redisEventLog keeps the sequence counter in a plain key and the history in a
+// stream whose entry IDs are "<seq>-0", so XRANGE can resume from any sequence.
+type redisEventLog struct {
+	client *redis.Client
+}
+
+// appendScript increments the counter and adds the entry atomically so that
+// stream IDs are always written in sequence order.
+var appendScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], seq .. '-0', 'f', ARGV[1])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return seq
+`)
+
+func (l *redisEventLog) Append(ctx context.Context, stream string, frame []byte) (int64, error) {
+	seq, err := appendScript.Run(ctx, l.client,
+		[]string{"feather:seq:" + stream, "feather:log:" + stream},
+		frame, replayLogSize, int(replayLogTTL.Seconds()),
+	).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("append event: %w", err)
+	}
+	return seq, nil
+}
+
+func (l *redisEventLog) Since(ctx context.Context, stream string, after int64) ([]logEntry, bool, error) {
+	current, err := l.client.Get(ctx, "feather:seq:"+stream).Int64()
+	if err == redis.Nil {
+		current = 0
+	} else if err != nil {
+		return nil, false, fmt.Errorf("get sequence: %w", err)
+	}
+	if after == current {
+		return nil, true, nil
+	}
+	if after > current {
+		return nil, false, nil // counter was reset
+	}
+
+	msgs, err := l.client.XRangeN(ctx, "feather:log:"+stream, strconv.FormatInt(after, 10)+"-1", "+", replayLogSize+1).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("read event log: %w", err)
+	}
+	if len(msgs) == 0 || len(msgs) > replayLogSize {
+		return nil, false, nil
+	}
+
+	entries := make([]logEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		seq, err := strconv.ParseInt(strings.TrimSuffix(msg.ID, "-0"), 10, 64)
+		if err != nil {
+			continue
+		}
+		frame, _ := msg.Values["f"].(string)
+		entries = append(entries, logEntry{Seq: seq, Frame: []byte(frame)})
+	}
+	if len(entries) == 0 || entries[0].Seq != after+1 {
+		return nil, false, nil
+	}
+	return entries, true, nil
+}
+
+// memoryEventLog is used when Redis is not configured (single instance).
+type memoryEventLog struct {
+	mu      sync.Mutex
+	streams map[string]*memoryStream
+}
+
+type memoryStream struct {
+	seq     int64
+	entries []logEntry
+}
+
+func newMemoryEventLog() *memoryEventLog {
+	return &memoryEventLog{streams: make(map[string]*memoryStream)}
+}
+
+func (l *memoryEventLog) Append(_ context.Context, stream string, frame []byte) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.streams[stream]
+	if !ok {
+		s = &memoryStream{}
+		l.streams[stream] = s
+	}
+	s.seq++
+	s.entries = append(s.entries, logEntry{Seq: s.seq, Frame: frame})
+	if len(s.entries) > replayLogSize {
+		s.entries = append([]logEntry(nil), s.entries[len(s.entries)-replayLogSize:]...)
+	}
+	return s.seq, nil
+}
+
+func (l *memoryEventLog) Since(_ context.Context, stream string, after int64) ([]logEntry, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.streams[stream]
+	if !ok {
+		return nil, after == 0, nil
+	}
+	if after == s.seq {
+		return nil, true, nil
+	}
+	if after > s.seq || len(s.entries) == 0 || s.entries[0].Seq > after+1 {
+		return nil, false, nil
+	}
+
+	start := int(after + 1 - s.entries[0].Seq)
+	return append([]logEntry(nil), s.entries[start:]...), true, nil
+}
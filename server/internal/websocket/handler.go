@@ -5,21 +5,39 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	ws "nhooyr.io/websocket"
+
+	"github.com/feather-chat/feather/internal/middleware"
+	"github.com/feather-chat/feather/internal/model"
 )
 
 type ChannelLister interface {
 	GetUserChannelIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
 }
 
+// RevocationChecker reports whether an access token has been revoked before it
+// expired.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, userID, sessionID uuid.UUID, issuedAt time.Time) (bool, error)
+}
+
+// APITokenValidator resolves API tokens, which clients can authenticate with
+// instead of an access token.
+type APITokenValidator interface {
+	ValidateAPIToken(ctx context.Context, token string) (*middleware.APITokenIdentity, error)
+}
+
 type WSHandler struct {
-	hub       *Hub
-	jwtSecret string
-	channels  ChannelLister
+	hub         *Hub
+	jwtSecret   string
+	channels    ChannelLister
+	revocations RevocationChecker
+	apiTokens   APITokenValidator
 }
 
 func NewHandler(hub *Hub, jwtSecret string, channels ChannelLister) *WSHandler {
@@ -30,16 +48,33 @@ func NewHandler(hub *Hub, jwtSecret string, channels ChannelLister) *WSHandler {
 	}
 }
 
+// SetRevocationChecker makes the handshake reject revoked access tokens.
+func (h *WSHandler) SetRevocationChecker(rc RevocationChecker) {
+	h.revocations = rc
+}
+
+// SetAPITokenValidator lets API tokens with the events:read scope connect.
+func (h *WSHandler) SetAPITokenValidator(v APITokenValidator) {
+	h.apiTokens = v
+}
+
 // authMessage is the expected first message from the client.
 type authMessage struct {
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
 }
 
+// authPayload carries the token and, on reconnect, the last sequence number the
+// client processed per stream: channel IDs for channel events and "user" for
+// events sent to the user directly.
 type authPayload struct {
-	Token string `json:"token"`
+	Token   string           `json:"token"`
+	LastSeq map[string]int64 `json:"last_seq,omitempty"`
 }
 
+// userStreamKey is the last_seq key for the user's own event stream.
+const userStreamKey = "user"
+
 func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	conn, err := ws.Accept(w, r, &ws.AcceptOptions{
 		InsecureSkipVerify: true,
@@ -71,14 +106,25 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate JWT
-	userID, userName, err := h.validateToken(payload.Token)
+	// Validate JWT, or an API token
+	var (
+		userID, sessionID uuid.UUID
+		userName          string
+		readOnly          bool
+	)
+	if h.apiTokens != nil && strings.HasPrefix(payload.Token, middleware.APITokenPrefix) {
+		userID, userName, sessionID, readOnly, err = h.validateAPIToken(r.Context(), payload.Token)
+	} else {
+		userID, userName, sessionID, err = h.validateToken(r.Context(), payload.Token)
+	}
 	if err != nil {
 		conn.Close(ws.StatusPolicyViolation, "invalid token")
 		return
 	}
 
 	client := NewClient(conn, h.hub, userID, userName)
+	client.SessionID = sessionID
+	client.ReadOnly = readOnly
 
 	// Subscribe to user's channels
 	if h.channels != nil {
@@ -90,13 +136,88 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Replay missed events before the write pump starts; live events are held
+	// meanwhile and sent after them
+	replaying := len(payload.LastSeq) > 0
+	if replaying {
+		client.holdForReplay()
+	}
+
 	h.hub.register <- client
 
+	if replaying {
+		if err := h.replay(r.Context(), conn, client, payload.LastSeq); err != nil {
+			h.hub.unregister <- client
+			conn.Close(ws.StatusInternalError, "replay failed")
+			return
+		}
+	}
+
 	go client.WritePump()
 	go client.ReadPump()
 }
 
-func (h *WSHandler) validateToken(tokenStr string) (uuid.UUID, string, error) {
+// replay writes every event the client missed on the streams it resumes, then
+// the live events held meanwhile that were not part of the replay. Streams
+// whose history is gone get a resync.required event instead.
+func (h *WSHandler) replay(ctx context.Context, conn *ws.Conn, client *Client, lastSeq map[string]int64) error {
+	write := func(frames [][]byte) error {
+		for _, frame := range frames {
+			writeCtx, cancel := context.WithTimeout(ctx, writeWait)
+			err := conn.Write(writeCtx, ws.MessageText, frame)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	replayed := make(map[string]int64)
+	for key, after := range lastSeq {
+		var stream, channelID string
+		if key == userStreamKey {
+			stream = userStream(client.UserID)
+		} else {
+			chID, err := uuid.Parse(key)
+			if err != nil || !client.IsSubscribed(chID) {
+				continue
+			}
+			stream = channelStream(chID)
+			channelID = key
+		}
+
+		frames, last, complete := h.hub.replay(ctx, stream, after)
+		if complete {
+			replayed[stream] = last
+		} else {
+			payload, _ := json.Marshal(map[string]string{"stream": key})
+			frame, _ := json.Marshal(model.WebSocketEvent{
+				Type:      model.EventResyncRequired,
+				ChannelID: channelID,
+				Payload:   payload,
+			})
+			frames = [][]byte{frame}
+		}
+
+		if err := write(frames); err != nil {
+			return err
+		}
+	}
+
+	for {
+		held := client.releaseHeld(replayed)
+		if held == nil {
+			return nil
+		}
+		if err := write(held); err != nil {
+			return err
+		}
+	}
+}
+
+// validateToken returns the user and session of a valid, unrevoked access token.
+func (h *WSHandler) validateToken(ctx context.Context, tokenStr string) (uuid.UUID, string, uuid.UUID, error) {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, jwt.ErrSignatureInvalid
@@ -104,24 +225,69 @@ func (h *WSHandler) validateToken(tokenStr string) (uuid.UUID, string, error) {
 		return []byte(h.jwtSecret), nil
 	})
 	if err != nil || !token.Valid {
-		return uuid.Nil, "", err
+		return uuid.Nil, "", uuid.Nil, err
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return uuid.Nil, "", jwt.ErrTokenInvalidClaims
+		return uuid.Nil, "", uuid.Nil, jwt.ErrTokenInvalidClaims
+	}
+	if typ, ok := claims["typ"]; ok && typ != "access" {
+		return uuid.Nil, "", uuid.Nil, jwt.ErrTokenInvalidClaims
 	}
 
 	sub, ok := claims["sub"].(string)
 	if !ok || sub == "" {
-		return uuid.Nil, "", jwt.ErrTokenInvalidClaims
+		return uuid.Nil, "", uuid.Nil, jwt.ErrTokenInvalidClaims
 	}
 
 	userID, err := uuid.Parse(sub)
 	if err != nil {
-		return uuid.Nil, "", err
+		return uuid.Nil, "", uuid.Nil, err
+	}
+
+	var sessionID uuid.UUID
+	if sid, ok := claims["sid"].(string); ok {
+		sessionID, _ = uuid.Parse(sid)
+	}
+
+	if h.revocations != nil {
+		revoked, err := h.revocations.IsRevoked(ctx, userID, sessionID, middleware.IssuedAt(claims))
+		// Fails open like middleware.Auth, so an unreachable Redis does not
+		// disconnect everyone
+		if err != nil {
+			slog.Warn("token revocation check failed", "error", err, "user_id", userID)
+		}
+		if revoked {
+			return uuid.Nil, "", uuid.Nil, jwt.ErrTokenInvalidClaims
+		}
 	}
 
 	userName, _ := claims["name"].(string)
-	return userID, userName, nil
+	return userID, userName, sessionID, nil
+}
+
+// validateAPIToken returns the user of an API token with the events:read
+// scope. The token ID stands in for the session, so revoking the token closes
+// its connections. Without messages:write the connection is read-only.
+func (h *WSHandler) validateAPIToken(ctx context.Context, token string) (uuid.UUID, string, uuid.UUID, bool, error) {
+	identity, err := h.apiTokens.ValidateAPIToken(ctx, token)
+	if err != nil {
+		slog.Error("api token validation failed", "error", err)
+		return uuid.Nil, "", uuid.Nil, false, err
+	}
+	if identity == nil || !hasScope(identity.Scopes, model.ScopeEventsRead) {
+		return uuid.Nil, "", uuid.Nil, false, jwt.ErrTokenInvalidClaims
+	}
+	readOnly := !hasScope(identity.Scopes, model.ScopeMessagesWrite)
+	return identity.UserID, identity.UserName, identity.TokenID, readOnly, nil
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
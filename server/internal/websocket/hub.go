@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"log/slog"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	ws "nhooyr.io/websocket"
 
 	"github.com/feather-chat/feather/internal/model"
 )
@@ -15,16 +18,27 @@ import (
 // CallHandlerFunc handles call-related WebSocket events from clients.
 type CallHandlerFunc func(userID uuid.UUID, event model.WebSocketEvent)
 
+// PresenceHandlerFunc is called when a user comes online or goes offline cluster-wide.
+type PresenceHandlerFunc func(userID uuid.UUID, online bool)
+
+// ActivityHandlerFunc is called for client activity pings.
+type ActivityHandlerFunc func(userID uuid.UUID)
+
 type Hub struct {
-	instanceID  string
-	clients     map[uuid.UUID]*Client
-	mu          sync.RWMutex
-	register    chan *Client
-	unregister  chan *Client
-	redis       *redis.Client
-	ctx         context.Context
-	cancel      context.CancelFunc
-	callHandler CallHandlerFunc
+	instanceID      string
+	clients         map[uuid.UUID]*Client
+	userConns       map[uuid.UUID]int // local connection count per user
+	mu              sync.RWMutex
+	register        chan *Client
+	unregister      chan *Client
+	presenceUpdates chan presenceUpdate
+	redis           *redis.Client
+	log             eventLog
+	ctx             context.Context
+	cancel          context.CancelFunc
+	callHandler     CallHandlerFunc
+	presenceHandler PresenceHandlerFunc
+	activityHandler ActivityHandlerFunc
 }
 
 // SetCallHandler sets the handler for call signaling events.
@@ -32,49 +46,103 @@ func (h *Hub) SetCallHandler(fn CallHandlerFunc) {
 	h.callHandler = fn
 }
 
+// SetPresenceHandler replaces the default online/offline broadcast.
+func (h *Hub) SetPresenceHandler(fn PresenceHandlerFunc) {
+	h.presenceHandler = fn
+}
+
+// SetActivityHandler sets the handler for client activity pings.
+func (h *Hub) SetActivityHandler(fn ActivityHandlerFunc) {
+	h.activityHandler = fn
+}
+
+// Redis pub/sub topics. Channel topics carry channel broadcasts, user topics carry
+// per-user frames and subscription changes, and the broadcast topic reaches every client.
+const (
+	channelTopicPrefix = "feather:channel:"
+	userTopicPrefix    = "feather:user:"
+	broadcastTopic     = "feather:broadcast"
+)
+
+const eventLogTimeout = 2 * time.Second
+
+// Control operations carried on user topics instead of data.
+const (
+	opSubscribe   = "subscribe"
+	opUnsubscribe = "unsubscribe"
+	opDisconnect  = "disconnect"
+)
+
 type redisEnvelope struct {
 	InstanceID string          `json:"instance_id"`
-	Data       json.RawMessage `json:"data"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Op         string          `json:"op,omitempty"`
+	ChannelID  *uuid.UUID      `json:"channel_id,omitempty"`
+	SessionID  *uuid.UUID      `json:"session_id,omitempty"`
 }
 
 func NewHub(redisClient *redis.Client) *Hub {
 	ctx, cancel := context.WithCancel(context.Background())
+
+	var log eventLog = newMemoryEventLog()
+	if redisClient != nil {
+		log = &redisEventLog{client: redisClient}
+	}
+
 	return &Hub{
 		instanceID: uuid.New().String(),
 		clients:    make(map[uuid.UUID]*Client),
+		userConns:  make(map[uuid.UUID]int),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		redis:      redisClient,
+		log:        log,
 		ctx:        ctx,
 		cancel:     cancel,
+
+		presenceUpdates: make(chan presenceUpdate, presenceQueueSize),
 	}
 }
 
 func (h *Hub) Run() {
-	// Start Redis subscriber
+	// Start Redis subscriber, presence updates and presence heartbeat
 	go h.subscribeRedis()
+	go h.runPresenceUpdates()
+	go h.runPresenceHeartbeat()
 
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client.ID] = client
+			h.userConns[client.UserID]++
+			first := h.userConns[client.UserID] == 1
 			h.mu.Unlock()
 			slog.Info("client connected", "user_id", client.UserID, "client_id", client.ID)
 
-			// Broadcast presence update
-			h.broadcastPresence(client.UserID, true)
+			// Only a user's first local connection can change presence
+			if first {
+				h.queuePresence(client.UserID, true)
+			}
 
 		case client := <-h.unregister:
 			h.mu.Lock()
+			last := false
 			if _, ok := h.clients[client.ID]; ok {
 				close(client.send)
 				delete(h.clients, client.ID)
+				h.userConns[client.UserID]--
+				if h.userConns[client.UserID] <= 0 {
+					delete(h.userConns, client.UserID)
+					last = true
+				}
 			}
 			h.mu.Unlock()
 			slog.Info("client disconnected", "user_id", client.UserID, "client_id", client.ID)
 
-			h.broadcastPresence(client.UserID, false)
+			if last {
+				h.queuePresence(client.UserID, false)
+			}
 
 		case <-h.ctx.Done():
 			return
@@ -91,21 +159,13 @@ func (h *Hub) BroadcastToChannel(channelID uuid.UUID, data []byte, excludeClient
 	h.deliverToChannel(channelID, data, excludeClientID)
 
 	// Also publish to Redis for cross-instance delivery
-	if h.redis != nil {
-		envelope, err := json.Marshal(redisEnvelope{
-			InstanceID: h.instanceID,
-			Data:       data,
-		})
-		if err != nil {
-			slog.Error("failed to marshal redis envelope", "error", err)
-			return
-		}
-		h.redis.Publish(h.ctx, "feather:channel:"+channelID.String(), envelope)
-	}
+	h.publish(channelTopicPrefix+channelID.String(), redisEnvelope{Data: data})
 }
 
+// BroadcastEvent sequences and logs the event for replay, then delivers it to
+// every client subscribed to the channel.
 func (h *Hub) BroadcastEvent(channelID uuid.UUID, event model.WebSocketEvent) {
-	data, err := json.Marshal(event)
+	data, err := h.sequence(channelStream(channelID), event)
 	if err != nil {
 		slog.Error("failed to marshal event", "error", err)
 		return
@@ -113,7 +173,66 @@ func (h *Hub) BroadcastEvent(channelID uuid.UUID, event model.WebSocketEvent) {
 	h.BroadcastToChannel(channelID, data, uuid.Nil)
 }
 
+// sequence appends the event to the stream's replay log and returns the frame
+// stamped with its sequence number. If the log is unavailable the event is
+// still delivered, unsequenced.
+func (h *Hub) sequence(stream string, event model.WebSocketEvent) ([]byte, error) {
+	event.Seq = 0
+	frame, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, eventLogTimeout)
+	defer cancel()
+
+	seq, err := h.log.Append(ctx, stream, frame)
+	if err != nil {
+		slog.Warn("failed to log event for replay", "error", err, "stream", stream)
+		return frame, nil
+	}
+	return stampSeq(frame, seq), nil
+}
+
+// replay returns the frames logged on the stream after the given sequence
+// number, and the sequence number of the last one. complete is false if the
+// client must resync instead.
+func (h *Hub) replay(ctx context.Context, stream string, after int64) ([][]byte, int64, bool) {
+	entries, complete, err := h.log.Since(ctx, stream, after)
+	if err != nil {
+		slog.Error("failed to read replay log", "error", err, "stream", stream)
+		return nil, 0, false
+	}
+	if !complete {
+		return nil, 0, false
+	}
+
+	last := after
+	frames := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		frames = append(frames, stampSeq(e.Frame, e.Seq))
+		last = e.Seq
+	}
+	return frames, last, true
+}
+
+// stampSeq sets the seq field on a marshaled event.
+func stampSeq(frame []byte, seq int64) []byte {
+	var event model.WebSocketEvent
+	if err := json.Unmarshal(frame, &event); err != nil {
+		return frame
+	}
+	event.Seq = seq
+	data, err := json.Marshal(event)
+	if err != nil {
+		return frame
+	}
+	return data
+}
+
 func (h *Hub) deliverToChannel(channelID uuid.UUID, data []byte, excludeClientID uuid.UUID) {
+	stream := channelStream(channelID)
+
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
@@ -121,22 +240,33 @@ func (h *Hub) deliverToChannel(channelID uuid.UUID, data []byte, excludeClientID
 		if client.ID == excludeClientID {
 			continue
 		}
-		if client.IsSubscribed(channelID) {
-			select {
-			case client.send <- data:
-			default:
-				// Client buffer full, skip
-			}
+		if client.IsSubscribed(channelID) && !client.queue(stream, data) {
+			// Client buffer full; drop it so it reconnects and replays
+			client.closeSlow()
 		}
 	}
 }
 
+// publish sends an envelope to the other instances. It is a no-op without Redis.
+func (h *Hub) publish(topic string, env redisEnvelope) {
+	if h.redis == nil {
+		return
+	}
+	env.InstanceID = h.instanceID
+	envelope, err := json.Marshal(env)
+	if err != nil {
+		slog.Error("failed to marshal redis envelope", "error", err)
+		return
+	}
+	h.redis.Publish(h.ctx, topic, envelope)
+}
+
 func (h *Hub) subscribeRedis() {
 	if h.redis == nil {
 		return
 	}
 
-	pubsub := h.redis.PSubscribe(h.ctx, "feather:channel:*")
+	pubsub := h.redis.PSubscribe(h.ctx, channelTopicPrefix+"*", userTopicPrefix+"*", broadcastTopic)
 	defer pubsub.Close()
 
 	ch := pubsub.Channel()
@@ -155,13 +285,23 @@ func (h *Hub) subscribeRedis() {
 				continue // Already delivered locally
 			}
 
-			// Extract channel ID from Redis channel name
-			channelIDStr := msg.Channel[len("feather:channel:"):]
-			channelID, err := uuid.Parse(channelIDStr)
-			if err != nil {
-				continue
+			// Extract the channel or user ID from the Redis topic name
+			switch {
+			case msg.Channel == broadcastTopic:
+				h.deliverToAll(env.Data)
+			case strings.HasPrefix(msg.Channel, channelTopicPrefix):
+				channelID, err := uuid.Parse(strings.TrimPrefix(msg.Channel, channelTopicPrefix))
+				if err != nil {
+					continue
+				}
+				h.deliverToChannel(channelID, env.Data, uuid.Nil)
+			case strings.HasPrefix(msg.Channel, userTopicPrefix):
+				userID, err := uuid.Parse(strings.TrimPrefix(msg.Channel, userTopicPrefix))
+				if err != nil {
+					continue
+				}
+				h.handleUserEnvelope(userID, env)
 			}
-			h.deliverToChannel(channelID, env.Data, uuid.Nil)
 
 		case <-h.ctx.Done():
 			return
@@ -169,75 +309,132 @@ func (h *Hub) subscribeRedis() {
 	}
 }
 
-func (h *Hub) broadcastPresence(userID uuid.UUID, online bool) {
-	payload := map[string]interface{}{
-		"user_id": userID,
-		"online":  online,
-	}
-	data, err := json.Marshal(payload)
-	if err != nil {
-		slog.Error("failed to marshal presence payload", "error", err)
-		return
+// handleUserEnvelope applies a user-topic message published by another instance.
+func (h *Hub) handleUserEnvelope(userID uuid.UUID, env redisEnvelope) {
+	switch env.Op {
+	case opSubscribe:
+		if env.ChannelID != nil {
+			h.subscribeLocal(userID, *env.ChannelID)
+		}
+	case opUnsubscribe:
+		if env.ChannelID != nil {
+			h.unsubscribeLocal(userID, *env.ChannelID)
+		}
+	case opDisconnect:
+		sessionID := uuid.Nil
+		if env.SessionID != nil {
+			sessionID = *env.SessionID
+		}
+		h.disconnectLocal(userID, sessionID)
+	default:
+		h.deliverToUser(userID, env.Data)
 	}
-	event := model.WebSocketEvent{
-		Type:    model.EventPresenceUpdate,
-		Payload: data,
+}
+
+// BroadcastToAll sends data to every connected client on every instance.
+func (h *Hub) BroadcastToAll(data []byte) {
+	h.deliverToAll(data)
+	h.publish(broadcastTopic, redisEnvelope{Data: data})
+}
+
+func (h *Hub) deliverToAll(data []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.clients {
+		if !client.queue("", data) {
+			client.closeSlow()
+		}
 	}
-	eventData, err := json.Marshal(event)
-	if err != nil {
-		slog.Error("failed to marshal presence event", "error", err)
-		return
+}
+
+// SendToUser sends data to all connected clients of a specific user, on this
+// instance and (via Redis) on every other instance.
+func (h *Hub) SendToUser(userID uuid.UUID, data []byte) {
+	// Events are sequenced on the user's stream so they can be replayed
+	var event model.WebSocketEvent
+	if err := json.Unmarshal(data, &event); err == nil && event.Type != "" {
+		if sequenced, err := h.sequence(userStream(userID), event); err == nil {
+			data = sequenced
+		}
 	}
 
+	h.deliverToUser(userID, data)
+	h.publish(userTopicPrefix+userID.String(), redisEnvelope{Data: data})
+}
+
+func (h *Hub) deliverToUser(userID uuid.UUID, data []byte) {
+	stream := userStream(userID)
+
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	for _, client := range h.clients {
-		select {
-		case client.send <- eventData:
-		default:
+		if client.UserID == userID && !client.queue(stream, data) {
+			client.closeSlow()
 		}
 	}
 }
 
-func (h *Hub) GetOnlineUsers() []uuid.UUID {
+// SubscribeUserToChannel subscribes all connected clients of a user, on every
+// instance, to a channel.
+func (h *Hub) SubscribeUserToChannel(userID uuid.UUID, channelID uuid.UUID) {
+	h.subscribeLocal(userID, channelID)
+	h.publish(userTopicPrefix+userID.String(), redisEnvelope{Op: opSubscribe, ChannelID: &channelID})
+}
+
+// UnsubscribeUserFromChannel stops channel delivery to all connected clients of a
+// user on every instance.
+func (h *Hub) UnsubscribeUserFromChannel(userID uuid.UUID, channelID uuid.UUID) {
+	h.unsubscribeLocal(userID, channelID)
+	h.publish(userTopicPrefix+userID.String(), redisEnvelope{Op: opUnsubscribe, ChannelID: &channelID})
+}
+
+func (h *Hub) subscribeLocal(userID uuid.UUID, channelID uuid.UUID) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	seen := make(map[uuid.UUID]bool)
-	var users []uuid.UUID
 	for _, client := range h.clients {
-		if !seen[client.UserID] {
-			seen[client.UserID] = true
-			users = append(users, client.UserID)
+		if client.UserID == userID {
+			client.SubscribeChannel(channelID)
 		}
 	}
-	return users
 }
 
-// SendToUser sends data to all connected clients of a specific user.
-func (h *Hub) SendToUser(userID uuid.UUID, data []byte) {
+func (h *Hub) unsubscribeLocal(userID uuid.UUID, channelID uuid.UUID) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	for _, client := range h.clients {
 		if client.UserID == userID {
-			select {
-			case client.send <- data:
-			default:
-			}
+			client.UnsubscribeChannel(channelID)
 		}
 	}
 }
 
-// SubscribeUserToChannel subscribes all connected clients of a user to a channel.
-func (h *Hub) SubscribeUserToChannel(userID uuid.UUID, channelID uuid.UUID) {
+// DisconnectUser closes every connection of a user on every instance, e.g. when
+// their account is deactivated. Clients must authenticate again to reconnect.
+func (h *Hub) DisconnectUser(userID uuid.UUID) {
+	h.disconnectLocal(userID, uuid.Nil)
+	h.publish(userTopicPrefix+userID.String(), redisEnvelope{Op: opDisconnect})
+}
+
+// DisconnectSession closes the connections opened with one session's tokens,
+// on every instance.
+func (h *Hub) DisconnectSession(userID, sessionID uuid.UUID) {
+	h.disconnectLocal(userID, sessionID)
+	h.publish(userTopicPrefix+userID.String(), redisEnvelope{Op: opDisconnect, SessionID: &sessionID})
+}
+
+// disconnectLocal closes the user's local connections, only those of the
+// session unless sessionID is uuid.Nil.
+func (h *Hub) disconnectLocal(userID, sessionID uuid.UUID) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	for _, client := range h.clients {
-		if client.UserID == userID {
-			client.SubscribeChannel(channelID)
+		if client.UserID == userID && (sessionID == uuid.Nil || client.SessionID == sessionID) {
+			client.disconnect(ws.StatusPolicyViolation, "session revoked")
 		}
 	}
 }
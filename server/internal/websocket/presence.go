@@ -0,0 +1,264 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/feather-chat/feather/internal/model"
+)
+
+// Cluster-wide presence registry. Each user has a sorted set of the instances
+// holding a connection for them, scored by the instance's last heartbeat, and
+// the online set holds every user scored by their latest heartbeat from any
+// instance. Entries older than presenceTTL belong to instances that died
+// without cleaning up and are reaped by whichever instance sees them first.
+const (
+	presenceHeartbeat   = 15 * time.Second
+	presenceTTL         = 45 * time.Second
+	presenceOpTimeout   = 2 * time.Second
+	presenceOnlineKey   = "feather:presence:online"
+	presenceUserKeyBase = "feather:presence:user:"
+
+	// presenceQueueSize bounds the connection changes waiting to be applied.
+	// The hub loop only waits on a slow Redis once this many are queued.
+	presenceQueueSize = 1024
+)
+
+// presenceUpdate is a user's first connection or last disconnection on this
+// instance.
+type presenceUpdate struct {
+	userID uuid.UUID
+	online bool
+}
+
+func presenceUserKey(userID uuid.UUID) string {
+	return presenceUserKeyBase + userID.String()
+}
+
+// queuePresence hands a local presence change to runPresenceUpdates, so Redis
+// round-trips never hold up connects, disconnects and broadcasts.
+func (h *Hub) queuePresence(userID uuid.UUID, online bool) {
+	select {
+	case h.presenceUpdates <- presenceUpdate{userID: userID, online: online}:
+	case <-h.ctx.Done():
+	}
+}
+
+// runPresenceUpdates applies queued presence changes one at a time, in the
+// order they happened.
+func (h *Hub) runPresenceUpdates() {
+	for {
+		select {
+		case u := <-h.presenceUpdates:
+			if u.online {
+				h.markOnline(u.userID)
+			} else {
+				h.markOffline(u.userID)
+			}
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// markOnline records the user's first connection on this instance and announces
+// them if no other instance already had them online.
+func (h *Hub) markOnline(userID uuid.UUID) {
+	if h.redis == nil {
+		h.announcePresence(userID, true)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, presenceOpTimeout)
+	defer cancel()
+
+	now := time.Now()
+	score, err := h.redis.ZScore(ctx, presenceOnlineKey, userID.String()).Result()
+	wasOnline := err == nil && score >= float64(now.Add(-presenceTTL).Unix())
+	if err != nil && err != redis.Nil {
+		slog.Error("presence: failed to read online set", "error", err)
+	}
+
+	if err := h.heartbeat(ctx, []uuid.UUID{userID}, now); err != nil {
+		slog.Error("presence: failed to register connection", "error", err, "user_id", userID)
+	}
+
+	if !wasOnline {
+		h.announcePresence(userID, true)
+	}
+}
+
+// markOffline removes this instance from the user's registry and announces them
+// offline once no live instance holds a connection.
+func (h *Hub) markOffline(userID uuid.UUID) {
+	if h.redis == nil {
+		h.announcePresence(userID, false)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, presenceOpTimeout)
+	defer cancel()
+
+	key := presenceUserKey(userID)
+	if err := h.redis.ZRem(ctx, key, h.instanceID).Err(); err != nil {
+		slog.Error("presence: failed to unregister connection", "error", err, "user_id", userID)
+		return
+	}
+
+	cutoff := strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10)
+	remaining, err := h.redis.ZCount(ctx, key, cutoff, "+inf").Result()
+	if err != nil {
+		slog.Error("presence: failed to count connections", "error", err, "user_id", userID)
+		return
+	}
+	if remaining > 0 {
+		return
+	}
+
+	// Only the instance that actually removes the user announces it
+	removed, err := h.redis.ZRem(ctx, presenceOnlineKey, userID.String()).Result()
+	if err == nil && removed > 0 {
+		h.announcePresence(userID, false)
+	}
+}
+
+// heartbeat refreshes this instance's registry entries for the given users.
+func (h *Hub) heartbeat(ctx context.Context, userIDs []uuid.UUID, now time.Time) error {
+	score := float64(now.Unix())
+	pipe := h.redis.Pipeline()
+	for _, userID := range userIDs {
+		key := presenceUserKey(userID)
+		pipe.ZAdd(ctx, key, redis.Z{Score: score, Member: h.instanceID})
+		pipe.Expire(ctx, key, 2*presenceTTL)
+		pipe.ZAdd(ctx, presenceOnlineKey, redis.Z{Score: score, Member: userID.String()})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (h *Hub) runPresenceHeartbeat() {
+	if h.redis == nil {
+		return
+	}
+
+	ticker := time.NewTicker(presenceHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.refreshPresence()
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshPresence heartbeats every locally connected user and reaps users whose
+// instances stopped heartbeating.
+func (h *Hub) refreshPresence() {
+	ctx, cancel := context.WithTimeout(h.ctx, presenceHeartbeat)
+	defer cancel()
+
+	h.mu.RLock()
+	local := make([]uuid.UUID, 0, len(h.userConns))
+	for userID := range h.userConns {
+		local = append(local, userID)
+	}
+	h.mu.RUnlock()
+
+	now := time.Now()
+	if len(local) > 0 {
+		if err := h.heartbeat(ctx, local, now); err != nil {
+			slog.Error("presence: heartbeat failed", "error", err)
+			return
+		}
+	}
+
+	cutoff := strconv.FormatInt(now.Add(-presenceTTL).Unix(), 10)
+	stale, err := h.redis.ZRangeByScore(ctx, presenceOnlineKey, &redis.ZRangeBy{Min: "-inf", Max: "(" + cutoff}).Result()
+	if err != nil {
+		slog.Error("presence: failed to list stale users", "error", err)
+		return
+	}
+	for _, member := range stale {
+		userID, err := uuid.Parse(member)
+		if err != nil {
+			continue
+		}
+		removed, err := h.redis.ZRem(ctx, presenceOnlineKey, member).Result()
+		if err == nil && removed > 0 {
+			h.announcePresence(userID, false)
+		}
+	}
+}
+
+// announcePresence hands a cluster-wide presence change to the presence handler,
+// falling back to a bare online/offline broadcast.
+func (h *Hub) announcePresence(userID uuid.UUID, online bool) {
+	if h.presenceHandler != nil {
+		go h.presenceHandler(userID, online)
+		return
+	}
+	h.broadcastPresence(userID, online)
+}
+
+func (h *Hub) broadcastPresence(userID uuid.UUID, online bool) {
+	payload := map[string]interface{}{
+		"user_id": userID,
+		"online":  online,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("failed to marshal presence payload", "error", err)
+		return
+	}
+	event := model.WebSocketEvent{
+		Type:    model.EventPresenceUpdate,
+		Payload: data,
+	}
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to marshal presence event", "error", err)
+		return
+	}
+
+	h.BroadcastToAll(eventData)
+}
+
+// GetOnlineUsers returns users with at least one connection on any instance.
+// Without Redis only local connections are known.
+func (h *Hub) GetOnlineUsers() []uuid.UUID {
+	if h.redis != nil {
+		ctx, cancel := context.WithTimeout(h.ctx, presenceOpTimeout)
+		defer cancel()
+
+		cutoff := strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10)
+		members, err := h.redis.ZRangeByScore(ctx, presenceOnlineKey, &redis.ZRangeBy{Min: cutoff, Max: "+inf"}).Result()
+		if err == nil {
+			users := make([]uuid.UUID, 0, len(members))
+			for _, member := range members {
+				if userID, err := uuid.Parse(member); err == nil {
+					users = append(users, userID)
+				}
+			}
+			return users
+		}
+		slog.Error("presence: failed to read online set", "error", err)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	users := make([]uuid.UUID, 0, len(h.userConns))
+	for userID := range h.userConns {
+		users = append(users, userID)
+	}
+	return users
+}
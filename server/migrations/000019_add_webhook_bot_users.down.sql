@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_webhooks_bot_user;
+
+ALTER TABLE webhooks DROP COLUMN IF EXISTS bot_user_id;
@@ -0,0 +1,3 @@
+ALTER TABLE webhooks ADD COLUMN bot_user_id UUID REFERENCES users(id);
+
+CREATE INDEX idx_webhooks_bot_user ON webhooks(bot_user_id) WHERE bot_user_id IS NOT NULL;
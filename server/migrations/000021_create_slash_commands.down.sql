@@ -0,0 +1,3 @@
+ALTER TABLE channel_members DROP COLUMN IF EXISTS is_muted;
+DROP TABLE IF EXISTS reminders;
+DROP TABLE IF EXISTS slash_commands;
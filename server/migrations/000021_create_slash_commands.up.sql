@@ -0,0 +1,26 @@
+CREATE TABLE slash_commands (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(32) NOT NULL,
+    description VARCHAR(200) NOT NULL DEFAULT '',
+    usage_hint VARCHAR(200) NOT NULL DEFAULT '',
+    url VARCHAR(2000) NOT NULL,
+    token VARCHAR(64) NOT NULL,
+    creator_id UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_slash_commands_name ON slash_commands(name);
+
+CREATE TABLE reminders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    text TEXT NOT NULL,
+    remind_at TIMESTAMPTZ NOT NULL,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_reminders_due ON reminders(remind_at) WHERE delivered_at IS NULL;
+
+ALTER TABLE channel_members ADD COLUMN is_muted BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,12 @@
+CREATE TABLE user_presence (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'away', 'dnd')),
+    dnd_until TIMESTAMPTZ,
+    status_text VARCHAR(100) NOT NULL DEFAULT '',
+    status_emoji VARCHAR(64) NOT NULL DEFAULT '',
+    status_expires_at TIMESTAMPTZ,
+    last_active_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_presence_last_active ON user_presence(last_active_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_messages_pinned;
+ALTER TABLE messages DROP COLUMN IF EXISTS pinned_by;
+ALTER TABLE messages DROP COLUMN IF EXISTS pinned_at;
+
+ALTER TABLE channel_members DROP CONSTRAINT IF EXISTS channel_members_role_check;
+
+UPDATE channel_members SET role = 'admin' WHERE role = 'owner';
@@ -0,0 +1,13 @@
+-- Channel creators become owners; existing channel admins keep the admin role
+UPDATE channel_members cm SET role = 'owner'
+FROM channels c
+WHERE cm.channel_id = c.id AND c.creator_id = cm.user_id AND c.type NOT IN ('dm', 'group_dm');
+
+UPDATE channel_members SET role = 'member' WHERE role NOT IN ('owner', 'admin', 'member');
+
+ALTER TABLE channel_members ADD CONSTRAINT channel_members_role_check CHECK (role IN ('owner', 'admin', 'member'));
+
+ALTER TABLE messages ADD COLUMN pinned_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN pinned_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_messages_pinned ON messages (channel_id, pinned_at DESC) WHERE pinned_at IS NOT NULL;
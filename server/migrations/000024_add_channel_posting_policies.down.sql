@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_messages_channel_user_created;
+
+ALTER TABLE channels DROP COLUMN IF EXISTS max_attachments;
+ALTER TABLE channels DROP COLUMN IF EXISTS slow_mode_seconds;
+ALTER TABLE channels DROP COLUMN IF EXISTS threads_only;
+ALTER TABLE channels DROP COLUMN IF EXISTS admins_only;
@@ -0,0 +1,7 @@
+ALTER TABLE channels ADD COLUMN admins_only BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE channels ADD COLUMN threads_only BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE channels ADD COLUMN slow_mode_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE channels ADD COLUMN max_attachments INTEGER NOT NULL DEFAULT 0;
+
+-- Slow mode looks up each user's latest message in the channel
+CREATE INDEX idx_messages_channel_user_created ON messages(channel_id, user_id, created_at DESC);
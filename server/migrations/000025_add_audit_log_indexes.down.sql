@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_logs_entity;
+DROP INDEX IF EXISTS idx_audit_logs_created_id;
+CREATE INDEX idx_audit_logs_created ON audit_logs(created_at DESC);
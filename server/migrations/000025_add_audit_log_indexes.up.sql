@@ -0,0 +1,4 @@
+-- Audit queries page newest first by (created_at, id)
+DROP INDEX IF EXISTS idx_audit_logs_created;
+CREATE INDEX idx_audit_logs_created_id ON audit_logs(created_at DESC, id DESC);
+CREATE INDEX idx_audit_logs_entity ON audit_logs(entity_type, entity_id);
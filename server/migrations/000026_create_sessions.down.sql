@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_session;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS session_id;
+
+DROP TABLE IF EXISTS sessions;
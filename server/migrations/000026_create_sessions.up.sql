@@ -0,0 +1,18 @@
+-- A session is one sign-in on one device. Its refresh tokens rotate, and its
+-- access tokens carry the session ID so revoking it takes effect immediately.
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(45),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+
+-- Tokens issued before sessions existed have no session and get one on their next refresh
+ALTER TABLE refresh_tokens ADD COLUMN session_id UUID REFERENCES sessions(id) ON DELETE CASCADE;
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens(session_id);
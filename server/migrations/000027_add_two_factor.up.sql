@@ -0,0 +1,28 @@
+-- TOTP secret per user. enabled_at is NULL while enrollment is pending.
+-- last_step is the last accepted time step, so a code cannot be used twice.
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    enabled_at TIMESTAMPTZ,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_recovery_codes_user ON recovery_codes(user_id);
+
+-- Workspace-wide settings, a single row
+CREATE TABLE workspace_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    require_two_factor BOOLEAN NOT NULL DEFAULT false,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO workspace_settings DEFAULT VALUES;
@@ -0,0 +1,6 @@
+-- Keep Google sign-in working for accounts linked after the upgrade
+UPDATE users u SET google_id = i.subject
+FROM user_identities i
+WHERE i.user_id = u.id AND i.provider = 'google' AND u.google_id IS NULL;
+
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,19 @@
+-- External identities (OIDC providers, Google) linked to a user. A user can
+-- have several; each provider subject belongs to one user.
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities(user_id);
+
+-- Google accounts linked before identities existed
+INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+SELECT id, 'google', google_id, email, updated_at, updated_at
+FROM users WHERE google_id IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_user_groups_external_id;
+ALTER TABLE user_groups DROP COLUMN IF EXISTS external_id;
+DELETE FROM user_identities WHERE provider = 'scim';
+DROP TABLE IF EXISTS scim_tokens;
@@ -0,0 +1,15 @@
+-- Bearer tokens identity providers use to provision users and groups over
+-- SCIM, stored hashed
+CREATE TABLE scim_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    creator_id UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ
+);
+
+-- The directory's ID for groups it provisions. Users keep theirs in
+-- user_identities under the 'scim' provider.
+ALTER TABLE user_groups ADD COLUMN external_id VARCHAR(255);
+CREATE UNIQUE INDEX idx_user_groups_external_id ON user_groups(external_id) WHERE external_id IS NOT NULL;
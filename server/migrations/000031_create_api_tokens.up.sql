@@ -0,0 +1,16 @@
+-- Long-lived, scoped tokens for scripts and bots, stored hashed. Bot accounts
+-- (role 'bot') get theirs from an admin.
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    prefix VARCHAR(16) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    creator_id UUID NOT NULL REFERENCES users(id),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_tokens_user ON api_tokens(user_id);
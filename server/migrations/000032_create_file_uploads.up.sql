@@ -0,0 +1,18 @@
+-- Direct-to-storage uploads in progress. Small files are a single presigned
+-- PUT; larger ones an S3 multipart upload (multipart_id) that can be resumed.
+-- Finishing one creates the file_attachments row.
+CREATE TABLE file_uploads (
+    id UUID PRIMARY KEY,
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    storage_key VARCHAR(500) NOT NULL,
+    multipart_id VARCHAR(255),
+    part_size BIGINT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_file_uploads_expires ON file_uploads(expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE file_attachments
+    DROP COLUMN IF EXISTS thumbnail_sizes,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width;
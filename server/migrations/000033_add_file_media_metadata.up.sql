@@ -0,0 +1,6 @@
+-- Dimensions of image attachments, and the sizes of the thumbnails stored
+-- next to the original.
+ALTER TABLE file_attachments
+    ADD COLUMN width INT,
+    ADD COLUMN height INT,
+    ADD COLUMN thumbnail_sizes INT[] NOT NULL DEFAULT '{}';
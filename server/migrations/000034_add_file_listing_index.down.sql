@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_file_attachments_listing;
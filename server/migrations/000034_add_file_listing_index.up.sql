@@ -0,0 +1,3 @@
+-- Newest-first file listings per channel, over files attached to messages
+CREATE INDEX IF NOT EXISTS idx_file_attachments_listing
+    ON file_attachments(channel_id, created_at DESC, id DESC) WHERE message_id IS NOT NULL;